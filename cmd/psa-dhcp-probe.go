@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/client/msgtmpl"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/dhcpmsg"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/layer"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/oui"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/rsocks"
+)
+
+var (
+	ifname  = flag.String("ifname", "", "Interface to probe")
+	timeout = flag.Duration("timeout", 5*time.Second, "For how long to wait for offers")
+	expect  = flag.String("expect", "", "Comma separated server identifiers of expected servers, exit with status 1 if any other server answers")
+)
+
+// offer is the first reply of a server.
+type offer struct {
+	server net.IP
+	src    net.IP
+	hwaddr net.HardwareAddr
+	ip     net.IP
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage: %s -ifname <interface> [flags]
+
+Broadcasts DHCPDISCOVER messages with the hwaddr of the interface and lists all DHCP servers
+which answered with an offer. The offers are never accepted.
+
+Flags:
+`, os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	l := log.New(os.Stderr, "psa-dhcp-probe: ", 0)
+	if *ifname == "" {
+		usage()
+		os.Exit(2)
+	}
+	iface, err := net.InterfaceByName(*ifname)
+	if err != nil {
+		l.Fatalf("failed to discover interface %s: %v\n", *ifname, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	offers, err := probe(ctx, iface)
+	if err != nil {
+		l.Fatalf("probe failed: %v\n", err)
+	}
+
+	expected := make(map[string]bool)
+	for _, s := range strings.Split(*expect, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			expected[s] = true
+		}
+	}
+
+	unexpected := false
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "SERVER\tSOURCE\tHWADDR\tVENDOR\tOFFER\tEXPECTED\n")
+	for _, o := range offers {
+		vendor, _ := oui.Lookup(o.hwaddr)
+		ok := len(expected) == 0 || expected[o.server.String()]
+		unexpected = unexpected || !ok
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%v\n", o.server, o.src, o.hwaddr, vendor, o.ip, ok)
+	}
+	tw.Flush()
+
+	if len(offers) == 0 {
+		l.Printf("no DHCP server answered within %s\n", *timeout)
+	}
+	if unexpected {
+		os.Exit(1)
+	}
+}
+
+// probe broadcasts discover messages until the context is done and returns the offers of all servers.
+func probe(ctx context.Context, iface *net.Interface) ([]offer, error) {
+	rsock, err := rsocks.GetIPRecvSock(iface)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		<-ctx.Done()
+		rsock.Close()
+	}()
+
+	ssock, err := rsocks.GetIPSendSock(iface)
+	if err != nil {
+		return nil, err
+	}
+	defer ssock.Close()
+
+	discover, xid := msgtmpl.Discover(iface)
+	go func() {
+		// Messages might get lost: repeat until done.
+		for ctx.Err() == nil {
+			b, _, _ := discover()
+			ssock.Write(b)
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	var offers []offer
+	seen := make(map[string]bool)
+	buf := make([]byte, 4096)
+	for {
+		nr, hwaddr, err := rsocks.ReadFrom(rsock, buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return offers, nil
+			}
+			return nil, err
+		}
+		v4, err := layer.DecodeIPv4(buf[0:nr])
+		if err != nil {
+			continue
+		}
+		udp, err := layer.DecodeUDP(v4.Data)
+		if err != nil || udp.DstPort != 68 {
+			continue
+		}
+		msg, err := dhcpmsg.Decode(udp.Data)
+		if err != nil || msg.Op != dhcpmsg.OpReply || msg.Xid != xid {
+			continue
+		}
+		opts := dhcpmsg.DecodeOptions(msg.Options)
+		if opts.MessageType != dhcpmsg.MsgTypeOffer {
+			continue
+		}
+		server := opts.ServerIdentifier
+		if server == nil {
+			server = v4.Source
+		}
+		if seen[server.String()] {
+			continue
+		}
+		seen[server.String()] = true
+		offers = append(offers, offer{server: server, src: v4.Source, hwaddr: hwaddr, ip: msg.YourIP})
+	}
+}
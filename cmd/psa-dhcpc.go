@@ -6,23 +6,30 @@ import (
 	"encoding/binary"
 	"flag"
 	"fmt"
-	"log"
 	"math/rand"
 	"net"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"git.sr.ht/~adrian-blx/psa-dhcp/lib/client"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/logger"
 	"git.sr.ht/~adrian-blx/psa-dhcp/lib/resolvconf"
 )
 
 var (
 	ifname    = flag.String("ifname", "", "Interface to use")
 	logTime   = flag.Bool("log_time", true, "Prefix log messages with timestamp")
+	logLevel  = flag.String("log_level", "info", "Minimum level of logged messages: debug, info, warn or error")
+	logJSON   = flag.Bool("log_json", false, "Log one JSON object per message, with fields such as interface, xid and hwaddr")
 	script    = flag.String("script", "", "Script to execute on significant changes")
 	route     = flag.Bool("default_route", true, "Configure (default) route")
 	syshook   = flag.Bool("syshook", false, "For use in -script: update /etc/resolv.conf")
 	resolvcfg = flag.Bool("resolvconf", false, "Maintain /etc/resolv.conf, can not be used in combination with -script")
+	dhcp6     = flag.Bool("dhcp6", false, "Also configure an IPv6 address via DHCPv6")
+	pd        = flag.Bool("prefix_delegation", false, "DHCPv6: ask for a delegated prefix, which is passed to -script")
+	duidFile  = flag.String("duid_file", "/var/lib/psa-dhcpc/duid", "DHCPv6: file to keep the client duid in, created if missing")
 )
 
 func init() {
@@ -40,11 +47,12 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	var lflags int
-	if *logTime {
-		lflags |= log.LstdFlags
+	level, err := logger.ParseLevel(*logLevel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
 	}
-	l := log.New(os.Stdout, "psa-dhcpc: ", lflags)
+	l := logger.New(os.Stdout, "psa-dhcpc: ", level, *logJSON, *logTime)
 
 	if *resolvcfg {
 		if *script != "" {
@@ -69,11 +77,23 @@ func main() {
 		l.Fatalf("failed to discover interface %s: %v\n", *ifname, err)
 	}
 
-	l.SetPrefix(fmt.Sprintf("psa-dhcpc[%s] ", iface.Name))
+	l = l.WithPrefix(fmt.Sprintf("psa-dhcpc[%s] ", iface.Name), "interface", iface.Name, "mac", iface.HardwareAddr)
+
+	// Shut down on SIGINT and SIGTERM, giving the DHCPv6 client a chance to release its lease.
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigc
+		l.Printf("received signal %s, shutting down.", sig)
+		cancel()
+	}()
 
 	c := client.New(l, iface, *script, *route)
+	if *dhcp6 {
+		c.EnableDHCPv6(*duidFile, *pd)
+	}
 	err = c.Run(ctx)
-	if err != nil {
+	if err != nil && err != context.Canceled {
 		l.Fatalf("error: %v\n", err)
 	}
 }
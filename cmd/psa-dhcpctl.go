@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ctl"
+)
+
+var (
+	socket = flag.String("socket", "/run/psa-dhcpd.sock", "Control socket of psa-dhcpd (see its -ctl_socket flag)")
+	ifname = flag.String("ifname", "", "Only talk to the server of this interface")
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage: %s [flags] <command> [args]
+
+Commands:
+  leases [ip|mac|duid]  List all leases, or only those matching the argument.
+  pools                 Show the utilisation of all networks.
+  revoke <ip>           Terminate the lease of an IP.
+  reserve <mac> <ip>    Permanently assign an IP to a MAC, kept across restarts by the journal.
+  unreserve <mac>       Remove the permanent assignment of a MAC.
+
+Flags:
+`, os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	l := log.New(os.Stderr, "psa-dhcpctl: ", 0)
+
+	req, err := parseRequest(flag.Args())
+	if err != nil {
+		l.Printf("%v\n", err)
+		usage()
+		os.Exit(2)
+	}
+	req.Interface = *ifname
+
+	res, err := ctl.Call(*socket, req)
+	if err != nil {
+		l.Fatalf("%s failed: %v\n", req.Method, err)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	defer tw.Flush()
+	switch req.Method {
+	case ctl.MethodLeases:
+		fmt.Fprintf(tw, "INTERFACE\tNETWORK\tIP\tDUID\tHOSTNAME\tUNTIL\n")
+		for _, le := range res.Leases {
+			until := le.Until.Local().Format(time.RFC3339)
+			if le.Permanent {
+				until = "permanent"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", le.Interface, le.Network, le.IP, le.Duid, le.Hostname, until)
+		}
+	case ctl.MethodPools:
+		fmt.Fprintf(tw, "INTERFACE\tNETWORK\tRELAYED\tSIZE\tDYNAMIC\tFREE\tLEASED\tPERMANENT\tQUARANTINED\n")
+		for _, p := range res.Pools {
+			fmt.Fprintf(tw, "%s\t%s\t%v\t%d\t%d\t%d\t%d\t%d\t%d\n", p.Interface, p.Network, p.Relayed, p.Size, p.Dynamic, p.Free, p.Leased, p.Permanent, p.Quarantined)
+		}
+	default:
+		fmt.Fprintf(tw, "ok\n")
+	}
+}
+
+// parseRequest builds a request from the command line arguments.
+func parseRequest(args []string) (*ctl.Request, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("no command given")
+	}
+	req := &ctl.Request{Method: args[0]}
+	args = args[1:]
+
+	want := map[string]int{
+		ctl.MethodLeases:    -1,
+		ctl.MethodPools:     0,
+		ctl.MethodRevoke:    1,
+		ctl.MethodReserve:   2,
+		ctl.MethodUnreserve: 1,
+	}
+	n, ok := want[req.Method]
+	if !ok {
+		return nil, fmt.Errorf("unknown command '%s'", req.Method)
+	}
+	if (n >= 0 && len(args) != n) || (n < 0 && len(args) > 1) {
+		return nil, fmt.Errorf("wrong number of arguments for '%s'", req.Method)
+	}
+
+	switch req.Method {
+	case ctl.MethodLeases:
+		if len(args) == 0 {
+			break
+		}
+		if ip := net.ParseIP(args[0]); ip != nil {
+			req.IP = ip
+		} else if _, err := net.ParseMAC(args[0]); err == nil {
+			req.MAC = args[0]
+		} else {
+			req.Duid = args[0]
+		}
+	case ctl.MethodRevoke:
+		if req.IP = net.ParseIP(args[0]); req.IP == nil {
+			return nil, fmt.Errorf("invalid ip '%s'", args[0])
+		}
+	case ctl.MethodReserve:
+		req.MAC = args[0]
+		if req.IP = net.ParseIP(args[1]); req.IP == nil {
+			return nil, fmt.Errorf("invalid ip '%s'", args[1])
+		}
+	case ctl.MethodUnreserve:
+		req.MAC = args[0]
+	}
+	return req, nil
+}
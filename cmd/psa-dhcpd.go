@@ -1,27 +1,53 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	cr "crypto/rand"
 	"encoding/binary"
 	"flag"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"math/rand"
 	"net"
 	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/golang/protobuf/proto"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/logger"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/metrics"
 	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ctl"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/hooks"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ipdb"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ipdb/journal"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/peer"
 	pb "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/proto"
 )
 
 var (
-	ifname  = flag.String("ifname", "", "Interface to use")
-	config  = flag.String("config", "", "Config file to use")
-	logTime = flag.Bool("log_time", true, "Prefix log messages with timestamp")
+	ifname      = flag.String("ifname", "", "Interface to use, serve all interfaces of the config file if empty")
+	config      = flag.String("config", "", "Config file to use")
+	logTime     = flag.Bool("log_time", true, "Prefix log messages with timestamp")
+	logLevel    = flag.String("log_level", "info", "Minimum level of logged messages: debug, info, warn or error")
+	logJSON     = flag.Bool("log_json", false, "Log one JSON object per message, with fields such as interface, xid and hwaddr")
+	leaseFile   = flag.String("lease_file", "", "File to store leases in, leases are kept in memory only if empty")
+	metricsAddr = flag.String("metrics_addr", "", "Address to export Prometheus metrics on (eg. :9167), disabled if empty")
+	hookScript  = flag.String("hook_script", "", "Script to execute on lease events")
+	hookURL     = flag.String("hook_url", "", "URL to POST lease events to, as JSON")
+	peerRole    = flag.String("peer_role", "", "Failover role of this instance, 'primary' or 'standby'. Failover is disabled if empty")
+	peerAddr    = flag.String("peer_addr", "", "Failover: address of the standby, the primary connects to it and the standby listens on it")
+	peerSecret  = flag.String("peer_secret_file", "", "Failover: file containing the secret shared by primary and standby")
+	ctlSocket   = flag.String("ctl_socket", "", "Unix socket to accept psa-dhcpctl requests on (eg. /run/psa-dhcpd.sock), disabled if empty")
+)
+
+const (
+	// How often the lease file gets compacted.
+	compactInterval = 1 * time.Hour
 )
 
 func init() {
@@ -39,37 +65,193 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	var lflags int
-	if *logTime {
-		lflags |= log.LstdFlags
-	}
-	l := log.New(os.Stdout, "psa-dhcpd: ", lflags)
-
-	if *ifname == "" {
-		l.Fatalf("-ifname must be set")
-	}
-	iface, err := net.InterfaceByName(*ifname)
+	level, err := logger.ParseLevel(*logLevel)
 	if err != nil {
-		l.Fatalf("failed to discover interface %s: %v\n", *ifname, err)
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
 	}
-	l.SetPrefix(fmt.Sprintf("psa-dhcpd[%s] ", iface.Name))
+	l := logger.New(os.Stdout, "psa-dhcpd: ", level, *logJSON, *logTime)
 
-	confpb, err := loadConfig(*config)
+	confs, err := loadConfig(*ifname, *config)
 	if err != nil {
 		l.Fatalf("%s\n", err)
 	}
 
-	s, err := server.New(ctx, l, iface, confpb)
-	if err != nil {
-		l.Fatalf("failed to create new server: %v\n", err)
+	var jx *journal.Journal
+	if *leaseFile != "" {
+		if jx, err = journal.Open(*leaseFile); err != nil {
+			l.Fatalf("failed to open lease file: %v\n", err)
+		}
+		defer jx.Close()
+	}
+
+	// One server per interface, all sharing the same journal.
+	names := sortedKeys(confs)
+	servers := make(map[string]dhcpServer)
+	for _, name := range names {
+		iface, err := net.InterfaceByName(name)
+		if err != nil {
+			l.Fatalf("failed to discover interface %s: %v\n", name, err)
+		}
+		sl := l.WithPrefix(fmt.Sprintf("psa-dhcpd[%s] ", iface.Name), "interface", iface.Name)
+		s, err := server.New(ctx, sl, iface, confs[name], jx)
+		if err != nil {
+			l.Fatalf("failed to create new server for %s: %v\n", name, err)
+		}
+		servers[name] = s
+	}
+
+	if *peerRole != "" {
+		var secret []byte
+		if *peerSecret != "" {
+			if secret, err = ioutil.ReadFile(*peerSecret); err != nil {
+				l.Fatalf("failed to read peer secret: %v\n", err)
+			}
+		}
+		// The peer passes all changes on to the journal.
+		var next ipdb.Recorder
+		if jx != nil {
+			next = jx
+		}
+		p, err := peer.New(l, *peerRole, *peerAddr, bytes.TrimSpace(secret), next)
+		if err != nil {
+			l.Fatalf("failed to configure failover peer: %v\n", err)
+		}
+		for _, s := range servers {
+			s.SetPeer(p)
+		}
+		go func() {
+			if err := p.Run(ctx); err != nil {
+				l.Errorf("failover peer failed: %v\n", err)
+				cancel()
+			}
+		}()
+	}
+
+	if *hookScript != "" || *hookURL != "" {
+		hx, err := hooks.New(l, *hookScript, *hookURL)
+		if err != nil {
+			l.Fatalf("failed to configure hooks: %v\n", err)
+		}
+		for _, s := range servers {
+			s.SetHooks(hx)
+		}
+		go hx.Run(ctx)
+	}
+
+	if jx != nil {
+		// Get rid of stale records from previous runs.
+		if err := jx.Compact(); err != nil {
+			l.Fatalf("failed to compact lease file: %v\n", err)
+		}
+		go jx.Run(ctx, l, compactInterval)
+	}
+
+	if *metricsAddr != "" {
+		go func() {
+			if err := metrics.Serve(ctx, *metricsAddr, metrics.Default); err != nil {
+				l.Errorf("metrics listener failed: %v\n", err)
+			}
+		}()
+	}
+
+	if *ctlSocket != "" {
+		backends := make(map[string]ctl.Backend)
+		for name, s := range servers {
+			backends[name] = s
+		}
+		go func() {
+			if err := ctl.Serve(ctx, l, *ctlSocket, ctl.Dispatch(backends)); err != nil {
+				l.Errorf("control socket failed: %v\n", err)
+			}
+		}()
+	}
+
+	// Shut down all servers on SIGINT and SIGTERM, reload the configuration on SIGHUP.
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case sig := <-sigc:
+				if sig == syscall.SIGHUP {
+					reload(l, names, servers)
+					continue
+				}
+				l.Printf("received signal %s, shutting down.", sig)
+				cancel()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	errc := make(chan error, len(servers))
+	var wg sync.WaitGroup
+	for _, s := range servers {
+		wg.Add(1)
+		go func(s dhcpServer) {
+			defer wg.Done()
+			if err := s.Run(); err != nil {
+				// One broken server takes down all others.
+				l.Errorf("error: %v\n", err)
+				errc <- err
+				cancel()
+			}
+		}(s)
+	}
+	wg.Wait()
+	close(errc)
+
+	if jx != nil {
+		if err := jx.Compact(); err != nil {
+			l.Errorf("failed to compact lease file: %v\n", err)
+		}
+		jx.Close()
+	}
+	if len(errc) > 0 {
+		os.Exit(1)
 	}
-	err = s.Run()
+}
+
+// dhcpServer is a server, as returned by server.New.
+type dhcpServer interface {
+	ctl.Backend
+	Run() error
+	Reload(*pb.ServerConfig) error
+	SetHooks(*hooks.Hooks)
+	SetPeer(*peer.Peer)
+}
+
+// reload re-reads the config file and applies it to all running servers.
+// Servers keep their running configuration if the new one is broken.
+func reload(l *logger.Logger, names []string, servers map[string]dhcpServer) {
+	l.Printf("received SIGHUP, reloading %s", *config)
+	confs, err := loadConfig(*ifname, *config)
 	if err != nil {
-		l.Fatalf("error: %v\n", err)
+		l.Errorf("reload failed, keeping running configuration: %v", err)
+		return
+	}
+	for _, name := range sortedKeys(confs) {
+		if _, ok := servers[name]; !ok {
+			l.Warnf("reload: ignoring new interface %s, adding interfaces requires a restart", name)
+		}
+	}
+	for _, name := range names {
+		conf, ok := confs[name]
+		if !ok {
+			l.Warnf("reload: interface %s is gone from the configuration, removing interfaces requires a restart", name)
+			continue
+		}
+		if err := servers[name].Reload(conf); err != nil {
+			l.Errorf("reload of %s failed, keeping running configuration: %v", name, err)
+		}
 	}
 }
 
-func loadConfig(path string) (*pb.ServerConfig, error) {
+// loadConfig returns the configuration of all interfaces to serve.
+// If ifname is set, the config file contains a ServerConfig for it, a DaemonConfig otherwise.
+func loadConfig(ifname, path string) (map[string]*pb.ServerConfig, error) {
 	if path == "" {
 		return nil, fmt.Errorf("-config must be set")
 	}
@@ -85,10 +267,29 @@ func loadConfig(path string) (*pb.ServerConfig, error) {
 		return nil, err
 	}
 
-	conf := &pb.ServerConfig{}
-	err = proto.UnmarshalText(string(data), conf)
-	if err != nil {
-		return nil, err
+	if ifname != "" {
+		conf := &pb.ServerConfig{}
+		if err := proto.UnmarshalText(string(data), conf); err != nil {
+			return nil, err
+		}
+		return map[string]*pb.ServerConfig{ifname: conf}, nil
+	}
+
+	conf := &pb.DaemonConfig{}
+	if err := proto.UnmarshalText(string(data), conf); err != nil {
+		return nil, fmt.Errorf("%v (use -ifname for single interface configs)", err)
+	}
+	if len(conf.GetInterface()) == 0 {
+		return nil, fmt.Errorf("no interface configured in %s", path)
+	}
+	return conf.GetInterface(), nil
+}
+
+func sortedKeys(m map[string]*pb.ServerConfig) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
 	}
-	return conf, nil
+	sort.Strings(keys)
+	return keys
 }
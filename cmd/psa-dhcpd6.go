@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/golang/protobuf/proto"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/logger"
+	pb "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/proto"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server6"
+)
+
+var (
+	ifname   = flag.String("ifname", "", "Interface to serve")
+	config   = flag.String("config", "", "Config file to use")
+	logTime  = flag.Bool("log_time", true, "Prefix log messages with timestamp")
+	logLevel = flag.String("log_level", "info", "Minimum level of logged messages: debug, info, warn or error")
+	logJSON  = flag.Bool("log_json", false, "Log one JSON object per message, with fields such as interface, xid and hwaddr")
+)
+
+func main() {
+	flag.Parse()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	level, err := logger.ParseLevel(*logLevel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	l := logger.New(os.Stdout, "psa-dhcpd6: ", level, *logJSON, *logTime)
+
+	if *ifname == "" {
+		l.Fatalf("-ifname must be set\n")
+	}
+	conf, err := loadConfig(*config)
+	if err != nil {
+		l.Fatalf("%s\n", err)
+	}
+	iface, err := net.InterfaceByName(*ifname)
+	if err != nil {
+		l.Fatalf("failed to discover interface %s: %v\n", *ifname, err)
+	}
+	sl := l.WithPrefix(fmt.Sprintf("psa-dhcpd6[%s] ", iface.Name), "interface", iface.Name)
+	s, err := server6.New(ctx, sl, iface, conf)
+	if err != nil {
+		l.Fatalf("failed to create new server for %s: %v\n", *ifname, err)
+	}
+
+	// Shut down on SIGINT and SIGTERM.
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-sigc:
+			l.Printf("received signal %s, shutting down.", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if err := s.Run(); err != nil {
+		l.Fatalf("error: %v\n", err)
+	}
+}
+
+// loadConfig reads a Server6Config from path.
+func loadConfig(path string) (*pb.Server6Config, error) {
+	if path == "" {
+		return nil, fmt.Errorf("-config must be set")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	conf := &pb.Server6Config{}
+	if err := proto.UnmarshalText(string(data), conf); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
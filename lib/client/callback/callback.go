@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/csv"
 	"fmt"
-	"log"
 	"net"
 	"os"
 	"os/exec"
@@ -13,6 +12,7 @@ import (
 	"time"
 
 	"git.sr.ht/~adrian-blx/psa-dhcp/lib/libif"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/logger"
 )
 
 const (
@@ -20,41 +20,59 @@ const (
 )
 
 var (
-	reBadChars = regexp.MustCompile(`[^a-zA-Z0-9,\.-]`)
+	reBadChars = regexp.MustCompile(`[^a-zA-Z0-9,\.:/-]`)
 )
 
 // Cbhandler returns a function which can be called to execute the specified script.
-func Cbhandler(script string, iface *net.Interface, l *log.Logger) func(context.Context, *libif.Ifconfig) {
+func Cbhandler(script string, iface *net.Interface, l *logger.Logger) func(context.Context, *libif.Ifconfig) {
 	return func(ctx context.Context, c *libif.Ifconfig) {
-		cargs, err := parseScriptArgs(script)
-		if err != nil {
-			l.Printf("failed to parse '%s': %v", script, err)
-			return
-		}
-		if len(cargs) == 0 {
-			return
+		var env []string
+		if c != nil {
+			env = dumpScriptConf(c)
 		}
+		run(ctx, script, iface, l, env)
+	}
+}
 
-		cctx, ccancel := context.WithTimeout(ctx, scriptTimeout)
-		defer ccancel()
-
-		cmd := exec.CommandContext(cctx, cargs[0], cargs[1:]...)
-		cmd.Env = append(os.Environ(),
-			envEntry("INTERFACE", iface.Name),
-		)
+// Cb6handler returns a function which can be called to execute the specified script with a DHCPv6 configuration.
+func Cb6handler(script string, iface *net.Interface, l *logger.Logger) func(context.Context, *libif.Ifconfig6) {
+	return func(ctx context.Context, c *libif.Ifconfig6) {
+		var env []string
 		if c != nil {
-			cmd.Env = append(cmd.Env, dumpScriptConf(c)...)
+			env = dumpScriptConf6(c)
 		}
+		run(ctx, script, iface, l, env)
+	}
+}
 
-		out, err := cmd.CombinedOutput()
-		if err != nil {
-			l.Printf("Execution of command '%s' returned error: %v", script, err)
-		}
-		if len(out) == 0 {
-			l.Printf("-> Command exited without any output.")
-		} else {
-			l.Printf("-> Command exited with output %q", string(out))
-		}
+// run executes the script with the given additional environment.
+func run(ctx context.Context, script string, iface *net.Interface, l *logger.Logger, env []string) {
+	cargs, err := parseScriptArgs(script)
+	if err != nil {
+		l.Errorf("failed to parse '%s': %v", script, err)
+		return
+	}
+	if len(cargs) == 0 {
+		return
+	}
+
+	cctx, ccancel := context.WithTimeout(ctx, scriptTimeout)
+	defer ccancel()
+
+	cmd := exec.CommandContext(cctx, cargs[0], cargs[1:]...)
+	cmd.Env = append(os.Environ(),
+		envEntry("INTERFACE", iface.Name),
+	)
+	cmd.Env = append(cmd.Env, env...)
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		l.Errorf("Execution of command '%s' returned error: %v", script, err)
+	}
+	if len(out) == 0 {
+		l.Printf("-> Command exited without any output.")
+	} else {
+		l.Printf("-> Command exited with output %q", string(out))
 	}
 }
 
@@ -76,6 +94,26 @@ func dumpScriptConf(c *libif.Ifconfig) []string {
 	)
 }
 
+// dumpScriptConf6 returns a (shell safe) version of the specified DHCPv6 configuration.
+func dumpScriptConf6(c *libif.Ifconfig6) []string {
+	dns := make([]string, len(c.DNS))
+	for i, d := range c.DNS {
+		dns[i] = d.String()
+	}
+	prefixes := make([]string, len(c.Prefixes))
+	for i, p := range c.Prefixes {
+		prefixes[i] = p.String()
+	}
+
+	return append([]string{},
+		envEntry("IPV6_ADDRESS", c.IP.String()),
+		envEntry("IPV6_DNS_LIST", strings.Join(dns, ",")),
+		envEntry("IPV6_DOMAIN_SEARCH", strings.Join(c.Domains, ",")),
+		envEntry("IPV6_PREFIXES", strings.Join(prefixes, ",")),
+		envEntry("IPV6_LEASE_SEC", fmt.Sprintf("%d", int(c.Valid.Seconds()))),
+	)
+}
+
 func envEntry(key, val string) string {
 	val = reBadChars.ReplaceAllString(val, "_")
 	return fmt.Sprintf("PSA_DHCPC_%s=%s", key, val)
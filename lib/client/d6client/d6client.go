@@ -0,0 +1,187 @@
+package d6client
+
+import (
+	"context"
+	"hash/crc32"
+	"math/rand"
+	"net"
+	"time"
+
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/dhcp6msg"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/libif"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/logger"
+	d "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ipdb/duid"
+	"golang.org/x/time/rate"
+)
+
+const (
+	stateINVALID_       = iota
+	statePurgeInterface // Removes our address, if any.
+	stateSoliciting     // Multicast SOLICIT until a server advertises an address.
+	stateRequesting     // Request the advertised address from the server.
+	stateIfconfig       // Configures the OS with the received configuration.
+	stateBound          // We have a lease and are sleeping.
+	stateRenewing       // We try to renew the lease with our server.
+	stateRebinding      // We try to rebind with any server.
+)
+
+// stateNames are added to all messages logged in a state.
+var stateNames = map[int]string{
+	statePurgeInterface: "purge_interface",
+	stateSoliciting:     "soliciting",
+	stateRequesting:     "requesting",
+	stateIfconfig:       "ifconfig",
+	stateBound:          "bound",
+	stateRenewing:       "renewing",
+	stateRebinding:      "rebinding",
+}
+
+const (
+	// For how long to wait before soliciting again if the server did not assign an address.
+	retryDelay = 30 * time.Second
+	// For how long to try to release the lease on shutdown.
+	releaseTimeout = 3 * time.Second
+)
+
+type boundDeadlines struct {
+	t1 time.Time // When to enter renewing state
+	t2 time.Time // When to enter rebinding state
+	tx time.Time // End of the shortest valid lifetime
+}
+
+// d6client is the dhcpv6 client state machine.
+type d6client struct {
+	ctx            context.Context                         // The context to use.
+	l              *logger.Logger                          // Logging interface, tagged with the current state
+	log            *logger.Logger                          // Logging interface
+	iface          *net.Interface                          // Network hardware interface
+	duid           d.Duid                                  // Our client id.
+	iaid           uint32                                  // IAID of our IA_NA and IA_PD.
+	pd             bool                                    // Whether to ask for a delegated prefix.
+	state          int                                     // The current state we are in
+	serverID       []byte                                  // Server id of the server we are bound to.
+	lastOpts       dhcp6msg.DecodedOptions                 // Options of last accepted advertise or reply
+	configured     *libif.Ifconfig6                        // Configuration applied to the interface, nil if none.
+	boundDeadlines boundDeadlines                          // Deadline information, updated by BOUND state
+	limiter        *rate.Limiter                           // Rate limiter
+	callback       func(context.Context, *libif.Ifconfig6) // Post-configuration callback.
+}
+
+func New(ctx context.Context, iface *net.Interface, l *logger.Logger, duid d.Duid, pd bool, cb func(context.Context, *libif.Ifconfig6)) *d6client {
+	return &d6client{
+		ctx:      ctx,
+		iface:    iface,
+		l:        l,
+		log:      l,
+		duid:     duid,
+		iaid:     crc32.ChecksumIEEE(iface.HardwareAddr),
+		pd:       pd,
+		state:    statePurgeInterface,
+		callback: cb,
+		limiter:  rate.NewLimiter(1, 10),
+	}
+}
+
+// Run runs the state machine until the context is done, the lease is released on return.
+func (cx *d6client) Run() error {
+	for {
+		cx.l = cx.log.With("state", stateNames[cx.state])
+		switch cx.state {
+		case statePurgeInterface:
+			cx.runStatePurgeInterface(stateSoliciting)
+		case stateSoliciting:
+			cx.runStateSoliciting(stateRequesting)
+		case stateRequesting:
+			cx.runStateRequesting(stateIfconfig, stateSoliciting)
+		case stateIfconfig:
+			cx.runStateIfconfig(stateBound)
+		case stateBound:
+			cx.runStateBound(stateRenewing)
+		case stateRenewing:
+			cx.runStateRenewing(stateIfconfig, stateRebinding)
+		case stateRebinding:
+			cx.runStateRebinding(stateIfconfig, statePurgeInterface)
+		default:
+			cx.l.Panicf("invalid state: %d\n", cx.state)
+		}
+
+		if !cx.limiter.Allow() {
+			cx.l.Errorf("dhcpv6 client went bananas, consumed all tokens! - will exit in 20 sec.")
+			time.Sleep(20 * time.Second)
+			cx.l.Panicf("EXITING AFTER FATAL ERROR: DHCPV6 CLIENT CONSUMED ALL TOKENS!")
+		}
+		// release and break if main context is done.
+		if err := cx.ctx.Err(); err != nil {
+			cx.release()
+			return err
+		}
+	}
+}
+
+// buildNetconfig returns the configuration of the last accepted reply.
+func (cx *d6client) buildNetconfig() libif.Ifconfig6 {
+	a, _ := boundAddr(cx.lastOpts)
+	c := libif.Ifconfig6{
+		Interface: cx.iface,
+		IP:        a.IP,
+		Preferred: a.Preferred,
+		Valid:     a.Valid,
+		DNS:       cx.lastOpts.DNS,
+		Domains:   cx.lastOpts.DomainList,
+	}
+	for _, p := range boundPrefixes(cx.lastOpts) {
+		c.Prefixes = append(c.Prefixes, p.Prefix)
+	}
+	return c
+}
+
+// deadlines returns T1, T2 and the end of the shortest valid lifetime of the last accepted reply.
+func (cx *d6client) deadlines(now time.Time) boundDeadlines {
+	var t1, t2, valid, preferred time.Duration
+	a, _ := boundAddr(cx.lastOpts)
+	valid, preferred = a.Valid, a.Preferred
+	for _, p := range boundPrefixes(cx.lastOpts) {
+		if p.Valid < valid {
+			valid, preferred = p.Valid, p.Preferred
+		}
+	}
+	for _, ia := range append(append([]dhcp6msg.IA{}, cx.lastOpts.IANA...), cx.lastOpts.IAPD...) {
+		if ia.T1 > 0 && (t1 == 0 || ia.T1 < t1) {
+			t1 = ia.T1
+		}
+		if ia.T2 > 0 && (t2 == 0 || ia.T2 < t2) {
+			t2 = ia.T2
+		}
+	}
+	// RFC 8415: the client picks the times if the server leaves it to us.
+	if t1 == 0 || t2 < t1 || t2 > valid {
+		t1 = preferred / 2
+		t2 = preferred * 4 / 5
+	}
+	return boundDeadlines{t1: now.Add(t1), t2: now.Add(t2), tx: now.Add(valid)}
+}
+
+// sleepUntil sleeps until the context expires or the supplied time was reached, polling
+// once in a while to detect clock jumps.
+func sleepUntil(ctx context.Context, when time.Time) {
+	for {
+		left := when.Sub(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(left):
+			return
+		case <-time.After(17 * time.Second):
+			// -> recalculate time
+		}
+	}
+}
+
+// newXid returns a random transaction id.
+func newXid() uint32 {
+	return rand.Uint32() & 0xffffff
+}
+
+func (cx *d6client) runCallback(c *libif.Ifconfig6) {
+	cx.callback(cx.ctx, c)
+}
@@ -0,0 +1,116 @@
+package d6client
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/dhcp6msg"
+	d "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ipdb/duid"
+)
+
+func TestLoadDuid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "d6client")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	hw := net.HardwareAddr{2, 0, 0, 0, 0, 1}
+	path := filepath.Join(dir, "sub", "duid")
+	first, err := LoadDuid(path, hw)
+	if err != nil {
+		t.Fatalf("LoadDuid = %v, wanted nil err", err)
+	}
+	if len(first) != 14 || first[1] != 1 || !first.HasHwAddr(hw) {
+		t.Errorf("LoadDuid = %s, want a DUID-LLT of %s", first, hw)
+	}
+	again, err := LoadDuid(path, net.HardwareAddr{2, 0, 0, 0, 0, 2})
+	if err != nil || again.String() != first.String() {
+		t.Errorf("LoadDuid(again) = %s, %v; want %s", again, err, first)
+	}
+
+	ioutil.WriteFile(path, []byte("garbage"), 0644)
+	if _, err := LoadDuid(path, hw); err == nil {
+		t.Errorf("LoadDuid(garbage) wanted err, got nil err")
+	}
+}
+
+func TestExchange(t *testing.T) {
+	duid := d.Duid{0, 3, 0, 1, 2, 0, 0, 0, 0, 1}
+	server := []byte{0, 3, 0, 1, 2, 0, 0, 0, 0, 9}
+	ip := net.ParseIP("2001:db8::1")
+	_, prefix, _ := net.ParseCIDR("2001:db8:100::/56")
+
+	msg := solicit(1, duid, 7, true)(1500 * time.Millisecond)
+	opts := dhcp6msg.DecodeOptions(msg.Options)
+	want := dhcp6msg.DecodedOptions{
+		ClientID:    duid,
+		IANA:        []dhcp6msg.IA{{IAID: 7}},
+		IAPD:        []dhcp6msg.IA{{IAID: 7}},
+		ORO:         []uint16{dhcp6msg.OptDNS, dhcp6msg.OptDomainList},
+		ElapsedTime: 1500 * time.Millisecond,
+	}
+	if diff := cmp.Diff(want, opts); diff != "" || msg.MsgType != dhcp6msg.MsgTypeSolicit {
+		t.Errorf("solicit had a diff: %s", diff)
+	}
+
+	advertised := dhcp6msg.DecodedOptions{
+		IANA: []dhcp6msg.IA{{IAID: 7, Addrs: []dhcp6msg.IAAddr{{IP: ip, Preferred: time.Hour, Valid: 2 * time.Hour}}}},
+		IAPD: []dhcp6msg.IA{{IAID: 7, Prefixes: []dhcp6msg.IAPrefix{{Prefix: prefix, Preferred: time.Hour, Valid: 2 * time.Hour}}}},
+	}
+	msg = withIAs(dhcp6msg.MsgTypeRequest, 2, duid, server, advertised)(0)
+	opts = dhcp6msg.DecodeOptions(msg.Options)
+	if diff := cmp.Diff(advertised.IANA, opts.IANA); diff != "" || string(opts.ServerID) != string(server) {
+		t.Errorf("request had a diff: %s", diff)
+	}
+
+	reply := func(msgType uint8, xid uint32, ias ...dhcp6msg.DHCP6Opt) (dhcp6msg.Message, dhcp6msg.DecodedOptions) {
+		msg := dhcp6msg.Message{MsgType: msgType, Xid: xid, Options: append([]dhcp6msg.DHCP6Opt{
+			dhcp6msg.OptionClientID(duid),
+			dhcp6msg.OptionServerID(server),
+		}, ias...)}
+		return msg, dhcp6msg.DecodeOptions(msg.Options)
+	}
+	bound := dhcp6msg.OptionIANA(advertised.IANA[0])
+	noAddrs := dhcp6msg.OptionIANA(dhcp6msg.IA{IAID: 7, Status: &dhcp6msg.Status{Code: dhcp6msg.StatusNoAddrsAvail}})
+	for _, test := range []struct {
+		name    string
+		vrfy    vrfyFunc
+		msgType uint8
+		ia      dhcp6msg.DHCP6Opt
+		want    bool
+	}{
+		{name: "advertise", vrfy: verifyAdvertise(1, duid), msgType: dhcp6msg.MsgTypeAdvertise, ia: bound, want: true},
+		{name: "advertise without address", vrfy: verifyAdvertise(1, duid), msgType: dhcp6msg.MsgTypeAdvertise, ia: noAddrs},
+		{name: "advertise of other xid", vrfy: verifyAdvertise(2, duid), msgType: dhcp6msg.MsgTypeAdvertise, ia: bound},
+		{name: "reply as advertise", vrfy: verifyAdvertise(1, duid), msgType: dhcp6msg.MsgTypeReply, ia: bound},
+		{name: "reply", vrfy: verifyReply(1, duid, server), msgType: dhcp6msg.MsgTypeReply, ia: bound, want: true},
+		{name: "reply of any server", vrfy: verifyReply(1, duid, nil), msgType: dhcp6msg.MsgTypeReply, ia: noAddrs, want: true},
+		{name: "reply of other server", vrfy: verifyReply(1, duid, []byte{1}), msgType: dhcp6msg.MsgTypeReply, ia: bound},
+		{name: "reply of other client", vrfy: verifyReply(1, d.Duid{1}, server), msgType: dhcp6msg.MsgTypeReply, ia: bound},
+	} {
+		msg, opts := reply(test.msgType, 1, test.ia)
+		if got := test.vrfy(msg, opts); got != test.want {
+			t.Errorf("verify(%s) = %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	cx := &d6client{lastOpts: advertised}
+	nc := cx.buildNetconfig()
+	if !nc.IP.Equal(ip) || nc.Valid != 2*time.Hour || len(nc.Prefixes) != 1 || nc.Prefixes[0].String() != prefix.String() {
+		t.Errorf("buildNetconfig = %+v, want %s and %s", nc, ip, prefix)
+	}
+	now := time.Now()
+	if dl := cx.deadlines(now); dl.t1 != now.Add(30*time.Minute) || dl.t2 != now.Add(48*time.Minute) || dl.tx != now.Add(2*time.Hour) {
+		t.Errorf("deadlines = %+v, want T1 30m, T2 48m and 2h", dl)
+	}
+	cx.lastOpts.IANA[0].T1, cx.lastOpts.IANA[0].T2 = 10*time.Minute, 20*time.Minute
+	if dl := cx.deadlines(now); dl.t1 != now.Add(10*time.Minute) || dl.t2 != now.Add(20*time.Minute) {
+		t.Errorf("deadlines = %+v, want T1 10m and T2 20m of the server", dl)
+	}
+}
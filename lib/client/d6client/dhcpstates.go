@@ -0,0 +1,105 @@
+package d6client
+
+import (
+	"context"
+	"time"
+
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/dhcp6msg"
+)
+
+// runStateSoliciting multicasts SOLICIT messages until a server advertises an address.
+// The first advertisement wins, even if other servers have a higher preference.
+func (cx *d6client) runStateSoliciting(nextState int) {
+	cx.l.Printf("Sending SOLICIT multicast\n")
+
+	xid := newXid()
+	rq := solicit(xid, cx.duid, cx.iaid, cx.pd)
+	if _, lo, err := cx.advanceState(time.Now().Add(10*time.Minute), verifyAdvertise(xid, cx.duid), rq); err == nil {
+		cx.serverID = lo.ServerID
+		cx.lastOpts = lo
+		cx.state = nextState
+	}
+	// else: can't advance to any other state.
+}
+
+// runStateRequesting requests the advertised address and prefixes from the server.
+func (cx *d6client) runStateRequesting(nextState, failState int) {
+	a, _ := boundAddr(cx.lastOpts)
+	cx.l.Printf("Requesting advertised IP %s from server %x\n", a.IP, cx.serverID)
+
+	xid := newXid()
+	rq := withIAs(dhcp6msg.MsgTypeRequest, xid, cx.duid, cx.serverID, cx.lastOpts)
+	_, lo, err := cx.advanceState(time.Now().Add(time.Minute), verifyReply(xid, cx.duid, cx.serverID), rq)
+	if err != nil {
+		cx.state = failState
+		return
+	}
+	if _, ok := boundAddr(lo); !ok {
+		cx.l.Warnf("server assigned no address (status %+v), soliciting again in %s", lo.Status, retryDelay)
+		sleepUntil(cx.ctx, time.Now().Add(retryDelay))
+		cx.state = failState
+		return
+	}
+	cx.lastOpts = lo
+	cx.state = nextState
+}
+
+// runStateBound configures T1 and T2, sleeping until T1 (or the context) expires.
+func (cx *d6client) runStateBound(nextState int) {
+	now := time.Now()
+	cx.boundDeadlines = cx.deadlines(now)
+	cx.l.Printf("-> Lease is valid for %s", cx.boundDeadlines.tx.Sub(now))
+	cx.l.Printf("-> Renew will happen after %s, must rebind after %s", cx.boundDeadlines.t1.Sub(now), cx.boundDeadlines.t2.Sub(now))
+	sleepUntil(cx.ctx, cx.boundDeadlines.t1)
+	cx.state = nextState
+}
+
+// runStateRenewing sends RENEW messages to our server until T2 expires.
+func (cx *d6client) runStateRenewing(nextState, failState int) {
+	cx.l.Printf("Renewing lease, will try until %s", cx.boundDeadlines.t2.Format(time.RFC3339))
+	xid := newXid()
+	rq := withIAs(dhcp6msg.MsgTypeRenew, xid, cx.duid, cx.serverID, cx.lastOpts)
+	cx.extend(cx.boundDeadlines.t2, verifyReply(xid, cx.duid, cx.serverID), rq, nextState, failState)
+}
+
+// runStateRebinding sends REBIND messages to all servers until our lease expires.
+func (cx *d6client) runStateRebinding(nextState, failState int) {
+	cx.l.Printf("Rebinding lease, will try until %s", cx.boundDeadlines.tx.Format(time.RFC3339))
+	xid := newXid()
+	rq := withIAs(dhcp6msg.MsgTypeRebind, xid, cx.duid, nil, cx.lastOpts)
+	cx.extend(cx.boundDeadlines.tx, verifyReply(xid, cx.duid, nil), rq, nextState, failState)
+}
+
+// extend runs a renew or rebind exchange: the lease is lost if the reply has no valid address.
+func (cx *d6client) extend(deadline time.Time, vrfy vrfyFunc, rq builderFunc, nextState, failState int) {
+	_, lo, err := cx.advanceState(deadline, vrfy, rq)
+	if err != nil {
+		cx.state = failState
+		return
+	}
+	if _, ok := boundAddr(lo); !ok {
+		cx.l.Warnf("server did not extend our address (status %+v), purging interface", lo.Status)
+		cx.state = statePurgeInterface
+		return
+	}
+	cx.serverID = lo.ServerID
+	cx.lastOpts = lo
+	cx.state = nextState
+}
+
+// release gives our lease back to the server and removes our address, best effort.
+func (cx *d6client) release() {
+	if cx.configured == nil || cx.serverID == nil {
+		return
+	}
+	cx.l.Printf("Releasing lease of IP %s", cx.configured.IP)
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+
+	xid := newXid()
+	rq := withIAs(dhcp6msg.MsgTypeRelease, xid, cx.duid, cx.serverID, cx.lastOpts)
+	if _, _, err := exchange(ctx, cx.iface, verifyReply(xid, cx.duid, cx.serverID), rq); err != nil {
+		cx.l.Warnf("server did not confirm release: %v", err)
+	}
+	cx.unconfigure(ctx)
+}
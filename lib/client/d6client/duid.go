@@ -0,0 +1,51 @@
+package d6client
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	d "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ipdb/duid"
+)
+
+// duidEpoch is the base of the time of a DUID-LLT.
+var duidEpoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// LoadDuid returns the duid stored in path. If the file does not exist, a DUID-LLT is created
+// from the hwaddr and stored in it: the duid must not change as servers identify us by it.
+func LoadDuid(path string, hw net.HardwareAddr) (d.Duid, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err == nil {
+		duid, err := d.Parse(strings.TrimSpace(string(buf)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse duid in %s: %v", path, err)
+		}
+		return duid, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	duid := newDuidLLT(hw, time.Now())
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(path, []byte(duid.String()+"\n"), 0644); err != nil {
+		return nil, err
+	}
+	return duid, nil
+}
+
+// newDuidLLT returns a link-layer plus time DUID of an ethernet hwaddr.
+func newDuidLLT(hw net.HardwareAddr, now time.Time) d.Duid {
+	b := make([]byte, 8, 8+len(hw))
+	binary.BigEndian.PutUint16(b[0:], 1) // DUID-LLT
+	binary.BigEndian.PutUint16(b[2:], 1) // Ethernet
+	binary.BigEndian.PutUint32(b[4:], uint32(now.Sub(duidEpoch)/time.Second))
+	return d.Duid(append(b, hw...))
+}
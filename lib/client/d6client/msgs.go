@@ -0,0 +1,107 @@
+package d6client
+
+import (
+	"bytes"
+	"time"
+
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/dhcp6msg"
+	d "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ipdb/duid"
+)
+
+// builderFunc returns the message to send after the given time since the start of the exchange.
+type builderFunc func(elapsed time.Duration) dhcp6msg.Message
+
+// vrfyFunc returns true if a message is the expected reply.
+type vrfyFunc func(dhcp6msg.Message, dhcp6msg.DecodedOptions) bool
+
+// solicit returns the builder of SOLICIT messages, asking for an address and optionally for a prefix.
+func solicit(xid uint32, duid d.Duid, iaid uint32, pd bool) builderFunc {
+	ias := []dhcp6msg.DHCP6Opt{dhcp6msg.OptionIANA(dhcp6msg.IA{IAID: iaid})}
+	if pd {
+		ias = append(ias, dhcp6msg.OptionIAPD(dhcp6msg.IA{IAID: iaid}))
+	}
+	return builder(dhcp6msg.MsgTypeSolicit, xid, duid, nil, ias)
+}
+
+// withIAs returns the builder of messages for the IAs of last, which are REQUEST, RENEW, REBIND or
+// RELEASE messages. The server id is not sent if nil.
+func withIAs(msgType uint8, xid uint32, duid d.Duid, serverID []byte, last dhcp6msg.DecodedOptions) builderFunc {
+	var ias []dhcp6msg.DHCP6Opt
+	for _, ia := range last.IANA {
+		ias = append(ias, dhcp6msg.OptionIANA(dhcp6msg.IA{IAID: ia.IAID, Addrs: ia.Addrs}))
+	}
+	for _, ia := range last.IAPD {
+		ias = append(ias, dhcp6msg.OptionIAPD(dhcp6msg.IA{IAID: ia.IAID, Prefixes: ia.Prefixes}))
+	}
+	return builder(msgType, xid, duid, serverID, ias)
+}
+
+func builder(msgType uint8, xid uint32, duid d.Duid, serverID []byte, ias []dhcp6msg.DHCP6Opt) builderFunc {
+	return func(elapsed time.Duration) dhcp6msg.Message {
+		opts := []dhcp6msg.DHCP6Opt{dhcp6msg.OptionClientID(duid)}
+		if serverID != nil {
+			opts = append(opts, dhcp6msg.OptionServerID(serverID))
+		}
+		opts = append(opts, dhcp6msg.OptionElapsedTime(elapsed))
+		if msgType != dhcp6msg.MsgTypeRelease {
+			opts = append(opts, dhcp6msg.OptionORO(dhcp6msg.OptDNS, dhcp6msg.OptDomainList))
+		}
+		return dhcp6msg.Message{MsgType: msgType, Xid: xid, Options: append(opts, ias...)}
+	}
+}
+
+// verifyAdvertise accepts advertisements offering an address.
+func verifyAdvertise(xid uint32, duid d.Duid) vrfyFunc {
+	return func(msg dhcp6msg.Message, opts dhcp6msg.DecodedOptions) bool {
+		if msg.MsgType != dhcp6msg.MsgTypeAdvertise || !isOurs(msg, opts, xid, duid) || len(opts.ServerID) == 0 {
+			return false
+		}
+		_, ok := boundAddr(opts)
+		return ok
+	}
+}
+
+// verifyReply accepts replies of the given server, of any server if serverID is nil.
+func verifyReply(xid uint32, duid d.Duid, serverID []byte) vrfyFunc {
+	return func(msg dhcp6msg.Message, opts dhcp6msg.DecodedOptions) bool {
+		if msg.MsgType != dhcp6msg.MsgTypeReply || !isOurs(msg, opts, xid, duid) || len(opts.ServerID) == 0 {
+			return false
+		}
+		return serverID == nil || bytes.Equal(serverID, opts.ServerID)
+	}
+}
+
+func isOurs(msg dhcp6msg.Message, opts dhcp6msg.DecodedOptions, xid uint32, duid d.Duid) bool {
+	return msg.Xid == xid && bytes.Equal(opts.ClientID, duid)
+}
+
+// boundAddr returns the first address with a valid lifetime, false if there is none.
+func boundAddr(opts dhcp6msg.DecodedOptions) (dhcp6msg.IAAddr, bool) {
+	for _, ia := range opts.IANA {
+		if ia.Status != nil && ia.Status.Code != dhcp6msg.StatusSuccess {
+			continue
+		}
+		for _, a := range ia.Addrs {
+			if a.Valid > 0 {
+				return a, true
+			}
+		}
+	}
+	return dhcp6msg.IAAddr{}, false
+}
+
+// boundPrefixes returns all delegated prefixes with a valid lifetime.
+func boundPrefixes(opts dhcp6msg.DecodedOptions) []dhcp6msg.IAPrefix {
+	var res []dhcp6msg.IAPrefix
+	for _, ia := range opts.IAPD {
+		if ia.Status != nil && ia.Status.Code != dhcp6msg.StatusSuccess {
+			continue
+		}
+		for _, p := range ia.Prefixes {
+			if p.Valid > 0 {
+				res = append(res, p)
+			}
+		}
+	}
+	return res
+}
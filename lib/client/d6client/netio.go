@@ -0,0 +1,117 @@
+package d6client
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"time"
+
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/dhcp6msg"
+)
+
+const (
+	// Initial and maximum retransmission timeout (RFC 8415).
+	initialTimeout = time.Second
+	maxTimeout     = 120 * time.Second
+)
+
+func (cx *d6client) advanceState(deadline time.Time, vrfy vrfyFunc, build builderFunc) (dhcp6msg.Message, dhcp6msg.DecodedOptions, error) {
+	ctx, cancel := context.WithDeadline(cx.ctx, deadline)
+	defer cancel()
+
+	cx.l.Debugf("  ==> waiting for valid reply until %s", deadline.Format(time.RFC3339))
+	return exchange(ctx, cx.iface, vrfy, build)
+}
+
+// exchange multicasts the built message to all servers until a reply passes the verification
+// function or the context is done.
+func exchange(octx context.Context, iface *net.Interface, vrfy vrfyFunc, build builderFunc) (dhcp6msg.Message, dhcp6msg.DecodedOptions, error) {
+	ctx, cancel := context.WithCancel(octx)
+	defer cancel()
+
+	conn, err := listen(ctx, iface)
+	if err != nil {
+		return dhcp6msg.Message{}, dhcp6msg.DecodedOptions{}, err
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	go sendMessage(ctx, conn, iface, build)
+
+	buf := make([]byte, 4096)
+	for {
+		nr, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return dhcp6msg.Message{}, dhcp6msg.DecodedOptions{}, err
+		}
+		msg, err := dhcp6msg.Decode(buf[0:nr])
+		if err != nil {
+			continue
+		}
+		opts := dhcp6msg.DecodeOptions(msg.Options)
+		if vrfy(*msg, opts) {
+			return *msg, opts, nil
+		}
+	}
+}
+
+// sendMessage sends the built message with exponential backoff until the context is done.
+func sendMessage(ctx context.Context, conn *net.UDPConn, iface *net.Interface, build builderFunc) error {
+	dst := &net.UDPAddr{IP: net.ParseIP(dhcp6msg.AllServers), Port: dhcp6msg.PortServer, Zone: iface.Name}
+	start := time.Now()
+	delay := initialTimeout
+	for {
+		if _, err := conn.WriteToUDP(build(time.Since(start)).Assemble(), dst); err != nil {
+			return err
+		}
+		// Double the delay with a random factor of +/- 10%.
+		delay = 2*delay + time.Duration(rand.Int63n(int64(delay)/5+1)) - delay/10
+		if delay > maxTimeout {
+			delay = maxTimeout
+		}
+		select {
+		case <-time.After(delay):
+			continue
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// listen returns a socket bound to the client port on the link-local address of the interface.
+// It waits for the address to become usable, which takes a while after the interface came up.
+func listen(ctx context.Context, iface *net.Interface) (*net.UDPConn, error) {
+	var lerr error
+	for {
+		if ip := linkLocal(iface); ip != nil {
+			conn, err := net.ListenUDP("udp6", &net.UDPAddr{IP: ip, Port: dhcp6msg.PortClient, Zone: iface.Name})
+			if err == nil {
+				return conn, nil
+			}
+			lerr = err
+		}
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			if lerr != nil {
+				return nil, lerr
+			}
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// linkLocal returns the IPv6 link-local address of the interface, nil if there is none.
+func linkLocal(iface *net.Interface) net.IP {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil
+	}
+	for _, a := range addrs {
+		if n, ok := a.(*net.IPNet); ok && n.IP.To4() == nil && n.IP.IsLinkLocalUnicast() {
+			return n.IP
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package d6client
+
+import (
+	"context"
+	"time"
+
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/libif"
+)
+
+// runStatePurgeInterface removes our address from the interface, if any.
+func (cx *d6client) runStatePurgeInterface(nextState int) {
+	cx.unconfigure(cx.ctx)
+	cx.serverID = nil
+	cx.state = nextState
+}
+
+// runStateIfconfig applies the current state of the client to the network interface.
+func (cx *d6client) runStateIfconfig(nextState int) {
+	nc := cx.buildNetconfig()
+	if cx.configured != nil && !cx.configured.IP.Equal(nc.IP) {
+		cx.unconfigure(cx.ctx)
+	}
+
+	cx.l.Printf("Configuring interface to use IP %s/128, delegated prefixes: %v\n", nc.IP, nc.Prefixes)
+	if err := libif.SetIface6(nc); err != nil {
+		cx.l.Errorf("PANIC RESET: Unexpected error while configuring interface, falling back to SOLICIT in 30 sec! (error was: %v)\n", err)
+		fctx, cancel := context.WithTimeout(cx.ctx, time.Second*30)
+		<-fctx.Done()
+		cancel()
+		cx.state = statePurgeInterface
+		return
+	}
+	cx.configured = &nc
+	cx.state = nextState
+	cx.runCallback(&nc)
+}
+
+// unconfigure removes the configured address from the interface, if any.
+func (cx *d6client) unconfigure(ctx context.Context) {
+	if cx.configured == nil {
+		return
+	}
+	cx.l.Printf("unconfiguring IP %s\n", cx.configured.IP)
+	if err := libif.Unconfigure6(*cx.configured); err != nil {
+		cx.l.Errorf("Unconfigure6 returned error %v\n", err)
+	}
+	cx.configured = nil
+	cx.callback(ctx, nil)
+}
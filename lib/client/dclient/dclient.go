@@ -2,12 +2,12 @@ package dclient
 
 import (
 	"context"
-	"log"
 	"net"
 	"time"
 
 	"git.sr.ht/~adrian-blx/psa-dhcp/lib/dhcpmsg"
 	"git.sr.ht/~adrian-blx/psa-dhcp/lib/libif"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/logger"
 	"golang.org/x/time/rate"
 )
 
@@ -24,6 +24,18 @@ const (
 
 )
 
+// stateNames are added to all messages logged in a state.
+var stateNames = map[int]string{
+	statePurgeInterface: "purge_interface",
+	stateDiscovering:    "discovering",
+	stateSelecting:      "selecting",
+	stateArpCheck:       "arp_check",
+	stateIfconfig:       "ifconfig",
+	stateBound:          "bound",
+	stateRenewing:       "renewing",
+	stateRebinding:      "rebinding",
+}
+
 type boundDeadlines struct {
 	t1 time.Time // When to enter renewing state
 	t2 time.Time // When to enter rebinding state
@@ -33,7 +45,8 @@ type boundDeadlines struct {
 // dclient is the dhcp client state machine.
 type dclient struct {
 	ctx            context.Context                        // The context to use.
-	l              *log.Logger                            // Logging interface
+	l              *logger.Logger                         // Logging interface, tagged with the current state
+	log            *logger.Logger                         // Logging interface
 	iface          *net.Interface                         // Network hardware interface
 	state          int                                    // The current state we are in
 	lastMsg        dhcpmsg.Message                        // Last accepted DHCP reply
@@ -44,11 +57,12 @@ type dclient struct {
 	postCallback   func(context.Context, *libif.Ifconfig) // Post-configuration callback.
 }
 
-func New(ctx context.Context, iface *net.Interface, l *log.Logger, prCb, poCb func(context.Context, *libif.Ifconfig)) *dclient {
+func New(ctx context.Context, iface *net.Interface, l *logger.Logger, prCb, poCb func(context.Context, *libif.Ifconfig)) *dclient {
 	return &dclient{
 		ctx:          ctx,
 		iface:        iface,
 		l:            l,
+		log:          l,
 		state:        statePurgeInterface,
 		preCallback:  prCb,
 		postCallback: poCb,
@@ -58,6 +72,7 @@ func New(ctx context.Context, iface *net.Interface, l *log.Logger, prCb, poCb fu
 
 func (dx *dclient) Run() error {
 	for {
+		dx.l = dx.log.With("state", stateNames[dx.state])
 		switch dx.state {
 		case statePurgeInterface:
 			dx.runStatePurgeInterface(stateDiscovering)
@@ -80,7 +95,7 @@ func (dx *dclient) Run() error {
 		}
 
 		if !dx.limiter.Allow() {
-			dx.l.Printf("client went bananas, consumed all tokens! - will exit in 20 sec.")
+			dx.l.Errorf("client went bananas, consumed all tokens! - will exit in 20 sec.")
 			time.Sleep(20 * time.Second)
 			dx.l.Panicf("EXITING AFTER FATAL ERROR: CLIENT CONSUMED ALL TOKENS!")
 		}
@@ -118,13 +133,27 @@ func (dx dclient) buildNetconfig() libif.Ifconfig {
 	c := libif.Ifconfig{
 		Interface:     dx.iface,
 		MTU:           int(dx.lastOpts.InterfaceMTU),
-		Router:        dx.lastOpts.Routers[0],
 		IP:            dx.lastMsg.YourIP,
 		Netmask:       netmask,
 		DNS:           dx.lastOpts.DNS,
 		DomainName:    dx.lastOpts.DomainName,
 		LeaseDuration: dx.lastOpts.IPAddressLeaseDuration,
 	}
+
+	if len(dx.lastOpts.ClasslessRoutes) > 0 {
+		// RFC 3442: The router option must be ignored if classless static routes are present,
+		// a default route may be part of them.
+		for _, r := range dx.lastOpts.ClasslessRoutes {
+			if ones, _ := r.Dest.Mask.Size(); ones == 0 && !r.Router.Equal(net.IPv4zero) {
+				c.Router = r.Router
+			} else {
+				// Includes an on-link default route (router 0.0.0.0), which setRoutes adds without gateway.
+				c.Routes = append(c.Routes, libif.Route{Dest: r.Dest, Router: r.Router})
+			}
+		}
+	} else if len(dx.lastOpts.Routers) > 0 {
+		c.Router = dx.lastOpts.Routers[0]
+	}
 	return c
 }
 
@@ -149,7 +178,7 @@ func (dx *dclient) advanceState(deadline time.Time, vrfy vrfyFunc, sender sender
 	ctx, cancel := context.WithDeadline(dx.ctx, deadline)
 	defer cancel()
 
-	dx.l.Printf("  ==> waiting for valid reply until %s", deadline.Format(time.RFC3339))
+	dx.l.Debugf("  ==> waiting for valid reply until %s", deadline.Format(time.RFC3339))
 	go sendMessage(ctx, dx.iface, sender)
 	msg, opts, err := catchReply(ctx, dx.iface, vrfy)
 
@@ -63,7 +63,7 @@ func (dx *dclient) runStateRenewing(nextState, failState int) {
 		dx.lastOpts = lo
 		dx.state = nextState
 	} else if err == errWasNack {
-		dx.l.Printf("received NACK during renew, purging interface")
+		dx.l.Warnf("received NACK during renew, purging interface")
 		dx.state = statePurgeInterface
 	} else {
 		dx.state = failState
@@ -79,7 +79,7 @@ func (dx *dclient) runStateRebinding(nextState, failState int) {
 		dx.lastOpts = lo
 		dx.state = nextState
 	} else if err == errWasNack {
-		dx.l.Printf("received NACK during rebind, purging interface")
+		dx.l.Warnf("received NACK during rebind, purging interface")
 		dx.state = statePurgeInterface
 	} else {
 		dx.state = failState
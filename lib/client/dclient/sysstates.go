@@ -16,10 +16,10 @@ func (dx *dclient) runStatePurgeInterface(nextState int) {
 
 	dx.l.Printf("unconfiguring interface\n")
 	if err := libif.Unconfigure(dx.iface); err != nil {
-		dx.l.Printf("Unconfigure returned error %v\n", err)
+		dx.l.Errorf("Unconfigure returned error %v\n", err)
 	}
 	if err := libif.Up(dx.iface); err != nil {
-		dx.l.Printf("Bringing up interface returned error %v\n", err)
+		dx.l.Errorf("Bringing up interface returned error %v\n", err)
 	}
 	dx.state = nextState
 	dx.runPostCallback(nil)
@@ -52,7 +52,7 @@ func (dx *dclient) runStateArpCheck(nextState int) {
 
 // panicReset unconfigures the service after some time.
 func (dx *dclient) panicReset(f string, args ...interface{}) {
-	dx.l.Printf("PANIC RESET: "+f, args...)
+	dx.l.Errorf("PANIC RESET: "+f, args...)
 
 	libif.Unconfigure(dx.iface) // drop our own IP; best effort.
 	fctx, _ := context.WithTimeout(dx.ctx, time.Second*30)
@@ -14,5 +14,6 @@ func (mx *mclient) filterNetconfig(ctx context.Context, conf *libif.Ifconfig) {
 
 	if !mx.configureRoute {
 		conf.Router = nil
+		conf.Routes = nil
 	}
 }
@@ -2,24 +2,30 @@ package client
 
 import (
 	"context"
-	"log"
+	"fmt"
 	"net"
+	"sync"
 
 	cb "git.sr.ht/~adrian-blx/psa-dhcp/lib/client/callback"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/client/d6client"
 	"git.sr.ht/~adrian-blx/psa-dhcp/lib/client/dclient"
 	"git.sr.ht/~adrian-blx/psa-dhcp/lib/ifmon"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/logger"
 )
 
 // mclient is the 'main' client and is what we return on New.
 type mclient struct {
-	l              *log.Logger
+	l              *logger.Logger
 	iface          *net.Interface
 	script         string
 	configureRoute bool
+	dhcp6          bool   // Whether to run a DHCPv6 client as well.
+	duidFile       string // File the DHCPv6 duid is persisted in.
+	pd             bool   // Whether to ask for a delegated prefix.
 }
 
 // New returns a new mclient to the caller. Use Run() to launch it.
-func New(l *log.Logger, iface *net.Interface, script string, croute bool) *mclient {
+func New(l *logger.Logger, iface *net.Interface, script string, croute bool) *mclient {
 	return &mclient{
 		l:              l,
 		iface:          iface,
@@ -28,8 +34,33 @@ func New(l *log.Logger, iface *net.Interface, script string, croute bool) *mclie
 	}
 }
 
+// EnableDHCPv6 runs a DHCPv6 client alongside the DHCPv4 client, using the duid persisted in duidFile.
+// Delegated prefixes are requested if pd is set.
+func (mx *mclient) EnableDHCPv6(duidFile string, pd bool) {
+	mx.dhcp6 = true
+	mx.duidFile = duidFile
+	mx.pd = pd
+}
+
 // Run runs the main loop.
 func (mx *mclient) Run(ctx context.Context) error {
+	// The DHCPv6 client is independent of interface changes, it releases its lease once ctx is done.
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	if mx.dhcp6 {
+		duid, err := d6client.LoadDuid(mx.duidFile, mx.iface.HardwareAddr)
+		if err != nil {
+			return fmt.Errorf("failed to load DHCPv6 duid: %v", err)
+		}
+		mx.l.Printf("Using DHCPv6 duid %s", duid)
+		cx := d6client.New(ctx, mx.iface, mx.l, duid, mx.pd, cb.Cb6handler(mx.script, mx.iface, mx.l))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cx.Run()
+		}()
+	}
+
 	// This is the context we use for the dclient.
 	// We will cancel it if there are any important netlink changes.
 	dctx, dcancel := context.WithCancel(ctx)
@@ -23,7 +23,8 @@ func (rx *tmpl) request(msgtype uint8, sourceIP, destinationIP, requestedIP, ser
 			dhcpmsg.OptSubnetMask, dhcpmsg.OptRouter, dhcpmsg.OptIPAddressLeaseDuration,
 			dhcpmsg.OptServerIdentifier,
 			dhcpmsg.OptDNS, dhcpmsg.OptDomainName, dhcpmsg.OptInterfaceMTU,
-			dhcpmsg.OptRenewalDuration, dhcpmsg.OptRebindDuration),
+			dhcpmsg.OptRenewalDuration, dhcpmsg.OptRebindDuration,
+			dhcpmsg.OptClasslessRoutes),
 	}
 	if requestedIP != nil {
 		msgopts = append(msgopts, dhcpmsg.OptionRequestedIP(requestedIP))
@@ -17,7 +17,8 @@ var (
 	testParams     = dhcpmsg.OptionParametersList(
 		dhcpmsg.OptSubnetMask, dhcpmsg.OptRouter, dhcpmsg.OptIPAddressLeaseDuration,
 		dhcpmsg.OptServerIdentifier, dhcpmsg.OptDNS, dhcpmsg.OptDomainName,
-		dhcpmsg.OptInterfaceMTU, dhcpmsg.OptRenewalDuration, dhcpmsg.OptRebindDuration)
+		dhcpmsg.OptInterfaceMTU, dhcpmsg.OptRenewalDuration, dhcpmsg.OptRebindDuration,
+		dhcpmsg.OptClasslessRoutes)
 )
 
 type bundle struct {
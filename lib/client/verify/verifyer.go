@@ -63,7 +63,7 @@ func verifyCommon(xid uint32, m dhcpmsg.Message, opt dhcpmsg.DecodedOptions) Sta
 	if m.Xid != xid {
 		return Failed
 	}
-	if len(opt.Routers) == 0 ||
+	if (len(opt.Routers) == 0 && len(opt.ClasslessRoutes) == 0) ||
 		m.YourIP == nil ||
 		m.YourIP.Equal(net.IPv4zero) ||
 		m.YourIP.Equal(net.IPv4bcast) {
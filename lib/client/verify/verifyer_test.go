@@ -246,6 +246,23 @@ func TestVerifyOffer(t *testing.T) {
 			},
 			want: Failed,
 		},
+		{
+			name: "routes instead of routers",
+			xid:  33,
+			msg: dhcpmsg.Message{
+				Xid:    33,
+				YourIP: net.IPv4(192, 168, 1, 1),
+			},
+			opts: dhcpmsg.DecodedOptions{
+				ServerIdentifier: net.IPv4(192, 168, 9, 99),
+				ClasslessRoutes: []dhcpmsg.Route{
+					{Dest: &net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)}, Router: net.IPv4(192, 168, 0, 1)},
+				},
+				MessageType:            dhcpmsg.MsgTypeOffer,
+				IPAddressLeaseDuration: 1 * time.Minute,
+			},
+			want: Passed,
+		},
 		{
 			name: "no ip",
 			xid:  33,
@@ -0,0 +1,206 @@
+package dhcp6msg
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"time"
+)
+
+type Message struct {
+	MsgType uint8
+	Xid     uint32 // Transaction id, only the lower 24 bits are used.
+	Options []DHCP6Opt
+}
+
+type DHCP6Opt struct {
+	Option uint16
+	Data   []byte
+}
+
+// IA is an identity association for non-temporary addresses (IA_NA) or for prefix delegation (IA_PD).
+type IA struct {
+	IAID     uint32
+	T1       time.Duration // Time until the client renews.
+	T2       time.Duration // Time until the client rebinds.
+	Addrs    []IAAddr      // Addresses of an IA_NA.
+	Prefixes []IAPrefix    // Prefixes of an IA_PD.
+	Status   *Status       // Status of the IA, nil if not sent.
+}
+
+// IAAddr is an address of an IA_NA.
+type IAAddr struct {
+	IP        net.IP
+	Preferred time.Duration
+	Valid     time.Duration
+}
+
+// IAPrefix is a delegated prefix of an IA_PD.
+type IAPrefix struct {
+	Prefix    *net.IPNet
+	Preferred time.Duration
+	Valid     time.Duration
+}
+
+// Status is the content of the status code option.
+type Status struct {
+	Code    uint16
+	Message string
+}
+
+// Assemble assembles a dhcpv6 message into raw bytes.
+func (msg Message) Assemble() []byte {
+	buf := make([]byte, 4)
+	buf[0] = msg.MsgType
+	buf[1] = uint8(msg.Xid >> 16)
+	buf[2] = uint8(msg.Xid >> 8)
+	buf[3] = uint8(msg.Xid)
+	return append(buf, assembleOpts(msg.Options)...)
+}
+
+func assembleOpts(opts []DHCP6Opt) []byte {
+	var buf []byte
+	for _, opt := range opts {
+		b := make([]byte, 4+len(opt.Data))
+		setU16Int(b[0:], opt.Option)
+		setU16Int(b[2:], uint16(len(opt.Data)))
+		copy(b[4:], opt.Data)
+		buf = append(buf, b...)
+	}
+	return buf
+}
+
+func setU16Int(b []byte, val uint16) {
+	binary.BigEndian.PutUint16(b, val)
+}
+
+func setU32Int(b []byte, val uint32) {
+	binary.BigEndian.PutUint32(b, val)
+}
+
+// setSeconds encodes a duration in seconds, durations which do not fit are infinite (0xffffffff).
+func setSeconds(b []byte, d time.Duration) {
+	s := d / time.Second
+	if s < 0 {
+		s = 0
+	}
+	if s > 0xffffffff {
+		s = 0xffffffff
+	}
+	setU32Int(b, uint32(s))
+}
+
+func setIPv6(b []byte, ip net.IP) {
+	if v6 := ip.To16(); v6 != nil {
+		copy(b, v6)
+	}
+}
+
+// DuidLL returns a link-layer DUID (DUID-LL) of an ethernet hwaddr.
+func DuidLL(hwaddr net.HardwareAddr) []byte {
+	return append([]byte{0x00, 0x03, 0x00, 0x01}, hwaddr...)
+}
+
+func OptionClientID(duid []byte) DHCP6Opt {
+	return DHCP6Opt{Option: OptClientID, Data: duid}
+}
+
+func OptionServerID(duid []byte) DHCP6Opt {
+	return DHCP6Opt{Option: OptServerID, Data: duid}
+}
+
+// OptionIANA encodes an IA_NA with its addresses and status.
+func OptionIANA(ia IA) DHCP6Opt {
+	return optIA(OptIANA, ia)
+}
+
+// OptionIAPD encodes an IA_PD with its prefixes and status.
+func OptionIAPD(ia IA) DHCP6Opt {
+	return optIA(OptIAPD, ia)
+}
+
+func optIA(code uint16, ia IA) DHCP6Opt {
+	b := make([]byte, 12)
+	setU32Int(b[0:], ia.IAID)
+	setSeconds(b[4:], ia.T1)
+	setSeconds(b[8:], ia.T2)
+	var opts []DHCP6Opt
+	for _, a := range ia.Addrs {
+		data := make([]byte, 24)
+		setIPv6(data[0:], a.IP)
+		setSeconds(data[16:], a.Preferred)
+		setSeconds(data[20:], a.Valid)
+		opts = append(opts, DHCP6Opt{Option: OptIAAddr, Data: data})
+	}
+	for _, p := range ia.Prefixes {
+		data := make([]byte, 25)
+		setSeconds(data[0:], p.Preferred)
+		setSeconds(data[4:], p.Valid)
+		ones, _ := p.Prefix.Mask.Size()
+		data[8] = uint8(ones)
+		setIPv6(data[9:], p.Prefix.IP)
+		opts = append(opts, DHCP6Opt{Option: OptIAPrefix, Data: data})
+	}
+	if ia.Status != nil {
+		opts = append(opts, OptionStatusCode(ia.Status.Code, ia.Status.Message))
+	}
+	return DHCP6Opt{Option: code, Data: append(b, assembleOpts(opts)...)}
+}
+
+// OptionORO encodes the option request option, listing the options wanted by a client.
+func OptionORO(codes ...uint16) DHCP6Opt {
+	b := make([]byte, 2*len(codes))
+	for i, c := range codes {
+		setU16Int(b[2*i:], c)
+	}
+	return DHCP6Opt{Option: OptORO, Data: b}
+}
+
+func OptionPreference(p uint8) DHCP6Opt {
+	return DHCP6Opt{Option: OptPreference, Data: []byte{p}}
+}
+
+// OptionElapsedTime encodes the time since the client started the current exchange, in 1/100 seconds.
+func OptionElapsedTime(d time.Duration) DHCP6Opt {
+	cs := d / (10 * time.Millisecond)
+	if cs > 0xffff {
+		cs = 0xffff
+	}
+	b := make([]byte, 2)
+	setU16Int(b, uint16(cs))
+	return DHCP6Opt{Option: OptElapsedTime, Data: b}
+}
+
+func OptionStatusCode(code uint16, msg string) DHCP6Opt {
+	b := make([]byte, 2)
+	setU16Int(b, code)
+	return DHCP6Opt{Option: OptStatusCode, Data: append(b, []byte(msg)...)}
+}
+
+func OptionRapidCommit() DHCP6Opt {
+	return DHCP6Opt{Option: OptRapidCommit, Data: []byte{}}
+}
+
+func OptionDNS(ip ...net.IP) DHCP6Opt {
+	b := make([]byte, 16*len(ip))
+	for i, x := range ip {
+		setIPv6(b[16*i:], x)
+	}
+	return DHCP6Opt{Option: OptDNS, Data: b}
+}
+
+// OptionDomainList encodes a domain search list, in uncompressed DNS wire format.
+func OptionDomainList(names ...string) DHCP6Opt {
+	var b []byte
+	for _, n := range names {
+		for _, label := range strings.Split(strings.Trim(n, "."), ".") {
+			if label == "" || len(label) > 63 {
+				continue
+			}
+			b = append(b, uint8(len(label)))
+			b = append(b, label...)
+		}
+		b = append(b, 0)
+	}
+	return DHCP6Opt{Option: OptDomainList, Data: b}
+}
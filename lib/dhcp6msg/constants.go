@@ -0,0 +1,55 @@
+package dhcp6msg
+
+// Ports of DHCPv6 clients and servers.
+const (
+	PortClient = 546
+	PortServer = 547
+)
+
+// AllServers is the All_DHCP_Relay_Agents_and_Servers multicast address, clients send all messages to it.
+const AllServers = "ff02::1:2"
+
+const (
+	MsgTypeSolicit            = 1
+	MsgTypeAdvertise          = 2
+	MsgTypeRequest            = 3
+	MsgTypeConfirm            = 4
+	MsgTypeRenew              = 5
+	MsgTypeRebind             = 6
+	MsgTypeReply              = 7
+	MsgTypeRelease            = 8
+	MsgTypeDecline            = 9
+	MsgTypeReconfigure        = 10
+	MsgTypeInformationRequest = 11
+	MsgTypeRelayForw          = 12
+	MsgTypeRelayRepl          = 13
+)
+
+const (
+	OptClientID    = 1
+	OptServerID    = 2
+	OptIANA        = 3
+	OptIATA        = 4
+	OptIAAddr      = 5
+	OptORO         = 6
+	OptPreference  = 7
+	OptElapsedTime = 8
+	OptRelayMsg    = 9
+	OptStatusCode  = 13
+	OptRapidCommit = 14
+	OptDNS         = 23
+	OptDomainList  = 24
+	OptIAPD        = 25
+	OptIAPrefix    = 26
+)
+
+// Status codes of the status code option.
+const (
+	StatusSuccess       = 0
+	StatusUnspecFail    = 1
+	StatusNoAddrsAvail  = 2
+	StatusNoBinding     = 3
+	StatusNotOnLink     = 4
+	StatusUseMulticast  = 5
+	StatusNoPrefixAvail = 6
+)
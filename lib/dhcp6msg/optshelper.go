@@ -0,0 +1,165 @@
+package dhcp6msg
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"time"
+)
+
+type DecodedOptions struct {
+	ClientID    []byte
+	ServerID    []byte
+	IANA        []IA
+	IAPD        []IA
+	ORO         []uint16
+	Preference  uint8
+	ElapsedTime time.Duration
+	Status      *Status // Status of the message, nil if not sent.
+	RapidCommit bool
+	DNS         []net.IP
+	DomainList  []string
+}
+
+func DecodeOptions(opts []DHCP6Opt) DecodedOptions {
+	d := DecodedOptions{}
+	for _, o := range opts {
+		switch o.Option {
+		case OptClientID:
+			d.ClientID = o.Data
+		case OptServerID:
+			d.ServerID = o.Data
+		case OptIANA:
+			if ia, ok := toIA(o.Data); ok {
+				d.IANA = append(d.IANA, ia)
+			}
+		case OptIAPD:
+			if ia, ok := toIA(o.Data); ok {
+				d.IAPD = append(d.IAPD, ia)
+			}
+		case OptORO:
+			d.ORO = toUint16A(o.Data)
+		case OptPreference:
+			if len(o.Data) == 1 {
+				d.Preference = o.Data[0]
+			}
+		case OptElapsedTime:
+			if len(o.Data) == 2 {
+				d.ElapsedTime = time.Duration(binary.BigEndian.Uint16(o.Data)) * 10 * time.Millisecond
+			}
+		case OptStatusCode:
+			d.Status = toStatus(o.Data)
+		case OptRapidCommit:
+			d.RapidCommit = true
+		case OptDNS:
+			d.DNS = toV6A(o.Data)
+		case OptDomainList:
+			d.DomainList = toDomainList(o.Data)
+		}
+	}
+	return d
+}
+
+// toIA decodes an IA_NA or IA_PD with its addresses, prefixes and status. Malformed
+// addresses and prefixes are skipped, false is returned if the IA itself is malformed.
+func toIA(x []byte) (IA, bool) {
+	if len(x) < 12 {
+		return IA{}, false
+	}
+	ia := IA{
+		IAID: binary.BigEndian.Uint32(x[0:]),
+		T1:   toDuration(x[4:8]),
+		T2:   toDuration(x[8:12]),
+	}
+	opts, err := decodeOpts(x[12:])
+	if err != nil {
+		return IA{}, false
+	}
+	for _, o := range opts {
+		switch o.Option {
+		case OptIAAddr:
+			if len(o.Data) >= 24 {
+				ia.Addrs = append(ia.Addrs, IAAddr{
+					IP:        toV6(o.Data[0:16]),
+					Preferred: toDuration(o.Data[16:20]),
+					Valid:     toDuration(o.Data[20:24]),
+				})
+			}
+		case OptIAPrefix:
+			if len(o.Data) >= 25 && o.Data[8] <= 128 {
+				mask := net.CIDRMask(int(o.Data[8]), 128)
+				ia.Prefixes = append(ia.Prefixes, IAPrefix{
+					Prefix:    &net.IPNet{IP: toV6(o.Data[9:25]).Mask(mask), Mask: mask},
+					Preferred: toDuration(o.Data[0:4]),
+					Valid:     toDuration(o.Data[4:8]),
+				})
+			}
+		case OptStatusCode:
+			ia.Status = toStatus(o.Data)
+		}
+	}
+	return ia, true
+}
+
+func toStatus(x []byte) *Status {
+	if len(x) < 2 {
+		return nil
+	}
+	return &Status{Code: binary.BigEndian.Uint16(x), Message: string(x[2:])}
+}
+
+// toDomainList decodes domain names in uncompressed DNS wire format, returning nil if they are malformed.
+func toDomainList(x []byte) []string {
+	var v []string
+	var labels []string
+	for i := 0; i < len(x); {
+		l := int(x[i])
+		i++
+		if l == 0 {
+			v = append(v, strings.Join(labels, "."))
+			labels = nil
+			continue
+		}
+		if l > 63 || i+l > len(x) {
+			return nil
+		}
+		labels = append(labels, string(x[i:i+l]))
+		i += l
+	}
+	if len(labels) > 0 {
+		return nil
+	}
+	return v
+}
+
+func toDuration(x []byte) time.Duration {
+	return time.Second * time.Duration(binary.BigEndian.Uint32(x))
+}
+
+// toUint16A returns an uint16 array.
+func toUint16A(x []byte) []uint16 {
+	var v []uint16
+	if len(x)%2 == 0 {
+		for i := 0; i < len(x); i += 2 {
+			v = append(v, binary.BigEndian.Uint16(x[i:]))
+		}
+	}
+	return v
+}
+
+func toV6(x []byte) net.IP {
+	ip := make(net.IP, 16)
+	copy(ip, x)
+	return ip
+}
+
+// toV6A returns a net.IP array.
+func toV6A(x []byte) []net.IP {
+	var v []net.IP
+	if len(x)%16 == 0 {
+		for i := 0; i < len(x); i += 16 {
+			v = append(v, toV6(x[i:i+16]))
+		}
+	}
+	return v
+}
@@ -0,0 +1,103 @@
+package dhcp6msg
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDecodeOptions(t *testing.T) {
+	_, prefix, _ := net.ParseCIDR("2001:db8:100::/56")
+	input := []struct {
+		name string
+		data []DHCP6Opt
+		want DecodedOptions
+	}{
+		{
+			name: "empty",
+			want: DecodedOptions{},
+		}, {
+			name: "ids",
+			data: []DHCP6Opt{
+				OptionClientID(DuidLL(net.HardwareAddr{2, 0, 0, 0, 0, 1})),
+				OptionServerID([]byte{0, 2, 0xaa}),
+			},
+			want: DecodedOptions{
+				ClientID: []byte{0, 3, 0, 1, 2, 0, 0, 0, 0, 1},
+				ServerID: []byte{0, 2, 0xaa},
+			},
+		}, {
+			name: "ias",
+			data: []DHCP6Opt{
+				OptionIANA(IA{
+					IAID:  1,
+					T1:    time.Hour,
+					T2:    2 * time.Hour,
+					Addrs: []IAAddr{{IP: net.ParseIP("2001:db8::1"), Preferred: time.Hour, Valid: 4 * time.Hour}},
+				}),
+				OptionIAPD(IA{
+					IAID:     2,
+					Prefixes: []IAPrefix{{Prefix: prefix, Preferred: time.Minute, Valid: 1 << 33 * time.Second}},
+				}),
+				OptionIAPD(IA{IAID: 3, Status: &Status{Code: StatusNoPrefixAvail, Message: "none left"}}),
+				{Option: OptIANA, Data: []byte{0, 0, 0, 1}},
+			},
+			want: DecodedOptions{
+				IANA: []IA{{
+					IAID:  1,
+					T1:    time.Hour,
+					T2:    2 * time.Hour,
+					Addrs: []IAAddr{{IP: net.ParseIP("2001:db8::1"), Preferred: time.Hour, Valid: 4 * time.Hour}},
+				}},
+				IAPD: []IA{
+					{IAID: 2, Prefixes: []IAPrefix{{Prefix: prefix, Preferred: time.Minute, Valid: 0xffffffff * time.Second}}},
+					{IAID: 3, Status: &Status{Code: StatusNoPrefixAvail, Message: "none left"}},
+				},
+			},
+		}, {
+			name: "misc",
+			data: []DHCP6Opt{
+				OptionORO(OptDNS, OptDomainList),
+				OptionPreference(255),
+				OptionElapsedTime(1500 * time.Millisecond),
+				OptionStatusCode(StatusUseMulticast, "multicast please"),
+				OptionRapidCommit(),
+			},
+			want: DecodedOptions{
+				ORO:         []uint16{OptDNS, OptDomainList},
+				Preference:  255,
+				ElapsedTime: 1500 * time.Millisecond,
+				Status:      &Status{Code: StatusUseMulticast, Message: "multicast please"},
+				RapidCommit: true,
+			},
+		}, {
+			name: "dns",
+			data: []DHCP6Opt{
+				OptionDNS(net.ParseIP("2001:db8::53"), net.ParseIP("2001:db8::54")),
+				OptionDomainList("example.com.", "lan"),
+			},
+			want: DecodedOptions{
+				DNS:        []net.IP{net.ParseIP("2001:db8::53"), net.ParseIP("2001:db8::54")},
+				DomainList: []string{"example.com", "lan"},
+			},
+		}, {
+			name: "malformed domain list",
+			data: []DHCP6Opt{{Option: OptDomainList, Data: []byte{3, 'l', 'a'}}},
+			want: DecodedOptions{},
+		},
+	}
+
+	for _, test := range input {
+		// Options must survive a round trip through the wire format.
+		msg, err := Decode(Message{MsgType: MsgTypeReply, Options: test.data}.Assemble())
+		if err != nil {
+			t.Errorf("Decode(%s) = %v, wanted nil err", test.name, err)
+			continue
+		}
+		if diff := cmp.Diff(test.want, DecodeOptions(msg.Options)); diff != "" {
+			t.Errorf("DecodeOptions(%s) had a diff: %s", test.name, diff)
+		}
+	}
+}
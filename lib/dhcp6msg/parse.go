@@ -0,0 +1,47 @@
+package dhcp6msg
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	dhcp6MinLen = 4
+)
+
+// Decode decodes a client/server message, relay messages are not supported.
+func Decode(b []byte) (*Message, error) {
+	if len(b) < dhcp6MinLen {
+		return nil, fmt.Errorf("short dhcp6msg")
+	}
+	if b[0] == MsgTypeRelayForw || b[0] == MsgTypeRelayRepl {
+		return nil, fmt.Errorf("relay messages are not supported")
+	}
+	opts, err := decodeOpts(b[4:])
+	if err != nil {
+		return nil, err
+	}
+	return &Message{
+		MsgType: b[0],
+		Xid:     uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3]),
+		Options: opts,
+	}, nil
+}
+
+// decodeOpts decodes a list of options, options of IAs use the same encoding.
+func decodeOpts(b []byte) ([]DHCP6Opt, error) {
+	var opts []DHCP6Opt
+	for c := 0; c < len(b); {
+		if c+4 > len(b) {
+			return nil, fmt.Errorf("truncated option header")
+		}
+		code := binary.BigEndian.Uint16(b[c:])
+		olen := int(binary.BigEndian.Uint16(b[c+2:]))
+		if c += 4; c+olen > len(b) {
+			return nil, fmt.Errorf("truncated option %d", code)
+		}
+		opts = append(opts, DHCP6Opt{Option: code, Data: b[c : c+olen]})
+		c += olen
+	}
+	return opts, nil
+}
@@ -0,0 +1,73 @@
+package dhcp6msg
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDecodeMessage(t *testing.T) {
+	input := []struct {
+		name string
+		data []byte
+		fail bool
+		want *Message
+	}{
+		{
+			name: "empty",
+			data: []byte{},
+			fail: true,
+		}, {
+			name: "no options",
+			data: []byte{0x01, 0x12, 0x34, 0x56},
+			want: &Message{MsgType: MsgTypeSolicit, Xid: 0x123456},
+		}, {
+			name: "options",
+			data: []byte{
+				0x07, 0x00, 0x00, 0x01,
+				0x00, 0x01, 0x00, 0x03, 0xaa, 0xbb, 0xcc,
+				0x00, 0x0e, 0x00, 0x00,
+			},
+			want: &Message{
+				MsgType: MsgTypeReply,
+				Xid:     1,
+				Options: []DHCP6Opt{
+					{Option: OptClientID, Data: []byte{0xaa, 0xbb, 0xcc}},
+					{Option: OptRapidCommit, Data: []byte{}},
+				},
+			},
+		}, {
+			name: "truncated option",
+			data: []byte{0x07, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0x03, 0xaa},
+			fail: true,
+		}, {
+			name: "truncated header",
+			data: []byte{0x07, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00},
+			fail: true,
+		}, {
+			name: "relay",
+			data: []byte{0x0c, 0x00, 0x00, 0x01},
+			fail: true,
+		},
+	}
+
+	for _, test := range input {
+		got, err := Decode(test.data)
+		if test.fail {
+			if err == nil {
+				t.Errorf("Decode(%s) wanted err, got nil err", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Decode(%s) = %v, wanted nil err", test.name, err)
+			continue
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("Decode(%s) had a diff: %s", test.name, diff)
+		}
+		if diff := cmp.Diff(test.data, got.Assemble()); diff != "" {
+			t.Errorf("Assemble(%s) had a diff: %s", test.name, diff)
+		}
+	}
+}
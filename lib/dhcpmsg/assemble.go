@@ -30,6 +30,18 @@ type DHCPOpt struct {
 	Data   []byte
 }
 
+// Route is a classless static route (RFC 3442).
+type Route struct {
+	Dest   *net.IPNet
+	Router net.IP
+}
+
+// SubOpt is a sub-option of the relay agent information option (RFC 3046).
+type SubOpt struct {
+	Code uint8
+	Data []byte
+}
+
 // Assemble assembles a dhcp message into raw bytes.
 func (msg Message) Assemble() []byte {
 	buf := make([]byte, 240)
@@ -89,6 +101,18 @@ func OptionDomainName(n string) DHCPOpt {
 	return DHCPOpt{Option: OptDomainName, Data: []byte(n)}
 }
 
+func OptionVendorClass(n string) DHCPOpt {
+	return DHCPOpt{Option: OptVendorClass, Data: []byte(n)}
+}
+
+func OptionTFTPServerName(n string) DHCPOpt {
+	return DHCPOpt{Option: OptTFTPServerName, Data: []byte(n)}
+}
+
+func OptionBootFileName(n string) DHCPOpt {
+	return DHCPOpt{Option: OptBootFileName, Data: []byte(n)}
+}
+
 func OptionServerIdentifier(ip net.IP) DHCPOpt {
 	return optIP(OptServerIdentifier, ip)
 }
@@ -109,6 +133,38 @@ func OptionNTP(ip ...net.IP) DHCPOpt {
 	return optIP(OptNTP, ip...)
 }
 
+// OptionClasslessRoutes encodes routes as described in RFC 3442: the prefix length, the significant
+// octets of the destination and the router of each route.
+func OptionClasslessRoutes(routes ...Route) DHCPOpt {
+	var b []byte
+	for _, r := range routes {
+		ones, _ := r.Dest.Mask.Size()
+		dest := make([]byte, 4)
+		setIPv4(dest, r.Dest.IP)
+		router := make([]byte, 4)
+		setIPv4(router, r.Router)
+		b = append(b, uint8(ones))
+		b = append(b, dest[:(ones+7)/8]...)
+		b = append(b, router...)
+	}
+	return DHCPOpt{Option: OptClasslessRoutes, Data: b}
+}
+
+// OptionMSClasslessRoutes encodes routes like OptionClasslessRoutes, using the option code of older Windows clients.
+func OptionMSClasslessRoutes(routes ...Route) DHCPOpt {
+	return DHCPOpt{Option: OptMSClasslessRoutes, Data: OptionClasslessRoutes(routes...).Data}
+}
+
+// OptionRelayAgentInfo encodes the relay agent information option (RFC 3046) with the given sub-options.
+func OptionRelayAgentInfo(subs ...SubOpt) DHCPOpt {
+	var b []byte
+	for _, so := range subs {
+		b = append(b, so.Code, uint8(len(so.Data)))
+		b = append(b, so.Data...)
+	}
+	return DHCPOpt{Option: OptRelayAgentInfo, Data: b}
+}
+
 func optIP(ot uint8, ip ...net.IP) DHCPOpt {
 	b := make([]byte, 4*len(ip))
 	for i, x := range ip {
@@ -119,6 +175,10 @@ func optIP(ot uint8, ip ...net.IP) DHCPOpt {
 	return DHCPOpt{Option: ot, Data: b}
 }
 
+func OptionAssociatedIP(ip ...net.IP) DHCPOpt {
+	return optIP(OptAssociatedIP, ip...)
+}
+
 func OptionMaxMessageSize(size uint16) DHCPOpt {
 	data := make([]byte, 2)
 	setU16Int(data, size)
@@ -159,6 +219,13 @@ func OptionIPAddressLeaseDuration(d time.Duration) DHCPOpt {
 	return DHCPOpt{Option: OptIPAddressLeaseDuration, Data: b}
 }
 
+// OptionClientLastTransaction encodes the time since the last transaction of a client (RFC 4388).
+func OptionClientLastTransaction(d time.Duration) DHCPOpt {
+	b := make([]byte, 4)
+	setU32Int(b, uint32(d.Seconds()))
+	return DHCPOpt{Option: OptClientLastTransaction, Data: b}
+}
+
 func OptionSubnetMask(mask net.IPMask) DHCPOpt {
 	return DHCPOpt{Option: OptSubnetMask, Data: mask}
 }
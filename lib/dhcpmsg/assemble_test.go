@@ -105,3 +105,36 @@ func TestAssemble(t *testing.T) {
 		}
 	}
 }
+
+func TestOptionClasslessRoutes(t *testing.T) {
+	_, n1, _ := net.ParseCIDR("10.0.0.0/8")
+	_, n2, _ := net.ParseCIDR("192.168.128.0/17")
+	_, n3, _ := net.ParseCIDR("0.0.0.0/0")
+	got := OptionClasslessRoutes(
+		Route{Dest: n1, Router: net.IPv4(192, 168, 1, 1)},
+		Route{Dest: n2, Router: net.IPv4(192, 168, 1, 2)},
+		Route{Dest: n3, Router: net.IPv4(192, 168, 1, 3)},
+	)
+	want := DHCPOpt{Option: OptClasslessRoutes, Data: []byte{
+		8, 10, 192, 168, 1, 1,
+		17, 192, 168, 128, 192, 168, 1, 2,
+		0, 192, 168, 1, 3,
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("OptionClasslessRoutes had a diff: %s", diff)
+	}
+}
+
+func TestOptionRelayAgentInfo(t *testing.T) {
+	got := OptionRelayAgentInfo(
+		SubOpt{Code: SubOptCircuitID, Data: []byte("p12")},
+		SubOpt{Code: SubOptRemoteID, Data: []byte{0xaa, 0xbb}},
+	)
+	want := DHCPOpt{Option: OptRelayAgentInfo, Data: []byte{1, 3, 'p', '1', '2', 2, 2, 0xaa, 0xbb}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("OptionRelayAgentInfo had a diff: %s", diff)
+	}
+	if diff := cmp.Diff(toRelayAgentInfo(got.Data).CircuitID, []byte("p12")); diff != "" {
+		t.Errorf("toRelayAgentInfo(OptionRelayAgentInfo) had a diff: %s", diff)
+	}
+}
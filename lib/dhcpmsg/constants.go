@@ -1,5 +1,7 @@
 package dhcpmsg
 
+import "fmt"
+
 const (
 	OpRequest = 1
 	OpReply   = 2
@@ -21,10 +23,42 @@ const (
 	MsgTypeDiscover = 1
 	MsgTypeOffer    = 2
 	MsgTypeRequest  = 3
+	MsgTypeDecline  = 4
 	MsgTypeAck      = 5
 	MsgTypeNack     = 6
+	MsgTypeRelease  = 7
+	MsgTypeInform   = 8
+	// Leasequery (RFC 4388).
+	MsgTypeLeaseQuery      = 10
+	MsgTypeLeaseUnassigned = 11
+	MsgTypeLeaseUnknown    = 12
+	MsgTypeLeaseActive     = 13
 )
 
+// msgTypeNames maps message types to their lowercase name, as used in metrics and logs.
+var msgTypeNames = map[uint8]string{
+	MsgTypeDiscover:        "discover",
+	MsgTypeOffer:           "offer",
+	MsgTypeRequest:         "request",
+	MsgTypeDecline:         "decline",
+	MsgTypeAck:             "ack",
+	MsgTypeNack:            "nak",
+	MsgTypeRelease:         "release",
+	MsgTypeInform:          "inform",
+	MsgTypeLeaseQuery:      "leasequery",
+	MsgTypeLeaseUnassigned: "leaseunassigned",
+	MsgTypeLeaseUnknown:    "leaseunknown",
+	MsgTypeLeaseActive:     "leaseactive",
+}
+
+// MsgTypeName returns the name of a message type, eg. 'discover'.
+func MsgTypeName(t uint8) string {
+	if n, ok := msgTypeNames[t]; ok {
+		return n
+	}
+	return fmt.Sprintf("unknown_%d", t)
+}
+
 const (
 	OptPadding                = 0
 	OptSubnetMask             = 1
@@ -44,6 +78,22 @@ const (
 	OptMaxMessageSize         = 57
 	OptRenewalDuration        = 58
 	OptRebindDuration         = 59
+	OptVendorClass            = 60
 	OptClientIdentifier       = 61
+	OptTFTPServerName         = 66
+	OptBootFileName           = 67
+	OptUserClass              = 77
+	OptRelayAgentInfo         = 82
+	OptClientLastTransaction  = 91
+	OptAssociatedIP           = 92
+	OptClientArch             = 93
+	OptClasslessRoutes        = 121
+	OptMSClasslessRoutes      = 249
 	OptEnd                    = 255
 )
+
+// Sub-options of the relay agent information option (RFC 3046).
+const (
+	SubOptCircuitID = 1
+	SubOptRemoteID  = 2
+)
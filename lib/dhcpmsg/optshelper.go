@@ -20,9 +20,24 @@ type DecodedOptions struct {
 	RenewalDuration        time.Duration
 	RebindDuration         time.Duration
 	DomainName             string
+	Hostname               string
 	ClientIdentifier       []byte
 	Message                string
 	ParametersList         []uint8
+	VendorClass            string
+	UserClass              string
+	ClientArch             []uint16
+	ClasslessRoutes        []Route
+	RelayAgentInfo         *RelayAgentInfo
+	ClientLastTransaction  time.Duration
+	AssociatedIPs          []net.IP
+}
+
+// RelayAgentInfo is the relay agent information option (RFC 3046) inserted by relay agents.
+type RelayAgentInfo struct {
+	CircuitID []byte   // Circuit the request was received on, nil if not sent.
+	RemoteID  []byte   // Identifies the remote host end of the circuit, nil if not sent.
+	SubOpts   []SubOpt // All sub-options, in order.
 }
 
 func DecodeOptions(opts []DHCPOpt) DecodedOptions {
@@ -37,6 +52,8 @@ func DecodeOptions(opts []DHCPOpt) DecodedOptions {
 			d.DNS = toV4A(o.Data)
 		case OptDomainName:
 			d.DomainName = toString(o.Data)
+		case OptHostname:
+			d.Hostname = toString(o.Data)
 		case OptBroadcastAddress:
 			d.BroadcastAddress = toV4(o.Data)
 		case OptRequestedIP:
@@ -61,7 +78,20 @@ func DecodeOptions(opts []DHCPOpt) DecodedOptions {
 			d.ClientIdentifier = o.Data
 		case OptParametersList:
 			d.ParametersList = o.Data
-
+		case OptVendorClass:
+			d.VendorClass = toString(o.Data)
+		case OptUserClass:
+			d.UserClass = toString(o.Data)
+		case OptClientArch:
+			d.ClientArch = toUint16A(o.Data)
+		case OptClasslessRoutes:
+			d.ClasslessRoutes = toRoutes(o.Data)
+		case OptClientLastTransaction:
+			d.ClientLastTransaction = toDuration(o.Data)
+		case OptAssociatedIP:
+			d.AssociatedIPs = toV4A(o.Data)
+		case OptRelayAgentInfo:
+			d.RelayAgentInfo = toRelayAgentInfo(o.Data)
 		}
 	}
 	return d
@@ -81,6 +111,59 @@ func toUint16(x []byte) (v uint16) {
 	return
 }
 
+// toUint16A returns an uint16 array.
+func toUint16A(x []byte) []uint16 {
+	var v []uint16
+	if len(x)%2 == 0 {
+		for i := 0; i < len(x); i += 2 {
+			v = append(v, toUint16(x[i:i+2]))
+		}
+	}
+	return v
+}
+
+// toRoutes decodes classless static routes (RFC 3442), returning nil if they are malformed.
+func toRoutes(x []byte) []Route {
+	var v []Route
+	for i := 0; i < len(x); {
+		ones := int(x[i])
+		n := (ones + 7) / 8
+		if ones > 32 || i+1+n+4 > len(x) {
+			return nil
+		}
+		dest := make(net.IP, 4)
+		copy(dest, x[i+1:i+1+n])
+		mask := net.CIDRMask(ones, 32)
+		v = append(v, Route{
+			Dest:   &net.IPNet{IP: dest.Mask(mask), Mask: mask},
+			Router: toV4(x[i+1+n : i+1+n+4]),
+		})
+		i += 1 + n + 4
+	}
+	return v
+}
+
+// toRelayAgentInfo decodes the sub-options of the relay agent information option, returning nil if they
+// are malformed.
+func toRelayAgentInfo(x []byte) *RelayAgentInfo {
+	v := &RelayAgentInfo{}
+	for i := 0; i < len(x); {
+		if i+2 > len(x) || i+2+int(x[i+1]) > len(x) {
+			return nil
+		}
+		so := SubOpt{Code: x[i], Data: x[i+2 : i+2+int(x[i+1])]}
+		switch so.Code {
+		case SubOptCircuitID:
+			v.CircuitID = so.Data
+		case SubOptRemoteID:
+			v.RemoteID = so.Data
+		}
+		v.SubOpts = append(v.SubOpts, so)
+		i += 2 + len(so.Data)
+	}
+	return v
+}
+
 func toDuration(x []byte) (d time.Duration) {
 	if len(x) == 4 {
 		d = time.Second * time.Duration(binary.BigEndian.Uint32(x))
@@ -61,14 +61,84 @@ func TestDecodeOptions(t *testing.T) {
 			name: "strings",
 			data: []DHCPOpt{
 				{Option: OptDomainName, Data: []byte{'f', 'o', 'o'}},
+				{Option: OptHostname, Data: []byte{'b', 'a', 'r'}},
 				{Option: OptMessage, Data: []byte{'x', 'x', 'y', 'y', 'z', 'z'}},
 				{Option: OptClientIdentifier, Data: []byte{'a', 'b', 'c', 'd'}},
 			},
 			want: DecodedOptions{
 				DomainName:       "foo",
+				Hostname:         "bar",
 				Message:          "xxyyzz",
 				ClientIdentifier: []byte("abcd"),
 			},
+		}, {
+			name: "netboot",
+			data: []DHCPOpt{
+				{Option: OptVendorClass, Data: []byte("PXEClient:Arch:00007:UNDI:003016")},
+				{Option: OptUserClass, Data: []byte("iPXE")},
+				{Option: OptClientArch, Data: []byte{0x00, 0x07, 0x00, 0x10}},
+			},
+			want: DecodedOptions{
+				VendorClass: "PXEClient:Arch:00007:UNDI:003016",
+				UserClass:   "iPXE",
+				ClientArch:  []uint16{7, 16},
+			},
+		}, {
+			name: "routes",
+			data: []DHCPOpt{
+				{Option: OptClasslessRoutes, Data: []byte{8, 10, 192, 168, 1, 1, 0, 192, 168, 1, 2, 25, 192, 168, 2, 128, 0, 0, 0, 0}},
+			},
+			want: DecodedOptions{
+				ClasslessRoutes: []Route{
+					{Dest: &net.IPNet{IP: net.IP{10, 0, 0, 0}, Mask: net.CIDRMask(8, 32)}, Router: net.IPv4(192, 168, 1, 1)},
+					{Dest: &net.IPNet{IP: net.IP{0, 0, 0, 0}, Mask: net.CIDRMask(0, 32)}, Router: net.IPv4(192, 168, 1, 2)},
+					{Dest: &net.IPNet{IP: net.IP{192, 168, 2, 128}, Mask: net.CIDRMask(25, 32)}, Router: net.IPv4(0, 0, 0, 0)},
+				},
+			},
+		}, {
+			name: "truncated routes",
+			data: []DHCPOpt{
+				{Option: OptClasslessRoutes, Data: []byte{8, 10, 192, 168, 1, 1, 24, 10, 0}},
+			},
+			want: DecodedOptions{},
+		}, {
+			name: "relay agent info",
+			data: []DHCPOpt{
+				{Option: OptRelayAgentInfo, Data: []byte{1, 3, 'p', '1', '2', 9, 0, 2, 2, 0xaa, 0xbb}},
+			},
+			want: DecodedOptions{
+				RelayAgentInfo: &RelayAgentInfo{
+					CircuitID: []byte("p12"),
+					RemoteID:  []byte{0xaa, 0xbb},
+					SubOpts: []SubOpt{
+						{Code: SubOptCircuitID, Data: []byte("p12")},
+						{Code: 9, Data: []byte{}},
+						{Code: SubOptRemoteID, Data: []byte{0xaa, 0xbb}},
+					},
+				},
+			},
+		}, {
+			name: "truncated relay agent info",
+			data: []DHCPOpt{
+				{Option: OptRelayAgentInfo, Data: []byte{1, 3, 'p', '1'}},
+			},
+			want: DecodedOptions{},
+		}, {
+			name: "leasequery",
+			data: []DHCPOpt{
+				OptionClientLastTransaction(90 * time.Second),
+				OptionAssociatedIP(net.IPv4(192, 168, 1, 9), net.IPv4(192, 168, 2, 9)),
+			},
+			want: DecodedOptions{
+				ClientLastTransaction: 90 * time.Second,
+				AssociatedIPs:         []net.IP{net.IPv4(192, 168, 1, 9), net.IPv4(192, 168, 2, 9)},
+			},
+		}, {
+			name: "bad arch",
+			data: []DHCPOpt{
+				{Option: OptClientArch, Data: []byte{0x00, 0x07, 0x00}},
+			},
+			want: DecodedOptions{},
 		}, {
 			name: "time",
 			data: []DHCPOpt{
@@ -11,6 +11,7 @@ import (
 type Ifconfig struct {
 	Interface     *net.Interface
 	Router        net.IP
+	Routes        []Route
 	IP            net.IP
 	MTU           int
 	DNS           []net.IP
@@ -19,6 +20,26 @@ type Ifconfig struct {
 	LeaseDuration time.Duration
 }
 
+// Ifconfig6 is the DHCPv6 configuration of an interface.
+type Ifconfig6 struct {
+	Interface *net.Interface
+	IP        net.IP        // Assigned address, configured as /128: the on-link prefix is announced by routers.
+	Preferred time.Duration // Preferred lifetime of IP.
+	Valid     time.Duration // Valid lifetime of IP.
+	DNS       []net.IP
+	Domains   []string     // Domain search list.
+	Prefixes  []*net.IPNet // Delegated prefixes, these are not configured on any interface.
+}
+
+// Route is a static route, a router of 0.0.0.0 means that the destination is directly reachable.
+type Route struct {
+	Dest   *net.IPNet
+	Router net.IP
+}
+
+// routeProtocol marks routes installed by us (RTPROT_DHCP), so they can be found and removed later on.
+const routeProtocol = 16
+
 // Down attempts to bring an interface down.
 func Down(iface *net.Interface) error {
 	link, err := setupNL(iface)
@@ -68,7 +89,7 @@ func Unconfigure(iface *net.Interface) error {
 			return err
 		}
 	}
-	return nil
+	return setRoutes(iface, nil)
 }
 
 func InterfaceAddr(iface *net.Interface) (net.IP, error) {
@@ -129,6 +150,12 @@ func SetIface(c Ifconfig) error {
 		return err
 	}
 
+	// Our own routes go first: this removes an on-link default route we added before, which
+	// would collide with the default route via c.Router.
+	if err := setRoutes(c.Interface, c.Routes); err != nil {
+		return err
+	}
+
 	oldRoute, err := defaultRoute(c.Interface)
 	if err != nil {
 		return err
@@ -162,6 +189,82 @@ func SetIface(c Ifconfig) error {
 	return nil
 }
 
+// SetIface6 adds or updates the address of a DHCPv6 configuration.
+func SetIface6(c Ifconfig6) error {
+	link, err := setupNL(c.Interface)
+	if err != nil {
+		return err
+	}
+
+	addr := &netlink.Addr{
+		IPNet: &net.IPNet{
+			IP:   c.IP,
+			Mask: net.CIDRMask(128, 128),
+		},
+		PreferedLft: int(c.Preferred.Seconds()),
+		ValidLft:    int(c.Valid.Seconds()),
+	}
+	return netlink.AddrReplace(link, addr)
+}
+
+// Unconfigure6 removes the address of a DHCPv6 configuration.
+func Unconfigure6(c Ifconfig6) error {
+	link, err := setupNL(c.Interface)
+	if err != nil {
+		return err
+	}
+
+	return netlink.AddrDel(link, &netlink.Addr{IPNet: &net.IPNet{IP: c.IP, Mask: net.CIDRMask(128, 128)}})
+}
+
+// setRoutes installs the given static routes and removes all other routes previously installed by us.
+func setRoutes(iface *net.Interface, routes []Route) error {
+	link, err := setupNL(iface)
+	if err != nil {
+		return err
+	}
+
+	existing, err := netlink.RouteList(link, netlink.FAMILY_V4)
+	if err != nil {
+		return err
+	}
+
+	wanted := make(map[string]bool)
+	for _, r := range routes {
+		nr := &netlink.Route{
+			LinkIndex: iface.Index,
+			Dst:       r.Dest,
+			Protocol:  routeProtocol,
+		}
+		if r.Router == nil || r.Router.Equal(net.IPv4zero) {
+			nr.Scope = netlink.SCOPE_LINK
+		} else {
+			nr.Gw = r.Router
+		}
+		if err := netlink.RouteReplace(nr); err != nil {
+			return fmt.Errorf("failed to add route to %s via %s: %v", r.Dest, r.Router, err)
+		}
+		wanted[r.Dest.String()] = true
+	}
+
+	for _, r := range existing {
+		if r.Protocol == routeProtocol && !wanted[routeDest(r)] {
+			if err := netlink.RouteDel(&r); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// routeDest returns the destination of a route, netlink reports the default route without one.
+func routeDest(r netlink.Route) string {
+	if r.Dst == nil {
+		return "0.0.0.0/0"
+	}
+	return r.Dst.String()
+}
+
 func setupNL(iface *net.Interface) (netlink.Link, error) {
 	return netlink.LinkByIndex(iface.Index)
 }
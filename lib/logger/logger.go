@@ -0,0 +1,216 @@
+// Package logger implements a leveled logger writing either plain text lines, compatible with the
+// output of the standard library logger, or one JSON object per message.
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+func (lv Level) String() string {
+	if n, ok := levelNames[lv]; ok {
+		return n
+	}
+	return fmt.Sprintf("level_%d", int(lv))
+}
+
+// ParseLevel returns the level with the given name, one of debug, info, warn or error.
+func ParseLevel(s string) (Level, error) {
+	for lv, n := range levelNames {
+		if strings.EqualFold(s, n) {
+			return lv, nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level '%s', must be one of debug, info, warn or error", s)
+}
+
+// output is shared by a logger and all loggers derived from it.
+type output struct {
+	sync.Mutex
+	w          io.Writer
+	level      Level            // Messages below this level are discarded.
+	json       bool             // Write JSON objects instead of text lines.
+	timestamps bool             // Include the time of the message.
+	now        func() time.Time // Returns the time of a message, replaced by tests.
+}
+
+type field struct {
+	key   string
+	value interface{}
+}
+
+// Logger writes messages of a level to its output. Derived loggers add fields, which are only
+// written in JSON format, and text which is only written in text format.
+type Logger struct {
+	out    *output
+	prefix string  // Text only: written before the timestamp.
+	tag    string  // Text only: written after the timestamp.
+	fields []field // JSON only: added to every message.
+}
+
+// New returns a logger writing messages of at least the given level to w.
+func New(w io.Writer, prefix string, level Level, json, timestamps bool) *Logger {
+	return &Logger{
+		out:    &output{w: w, level: level, json: json, timestamps: timestamps, now: time.Now},
+		prefix: prefix,
+	}
+}
+
+// With returns a logger adding the given key value pairs to all messages, replacing fields with the
+// same key.
+func (l *Logger) With(kv ...interface{}) *Logger {
+	nl := *l
+	nl.fields = make([]field, len(l.fields), len(l.fields)+len(kv)/2)
+	copy(nl.fields, l.fields)
+	for i := 0; i+1 < len(kv); i += 2 {
+		f := field{key: fmt.Sprint(kv[i]), value: kv[i+1]}
+		replaced := false
+		for j := range nl.fields {
+			if nl.fields[j].key == f.key {
+				nl.fields[j], replaced = f, true
+			}
+		}
+		if !replaced {
+			nl.fields = append(nl.fields, f)
+		}
+	}
+	return &nl
+}
+
+// WithPrefix returns a logger using a different text prefix, with the given fields added.
+func (l *Logger) WithPrefix(prefix string, kv ...interface{}) *Logger {
+	nl := l.With(kv...)
+	nl.prefix = prefix
+	return nl
+}
+
+// WithTag returns a logger writing tag in front of every text message, with the given fields added.
+func (l *Logger) WithTag(tag string, kv ...interface{}) *Logger {
+	nl := l.With(kv...)
+	nl.tag += tag
+	return nl
+}
+
+// Enabled returns true if messages of the given level are written.
+func (l *Logger) Enabled(lv Level) bool {
+	return lv >= l.out.level
+}
+
+// Logf logs at the given level.
+func (l *Logger) Logf(lv Level, format string, args ...interface{}) {
+	l.output(lv, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.output(LevelDebug, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.output(LevelInfo, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.output(LevelWarn, fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.output(LevelError, fmt.Sprintf(format, args...))
+}
+
+// Printf logs at info level, like the standard library logger.
+func (l *Logger) Printf(format string, args ...interface{}) {
+	l.output(LevelInfo, fmt.Sprintf(format, args...))
+}
+
+// Fatalf logs at error level and exits.
+func (l *Logger) Fatalf(format string, args ...interface{}) {
+	l.output(LevelError, fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
+
+// Panicf logs at error level and panics.
+func (l *Logger) Panicf(format string, args ...interface{}) {
+	s := fmt.Sprintf(format, args...)
+	l.output(LevelError, s)
+	panic(s)
+}
+
+func (l *Logger) output(lv Level, msg string) {
+	if !l.Enabled(lv) {
+		return
+	}
+	msg = strings.TrimSuffix(msg, "\n")
+
+	l.out.Lock()
+	defer l.out.Unlock()
+	now := l.out.now()
+	var buf bytes.Buffer
+	if l.out.json {
+		buf.WriteByte('{')
+		if l.out.timestamps {
+			writeJSONField(&buf, "time", now.Format(time.RFC3339Nano))
+		}
+		writeJSONField(&buf, "level", lv.String())
+		writeJSONField(&buf, "msg", msg)
+		for _, f := range l.fields {
+			writeJSONField(&buf, f.key, f.value)
+		}
+		buf.WriteString("}\n")
+	} else {
+		buf.WriteString(l.prefix)
+		if l.out.timestamps {
+			buf.WriteString(now.Format("2006/01/02 15:04:05 "))
+		}
+		if lv != LevelInfo {
+			buf.WriteString(strings.ToUpper(lv.String()) + " ")
+		}
+		buf.WriteString(l.tag)
+		buf.WriteString(msg)
+		buf.WriteByte('\n')
+	}
+	l.out.w.Write(buf.Bytes())
+}
+
+// writeJSONField appends a key value pair to an object in buf. Values implementing fmt.Stringer or
+// error are written as strings.
+func writeJSONField(buf *bytes.Buffer, key string, value interface{}) {
+	switch v := value.(type) {
+	case error:
+		value = v.Error()
+	case fmt.Stringer:
+		value = v.String()
+	}
+	if buf.Len() > 1 {
+		buf.WriteByte(',')
+	}
+	k, _ := json.Marshal(key)
+	buf.Write(k)
+	buf.WriteByte(':')
+	b, err := json.Marshal(value)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(b)
+}
@@ -0,0 +1,71 @@
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func newTestLogger(buf *bytes.Buffer, level Level, json bool) *Logger {
+	l := New(buf, "test[eth0] ", level, json, true)
+	l.out.now = func() time.Time { return time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC) }
+	return l
+}
+
+func TestText(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := newTestLogger(buf, LevelInfo, false)
+	yl := l.WithTag("[aa:bb:cc:dd:ee:ff] ", "mac", "aa:bb:cc:dd:ee:ff")
+
+	l.Debugf("not logged")
+	l.Printf("# ready\n")
+	yl.Warnf("DISCOVER: %s. Dropping!", "bogus")
+	yl.With("state", "BOUND").Errorf("failed")
+	l.WithPrefix("other ").Infof("hello")
+	yl.Logf(LevelDebug, "not logged either")
+	yl.Logf(LevelInfo, "REQUEST: %s. Dropping!", "not for us")
+
+	want := `test[eth0] 2021/03/04 05:06:07 # ready
+test[eth0] 2021/03/04 05:06:07 WARN [aa:bb:cc:dd:ee:ff] DISCOVER: bogus. Dropping!
+test[eth0] 2021/03/04 05:06:07 ERROR [aa:bb:cc:dd:ee:ff] failed
+other 2021/03/04 05:06:07 hello
+test[eth0] 2021/03/04 05:06:07 [aa:bb:cc:dd:ee:ff] REQUEST: not for us. Dropping!
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("text output had diff: %s", diff)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := newTestLogger(buf, LevelDebug, true).With("interface", "eth0")
+	yl := l.WithTag("[aa:bb:cc:dd:ee:ff] ", "mac", net.HardwareAddr{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}, "xid", 42)
+
+	l.Debugf("# ready")
+	yl.With("decision", "drop", "xid", 43).Warnf("say \"hi\"")
+	l.With("err", errors.New("boom"), "ips", []net.IP{net.IPv4(10, 0, 0, 1)}).Errorf("failed")
+
+	want := `{"time":"2021-03-04T05:06:07Z","level":"debug","msg":"# ready","interface":"eth0"}
+{"time":"2021-03-04T05:06:07Z","level":"warn","msg":"say \"hi\"","interface":"eth0","mac":"aa:bb:cc:dd:ee:ff","xid":43,"decision":"drop"}
+{"time":"2021-03-04T05:06:07Z","level":"error","msg":"failed","interface":"eth0","err":"boom","ips":["10.0.0.1"]}
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("JSON output had diff: %s", diff)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for s, want := range map[string]Level{"debug": LevelDebug, "info": LevelInfo, "WARN": LevelWarn, "error": LevelError} {
+		lv, err := ParseLevel(s)
+		if err != nil || lv != want {
+			t.Errorf("ParseLevel(%s) = %v, %v, wanted %v, nil err", s, lv, err, want)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Errorf("ParseLevel(verbose) = nil err, wanted an error")
+	}
+}
@@ -0,0 +1,229 @@
+// Package metrics implements a minimal registry of counters, gauges and histograms which
+// can be exported in the Prometheus text format.
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default is the registry used by all packages of psa-dhcp.
+var Default = NewRegistry()
+
+// DefaultBuckets are the upper bounds of histogram buckets, in seconds.
+var DefaultBuckets = []float64{.001, .005, .01, .05, .1, .25, .5, 1, 2.5, 5}
+
+type Registry struct {
+	sync.Mutex
+	metrics []*metric // Registered metrics, in order of registration.
+	hooks   []func()  // Called before exporting the metrics.
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// metric is a named family of values, keyed by their label values.
+type metric struct {
+	sync.Mutex
+	name    string            // Name of the metric.
+	help    string            // Description of the metric.
+	kind    string            // One of counter, gauge or histogram.
+	labels  []string          // Label names.
+	values  map[string]*value // Values, keyed by their joined label values.
+	buckets []float64         // Histograms only: upper bounds of the buckets.
+}
+
+type value struct {
+	labels []string // Label values.
+	v      float64  // Value of counters and gauges, sum of histograms.
+	counts []uint64 // Histograms only: observations per bucket.
+	count  uint64   // Histograms only: number of observations.
+}
+
+type Counter struct{ m *metric }
+type Gauge struct{ m *metric }
+type Histogram struct{ m *metric }
+
+// Counter registers a new counter with the given label names.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	return &Counter{m: r.register(name, help, "counter", labels, nil)}
+}
+
+// Gauge registers a new gauge with the given label names.
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{m: r.register(name, help, "gauge", labels, nil)}
+}
+
+// Histogram registers a new histogram with the given bucket bounds and label names.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{m: r.register(name, help, "histogram", labels, buckets)}
+}
+
+// OnExport registers a function to call before the metrics are exported, eg. to update gauges.
+func (r *Registry) OnExport(f func()) {
+	r.Lock()
+	defer r.Unlock()
+	r.hooks = append(r.hooks, f)
+}
+
+func (r *Registry) register(name, help, kind string, labels []string, buckets []float64) *metric {
+	r.Lock()
+	defer r.Unlock()
+
+	for _, m := range r.metrics {
+		if m.name == name {
+			panic(fmt.Sprintf("metric %s registered twice", name))
+		}
+	}
+	m := &metric{name: name, help: help, kind: kind, labels: labels, values: make(map[string]*value), buckets: buckets}
+	r.metrics = append(r.metrics, m)
+	return m
+}
+
+// get returns the value for the given label values, creating it if needed. Must be called with m locked.
+func (m *metric) get(lv []string) *value {
+	if len(lv) != len(m.labels) {
+		panic(fmt.Sprintf("metric %s: got %d label values, wanted %d", m.name, len(lv), len(m.labels)))
+	}
+	key := strings.Join(lv, "\x00")
+	v, ok := m.values[key]
+	if !ok {
+		v = &value{labels: append([]string{}, lv...), counts: make([]uint64, len(m.buckets))}
+		m.values[key] = v
+	}
+	return v
+}
+
+// Inc increments the counter by one.
+func (c *Counter) Inc(lv ...string) {
+	c.Add(1, lv...)
+}
+
+// Add increases the counter by d, which must not be negative.
+func (c *Counter) Add(d float64, lv ...string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.m.get(lv).v += d
+}
+
+// Set sets the value of the gauge.
+func (g *Gauge) Set(v float64, lv ...string) {
+	g.m.Lock()
+	defer g.m.Unlock()
+	g.m.get(lv).v = v
+}
+
+// Observe adds a single observation to the histogram.
+func (h *Histogram) Observe(v float64, lv ...string) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	val := h.m.get(lv)
+	for i, b := range h.m.buckets {
+		if v <= b {
+			val.counts[i]++
+		}
+	}
+	val.count++
+	val.v += v
+}
+
+// Since observes the time elapsed since t, in seconds.
+func (h *Histogram) Since(t time.Time, lv ...string) {
+	h.Observe(time.Since(t).Seconds(), lv...)
+}
+
+// Export writes all metrics in the Prometheus text format to w.
+func (r *Registry) Export(w io.Writer) error {
+	r.Lock()
+	hooks := r.hooks
+	metrics := r.metrics
+	r.Unlock()
+
+	for _, f := range hooks {
+		f()
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.export(bw)
+	}
+	return bw.Flush()
+}
+
+func (m *metric) export(w io.Writer) {
+	m.Lock()
+	defer m.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", m.name, m.kind)
+
+	var keys []string
+	for k := range m.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := m.values[k]
+		if m.kind != "histogram" {
+			fmt.Fprintf(w, "%s%s %s\n", m.name, labelString(m.labels, v.labels, "", ""), formatFloat(v.v))
+			continue
+		}
+		for i, b := range m.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, labelString(m.labels, v.labels, "le", formatFloat(b)), v.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, labelString(m.labels, v.labels, "le", "+Inf"), v.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", m.name, labelString(m.labels, v.labels, "", ""), formatFloat(v.v))
+		fmt.Fprintf(w, "%s_count%s %d\n", m.name, labelString(m.labels, v.labels, "", ""), v.count)
+	}
+}
+
+// labelString formats label pairs, with an optional extra label.
+func labelString(names, values []string, extraName, extraValue string) string {
+	var pairs []string
+	for i, n := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", n, strconv.Quote(values[i])))
+	}
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", extraName, strconv.Quote(extraValue)))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// ServeHTTP exports the metrics to an HTTP client.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	r.Export(w)
+}
+
+// Serve exports the registry on http://addr/metrics until the context is done.
+func Serve(ctx context.Context, addr string, r *Registry) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", r)
+	hs := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		hs.Close()
+	}()
+	if err := hs.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExport(t *testing.T) {
+	r := NewRegistry()
+	c := r.Counter("test_messages_total", "Messages by type.", "iface", "type")
+	g := r.Gauge("test_free", "Free addresses.")
+	h := r.Histogram("test_latency_seconds", "Latency.", []float64{0.1, 1}, "iface")
+
+	c.Inc("eth0", "discover")
+	c.Inc("eth0", "discover")
+	c.Add(3, "eth1", "req\"uest")
+	h.Observe(0.05, "eth0")
+	h.Observe(0.5, "eth0")
+	h.Observe(7, "eth0")
+
+	hooks := 0
+	r.OnExport(func() {
+		hooks++
+		g.Set(42)
+	})
+
+	buf := &bytes.Buffer{}
+	if err := r.Export(buf); err != nil {
+		t.Fatalf("Export() = %v, wanted nil err", err)
+	}
+	want := `# HELP test_messages_total Messages by type.
+# TYPE test_messages_total counter
+test_messages_total{iface="eth0",type="discover"} 2
+test_messages_total{iface="eth1",type="req\"uest"} 3
+# HELP test_free Free addresses.
+# TYPE test_free gauge
+test_free 42
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{iface="eth0",le="0.1"} 1
+test_latency_seconds_bucket{iface="eth0",le="1"} 2
+test_latency_seconds_bucket{iface="eth0",le="+Inf"} 3
+test_latency_seconds_sum{iface="eth0"} 7.55
+test_latency_seconds_count{iface="eth0"} 3
+`
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Export() had diff: %s", diff)
+	}
+	if hooks != 1 {
+		t.Errorf("OnExport hook was called %d times, wanted 1", hooks)
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("test_total", "Test.")
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Registering test_total twice did not panic")
+		}
+	}()
+	r.Gauge("test_total", "Test.")
+}
@@ -5,10 +5,11 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"os"
 	"regexp"
 	"strings"
+
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/logger"
 )
 
 var (
@@ -16,7 +17,7 @@ var (
 	reGoodNums  = regexp.MustCompile(`^[0-9\.]+$`)
 )
 
-func Run(_ context.Context, l *log.Logger) error {
+func Run(_ context.Context, l *logger.Logger) error {
 	var searchDomain string
 	var nameservers []string
 
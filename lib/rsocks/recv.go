@@ -39,3 +39,29 @@ func getRecvSock(iface *net.Interface, proto uint16) (*os.File, error) {
 	}
 	return os.NewFile(uintptr(s), ""), nil
 }
+
+// ReadFrom reads a packet from a receiving socket and returns the hardware address of its sender.
+func ReadFrom(f *os.File, buf []byte) (int, net.HardwareAddr, error) {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return 0, nil, err
+	}
+	var nr int
+	var from syscall.Sockaddr
+	var rerr error
+	err = rc.Read(func(fd uintptr) bool {
+		nr, from, rerr = syscall.Recvfrom(int(fd), buf, 0)
+		return rerr != syscall.EAGAIN
+	})
+	if err == nil {
+		err = rerr
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	var hwaddr net.HardwareAddr
+	if sll, ok := from.(*syscall.SockaddrLinklayer); ok && int(sll.Halen) <= len(sll.Addr) {
+		hwaddr = append(hwaddr, sll.Addr[:sll.Halen]...)
+	}
+	return nr, hwaddr, nil
+}
@@ -50,6 +50,36 @@ func getSendSock(iface *net.Interface, proto uint16, hwaddr net.HardwareAddr) (*
 	return &rssock{fd: s, sll: sll}, nil
 }
 
+type rtsock struct {
+	fd int
+}
+
+// GetRoutedSendSock returns a raw socket for sending complete IPv4 packets.
+// Unlike the other sockets, the destination is taken from the IPv4 header and routed by the kernel.
+func GetRoutedSendSock() (*rtsock, error) {
+	// IPPROTO_RAW implies IP_HDRINCL.
+	s, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_RAW, syscall.IPPROTO_RAW)
+	if err != nil {
+		return nil, err
+	}
+	return &rtsock{fd: s}, nil
+}
+
+// Write implements the Writer interface.
+func (rs *rtsock) Write(p []byte) (n int, err error) {
+	if len(p) < 20 {
+		return 0, syscall.EINVAL
+	}
+	sa := &syscall.SockaddrInet4{}
+	copy(sa.Addr[:], p[16:20])
+	return len(p), syscall.Sendto(rs.fd, p, 0, sa)
+}
+
+// Close closes the socket.
+func (rs *rtsock) Close() error {
+	return syscall.Close(rs.fd)
+}
+
 // Write implements the Writer interface.
 func (rs *rssock) Write(p []byte) (n int, err error) {
 	return len(p), syscall.Sendto(rs.fd, p, 0, rs.sll)
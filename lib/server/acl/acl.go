@@ -0,0 +1,111 @@
+package acl
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+
+	pb "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/proto"
+)
+
+// ACL decides which clients are served.
+type ACL struct {
+	allow     []rule                 // Clients allowed to be served, everyone if empty.
+	deny      []rule                 // Clients never served normally.
+	Policy    pb.AccessConfig_Policy // How to handle denied and unknown clients.
+	PoolStart net.IP                 // First IP of the quarantine pool, nil if none.
+	PoolEnd   net.IP                 // Last IP of the quarantine pool.
+}
+
+// rule matches hardware addresses.
+type rule struct {
+	text   string // Rule as configured, used for logging.
+	prefix []byte // Hardware address prefix to match.
+	local  bool   // Matches locally administered addresses instead of a prefix.
+}
+
+// Parse inspects a proto.AccessConfig and returns the ACL. A nil configuration allows all clients.
+func Parse(conf *pb.AccessConfig) (*ACL, error) {
+	a := &ACL{Policy: conf.GetPolicy()}
+
+	var err error
+	if a.allow, err = parseRules(conf.GetAllow()); err != nil {
+		return nil, fmt.Errorf("allow: %v", err)
+	}
+	if a.deny, err = parseRules(conf.GetDeny()); err != nil {
+		return nil, fmt.Errorf("deny: %v", err)
+	}
+
+	qr := conf.GetQuarantineRange()
+	if qr != "" {
+		sr := strings.Split(qr, "-")
+		if len(sr) != 2 {
+			return nil, fmt.Errorf("quarantine_range format '%s' invalid. Expected 'start-end'", qr)
+		}
+		a.PoolStart, a.PoolEnd = net.ParseIP(sr[0]).To4(), net.ParseIP(sr[1]).To4()
+		if a.PoolStart == nil || a.PoolEnd == nil {
+			return nil, fmt.Errorf("quarantine_range has invalid IP range: '%s'", qr)
+		}
+		if bytes.Compare(a.PoolStart, a.PoolEnd) > 0 {
+			return nil, fmt.Errorf("quarantine_range '%s' ends before it starts", qr)
+		}
+	}
+	if (a.Policy == pb.AccessConfig_QUARANTINE) != (qr != "") {
+		return nil, fmt.Errorf("quarantine_range must be set if, and only if, policy is QUARANTINE")
+	}
+	return a, nil
+}
+
+// parseRules parses a list of hardware address prefixes and 'local' keywords.
+func parseRules(list []string) ([]rule, error) {
+	var res []rule
+	for _, s := range list {
+		if strings.ToLower(s) == "local" {
+			res = append(res, rule{text: s, local: true})
+			continue
+		}
+		b, err := hex.DecodeString(strings.NewReplacer(":", "", "-", "").Replace(s))
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("invalid rule '%s', expected a hardware address (prefix) or 'local'", s)
+		}
+		res = append(res, rule{text: s, prefix: b})
+	}
+	return res, nil
+}
+
+func (r rule) matches(hw net.HardwareAddr) bool {
+	if r.local {
+		return len(hw) > 0 && hw[0]&0x02 != 0
+	}
+	return bytes.HasPrefix(hw, r.prefix)
+}
+
+// Check returns true if a client with the given hardware address is allowed to be served normally,
+// known is true if the client has a static configuration. The reason names the deciding rule.
+func (a *ACL) Check(hw net.HardwareAddr, known bool) (bool, string) {
+	for _, r := range a.deny {
+		if r.matches(hw) {
+			return false, fmt.Sprintf("deny rule '%s'", r.text)
+		}
+	}
+	if known {
+		return true, "static client"
+	}
+	if len(a.allow) == 0 {
+		return true, "no allow rules"
+	}
+	for _, r := range a.allow {
+		if r.matches(hw) {
+			return true, fmt.Sprintf("allow rule '%s'", r.text)
+		}
+	}
+	return false, "unknown client"
+}
+
+// InPool returns true if ip is within the quarantine pool.
+func (a *ACL) InPool(ip net.IP) bool {
+	ip = ip.To4()
+	return a.PoolStart != nil && ip != nil && bytes.Compare(ip, a.PoolStart) >= 0 && bytes.Compare(ip, a.PoolEnd) <= 0
+}
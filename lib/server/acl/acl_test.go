@@ -0,0 +1,127 @@
+package acl
+
+import (
+	"net"
+	"testing"
+
+	pb "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/proto"
+)
+
+func TestParse(t *testing.T) {
+	for _, good := range []*pb.AccessConfig{
+		nil,
+		{Allow: []string{"b8:27:eb", "02:00:00:00:00:01", "LOCAL"}, Deny: []string{"dc-a6-32"}},
+		{Policy: pb.AccessConfig_QUARANTINE, QuarantineRange: "192.168.1.200-192.168.1.210"},
+	} {
+		if _, err := Parse(good); err != nil {
+			t.Errorf("Parse(%v) = %v, wanted nil err", good, err)
+		}
+	}
+
+	for _, bad := range []*pb.AccessConfig{
+		{Allow: []string{"zz"}},
+		{Deny: []string{""}},
+		{Policy: pb.AccessConfig_QUARANTINE},
+		{QuarantineRange: "192.168.1.200-192.168.1.210"},
+		{Policy: pb.AccessConfig_QUARANTINE, QuarantineRange: "192.168.1.210-192.168.1.200"},
+		{Policy: pb.AccessConfig_QUARANTINE, QuarantineRange: "192.168.1.200"},
+		{Policy: pb.AccessConfig_QUARANTINE, QuarantineRange: "::1-::2"},
+	} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("Parse(%v) wanted err, got nil err", bad)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	pi := net.HardwareAddr{0xb8, 0x27, 0xeb, 0x01, 0x02, 0x03}
+	random := net.HardwareAddr{0x5a, 0x01, 0x02, 0x03, 0x04, 0x05}
+	other := net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+
+	input := []struct {
+		name       string
+		conf       *pb.AccessConfig
+		hw         net.HardwareAddr
+		known      bool
+		want       bool
+		wantReason string
+	}{
+		{
+			name:       "no rules",
+			hw:         other,
+			want:       true,
+			wantReason: "no allow rules",
+		},
+		{
+			name:       "allowed oui",
+			conf:       &pb.AccessConfig{Allow: []string{"00:00:01", "b8:27:eb"}},
+			hw:         pi,
+			want:       true,
+			wantReason: "allow rule 'b8:27:eb'",
+		},
+		{
+			name:       "unknown",
+			conf:       &pb.AccessConfig{Allow: []string{"b8:27:eb"}},
+			hw:         other,
+			wantReason: "unknown client",
+		},
+		{
+			name:       "static client",
+			conf:       &pb.AccessConfig{Allow: []string{"b8:27:eb"}},
+			hw:         other,
+			known:      true,
+			want:       true,
+			wantReason: "static client",
+		},
+		{
+			name:       "denied exact",
+			conf:       &pb.AccessConfig{Allow: []string{"b8:27:eb"}, Deny: []string{"b8:27:eb:01:02:03"}},
+			hw:         pi,
+			known:      true,
+			wantReason: "deny rule 'b8:27:eb:01:02:03'",
+		},
+		{
+			name:       "denied randomized",
+			conf:       &pb.AccessConfig{Deny: []string{"local"}},
+			hw:         random,
+			wantReason: "deny rule 'local'",
+		},
+		{
+			name:       "not randomized",
+			conf:       &pb.AccessConfig{Deny: []string{"local"}},
+			hw:         pi,
+			want:       true,
+			wantReason: "no allow rules",
+		},
+	}
+	for _, test := range input {
+		a, err := Parse(test.conf)
+		if err != nil {
+			t.Fatalf("Parse(%s) = %v, wanted nil err", test.name, err)
+		}
+		got, reason := a.Check(test.hw, test.known)
+		if got != test.want || reason != test.wantReason {
+			t.Errorf("Check(%s) = %v, %q; want %v, %q", test.name, got, reason, test.want, test.wantReason)
+		}
+	}
+}
+
+func TestInPool(t *testing.T) {
+	a, err := Parse(&pb.AccessConfig{Policy: pb.AccessConfig_QUARANTINE, QuarantineRange: "192.168.1.200-192.168.1.210"})
+	if err != nil {
+		t.Fatalf("Parse = %v, wanted nil err", err)
+	}
+	for ip, want := range map[string]bool{
+		"192.168.1.199": false,
+		"192.168.1.200": true,
+		"192.168.1.210": true,
+		"192.168.1.211": false,
+	} {
+		if got := a.InPool(net.ParseIP(ip)); got != want {
+			t.Errorf("InPool(%s) = %v, want %v", ip, got, want)
+		}
+	}
+	if (&ACL{}).InPool(net.ParseIP("192.168.1.200")) {
+		t.Errorf("InPool without pool = true, want false")
+	}
+}
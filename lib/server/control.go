@@ -0,0 +1,135 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ctl"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/hooks"
+	d "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ipdb/duid"
+)
+
+// Control answers a request received on the control socket.
+// Reservations made through it are recorded like leases, so they survive reloads and restarts
+// unless they conflict with the configuration.
+func (sx *server) Control(req *ctl.Request) (*ctl.Response, error) {
+	var mac net.HardwareAddr
+	if req.MAC != "" {
+		var err error
+		if mac, err = net.ParseMAC(req.MAC); err != nil {
+			return nil, fmt.Errorf("invalid mac '%s': %v", req.MAC, err)
+		}
+	}
+	var duid d.Duid
+	if req.Duid != "" {
+		var err error
+		if duid, err = d.Parse(req.Duid); err != nil {
+			return nil, fmt.Errorf("invalid duid '%s': %v", req.Duid, err)
+		}
+	}
+
+	sx.RLock()
+	defer sx.RUnlock()
+
+	switch req.Method {
+	case ctl.MethodLeases:
+		return &ctl.Response{Leases: sx.leases(req.IP, mac, duid)}, nil
+	case ctl.MethodPools:
+		return &ctl.Response{Pools: sx.pools()}, nil
+	case ctl.MethodRevoke:
+		sn := sx.subnetForIP(req.IP)
+		if sn == nil {
+			return nil, ctl.ErrNotFound
+		}
+		cduid, err := sn.ipdb.LookupClientByIP(req.IP)
+		if err != nil {
+			return nil, fmt.Errorf("no lease for %s: %v", req.IP, err)
+		}
+		if err := sn.ipdb.ExpireClient(req.IP, cduid); err != nil {
+			return nil, err
+		}
+		sx.l.Printf("# ctl: revoked lease of %s (%s)", req.IP, cduid)
+		sx.fire(hooks.EventRevoke, hwAddrFromDuid(cduid), req.IP, cduid, "", time.Now())
+		return &ctl.Response{}, nil
+	case ctl.MethodReserve:
+		sn := sx.subnetForIP(req.IP)
+		if sn == nil {
+			return nil, ctl.ErrNotFound
+		}
+		if mac == nil {
+			return nil, fmt.Errorf("reserve requires a mac")
+		}
+		if err := sn.ipdb.Reserve(req.IP, duidFromHwAddr(mac)); err != nil {
+			return nil, fmt.Errorf("could not reserve %s for %s: %v", req.IP, mac, err)
+		}
+		sx.l.Printf("# ctl: reserved %s for %s", req.IP, mac)
+		return &ctl.Response{}, nil
+	case ctl.MethodUnreserve:
+		if mac == nil {
+			return nil, fmt.Errorf("unreserve requires a mac")
+		}
+		for _, sn := range sx.subnets() {
+			// Also matches the dynamic lease of a client without client identifier.
+			le, ok := sn.ipdb.LeaseByDuid(duidFromHwAddr(mac))
+			if !ok || !le.Permanent {
+				continue
+			}
+			if err := sn.ipdb.Unreserve(le.IP, le.Duid); err != nil {
+				return nil, fmt.Errorf("could not remove reservation of %s: %v", mac, err)
+			}
+			sx.l.Printf("# ctl: removed reservation of %s for %s", le.IP, mac)
+			return &ctl.Response{}, nil
+		}
+		return nil, ctl.ErrNotFound
+	}
+	return nil, fmt.Errorf("unknown method '%s'", req.Method)
+}
+
+// leases returns all leases matching the given filters, unset filters match everything.
+func (sx *server) leases(ip net.IP, mac net.HardwareAddr, duid d.Duid) []ctl.Lease {
+	var res []ctl.Lease
+	for _, sn := range sx.subnets() {
+		for _, le := range sn.ipdb.Leases() {
+			if ip != nil && !ip.Equal(le.IP) {
+				continue
+			}
+			if mac != nil && !le.Duid.HasHwAddr(mac) {
+				continue
+			}
+			if duid != nil && duid.String() != le.Duid.String() {
+				continue
+			}
+			res = append(res, ctl.Lease{
+				Interface: sx.iface.Name,
+				Network:   sn.ipnet.String(),
+				IP:        le.IP,
+				Duid:      le.Duid.String(),
+				Until:     le.Until,
+				Permanent: le.Permanent,
+				Hostname:  le.Hostname,
+			})
+		}
+	}
+	return res
+}
+
+// pools returns the utilisation of all subnets.
+func (sx *server) pools() []ctl.Pool {
+	var res []ctl.Pool
+	for _, sn := range sx.subnets() {
+		st := sn.ipdb.Stats()
+		res = append(res, ctl.Pool{
+			Interface:   sx.iface.Name,
+			Network:     sn.ipnet.String(),
+			Relayed:     sn.relayed,
+			Size:        st.Size,
+			Dynamic:     st.Dynamic,
+			Leased:      st.Leased,
+			Permanent:   st.Permanent,
+			Quarantined: st.Quarantined,
+			Free:        st.Free,
+		})
+	}
+	return res
+}
@@ -0,0 +1,183 @@
+// Package ctl implements the control protocol of psa-dhcpd: a single JSON encoded request
+// and response exchanged per connection on a unix socket.
+package ctl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"time"
+
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/logger"
+)
+
+const (
+	MethodLeases    = "leases"    // List leases, optionally filtered by IP, MAC or duid.
+	MethodPools     = "pools"     // Show utilisation of all networks.
+	MethodRevoke    = "revoke"    // Terminate the lease of an IP.
+	MethodReserve   = "reserve"   // Add a permanent ip<>mac mapping.
+	MethodUnreserve = "unreserve" // Remove a permanent ip<>mac mapping.
+)
+
+const (
+	// How long a client may take to send its request.
+	ioTimeout = 5 * time.Second
+)
+
+// ErrNotFound is returned by backends if they are not responsible for a request.
+var ErrNotFound = errors.New("not found")
+
+type Request struct {
+	Method    string `json:"method"`
+	Interface string `json:"interface,omitempty"` // Only ask the server of this interface.
+	IP        net.IP `json:"ip,omitempty"`
+	MAC       string `json:"mac,omitempty"`
+	Duid      string `json:"duid,omitempty"`
+}
+
+type Response struct {
+	Error  string  `json:"error,omitempty"`
+	Leases []Lease `json:"leases,omitempty"`
+	Pools  []Pool  `json:"pools,omitempty"`
+}
+
+type Lease struct {
+	Interface string    `json:"interface"`
+	Network   string    `json:"network"`
+	IP        net.IP    `json:"ip"`
+	Duid      string    `json:"duid"`
+	Until     time.Time `json:"until"`
+	Permanent bool      `json:"permanent"`
+	Hostname  string    `json:"hostname,omitempty"`
+}
+
+type Pool struct {
+	Interface   string `json:"interface"`
+	Network     string `json:"network"`
+	Relayed     bool   `json:"relayed"`
+	Size        int    `json:"size"`
+	Dynamic     int    `json:"dynamic"`
+	Leased      int    `json:"leased"`
+	Permanent   int    `json:"permanent"`
+	Quarantined int    `json:"quarantined"`
+	Free        int    `json:"free"`
+}
+
+// Backend answers requests for a single interface.
+// Mutating requests for IPs or clients unknown to the backend must return ErrNotFound.
+type Backend interface {
+	Control(*Request) (*Response, error)
+}
+
+// Handler answers requests.
+type Handler func(*Request) *Response
+
+// Dispatch returns a handler passing requests to all backends, keyed by interface name.
+// Responses of queries are merged while mutating requests stop at the first responsible backend.
+func Dispatch(backends map[string]Backend) Handler {
+	var names []string
+	for k := range backends {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	return func(req *Request) *Response {
+		res := &Response{}
+		mutating := req.Method == MethodRevoke || req.Method == MethodReserve || req.Method == MethodUnreserve
+		for _, name := range names {
+			if req.Interface != "" && req.Interface != name {
+				continue
+			}
+			r, err := backends[name].Control(req)
+			if err == ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return &Response{Error: err.Error()}
+			}
+			if mutating {
+				return r
+			}
+			res.Leases = append(res.Leases, r.Leases...)
+			res.Pools = append(res.Pools, r.Pools...)
+		}
+		if mutating {
+			return &Response{Error: "no server is responsible for this request"}
+		}
+		return res
+	}
+}
+
+// Serve answers requests on the unix socket at path until the context is done.
+func Serve(ctx context.Context, l *logger.Logger, path string, h Handler) error {
+	// Remove a stale socket of a previous run.
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go handleConn(l, conn, h)
+	}
+}
+
+func handleConn(l *logger.Logger, conn net.Conn, h Handler) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(ioTimeout))
+
+	req := &Request{}
+	if err := json.NewDecoder(conn).Decode(req); err != nil {
+		l.Errorf("# ctl: failed to decode request: %v", err)
+		return
+	}
+	if err := json.NewEncoder(conn).Encode(h(req)); err != nil {
+		l.Errorf("# ctl: failed to send response: %v", err)
+	}
+}
+
+// Call sends a request to the server listening at path and returns its response.
+// An error reported by the server is returned as error.
+func Call(path string, req *Request) (*Response, error) {
+	conn, err := net.DialTimeout("unix", path, ioTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(ioTimeout))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, err
+	}
+	res := &Response{}
+	if err := json.NewDecoder(conn).Decode(res); err != nil {
+		return nil, err
+	}
+	if res.Error != "" {
+		return nil, fmt.Errorf("%s", res.Error)
+	}
+	return res, nil
+}
@@ -0,0 +1,123 @@
+package ctl
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/logger"
+)
+
+// fakeBackend manages a single IP and has a single lease.
+type fakeBackend struct {
+	name string
+	ip   net.IP
+}
+
+func (f *fakeBackend) Control(req *Request) (*Response, error) {
+	switch req.Method {
+	case MethodLeases:
+		return &Response{Leases: []Lease{{Interface: f.name, IP: f.ip}}}, nil
+	case MethodPools:
+		return &Response{Pools: []Pool{{Interface: f.name}}}, nil
+	case MethodRevoke:
+		if !f.ip.Equal(req.IP) {
+			return nil, ErrNotFound
+		}
+		return &Response{}, nil
+	}
+	return nil, fmt.Errorf("unknown method '%s'", req.Method)
+}
+
+func TestDispatch(t *testing.T) {
+	h := Dispatch(map[string]Backend{
+		"eth1": &fakeBackend{name: "eth1", ip: net.IPv4(10, 0, 1, 1)},
+		"eth0": &fakeBackend{name: "eth0", ip: net.IPv4(10, 0, 0, 1)},
+	})
+
+	input := []struct {
+		name string
+		req  *Request
+		want *Response
+	}{
+		{
+			name: "all leases",
+			req:  &Request{Method: MethodLeases},
+			want: &Response{Leases: []Lease{{Interface: "eth0", IP: net.IPv4(10, 0, 0, 1)}, {Interface: "eth1", IP: net.IPv4(10, 0, 1, 1)}}},
+		},
+		{
+			name: "pools of one interface",
+			req:  &Request{Method: MethodPools, Interface: "eth1"},
+			want: &Response{Pools: []Pool{{Interface: "eth1"}}},
+		},
+		{
+			name: "revoke",
+			req:  &Request{Method: MethodRevoke, IP: net.IPv4(10, 0, 1, 1)},
+			want: &Response{},
+		},
+		{
+			name: "revoke unknown",
+			req:  &Request{Method: MethodRevoke, IP: net.IPv4(10, 0, 2, 1)},
+			want: &Response{Error: "no server is responsible for this request"},
+		},
+		{
+			name: "unknown method",
+			req:  &Request{Method: "reboot"},
+			want: &Response{Error: "unknown method 'reboot'"},
+		},
+	}
+	for _, test := range input {
+		if diff := cmp.Diff(test.want, h(test.req)); diff != "" {
+			t.Errorf("Dispatch(%s) had diff: %s", test.name, diff)
+		}
+	}
+}
+
+func TestServeAndCall(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ctl")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ctl.sock")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		h := Dispatch(map[string]Backend{"eth0": &fakeBackend{name: "eth0", ip: net.IPv4(10, 0, 0, 1)}})
+		done <- Serve(ctx, logger.New(ioutil.Discard, "", logger.LevelDebug, false, false), path, h)
+	}()
+
+	// Wait for the socket to show up.
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	res, err := Call(path, &Request{Method: MethodLeases})
+	if err != nil {
+		t.Fatalf("Call(leases) = %v, wanted nil err", err)
+	}
+	if len(res.Leases) != 1 || !res.Leases[0].IP.Equal(net.IPv4(10, 0, 0, 1)) {
+		t.Errorf("Call(leases) returned %+v, wanted a single lease of 10.0.0.1", res)
+	}
+	if _, err := Call(path, &Request{Method: MethodRevoke, IP: net.IPv4(10, 0, 2, 1)}); err == nil {
+		t.Errorf("Call(#revoke unknown) returned nil err, wanted non-nil")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Serve() = %v, wanted nil err", err)
+	}
+	if _, err := os.Stat(path); err == nil {
+		t.Errorf("Socket %s still exists after shutdown", path)
+	}
+}
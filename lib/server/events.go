@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/oui"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/hooks"
+	d "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ipdb/duid"
+)
+
+const (
+	// How often committed leases are checked for expiry.
+	expiryInterval = 10 * time.Second
+)
+
+// committedLeases remembers the last event of all committed leases, to report their expiry.
+type committedLeases struct {
+	sync.Mutex
+	m map[string]hooks.Event // Key is the IP of the lease.
+}
+
+// SetHooks configures hooks to notify about lease events, must be called before Run.
+func (sx *server) SetHooks(hx *hooks.Hooks) {
+	sx.hooks = hx
+	sx.committed = &committedLeases{m: make(map[string]hooks.Event)}
+
+	// Leases restored from the journal will expire too.
+	now := time.Now()
+	for _, sn := range sx.subnets() {
+		for _, le := range sn.ipdb.Leases() {
+			if le.Until.After(now) && !le.IP.Equal(sx.selfIP) {
+				sx.committed.m[le.IP.String()] = sx.event(hooks.EventCommit, hwAddrFromDuid(le.Duid), le.IP, le.Duid, le.Hostname, le.Until)
+			}
+		}
+	}
+}
+
+// fire notifies the hooks about a lease event, if any are configured.
+func (sx *server) fire(typ string, mac net.HardwareAddr, ip net.IP, duid d.Duid, hostname string, until time.Time) {
+	if sx.hooks == nil {
+		return
+	}
+	ev := sx.event(typ, mac, ip, duid, hostname, until)
+
+	sx.committed.Lock()
+	if prev, ok := sx.committed.m[ip.String()]; ok && ev.Hostname == "" {
+		// Clients usually only send their hostname while requesting a lease.
+		ev.Hostname = prev.Hostname
+	}
+	if typ == hooks.EventCommit || typ == hooks.EventRenew {
+		sx.committed.m[ip.String()] = ev
+	} else {
+		delete(sx.committed.m, ip.String())
+	}
+	sx.committed.Unlock()
+
+	sx.hooks.Fire(ev)
+}
+
+func (sx *server) event(typ string, mac net.HardwareAddr, ip net.IP, duid d.Duid, hostname string, until time.Time) hooks.Event {
+	ev := hooks.Event{Type: typ, Interface: sx.iface.Name, IP: ip, Duid: duid.String(), Hostname: hostname, Until: until}
+	if mac != nil {
+		ev.MAC = mac.String()
+		if vid, ok := oui.Lookup(mac); ok {
+			ev.Vendor = vid
+		}
+	}
+	return ev
+}
+
+// watchExpiry reports expired leases until the context is done.
+func (sx *server) watchExpiry(ctx context.Context) {
+	for {
+		select {
+		case <-time.After(expiryInterval):
+			sx.expireLeases(time.Now())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// expireLeases fires an expire event for all committed leases which ended before now.
+func (sx *server) expireLeases(now time.Time) {
+	sx.committed.Lock()
+	defer sx.committed.Unlock()
+
+	for k, ev := range sx.committed.m {
+		if now.After(ev.Until) {
+			delete(sx.committed.m, k)
+			ev.Type = hooks.EventExpire
+			sx.hooks.Fire(ev)
+		}
+	}
+}
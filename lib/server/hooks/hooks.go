@@ -0,0 +1,183 @@
+// Package hooks delivers lease events of psa-dhcpd to an external script or HTTP endpoint.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/logger"
+)
+
+const (
+	EventCommit  = "commit"  // A lease was acknowledged for a new client.
+	EventRenew   = "renew"   // A client renewed its lease.
+	EventRelease = "release" // A client released its lease.
+	EventDecline = "decline" // A client declined the offered IP.
+	EventExpire  = "expire"  // A lease expired without being renewed.
+	EventRevoke  = "revoke"  // A lease was revoked through the control socket.
+	EventRogue   = "rogue"   // Another DHCP server answered a client, MAC and IP are those of the server.
+)
+
+const (
+	// Number of workers delivering events.
+	numWorkers = 4
+	// Number of events each worker queues before new ones get dropped.
+	queueLen = 64
+	// Maximum runtime of a delivery.
+	deliveryTimeout = 30 * time.Second
+)
+
+var (
+	reBadChars = regexp.MustCompile(`[^a-zA-Z0-9,\.:_ -]`)
+)
+
+// Event describes a change of a lease.
+type Event struct {
+	Type      string    `json:"event"`
+	Interface string    `json:"interface"`
+	MAC       string    `json:"mac"`
+	IP        net.IP    `json:"ip"`
+	Duid      string    `json:"duid"`
+	Hostname  string    `json:"hostname,omitempty"`
+	Vendor    string    `json:"vendor,omitempty"`
+	Until     time.Time `json:"until"`
+}
+
+// Hooks delivers events to a script and/or a webhook without blocking the caller.
+// Events of the same client are delivered in order.
+type Hooks struct {
+	l      *logger.Logger
+	script []string       // Command line of the script to execute, if any.
+	url    string         // URL to POST events to, if any.
+	queues [](chan Event) // One queue per worker.
+	client *http.Client
+}
+
+// New returns a Hooks instance executing script and posting to url. Either may be empty.
+func New(l *logger.Logger, script, url string) (*Hooks, error) {
+	cargs, err := parseScriptArgs(script)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse '%s': %v", script, err)
+	}
+	hx := &Hooks{l: l, script: cargs, url: url, client: &http.Client{Timeout: deliveryTimeout}}
+	for i := 0; i < numWorkers; i++ {
+		hx.queues = append(hx.queues, make(chan Event, queueLen))
+	}
+	return hx, nil
+}
+
+// Fire queues an event for delivery. The event is dropped if the queue is full.
+// Firing events on a nil Hooks instance is a no-op.
+func (hx *Hooks) Fire(ev Event) {
+	if hx == nil {
+		return
+	}
+	h := fnv.New32a()
+	h.Write([]byte(ev.MAC))
+	select {
+	case hx.queues[h.Sum32()%uint32(len(hx.queues))] <- ev:
+	default:
+		hx.l.Warnf("# hooks: queue full, dropping %s event for %s (%s)", ev.Type, ev.IP, ev.MAC)
+	}
+}
+
+// Run delivers queued events until the context is done.
+func (hx *Hooks) Run(ctx context.Context) {
+	for _, q := range hx.queues {
+		go hx.worker(ctx, q)
+	}
+	<-ctx.Done()
+}
+
+func (hx *Hooks) worker(ctx context.Context, q chan Event) {
+	for {
+		select {
+		case ev := <-q:
+			hx.deliver(ctx, ev)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (hx *Hooks) deliver(ctx context.Context, ev Event) {
+	dctx, cancel := context.WithTimeout(ctx, deliveryTimeout)
+	defer cancel()
+
+	if len(hx.script) > 0 {
+		cmd := exec.CommandContext(dctx, hx.script[0], hx.script[1:]...)
+		cmd.Env = append(os.Environ(), eventEnv(ev)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			hx.l.Errorf("# hooks: execution of '%s' for %s event returned error: %v, output: %q", strings.Join(hx.script, " "), ev.Type, err, string(out))
+		}
+	}
+	if hx.url != "" {
+		if err := hx.post(dctx, ev); err != nil {
+			hx.l.Errorf("# hooks: posting %s event to %s failed: %v", ev.Type, hx.url, err)
+		}
+	}
+}
+
+func (hx *Hooks) post(ctx context.Context, ev Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hx.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := hx.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return nil
+}
+
+// eventEnv returns a (shell safe) version of the event, to be passed as environment.
+func eventEnv(ev Event) []string {
+	return []string{
+		envEntry("EVENT", ev.Type),
+		envEntry("INTERFACE", ev.Interface),
+		envEntry("MAC", ev.MAC),
+		envEntry("IPV4_ADDRESS", ev.IP.String()),
+		envEntry("DUID", strings.TrimSuffix(strings.TrimPrefix(ev.Duid, "<duid:"), ">")),
+		envEntry("HOSTNAME", ev.Hostname),
+		envEntry("VENDOR", ev.Vendor),
+		envEntry("LEASE_UNTIL", fmt.Sprintf("%d", ev.Until.Unix())),
+	}
+}
+
+func envEntry(key, val string) string {
+	val = reBadChars.ReplaceAllString(val, "_")
+	return fmt.Sprintf("PSA_DHCPD_%s=%s", key, val)
+}
+
+func parseScriptArgs(cmdline string) ([]string, error) {
+	var err error
+	var res []string
+
+	if cmdline != "" {
+		r := csv.NewReader(strings.NewReader(cmdline))
+		r.Comma = ' '
+		r.TrimLeadingSpace = true
+		res, err = r.Read()
+	}
+	return res, err
+}
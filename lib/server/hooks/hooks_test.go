@@ -0,0 +1,101 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/logger"
+)
+
+var testEvent = Event{
+	Type:      EventCommit,
+	Interface: "eth0",
+	MAC:       "02:00:00:00:00:01",
+	IP:        net.IPv4(192, 168, 1, 2).To4(),
+	Duid:      "<duid:00-03-00-00-02-00-00-00-00-01>",
+	Hostname:  "laptop",
+	Vendor:    "Evil Corp; rm -rf /",
+	Until:     time.Unix(5000, 0).UTC(),
+}
+
+func TestEventEnv(t *testing.T) {
+	want := []string{
+		"PSA_DHCPD_EVENT=commit",
+		"PSA_DHCPD_INTERFACE=eth0",
+		"PSA_DHCPD_MAC=02:00:00:00:00:01",
+		"PSA_DHCPD_IPV4_ADDRESS=192.168.1.2",
+		"PSA_DHCPD_DUID=00-03-00-00-02-00-00-00-00-01",
+		"PSA_DHCPD_HOSTNAME=laptop",
+		"PSA_DHCPD_VENDOR=Evil Corp_ rm -rf _",
+		"PSA_DHCPD_LEASE_UNTIL=5000",
+	}
+	if diff := cmp.Diff(want, eventEnv(testEvent)); diff != "" {
+		t.Errorf("eventEnv() had diff: %s", diff)
+	}
+}
+
+func TestDelivery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hooks")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+
+	got := make(chan Event, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ev := Event{}
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Errorf("Failed to decode posted event: %v", err)
+		}
+		got <- ev
+	}))
+	defer ts.Close()
+
+	hx, err := New(logger.New(ioutil.Discard, "", logger.LevelDebug, false, false), `sh -c "echo $PSA_DHCPD_EVENT > `+out+`"`, ts.URL)
+	if err != nil {
+		t.Fatalf("New() = %v, wanted nil err", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hx.Run(ctx)
+	hx.Fire(testEvent)
+
+	select {
+	case ev := <-got:
+		if diff := cmp.Diff(testEvent, ev); diff != "" {
+			t.Errorf("Posted event had diff: %s", diff)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Event was not posted")
+	}
+	// The script runs before the post.
+	if b, err := ioutil.ReadFile(out); err != nil || strings.TrimSpace(string(b)) != "commit" {
+		t.Errorf("Script output = %q, %v; wanted commit, nil", string(b), err)
+	}
+}
+
+func TestFireDoesNotBlock(t *testing.T) {
+	hx, err := New(logger.New(ioutil.Discard, "", logger.LevelDebug, false, false), "true", "")
+	if err != nil {
+		t.Fatalf("New() = %v, wanted nil err", err)
+	}
+	// Nobody is running the workers: queues fill up and further events are dropped.
+	for i := 0; i < 2*numWorkers*queueLen; i++ {
+		hx.Fire(testEvent)
+	}
+
+	var nilHooks *Hooks
+	nilHooks.Fire(testEvent)
+}
@@ -14,6 +14,8 @@ type client struct {
 	duid        d.Duid    // Client ID
 	leasedUntil time.Time // validity of this lease.
 	permanent   bool      // permanent entries expire, but are never removed.
+	hostname    string    // Hostname reported by the client.
+	updated     time.Time // Time of the last transaction of the client, zero if unknown.
 }
 
 type Clients struct {
@@ -46,6 +48,23 @@ func (cx *Clients) Lookup(now time.Time, ip uip.Uip, duid d.Duid) (*client, *cli
 	return res[0], res[1]
 }
 
+// All returns all entries which are still valid at the given time.
+func (cx *Clients) All(now time.Time) []*client {
+	cx.Lock()
+	defer cx.Unlock()
+
+	var res []*client
+	for k, p := range cx.m {
+		if !p.permanent && now.After(p.leasedUntil) {
+			delete(cx.m, k)
+		} else if k == p.ip.String() {
+			// Every entry is stored twice, only return it once.
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
 func (cx *Clients) InjectPermanent(now time.Time, ip uip.Uip, duid d.Duid) error {
 	return cx.injectInternal(now, ip, duid, time.Unix(0, 0), true)
 }
@@ -85,6 +104,43 @@ func (cx *Clients) SetLease(now time.Time, ip uip.Uip, duid d.Duid, leasedUntil
 	}
 }
 
+// SetHostname updates the hostname of the entry matching ip and duid.
+func (cx *Clients) SetHostname(now time.Time, ip uip.Uip, duid d.Duid, hostname string) error {
+	cx.Lock()
+	cx.Unlock()
+
+	if ip, duid := cx.Lookup(now, ip, duid); ip == nil || ip != duid {
+		return fmt.Errorf("no entry for this ip and duid")
+	} else {
+		ip.hostname = hostname
+		return nil
+	}
+}
+
+// Touch records a transaction of the client matching ip and duid.
+func (cx *Clients) Touch(now time.Time, ip uip.Uip, duid d.Duid) error {
+	if ip, duid := cx.Lookup(now, ip, duid); ip == nil || ip != duid {
+		return fmt.Errorf("no entry for this ip and duid")
+	} else {
+		ip.updated = now
+		return nil
+	}
+}
+
+// Remove deletes the entry of given ip and duid, permanent or not.
+func (cx *Clients) Remove(ip uip.Uip, duid d.Duid) error {
+	cx.Lock()
+	defer cx.Unlock()
+
+	p := cx.m[ip.String()]
+	if p == nil || p != cx.m[duid.String()] {
+		return fmt.Errorf("no entry for this ip and duid")
+	}
+	delete(cx.m, ip.String())
+	delete(cx.m, duid.String())
+	return nil
+}
+
 func (cx *Clients) Expire(now time.Time, ip uip.Uip, duid d.Duid) error {
 	return cx.SetLease(now, ip, duid, time.Unix(0, 0))
 }
@@ -92,3 +148,23 @@ func (cx *Clients) Expire(now time.Time, ip uip.Uip, duid d.Duid) error {
 func (c *client) Uip() uip.Uip {
 	return c.ip
 }
+
+func (c *client) Duid() d.Duid {
+	return c.duid
+}
+
+func (c *client) LeasedUntil() time.Time {
+	return c.leasedUntil
+}
+
+func (c *client) Permanent() bool {
+	return c.permanent
+}
+
+func (c *client) Hostname() string {
+	return c.hostname
+}
+
+func (c *client) Updated() time.Time {
+	return c.updated
+}
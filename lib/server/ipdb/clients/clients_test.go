@@ -122,3 +122,68 @@ func TestLeaseSet(t *testing.T) {
 		t.Errorf("Lookup of expire entry did not fail?!")
 	}
 }
+
+func TestAll(t *testing.T) {
+	c := NewClients()
+
+	c.Inject(now, uip.Uip(1), d.Duid{0x01}, leaseShort)
+	c.Inject(now, uip.Uip(2), d.Duid{0x02}, leaseLong)
+	c.InjectPermanent(now, uip.Uip(3), d.Duid{0x03})
+
+	if all := c.All(now); len(all) != 3 {
+		t.Errorf("All(now) returned %d entries, wanted 3", len(all))
+	}
+	// The short lease expired, the permanent one never will.
+	all := c.All(then)
+	if len(all) != 2 {
+		t.Fatalf("All(then) returned %d entries, wanted 2", len(all))
+	}
+	for _, e := range all {
+		if e.Uip() == uip.Uip(1) {
+			t.Errorf("All(then) returned expired entry %v", e.Uip())
+		}
+		if e.Permanent() != (e.Uip() == uip.Uip(3)) {
+			t.Errorf("All(then) returned entry %v with permanent=%v", e.Uip(), e.Permanent())
+		}
+	}
+}
+
+func TestRemove(t *testing.T) {
+	c := NewClients()
+
+	c.InjectPermanent(now, uip.Uip(1), d.Duid{0x01})
+	c.Inject(now, uip.Uip(2), d.Duid{0x02}, leaseLong)
+
+	if err := c.Remove(uip.Uip(1), d.Duid{0x02}); err == nil {
+		t.Errorf("Remove of mismatched ip and duid returned nil err")
+	}
+	for _, e := range []struct {
+		ip   uip.Uip
+		duid d.Duid
+	}{{uip.Uip(1), d.Duid{0x01}}, {uip.Uip(2), d.Duid{0x02}}} {
+		if err := c.Remove(e.ip, e.duid); err != nil {
+			t.Errorf("Remove(%v, %v) = %v, wanted nil err", e.ip, e.duid, err)
+		}
+		if a, b := c.Lookup(now, e.ip, e.duid); a != nil || b != nil {
+			t.Errorf("Lookup(%v, %v) returned removed entry", e.ip, e.duid)
+		}
+	}
+	if err := c.Remove(uip.Uip(1), d.Duid{0x01}); err == nil {
+		t.Errorf("Remove of removed entry returned nil err")
+	}
+}
+
+func TestTouch(t *testing.T) {
+	c := NewClients()
+	c.Inject(now, uip.Uip(1), d.Duid{0x01}, leaseLong)
+
+	if err := c.Touch(then, uip.Uip(1), d.Duid{0x02}); err == nil {
+		t.Errorf("Touch of mismatched ip and duid returned nil err")
+	}
+	if err := c.Touch(then, uip.Uip(1), d.Duid{0x01}); err != nil {
+		t.Errorf("Touch(1, 0x01) = %v, wanted nil err", err)
+	}
+	if ip, _ := c.Lookup(then, uip.Uip(1), nil); ip == nil || !ip.Updated().Equal(then) {
+		t.Errorf("Lookup(1) after Touch = %+v, wanted updated %v", ip, then)
+	}
+}
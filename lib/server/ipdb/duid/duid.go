@@ -1,7 +1,11 @@
 package duid
 
 import (
+	"bytes"
+	"encoding/hex"
 	"fmt"
+	"net"
+	"strings"
 )
 
 type Duid []byte
@@ -20,3 +24,27 @@ func (d Duid) String() string {
 
 	return fmt.Sprintf("<duid:%s>", string(buf))
 }
+
+// Parse parses a duid in the format returned by String(), the '<duid:' and '>' markers
+// are optional and bytes may also be separated by ':'.
+func Parse(s string) (Duid, error) {
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "<duid:"), ">")
+	var res Duid
+	for _, b := range strings.FieldsFunc(s, func(r rune) bool { return r == '-' || r == ':' }) {
+		v, err := hex.DecodeString(b)
+		if err != nil || len(v) != 1 {
+			return nil, fmt.Errorf("invalid duid byte '%s'", b)
+		}
+		res = append(res, v[0])
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("empty duid")
+	}
+	return res, nil
+}
+
+// HasHwAddr returns true if the duid was derived from the given hwaddr. This is the case for
+// our internal duids, client identifiers using the hwaddr and link-layer based DUIDs.
+func (d Duid) HasHwAddr(hw net.HardwareAddr) bool {
+	return len(hw) > 0 && len(d) > len(hw) && bytes.HasSuffix(d, hw)
+}
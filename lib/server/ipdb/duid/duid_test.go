@@ -0,0 +1,54 @@
+package duid
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParse(t *testing.T) {
+	input := []struct {
+		in   string
+		want Duid
+	}{
+		{in: "<duid:00-03-00-00-01-02>", want: Duid{0x00, 0x03, 0x00, 0x00, 0x01, 0x02}},
+		{in: "01-aa-BB", want: Duid{0x01, 0xaa, 0xbb}},
+		{in: "01:aa:bb", want: Duid{0x01, 0xaa, 0xbb}},
+		{in: "<duid:nil>"},
+		{in: ""},
+		{in: "01-aabb"},
+		{in: "xx"},
+	}
+	for _, test := range input {
+		got, err := Parse(test.in)
+		if test.want == nil && err == nil {
+			t.Errorf("Parse(%q) = %v, wanted err", test.in, got)
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("Parse(%q) had diff: %s", test.in, diff)
+		}
+	}
+	d := Duid{0x01, 0x02, 0xff}
+	if got, err := Parse(d.String()); err != nil || !cmp.Equal(d, got) {
+		t.Errorf("Parse(String()) = %v, %v; wanted %v, nil", got, err, d)
+	}
+}
+
+func TestHasHwAddr(t *testing.T) {
+	hw := net.HardwareAddr{0x01, 0x02, 0x03, 0x04, 0x05, 0x06}
+	input := []struct {
+		d    Duid
+		want bool
+	}{
+		{d: Duid{0x00, 0x03, 0x00, 0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06}, want: true},
+		{d: Duid{0x01, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06}, want: true},
+		{d: Duid{0x01, 0x02, 0x03, 0x04, 0x05, 0x06}, want: false},
+		{d: Duid{0x01, 0x01, 0x02, 0x03, 0x04, 0x05, 0x07}, want: false},
+	}
+	for _, test := range input {
+		if got := test.d.HasHwAddr(hw); got != test.want {
+			t.Errorf("%s.HasHwAddr(%s) = %v, want %v", test.d, hw, got, test.want)
+		}
+	}
+}
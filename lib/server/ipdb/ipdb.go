@@ -1,26 +1,57 @@
 package ipdb
 
 import (
+	"bytes"
 	"context"
 	"encoding/binary"
 	"fmt"
 	"math/rand"
 	"net"
+	"sort"
 	"sync"
 	"time"
 
 	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ipdb/clients"
 	d "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ipdb/duid"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ipdb/journal"
 	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ipdb/uip"
 )
 
+// Recorder gets notified about every change of the database.
+type Recorder interface {
+	Record(journal.Record) error
+}
+
+// Lease describes a client known to the database.
+type Lease struct {
+	IP        net.IP    // IP of the client.
+	Duid      d.Duid    // Client ID.
+	Until     time.Time // End of the lease, in the past for expired permanent clients.
+	Permanent bool      // True if the ip<>duid mapping never expires.
+	Hostname  string    // Hostname reported by the client, if any.
+	Updated   time.Time // Last transaction of the client, zero if unknown (eg. restored leases).
+}
+
+// Stats describes the utilisation of the database.
+type Stats struct {
+	Size        int // Number of usable IPs in the network.
+	Dynamic     int // Number of IPs in the dynamic range.
+	Leased      int // Number of active leases.
+	Permanent   int // Number of permanent clients.
+	Quarantined int // Number of quarantined IPs.
+	Free        int // Number of IPs in the dynamic range which can be handed out.
+}
+
 type IPDB struct {
 	sync.RWMutex
-	netFrom uip.Uip // Lowest IP we manage.
-	netTo   uip.Uip // Highest IP we manage.
-	dynFrom uip.Uip // Lowest IP to hand out while searching for IPs. If dynFrom and dynTo are set to zero, dynamic searches are disabled.
-	dynTo   uip.Uip // Highest IP to hand out while searching for IPs.
-	clients *clients.Clients
+	netFrom    uip.Uip // Lowest IP we manage.
+	netTo      uip.Uip // Highest IP we manage.
+	dynFrom    uip.Uip // Lowest IP to hand out while searching for IPs. If dynFrom and dynTo are set to zero, dynamic searches are disabled.
+	dynTo      uip.Uip // Highest IP to hand out while searching for IPs.
+	clients    *clients.Clients
+	recorder   Recorder              // Optional recorder, notified about all changes.
+	quarantine map[uip.Uip]time.Time // IPs which must not be handed out until the given time.
+	reserved   map[uip.Uip]bool      // Permanent clients added through Reserve, these survive a Reconfigure.
 }
 
 func New(network net.IP, netmask net.IPMask) (*IPDB, error) {
@@ -29,11 +60,13 @@ func New(network net.IP, netmask net.IPMask) (*IPDB, error) {
 		return nil, err
 	}
 	return &IPDB{
-		netFrom: from,
-		netTo:   to,
-		dynFrom: from,
-		dynTo:   to,
-		clients: clients.NewClients(),
+		netFrom:    from,
+		netTo:      to,
+		dynFrom:    from,
+		dynTo:      to,
+		clients:    clients.NewClients(),
+		quarantine: make(map[uip.Uip]time.Time),
+		reserved:   make(map[uip.Uip]bool),
 	}, nil
 }
 
@@ -81,6 +114,120 @@ func (ix *IPDB) LookupClientByDuid(duid d.Duid) (net.IP, error) {
 	return res.Uip().ToV4(), nil
 }
 
+// LookupClientByIP returns the duid of the client holding given IP.
+func (ix *IPDB) LookupClientByIP(ip net.IP) (d.Duid, error) {
+	ix.Lock()
+	defer ix.Unlock()
+
+	n, err := ix.toUip(ip)
+	if err != nil {
+		return nil, err
+	}
+	res, _ := ix.clients.Lookup(time.Now(), n, nil)
+	if res == nil {
+		return nil, fmt.Errorf("no such client found")
+	}
+	return res.Duid(), nil
+}
+
+// Leases returns all active leases and permanent clients, ordered by IP.
+func (ix *IPDB) Leases() []Lease {
+	ix.Lock()
+	defer ix.Unlock()
+
+	var res []Lease
+	for _, c := range ix.clients.All(time.Now()) {
+		res = append(res, toLease(c))
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return bytes.Compare(res[i].IP.To4(), res[j].IP.To4()) < 0
+	})
+	return res
+}
+
+// LeaseByIP returns the client holding given IP, false if there is none.
+func (ix *IPDB) LeaseByIP(ip net.IP) (Lease, bool) {
+	ix.Lock()
+	defer ix.Unlock()
+
+	n, err := ix.toUip(ip)
+	if err != nil {
+		return Lease{}, false
+	}
+	res, _ := ix.clients.Lookup(time.Now(), n, nil)
+	if res == nil {
+		return Lease{}, false
+	}
+	return toLease(res), true
+}
+
+// LeaseByDuid returns the client with given duid, false if there is none.
+func (ix *IPDB) LeaseByDuid(duid d.Duid) (Lease, bool) {
+	ix.Lock()
+	defer ix.Unlock()
+
+	_, res := ix.clients.Lookup(time.Now(), uip.Uip(0), duid)
+	if res == nil {
+		return Lease{}, false
+	}
+	return toLease(res), true
+}
+
+// client is an entry of clients.Clients.
+type client interface {
+	Uip() uip.Uip
+	Duid() d.Duid
+	LeasedUntil() time.Time
+	Permanent() bool
+	Hostname() string
+	Updated() time.Time
+}
+
+// toLease describes a client as lease.
+func toLease(c client) Lease {
+	return Lease{IP: c.Uip().ToV4(), Duid: c.Duid(), Until: c.LeasedUntil(), Permanent: c.Permanent(), Hostname: c.Hostname(), Updated: c.Updated()}
+}
+
+// Stats returns the current utilisation of the database.
+func (ix *IPDB) Stats() Stats {
+	ix.Lock()
+	defer ix.Unlock()
+
+	now := time.Now()
+	st := Stats{Size: 1 + int(ix.netTo-ix.netFrom)}
+	dynamic := ix.dynTo != 0 || ix.dynFrom != 0
+	if dynamic {
+		st.Dynamic = 1 + int(ix.dynTo-ix.dynFrom)
+	}
+	inDynamic := func(n uip.Uip) bool {
+		return dynamic && n >= ix.dynFrom && n <= ix.dynTo
+	}
+
+	// IPs of the dynamic range which can not be handed out.
+	used := make(map[uip.Uip]bool)
+	for _, c := range ix.clients.All(now) {
+		if c.LeasedUntil().After(now) {
+			st.Leased++
+		}
+		if c.Permanent() {
+			st.Permanent++
+		}
+		if inDynamic(c.Uip()) {
+			used[c.Uip()] = true
+		}
+	}
+	for n := range ix.quarantine {
+		if ix.quarantined(now, n) {
+			st.Quarantined++
+			if inDynamic(n) {
+				used[n] = true
+			}
+		}
+	}
+	st.Free = st.Dynamic - len(used)
+	return st
+}
+
 // AddPermanentClient injects a new client and marks it as permanent.
 // While the lease may expire, the ip<>duid mapping will not.
 func (ix *IPDB) AddPermanentClient(ip net.IP, duid d.Duid) error {
@@ -91,7 +238,152 @@ func (ix *IPDB) AddPermanentClient(ip net.IP, duid d.Duid) error {
 	if err != nil {
 		return err
 	}
-	return ix.clients.InjectPermanent(time.Now(), n, duid)
+	if err := ix.clients.InjectPermanent(time.Now(), n, duid); err != nil {
+		return err
+	}
+	return ix.record(journal.OpPermanent, n, duid, time.Unix(0, 0))
+}
+
+// Reserve adds a permanent client which is not part of the configuration.
+// Unlike clients added by AddPermanentClient, it is restored by Replay and kept by Reconfigure.
+func (ix *IPDB) Reserve(ip net.IP, duid d.Duid) error {
+	ix.Lock()
+	defer ix.Unlock()
+
+	n, err := ix.toUip(ip)
+	if err != nil {
+		return err
+	}
+	if err := ix.clients.InjectPermanent(time.Now(), n, duid); err != nil {
+		return err
+	}
+	ix.reserved[n] = true
+	return ix.record(journal.OpReserve, n, duid, time.Unix(0, 0))
+}
+
+// CheckReconfigure returns an error if Reconfigure can not apply the configuration of another IPDB.
+func (ix *IPDB) CheckReconfigure(o *IPDB) error {
+	ix.Lock()
+	defer ix.Unlock()
+	o.Lock()
+	defer o.Unlock()
+	return ix.checkReconfigure(o)
+}
+
+func (ix *IPDB) checkReconfigure(o *IPDB) error {
+	if ix.netFrom != o.netFrom || ix.netTo != o.netTo {
+		return fmt.Errorf("managed network differs")
+	}
+	return nil
+}
+
+// Reconfigure applies the configuration of another IPDB managing the same network: The dynamic range
+// and the set of permanent clients are taken over, dynamic leases and reservations are kept unless they
+// conflict with a new permanent client. Returns the number of added and removed permanent clients.
+// Nothing is changed if CheckReconfigure fails, otherwise all changes are applied even if some of them
+// could not be recorded: the first recording error is returned.
+func (ix *IPDB) Reconfigure(o *IPDB) (int, int, error) {
+	ix.Lock()
+	defer ix.Unlock()
+	o.Lock()
+	defer o.Unlock()
+
+	if err := ix.checkReconfigure(o); err != nil {
+		return 0, 0, err
+	}
+
+	now := time.Now()
+	key := func(n uip.Uip, duid d.Duid) string {
+		return n.String() + "/" + duid.String()
+	}
+	var rerr error
+	record := func(op string, n uip.Uip, duid d.Duid, until time.Time) {
+		if err := ix.record(op, n, duid, until); err != nil && rerr == nil {
+			rerr = err
+		}
+	}
+	// Entries to remove or inject were looked up before, so the clients can not refuse the changes.
+	drop := func(n uip.Uip, duid d.Duid) {
+		ix.clients.Remove(n, duid)
+		if ix.reserved[n] {
+			delete(ix.reserved, n)
+			record(journal.OpUnreserve, n, duid, time.Unix(0, 0))
+		} else {
+			record(journal.OpExpire, n, duid, time.Unix(0, 0))
+		}
+	}
+
+	want := make(map[string]bool)
+	for _, c := range o.clients.All(now) {
+		if c.Permanent() {
+			want[key(c.Uip(), c.Duid())] = true
+		}
+	}
+
+	// Drop permanent clients which are gone or changed.
+	have := make(map[string]bool)
+	removed := 0
+	for _, c := range ix.clients.All(now) {
+		if !c.Permanent() || ix.reserved[c.Uip()] {
+			continue
+		}
+		if want[key(c.Uip(), c.Duid())] {
+			have[key(c.Uip(), c.Duid())] = true
+			continue
+		}
+		drop(c.Uip(), c.Duid())
+		removed++
+	}
+
+	// Add new ones, replacing any existing lease of the IP or the duid.
+	added := 0
+	for _, c := range o.clients.All(now) {
+		if !c.Permanent() || have[key(c.Uip(), c.Duid())] {
+			continue
+		}
+		var until time.Time
+		oip, oduid := ix.clients.Lookup(now, c.Uip(), c.Duid())
+		if oip != nil {
+			if oip == oduid {
+				// The client already leased this IP: keep the lease.
+				until = oip.LeasedUntil()
+			}
+			drop(oip.Uip(), oip.Duid())
+		}
+		if oduid != nil && oduid != oip {
+			drop(oduid.Uip(), oduid.Duid())
+		}
+		ix.clients.InjectPermanent(now, c.Uip(), c.Duid())
+		record(journal.OpPermanent, c.Uip(), c.Duid(), time.Unix(0, 0))
+		if until.After(now) {
+			ix.clients.SetLease(now, c.Uip(), c.Duid(), until)
+			record(journal.OpLease, c.Uip(), c.Duid(), until)
+		}
+		added++
+	}
+
+	ix.dynFrom = o.dynFrom
+	ix.dynTo = o.dynTo
+	return added, removed, rerr
+}
+
+// Unreserve removes a client added by Reserve, including any lease it holds.
+func (ix *IPDB) Unreserve(ip net.IP, duid d.Duid) error {
+	ix.Lock()
+	defer ix.Unlock()
+
+	n, err := ix.toUip(ip)
+	if err != nil {
+		return err
+	}
+	if !ix.reserved[n] {
+		return fmt.Errorf("no reservation for this ip")
+	}
+	if err := ix.clients.Remove(n, duid); err != nil {
+		return err
+	}
+	delete(ix.reserved, n)
+	return ix.record(journal.OpUnreserve, n, duid, time.Unix(0, 0))
 }
 
 // SetClient updates the state of a client, inserting it if needed.
@@ -107,21 +399,186 @@ func (ix *IPDB) UpdateClient(ip net.IP, duid d.Duid, ttl time.Duration) error {
 	ltime := now.Add(ttl)
 
 	// First, just try an optimistic set.
-	if ix.clients.SetLease(now, n, duid, ltime) == nil {
+	if ix.clients.SetLease(now, n, duid, ltime) != nil {
+		// If this failed, we might need to inject first.
+		if err := ix.clients.Inject(now, n, duid, ltime); err != nil {
+			return err
+		}
+		if err := ix.clients.SetLease(now, n, duid, ltime); err != nil {
+			return err
+		}
+	}
+	ix.clients.Touch(now, n, duid)
+	// Keep the hostname of the client in the journal.
+	c, _ := ix.clients.Lookup(now, n, duid)
+	return ix.recordLease(n, duid, ltime, c.Hostname())
+}
+
+// SetHostname records the hostname reported by the client holding a lease for ip.
+func (ix *IPDB) SetHostname(ip net.IP, duid d.Duid, hostname string) error {
+	ix.Lock()
+	defer ix.Unlock()
+
+	n, err := ix.toUip(ip)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	c, _ := ix.clients.Lookup(now, n, duid)
+	if c == nil {
+		return fmt.Errorf("no such client found")
+	}
+	if c.Hostname() == hostname {
+		// Nothing changed, no need to record anything.
 		return nil
 	}
-	// If this failed, we might need to inject first.
-	if err := ix.clients.Inject(now, n, duid, ltime); err != nil {
+	if err := ix.clients.SetHostname(now, n, duid, hostname); err != nil {
+		return err
+	}
+	return ix.recordLease(n, duid, c.LeasedUntil(), hostname)
+}
+
+// ExpireClient terminates the lease of a client.
+func (ix *IPDB) ExpireClient(ip net.IP, duid d.Duid) error {
+	ix.Lock()
+	defer ix.Unlock()
+
+	n, err := ix.toUip(ip)
+	if err != nil {
+		return err
+	}
+	if err := ix.clients.Expire(time.Now(), n, duid); err != nil {
 		return err
 	}
-	return ix.clients.SetLease(now, n, duid, ltime)
+	return ix.record(journal.OpExpire, n, duid, time.Unix(0, 0))
+}
+
+// SetRecorder configures the recorder to notify about all future changes.
+func (ix *IPDB) SetRecorder(r Recorder) {
+	ix.Lock()
+	defer ix.Unlock()
+	ix.recorder = r
+}
+
+// Replay applies previously recorded changes to the database and returns the number of restored leases.
+// Records outside of our network are ignored, as are permanent records: those are part of the configuration.
+// Reservations are restored unless they conflict with the configuration.
+func (ix *IPDB) Replay(records []journal.Record) int {
+	ix.Lock()
+	defer ix.Unlock()
+
+	now := time.Now()
+	for _, rec := range records {
+		n, err := ix.toUip(rec.IP)
+		if err != nil {
+			continue
+		}
+		switch rec.Op {
+		case journal.OpLease:
+			if ix.clients.SetLease(now, n, rec.Duid, rec.Until) != nil && rec.Until.After(now) {
+				ix.clients.Inject(now, n, rec.Duid, rec.Until)
+			}
+			ix.clients.SetHostname(now, n, rec.Duid, rec.Hostname)
+		case journal.OpExpire:
+			ix.clients.Expire(now, n, rec.Duid)
+		case journal.OpReserve:
+			if ix.clients.InjectPermanent(now, n, rec.Duid) == nil {
+				ix.reserved[n] = true
+			}
+		case journal.OpUnreserve:
+			if ix.reserved[n] && ix.clients.Remove(n, rec.Duid) == nil {
+				delete(ix.reserved, n)
+			}
+		}
+	}
+
+	restored := 0
+	for _, c := range ix.clients.All(now) {
+		if !c.Permanent() {
+			restored++
+		}
+	}
+	return restored
+}
+
+// Snapshot returns the current state of the database as a list of records.
+func (ix *IPDB) Snapshot() []journal.Record {
+	ix.Lock()
+	defer ix.Unlock()
+
+	now := time.Now()
+	var res []journal.Record
+	for _, c := range ix.clients.All(now) {
+		if c.Permanent() && ix.reserved[c.Uip()] {
+			res = append(res, journal.Record{Op: journal.OpReserve, IP: c.Uip().ToV4(), Duid: c.Duid(), Until: time.Unix(0, 0)})
+		} else if c.Permanent() {
+			res = append(res, journal.Record{Op: journal.OpPermanent, IP: c.Uip().ToV4(), Duid: c.Duid(), Until: time.Unix(0, 0)})
+		}
+		if c.LeasedUntil().After(now) {
+			res = append(res, journal.Record{Op: journal.OpLease, IP: c.Uip().ToV4(), Duid: c.Duid(), Until: c.LeasedUntil(), Hostname: c.Hostname()})
+		}
+	}
+	return res
+}
+
+// record passes a change to the configured recorder, if any.
+func (ix *IPDB) record(op string, n uip.Uip, duid d.Duid, until time.Time) error {
+	if ix.recorder == nil {
+		return nil
+	}
+	return ix.recorder.Record(journal.Record{Op: op, IP: n.ToV4(), Duid: duid, Until: until})
+}
+
+// recordLease passes a lease, including the hostname of the client, to the configured recorder, if any.
+func (ix *IPDB) recordLease(n uip.Uip, duid d.Duid, until time.Time, hostname string) error {
+	if ix.recorder == nil {
+		return nil
+	}
+	return ix.recorder.Record(journal.Record{Op: journal.OpLease, IP: n.ToV4(), Duid: duid, Until: until, Hostname: hostname})
+}
+
+// OverlapsDynamicRange returns true if FindIP may hand out any IP between begin and end,
+// both of which must be in the managed range.
+func (ix *IPDB) OverlapsDynamicRange(begin, end net.IP) bool {
+	ix.Lock()
+	defer ix.Unlock()
+
+	b, berr := ix.toUip(begin)
+	e, eerr := ix.toUip(end)
+	if berr != nil || eerr != nil || (ix.dynFrom == 0 && ix.dynTo == 0) {
+		return false
+	}
+	return b <= ix.dynTo && e >= ix.dynFrom
 }
 
 // FindIP attempts to find an IP for given duid, having a bias for the suggested IP.
 func (ix *IPDB) FindIP(ctx context.Context, isFree func(context.Context, net.IP) bool, ip net.IP, duid d.Duid) (net.IP, error) {
 	ix.Lock()
 	defer ix.Unlock()
+	return ix.findIP(ctx, isFree, ip, duid, ix.dynFrom, ix.dynTo)
+}
+
+// FindIPInRange works like FindIP, but searches between begin and end instead of the dynamic range.
+func (ix *IPDB) FindIPInRange(ctx context.Context, isFree func(context.Context, net.IP) bool, ip net.IP, duid d.Duid, begin, end net.IP) (net.IP, error) {
+	ix.Lock()
+	defer ix.Unlock()
+
+	b, err := ix.toUip(begin)
+	if err != nil {
+		return nil, err
+	}
+	e, err := ix.toUip(end)
+	if err != nil {
+		return nil, err
+	}
+	if b > e {
+		return nil, fmt.Errorf("begin of range can not be larger than end")
+	}
+	return ix.findIP(ctx, isFree, ip, duid, b, e)
+}
 
+// findIP implements FindIP for the range from-to, searches are disabled if both are zero.
+func (ix *IPDB) findIP(ctx context.Context, isFree func(context.Context, net.IP) bool, ip net.IP, duid d.Duid, from, to uip.Uip) (net.IP, error) {
 	n, err := ix.toUip(ip)
 	if err != nil {
 		// Suggested IP not in range, just ignore it.
@@ -131,31 +588,74 @@ func (ix *IPDB) FindIP(ctx context.Context, isFree func(context.Context, net.IP)
 	oip, oduid := ix.clients.Lookup(time.Now(), n, duid)
 	if oduid != nil {
 		// This duid already has a lease.
+		if ix.quarantined(time.Now(), oduid.Uip()) {
+			return nil, fmt.Errorf("ip of existing lease is quarantined")
+		}
 		return oduid.Uip().ToV4(), nil
 	}
 
-	if ix.dynTo == 0 && ix.dynFrom == 0 {
+	if to == 0 && from == 0 {
 		return nil, fmt.Errorf("dynamic searches are disabled")
 	}
 
-	p := rand.Perm(1 + int(ix.dynTo-ix.dynFrom))
-	if oip == nil {
-		p = append([]int{int(n - ix.dynFrom)}, p...)
+	p := rand.Perm(1 + int(to-from))
+	if oip == nil && n >= from && n <= to {
+		p = append([]int{int(n - from)}, p...)
 	}
 
 	for _, v := range p {
 		if ctx.Err() != nil {
 			break
 		}
-		picked := ix.dynFrom + uip.Uip(v)
+		picked := from + uip.Uip(v)
 		e, _ := ix.clients.Lookup(time.Now(), picked, nil)
-		if e == nil && picked.Valid() && isFree(ctx, picked.ToV4()) {
+		if e == nil && picked.Valid() && !ix.quarantined(time.Now(), picked) && isFree(ctx, picked.ToV4()) {
 			return picked.ToV4(), nil
 		}
 	}
 	return nil, fmt.Errorf("no free ip found")
 }
 
+// Quarantine marks an IP as unusable for the given duration after the client with the given duid declined it.
+// The lease of the client is terminated, but permanent mappings are kept.
+func (ix *IPDB) Quarantine(ip net.IP, duid d.Duid, period time.Duration) error {
+	ix.Lock()
+	defer ix.Unlock()
+
+	n, err := ix.toUip(ip)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := ix.clients.Expire(now, n, duid); err != nil {
+		return err
+	}
+	ix.quarantine[n] = now.Add(period)
+	return ix.record(journal.OpExpire, n, duid, time.Unix(0, 0))
+}
+
+// QuarantinedUntil returns the end of the quarantine of an IP and true if the IP is currently quarantined.
+func (ix *IPDB) QuarantinedUntil(ip net.IP) (time.Time, bool) {
+	ix.Lock()
+	defer ix.Unlock()
+
+	n, err := ix.toUip(ip)
+	if err != nil || !ix.quarantined(time.Now(), n) {
+		return time.Time{}, false
+	}
+	return ix.quarantine[n], true
+}
+
+// quarantined returns true if the IP must not be handed out, purging stale entries.
+func (ix *IPDB) quarantined(now time.Time, n uip.Uip) bool {
+	until, ok := ix.quarantine[n]
+	if ok && now.After(until) {
+		delete(ix.quarantine, n)
+		return false
+	}
+	return ok
+}
+
 // InManagedRange returns 'true' if given ip is in the network range we manage.
 func (ix *IPDB) InManagedRange(ip net.IP) bool {
 	if _, err := ix.toUip(ip); err == nil {
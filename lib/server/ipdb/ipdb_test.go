@@ -2,11 +2,13 @@ package ipdb
 
 import (
 	"context"
+	"fmt"
 	"net"
 	"testing"
 	"time"
 
 	d "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ipdb/duid"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ipdb/journal"
 	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ipdb/uip"
 )
 
@@ -161,6 +163,71 @@ func TestSetDynamicRange(t *testing.T) {
 	}
 }
 
+func TestFindIPInRange(t *testing.T) {
+	db, err := New(net.IPv4(192, 168, 0, 0), net.IPv4Mask(255, 255, 255, 0))
+	if err != nil {
+		t.Fatalf("failed to create IPdb")
+	}
+
+	ctx := context.Background()
+	ip10 := net.IPv4(192, 168, 0, 10)
+	ip11 := net.IPv4(192, 168, 0, 11)
+	ip50 := net.IPv4(192, 168, 0, 50)
+	isFree := func(ctx context.Context, ip net.IP) bool {
+		return true
+	}
+
+	// The pool is used even if dynamic searches are disabled.
+	db.DisableDynamic()
+	if err := db.AddPermanentClient(ip10, d.Duid{0x10}); err != nil {
+		t.Errorf("AddPermanentClient(ip10) = %v, wanted nil err", err)
+	}
+	for i := 0; i < 10; i++ {
+		// The suggested IP is outside of the pool and must be ignored.
+		if ip, err := db.FindIPInRange(ctx, isFree, ip50, d.Duid{0x99}, ip10, ip11); err != nil || !ip.Equal(ip11) {
+			t.Errorf("FindIPInRange(#pool) = %v, %v; wanted %s, nil err", ip, err, ip11)
+		}
+	}
+	// Existing leases are returned even if they are outside of the pool.
+	if ip, err := db.FindIPInRange(ctx, isFree, net.IPv4(0, 0, 0, 0), d.Duid{0x10}, ip11, ip11); err != nil || !ip.Equal(ip10) {
+		t.Errorf("FindIPInRange(#permanent) = %v, %v; wanted %s, nil err", ip, err, ip10)
+	}
+	if _, err := db.FindIPInRange(ctx, isFree, nil, d.Duid{0x99}, ip11, ip10); err == nil {
+		t.Errorf("FindIPInRange(#reversed) returned nil err, wanted non-nil")
+	}
+	if _, err := db.FindIPInRange(ctx, isFree, nil, d.Duid{0x99}, ip10, net.IPv4(192, 168, 1, 1)); err == nil {
+		t.Errorf("FindIPInRange(#outside) returned nil err, wanted non-nil")
+	}
+}
+
+func TestOverlapsDynamicRange(t *testing.T) {
+	db, err := New(net.IPv4(192, 168, 0, 0), net.IPv4Mask(255, 255, 255, 0))
+	if err != nil {
+		t.Fatalf("Could not create ipdb: %v", err)
+	}
+	if err := db.SetDynamicRange(net.IPv4(192, 168, 0, 10), net.IPv4(192, 168, 0, 20)); err != nil {
+		t.Fatalf("SetDynamicRange failed: %v", err)
+	}
+	for _, test := range []struct {
+		begin, end net.IP
+		want       bool
+	}{
+		{net.IPv4(192, 168, 0, 1), net.IPv4(192, 168, 0, 9), false},
+		{net.IPv4(192, 168, 0, 1), net.IPv4(192, 168, 0, 10), true},
+		{net.IPv4(192, 168, 0, 12), net.IPv4(192, 168, 0, 14), true},
+		{net.IPv4(192, 168, 0, 20), net.IPv4(192, 168, 0, 30), true},
+		{net.IPv4(192, 168, 0, 21), net.IPv4(192, 168, 0, 30), false},
+	} {
+		if got := db.OverlapsDynamicRange(test.begin, test.end); got != test.want {
+			t.Errorf("OverlapsDynamicRange(%s, %s) = %v, wanted %v", test.begin, test.end, got, test.want)
+		}
+	}
+	db.DisableDynamic()
+	if db.OverlapsDynamicRange(net.IPv4(192, 168, 0, 1), net.IPv4(192, 168, 0, 254)) {
+		t.Errorf("OverlapsDynamicRange() = true with dynamic searches disabled, wanted false")
+	}
+}
+
 func TestToUip(t *testing.T) {
 	db, err := New(net.IPv4(10, 0, 0, 0), net.IPv4Mask(255, 0, 0, 0))
 	if err != nil {
@@ -340,3 +407,446 @@ func TestInManagedRange(t *testing.T) {
 		}
 	}
 }
+
+type fakeRecorder []journal.Record
+
+func (f *fakeRecorder) Record(rec journal.Record) error {
+	*f = append(*f, rec)
+	return nil
+}
+
+// failingRecorder refuses all records.
+type failingRecorder struct{}
+
+func (failingRecorder) Record(rec journal.Record) error {
+	return fmt.Errorf("disk full")
+}
+
+func TestReplayAndSnapshot(t *testing.T) {
+	db, err := New(net.IPv4(192, 168, 0, 0), net.IPv4Mask(255, 255, 255, 0))
+	if err != nil {
+		t.Fatalf("Could not create ipdb: %v", err)
+	}
+	rec := &fakeRecorder{}
+	db.SetRecorder(rec)
+
+	ip1 := net.IPv4(192, 168, 0, 1)
+	ip2 := net.IPv4(192, 168, 0, 2)
+	ip3 := net.IPv4(192, 168, 0, 3)
+	db.AddPermanentClient(ip1, d.Duid{0x1})
+	db.UpdateClient(ip2, d.Duid{0x2}, 5*time.Minute)
+	db.UpdateClient(ip3, d.Duid{0x3}, 5*time.Minute)
+	if err := db.ExpireClient(ip3, d.Duid{0x3}); err != nil {
+		t.Errorf("ExpireClient(ip3) = %v, wanted nil err", err)
+	}
+	if len(*rec) != 4 {
+		t.Errorf("Recorder got %d records, wanted 4: %+v", len(*rec), *rec)
+	}
+
+	// Replay into a fresh database: permanent entries are expected to come from the configuration.
+	ndb, err := New(net.IPv4(192, 168, 0, 0), net.IPv4Mask(255, 255, 255, 0))
+	if err != nil {
+		t.Fatalf("Could not create ipdb: %v", err)
+	}
+	replay := append(*rec, journal.Record{Op: journal.OpLease, IP: net.IPv4(10, 0, 0, 1), Duid: d.Duid{0x4}, Until: time.Now().Add(time.Hour)})
+	if n := ndb.Replay(replay); n != 1 {
+		t.Errorf("Replay() = %d, wanted 1", n)
+	}
+	if ip, err := ndb.LookupClientByDuid(d.Duid{0x2}); err != nil || !ip.Equal(ip2) {
+		t.Errorf("LookupClientByDuid(0x2) = %v, %v; wanted %v, nil", ip, err, ip2)
+	}
+	for _, duid := range []d.Duid{{0x1}, {0x3}, {0x4}} {
+		if ip, err := ndb.LookupClientByDuid(duid); err == nil {
+			t.Errorf("LookupClientByDuid(%s) = %v, wanted err", duid, ip)
+		}
+	}
+
+	snap := db.Snapshot()
+	ops := map[string]int{}
+	for _, r := range snap {
+		ops[r.Op]++
+	}
+	if ops[journal.OpPermanent] != 1 || ops[journal.OpLease] != 1 || ops[journal.OpExpire] != 0 {
+		t.Errorf("Snapshot() returned unexpected records: %+v", snap)
+	}
+}
+
+func TestExpireClient(t *testing.T) {
+	db, err := New(net.IPv4(192, 168, 0, 0), net.IPv4Mask(255, 255, 255, 0))
+	if err != nil {
+		t.Fatalf("Could not create ipdb: %v", err)
+	}
+	ctx := context.Background()
+	isFree := func(ctx context.Context, ip net.IP) bool {
+		return true
+	}
+
+	ip1 := net.IPv4(192, 168, 0, 1)
+	ip2 := net.IPv4(192, 168, 0, 2)
+	db.AddPermanentClient(ip1, d.Duid{0x1})
+	db.UpdateClient(ip1, d.Duid{0x1}, 5*time.Minute)
+	db.UpdateClient(ip2, d.Duid{0x2}, 5*time.Minute)
+
+	if err := db.ExpireClient(ip2, d.Duid{0x1}); err == nil {
+		t.Errorf("ExpireClient(#wrong duid) returned nil err, wanted non-nil")
+	}
+	if err := db.ExpireClient(ip2, d.Duid{0x2}); err != nil {
+		t.Errorf("ExpireClient(ip2) = %v, wanted nil err", err)
+	}
+	if ip, err := db.LookupClientByDuid(d.Duid{0x2}); err == nil {
+		t.Errorf("LookupClientByDuid(0x2) = %v, wanted err", ip)
+	}
+
+	// Permanent mappings must survive an expiration.
+	if err := db.ExpireClient(ip1, d.Duid{0x1}); err != nil {
+		t.Errorf("ExpireClient(ip1) = %v, wanted nil err", err)
+	}
+	if ip, err := db.FindIP(ctx, isFree, nil, d.Duid{0x1}); err != nil || !ip.Equal(ip1) {
+		t.Errorf("FindIP(0x1) = %v, %v; wanted %v, nil", ip, err, ip1)
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	// Range is limited to 192.168.0.1 - 192.168.0.6
+	db, err := New(net.IPv4(192, 168, 0, 1), net.IPv4Mask(255, 255, 255, 248))
+	if err != nil {
+		t.Fatalf("failed to create ipdb: %v", err)
+	}
+	ctx := context.Background()
+	isFree := func(ctx context.Context, ip net.IP) bool {
+		return true
+	}
+
+	ip2 := net.IPv4(192, 168, 0, 2)
+	ip3 := net.IPv4(192, 168, 0, 3)
+	db.AddPermanentClient(ip3, d.Duid{0x3})
+	db.UpdateClient(ip2, d.Duid{0x2}, 5*time.Minute)
+
+	if err := db.Quarantine(ip2, d.Duid{0x9}, time.Hour); err == nil {
+		t.Errorf("Quarantine(#wrong duid) returned nil err, wanted non-nil")
+	}
+	if _, ok := db.QuarantinedUntil(ip2); ok {
+		t.Errorf("QuarantinedUntil(ip2) = true, wanted false")
+	}
+	if err := db.Quarantine(ip2, d.Duid{0x2}, time.Hour); err != nil {
+		t.Errorf("Quarantine(ip2) = %v, wanted nil err", err)
+	}
+	if until, ok := db.QuarantinedUntil(ip2); !ok || until.Before(time.Now()) {
+		t.Errorf("QuarantinedUntil(ip2) = %v, %v; wanted future time, true", until, ok)
+	}
+
+	// Neither the declining client nor anybody else may get ip2, even if suggested.
+	for i := 0; i < 30; i++ {
+		for _, duid := range []d.Duid{{0x2}, {0x4}} {
+			if ip, err := db.FindIP(ctx, isFree, ip2, duid); err != nil || ip.Equal(ip2) {
+				t.Errorf("FindIP(%s) = %v, %v; wanted non-quarantined IP", duid, ip, err)
+			}
+		}
+	}
+
+	// A quarantined permanent IP is not handed out either.
+	if err := db.Quarantine(ip3, d.Duid{0x3}, time.Hour); err != nil {
+		t.Errorf("Quarantine(ip3) = %v, wanted nil err", err)
+	}
+	if ip, err := db.FindIP(ctx, isFree, nil, d.Duid{0x3}); err == nil {
+		t.Errorf("FindIP(0x3) = %v, wanted err", ip)
+	}
+
+	// Expired quarantines are lifted.
+	if err := db.Quarantine(ip3, d.Duid{0x3}, -time.Second); err != nil {
+		t.Errorf("Quarantine(ip3) = %v, wanted nil err", err)
+	}
+	if ip, err := db.FindIP(ctx, isFree, nil, d.Duid{0x3}); err != nil || !ip.Equal(ip3) {
+		t.Errorf("FindIP(0x3) = %v, %v; wanted %v, nil", ip, err, ip3)
+	}
+}
+
+func TestReconfigure(t *testing.T) {
+	db, err := New(net.IPv4(192, 168, 0, 0), net.IPv4Mask(255, 255, 255, 0))
+	if err != nil {
+		t.Fatalf("Could not create ipdb: %v", err)
+	}
+	rec := &fakeRecorder{}
+	db.SetRecorder(rec)
+
+	ip1 := net.IPv4(192, 168, 0, 1)
+	ip2 := net.IPv4(192, 168, 0, 2)
+	ip3 := net.IPv4(192, 168, 0, 3)
+	ip4 := net.IPv4(192, 168, 0, 4)
+	db.AddPermanentClient(ip1, d.Duid{0x1}) // Unchanged.
+	db.AddPermanentClient(ip2, d.Duid{0x2}) // Removed.
+	db.UpdateClient(ip3, d.Duid{0x3}, 5*time.Minute)
+	db.UpdateClient(ip4, d.Duid{0x4}, 5*time.Minute)
+
+	ndb, err := New(net.IPv4(192, 168, 0, 0), net.IPv4Mask(255, 255, 255, 0))
+	if err != nil {
+		t.Fatalf("Could not create ipdb: %v", err)
+	}
+	ndb.AddPermanentClient(ip1, d.Duid{0x1})
+	ndb.AddPermanentClient(ip3, d.Duid{0x5}) // Takes the IP of a dynamic lease.
+	ndb.AddPermanentClient(ip4, d.Duid{0x4}) // Pins an existing dynamic lease.
+	ndb.DisableDynamic()
+
+	other, err := New(net.IPv4(10, 0, 0, 0), net.IPv4Mask(255, 255, 255, 0))
+	if err != nil {
+		t.Fatalf("Could not create ipdb: %v", err)
+	}
+	if _, _, err := db.Reconfigure(other); err == nil {
+		t.Errorf("Reconfigure(#other network) returned nil err, wanted non-nil")
+	}
+	if err := db.CheckReconfigure(other); err == nil {
+		t.Errorf("CheckReconfigure(#other network) returned nil err, wanted non-nil")
+	}
+
+	added, removed, err := db.Reconfigure(ndb)
+	if err != nil || added != 2 || removed != 1 {
+		t.Errorf("Reconfigure() = %d, %d, %v; wanted 2, 1, nil", added, removed, err)
+	}
+
+	ctx := context.Background()
+	isFree := func(ctx context.Context, ip net.IP) bool {
+		return true
+	}
+	for _, test := range []struct {
+		duid d.Duid
+		want net.IP
+	}{
+		{d.Duid{0x1}, ip1},
+		{d.Duid{0x2}, nil},
+		{d.Duid{0x3}, nil},
+		{d.Duid{0x4}, ip4},
+		{d.Duid{0x5}, ip3},
+	} {
+		ip, err := db.FindIP(ctx, isFree, nil, test.duid)
+		if test.want == nil && err == nil {
+			t.Errorf("FindIP(%s) = %v, wanted err (dynamic searches are disabled)", test.duid, ip)
+		}
+		if test.want != nil && (err != nil || !ip.Equal(test.want)) {
+			t.Errorf("FindIP(%s) = %v, %v; wanted %v, nil", test.duid, ip, err, test.want)
+		}
+	}
+
+	// The pinned lease must survive a restart.
+	rdb, err := New(net.IPv4(192, 168, 0, 0), net.IPv4Mask(255, 255, 255, 0))
+	if err != nil {
+		t.Fatalf("Could not create ipdb: %v", err)
+	}
+	if n := rdb.Replay(*rec); n != 1 {
+		t.Errorf("Replay() = %d, wanted 1: %+v", n, *rec)
+	}
+}
+
+func TestReconfigureRecordError(t *testing.T) {
+	db, err := New(net.IPv4(192, 168, 0, 0), net.IPv4Mask(255, 255, 255, 0))
+	if err != nil {
+		t.Fatalf("Could not create ipdb: %v", err)
+	}
+	ip1 := net.IPv4(192, 168, 0, 1)
+	ip2 := net.IPv4(192, 168, 0, 2)
+	db.AddPermanentClient(ip1, d.Duid{0x1})
+	db.SetRecorder(failingRecorder{})
+
+	ndb, err := New(net.IPv4(192, 168, 0, 0), net.IPv4Mask(255, 255, 255, 0))
+	if err != nil {
+		t.Fatalf("Could not create ipdb: %v", err)
+	}
+	ndb.AddPermanentClient(ip2, d.Duid{0x2})
+	if err := db.CheckReconfigure(ndb); err != nil {
+		t.Fatalf("CheckReconfigure() = %v, wanted nil err", err)
+	}
+
+	// All changes are applied, even if they can not be recorded.
+	if added, removed, err := db.Reconfigure(ndb); err == nil || added != 1 || removed != 1 {
+		t.Errorf("Reconfigure() = %d, %d, %v; wanted 1, 1, non-nil err", added, removed, err)
+	}
+	if ip, err := db.LookupClientByDuid(d.Duid{0x1}); err == nil {
+		t.Errorf("LookupClientByDuid(0x1) = %v, wanted err for removed client", ip)
+	}
+	if ip, err := db.LookupClientByDuid(d.Duid{0x2}); err != nil || !ip.Equal(ip2) {
+		t.Errorf("LookupClientByDuid(0x2) = %v, %v; wanted %v, nil", ip, err, ip2)
+	}
+}
+
+func TestLeasesAndStats(t *testing.T) {
+	// Range is limited to 192.168.0.1 - 192.168.0.6
+	db, err := New(net.IPv4(192, 168, 0, 1), net.IPv4Mask(255, 255, 255, 248))
+	if err != nil {
+		t.Fatalf("failed to create ipdb: %v", err)
+	}
+	if err := db.SetDynamicRange(net.IPv4(192, 168, 0, 4), net.IPv4(192, 168, 0, 6)); err != nil {
+		t.Fatalf("SetDynamicRange failed: %v", err)
+	}
+
+	ip1 := net.IPv4(192, 168, 0, 1)
+	ip2 := net.IPv4(192, 168, 0, 2)
+	ip5 := net.IPv4(192, 168, 0, 5)
+	db.UpdateClient(ip5, d.Duid{0x5}, 5*time.Minute)
+	db.AddPermanentClient(ip1, d.Duid{0x1})
+	db.UpdateClient(ip1, d.Duid{0x1}, 5*time.Minute)
+	db.AddPermanentClient(ip2, d.Duid{0x2})
+	db.UpdateClient(net.IPv4(192, 168, 0, 6), d.Duid{0x6}, 5*time.Minute)
+	db.Quarantine(net.IPv4(192, 168, 0, 6), d.Duid{0x6}, time.Hour)
+
+	leases := db.Leases()
+	if len(leases) != 3 {
+		t.Fatalf("Leases() returned %d leases, wanted 3: %+v", len(leases), leases)
+	}
+	for i, want := range []Lease{
+		{IP: ip1.To4(), Duid: d.Duid{0x1}, Permanent: true},
+		{IP: ip2.To4(), Duid: d.Duid{0x2}, Permanent: true},
+		{IP: ip5.To4(), Duid: d.Duid{0x5}},
+	} {
+		got := leases[i]
+		if !got.IP.Equal(want.IP) || got.Duid.String() != want.Duid.String() || got.Permanent != want.Permanent {
+			t.Errorf("Leases()[%d] = %+v, want %+v", i, got, want)
+		}
+	}
+
+	want := Stats{Size: 6, Dynamic: 3, Leased: 2, Permanent: 2, Quarantined: 1, Free: 1}
+	if got := db.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+
+	if duid, err := db.LookupClientByIP(ip5); err != nil || duid.String() != (d.Duid{0x5}).String() {
+		t.Errorf("LookupClientByIP(ip5) = %v, %v; wanted 0x5, nil", duid, err)
+	}
+	if duid, err := db.LookupClientByIP(net.IPv4(192, 168, 0, 3)); err == nil {
+		t.Errorf("LookupClientByIP(#unused) = %v, wanted err", duid)
+	}
+}
+
+func TestReserve(t *testing.T) {
+	db, err := New(net.IPv4(192, 168, 0, 0), net.IPv4Mask(255, 255, 255, 0))
+	if err != nil {
+		t.Fatalf("Could not create ipdb: %v", err)
+	}
+	rec := &fakeRecorder{}
+	db.SetRecorder(rec)
+
+	ip1 := net.IPv4(192, 168, 0, 1)
+	ip2 := net.IPv4(192, 168, 0, 2)
+	ip3 := net.IPv4(192, 168, 0, 3)
+	db.AddPermanentClient(ip1, d.Duid{0x1})
+	db.UpdateClient(ip2, d.Duid{0x2}, 5*time.Minute)
+	if err := db.Reserve(ip2, d.Duid{0x3}); err == nil {
+		t.Errorf("Reserve(#leased ip) returned nil err, wanted non-nil")
+	}
+	if err := db.Reserve(ip3, d.Duid{0x3}); err != nil {
+		t.Errorf("Reserve(ip3) = %v, wanted nil err", err)
+	}
+
+	if err := db.Unreserve(ip1, d.Duid{0x1}); err == nil {
+		t.Errorf("Unreserve(#configured) returned nil err, wanted non-nil")
+	}
+	if err := db.Unreserve(ip2, d.Duid{0x2}); err == nil {
+		t.Errorf("Unreserve(#dynamic) returned nil err, wanted non-nil")
+	}
+	if err := db.Unreserve(ip3, d.Duid{0x2}); err == nil {
+		t.Errorf("Unreserve(#wrong duid) returned nil err, wanted non-nil")
+	}
+
+	// Reservations are restored from the journal and kept by a new configuration.
+	ndb, err := New(net.IPv4(192, 168, 0, 0), net.IPv4Mask(255, 255, 255, 0))
+	if err != nil {
+		t.Fatalf("Could not create ipdb: %v", err)
+	}
+	ndb.Replay(db.Snapshot())
+	if le, ok := ndb.LeaseByDuid(d.Duid{0x3}); !ok || !le.IP.Equal(ip3) || !le.Permanent {
+		t.Errorf("LeaseByDuid(0x3) = %+v, %v; wanted the restored reservation", le, ok)
+	}
+	cdb, err := New(net.IPv4(192, 168, 0, 0), net.IPv4Mask(255, 255, 255, 0))
+	if err != nil {
+		t.Fatalf("Could not create ipdb: %v", err)
+	}
+	if added, removed, err := db.Reconfigure(cdb); err != nil || added != 0 || removed != 1 {
+		t.Errorf("Reconfigure() = %d, %d, %v; wanted 0, 1, nil", added, removed, err)
+	}
+	if ip, err := db.LookupClientByDuid(d.Duid{0x3}); err != nil || !ip.Equal(ip3) {
+		t.Errorf("LookupClientByDuid(0x3) = %v, %v; wanted %v, nil", ip, err, ip3)
+	}
+
+	if err := db.Unreserve(ip3, d.Duid{0x3}); err != nil {
+		t.Errorf("Unreserve(ip3) = %v, wanted nil err", err)
+	}
+	if ip, err := db.LookupClientByDuid(d.Duid{0x3}); err == nil {
+		t.Errorf("LookupClientByDuid(0x3) = %v, wanted err", ip)
+	}
+	rdb, err := New(net.IPv4(192, 168, 0, 0), net.IPv4Mask(255, 255, 255, 0))
+	if err != nil {
+		t.Fatalf("Could not create ipdb: %v", err)
+	}
+	rdb.Replay(*rec)
+	if ip, err := rdb.LookupClientByDuid(d.Duid{0x3}); err == nil {
+		t.Errorf("LookupClientByDuid(0x3) after Replay() = %v, wanted err", ip)
+	}
+}
+
+func TestHostname(t *testing.T) {
+	db, err := New(net.IPv4(192, 168, 0, 0), net.IPv4Mask(255, 255, 255, 0))
+	if err != nil {
+		t.Fatalf("Could not create ipdb: %v", err)
+	}
+	rec := &fakeRecorder{}
+	db.SetRecorder(rec)
+
+	ip1 := net.IPv4(192, 168, 0, 1)
+	if err := db.SetHostname(ip1, d.Duid{0x1}, "foo"); err == nil {
+		t.Errorf("SetHostname(#no lease) returned nil err, wanted non-nil")
+	}
+	db.UpdateClient(ip1, d.Duid{0x1}, 5*time.Minute)
+	if err := db.SetHostname(ip1, d.Duid{0x2}, "foo"); err == nil {
+		t.Errorf("SetHostname(#wrong duid) returned nil err, wanted non-nil")
+	}
+	for i := 0; i < 3; i++ {
+		if err := db.SetHostname(ip1, d.Duid{0x1}, "foo"); err != nil {
+			t.Errorf("SetHostname(ip1) = %v, wanted nil err", err)
+		}
+	}
+	// Renewals must keep the hostname.
+	db.UpdateClient(ip1, d.Duid{0x1}, 5*time.Minute)
+
+	// Unchanged hostnames are only recorded once.
+	if len(*rec) != 3 {
+		t.Errorf("Recorder got %d records, wanted 3: %+v", len(*rec), *rec)
+	}
+	if leases := db.Leases(); len(leases) != 1 || leases[0].Hostname != "foo" {
+		t.Errorf("Leases() = %+v, wanted a single lease with hostname foo", leases)
+	}
+
+	ndb, err := New(net.IPv4(192, 168, 0, 0), net.IPv4Mask(255, 255, 255, 0))
+	if err != nil {
+		t.Fatalf("Could not create ipdb: %v", err)
+	}
+	ndb.Replay(*rec)
+	if leases := ndb.Leases(); len(leases) != 1 || leases[0].Hostname != "foo" {
+		t.Errorf("Leases(#replayed) = %+v, wanted a single lease with hostname foo", leases)
+	}
+}
+
+func TestLeaseBy(t *testing.T) {
+	db, err := New(net.IPv4(192, 168, 0, 0), net.IPv4Mask(255, 255, 255, 0))
+	if err != nil {
+		t.Fatalf("Could not create ipdb: %v", err)
+	}
+	ip1 := net.IPv4(192, 168, 0, 1)
+	ip2 := net.IPv4(192, 168, 0, 2)
+	db.AddPermanentClient(ip1, d.Duid{0x1})
+	before := time.Now()
+	db.UpdateClient(ip2, d.Duid{0x2}, 5*time.Minute)
+
+	if le, ok := db.LeaseByIP(ip1); !ok || !le.Permanent || !le.Updated.IsZero() {
+		t.Errorf("LeaseByIP(ip1) = %+v, %v; wanted permanent client without transaction", le, ok)
+	}
+	if le, ok := db.LeaseByDuid(d.Duid{0x2}); !ok || !le.IP.Equal(ip2) || le.Updated.Before(before) || !le.Until.After(before) {
+		t.Errorf("LeaseByDuid(0x2) = %+v, %v; wanted active lease of ip2", le, ok)
+	}
+	if le, ok := db.LeaseByIP(net.IPv4(192, 168, 0, 3)); ok {
+		t.Errorf("LeaseByIP(#unused) = %+v, wanted false", le)
+	}
+	if le, ok := db.LeaseByIP(net.IPv4(10, 0, 0, 1)); ok {
+		t.Errorf("LeaseByIP(#other network) = %+v, wanted false", le)
+	}
+	if le, ok := db.LeaseByDuid(d.Duid{0x3}); ok {
+		t.Errorf("LeaseByDuid(#unknown) = %+v, wanted false", le)
+	}
+}
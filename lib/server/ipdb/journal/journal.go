@@ -0,0 +1,249 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/logger"
+	d "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ipdb/duid"
+)
+
+const (
+	OpLease     = "lease"     // A lease was created or extended.
+	OpPermanent = "permanent" // A permanent ip<>duid mapping was created.
+	OpExpire    = "expire"    // A lease was expired before its end of life.
+	OpReserve   = "reserve"   // A permanent ip<>duid mapping was created at runtime, not through the configuration.
+	OpUnreserve = "unreserve" // A permanent ip<>duid mapping created at runtime was removed.
+)
+
+// Record describes a single change of the lease database.
+type Record struct {
+	Op       string    `json:"op"`
+	IP       net.IP    `json:"ip"`
+	Duid     d.Duid    `json:"duid"`
+	Until    time.Time `json:"until"`
+	Hostname string    `json:"hostname,omitempty"`
+}
+
+// Journal is an append-only, on-disk log of lease changes.
+// Every record is synced to disk before Record returns; Compact replaces
+// the log by a snapshot of the current state.
+type Journal struct {
+	sync.Mutex
+	path    string            // Path of the journal file.
+	fh      *os.File          // Open (append only) handle of the journal file.
+	records []Record          // Records found while opening the journal.
+	pending []Record          // Records written while a compaction is running, nil if none is running.
+	sources []func() []Record // Functions returning a snapshot of the current state.
+}
+
+// Open opens (or creates) the journal at the given path and reads all existing records.
+// A partially written last record (eg. due to a crash) is discarded.
+func Open(path string) (*Journal, error) {
+	fh, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	records, good, err := readRecords(fh)
+	if err != nil {
+		fh.Close()
+		return nil, fmt.Errorf("failed to read journal %s: %v", path, err)
+	}
+	// Drop any trailing garbage so that new records start on a clean line.
+	if err := fh.Truncate(good); err != nil {
+		fh.Close()
+		return nil, err
+	}
+	if _, err := fh.Seek(good, io.SeekStart); err != nil {
+		fh.Close()
+		return nil, err
+	}
+	return &Journal{path: path, fh: fh, records: records}, nil
+}
+
+// readRecords parses all records from r, returning them and the offset of the last good record.
+func readRecords(r io.Reader) ([]Record, int64, error) {
+	var records []Record
+	var good int64
+	var broken int
+
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			// Last line without a newline: the write never completed.
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if broken > 0 {
+			return nil, 0, fmt.Errorf("corrupted record at line %d", broken)
+		}
+
+		rec := Record{}
+		if err := json.Unmarshal(bytes.TrimSpace(line), &rec); err != nil {
+			// Only acceptable if this turns out to be the last line.
+			broken = len(records) + 1
+			continue
+		}
+		records = append(records, rec)
+		good += int64(len(line))
+	}
+	return records, good, nil
+}
+
+// Records returns the records found while opening the journal.
+func (jx *Journal) Records() []Record {
+	jx.Lock()
+	defer jx.Unlock()
+	return jx.records
+}
+
+// Register adds a function returning a snapshot of the current state, used during compaction.
+func (jx *Journal) Register(f func() []Record) {
+	jx.Lock()
+	defer jx.Unlock()
+	jx.sources = append(jx.sources, f)
+}
+
+// Record appends a record to the journal and syncs it to disk.
+func (jx *Journal) Record(rec Record) error {
+	jx.Lock()
+	defer jx.Unlock()
+
+	if jx.fh == nil {
+		return fmt.Errorf("journal is closed")
+	}
+	if err := writeRecords(jx.fh, rec); err != nil {
+		return err
+	}
+	if jx.pending != nil {
+		jx.pending = append(jx.pending, rec)
+	}
+	return jx.fh.Sync()
+}
+
+// Compact replaces the journal by a snapshot of all registered sources.
+func (jx *Journal) Compact() error {
+	jx.Lock()
+	if jx.pending != nil {
+		jx.Unlock()
+		return fmt.Errorf("compaction already running")
+	}
+	jx.pending = []Record{}
+	sources := jx.sources
+	jx.Unlock()
+
+	// Sources are queried without holding our lock: they will call Record() while holding their own.
+	// Anything recorded meanwhile ends up in 'pending' and is appended after the snapshot.
+	var snap []Record
+	for _, f := range sources {
+		snap = append(snap, f()...)
+	}
+
+	jx.Lock()
+	defer jx.Unlock()
+
+	snap = append(snap, jx.pending...)
+	jx.pending = nil
+	if jx.fh == nil {
+		return fmt.Errorf("journal is closed")
+	}
+
+	fh, err := writeSnapshot(jx.path, snap)
+	if err != nil {
+		return err
+	}
+	jx.fh.Close()
+	jx.fh = fh
+	return nil
+}
+
+// Run compacts the journal in the given interval until the context is done.
+func (jx *Journal) Run(ctx context.Context, l *logger.Logger, interval time.Duration) {
+	for {
+		select {
+		case <-time.After(interval):
+			if err := jx.Compact(); err != nil {
+				l.Errorf("# failed to compact lease journal %s: %v", jx.path, err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Close closes the journal.
+func (jx *Journal) Close() error {
+	jx.Lock()
+	defer jx.Unlock()
+
+	if jx.fh == nil {
+		return nil
+	}
+	err := jx.fh.Close()
+	jx.fh = nil
+	return err
+}
+
+// writeSnapshot atomically replaces path with the given records and returns
+// a handle to append further records to it.
+func writeSnapshot(path string, records []Record) (fh *os.File, err error) {
+	tmpfh, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+
+	name := tmpfh.Name()
+	defer func() {
+		if err != nil {
+			tmpfh.Close()
+			os.Remove(name)
+		}
+	}()
+
+	if err = writeRecords(tmpfh, records...); err != nil {
+		return nil, err
+	}
+	if err = tmpfh.Sync(); err != nil {
+		return nil, err
+	}
+	if err = os.Rename(name, path); err != nil {
+		return nil, err
+	}
+	if dir, derr := os.Open(filepath.Dir(path)); derr == nil {
+		// Make the rename itself durable; best effort.
+		dir.Sync()
+		dir.Close()
+	}
+	return tmpfh, nil
+}
+
+func writeRecords(w io.Writer, records ...Record) error {
+	var buf []byte
+	for _, rec := range records {
+		b, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, b...), '\n')
+	}
+	// A single write per call, so a crash can only truncate the last record.
+	nw, err := w.Write(buf)
+	if err == nil && nw != len(buf) {
+		err = io.ErrShortWrite
+	}
+	return err
+}
@@ -0,0 +1,135 @@
+package journal
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	d "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ipdb/duid"
+)
+
+var (
+	recA = Record{Op: OpLease, IP: net.IPv4(192, 168, 1, 2).To4(), Duid: d.Duid{0x01}, Until: time.Unix(5000, 0).UTC()}
+	recB = Record{Op: OpPermanent, IP: net.IPv4(192, 168, 1, 3).To4(), Duid: d.Duid{0x02}, Until: time.Unix(0, 0).UTC()}
+	recC = Record{Op: OpExpire, IP: net.IPv4(192, 168, 1, 2).To4(), Duid: d.Duid{0x01}, Until: time.Unix(0, 0).UTC()}
+)
+
+func tempJournal(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "leases")
+}
+
+func TestRecordAndReopen(t *testing.T) {
+	path := tempJournal(t)
+
+	jx, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open(#new) = %v, wanted nil err", err)
+	}
+	if n := len(jx.Records()); n != 0 {
+		t.Errorf("Records(#new) returned %d records, wanted 0", n)
+	}
+	for _, rec := range []Record{recA, recB, recC} {
+		if err := jx.Record(rec); err != nil {
+			t.Errorf("Record(%+v) = %v, wanted nil err", rec, err)
+		}
+	}
+	jx.Close()
+
+	jx, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open(#reopen) = %v, wanted nil err", err)
+	}
+	defer jx.Close()
+	if diff := cmp.Diff([]Record{recA, recB, recC}, jx.Records()); diff != "" {
+		t.Errorf("Records(#reopen) had diff: %s", diff)
+	}
+}
+
+func TestTruncatedRecord(t *testing.T) {
+	path := tempJournal(t)
+
+	jx, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open(#new) = %v, wanted nil err", err)
+	}
+	jx.Record(recA)
+	jx.Close()
+
+	// Simulate a crash during a write.
+	fh, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	fh.Write([]byte(`{"op":"lease","ip":"192.1`))
+	fh.Close()
+
+	jx, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open(#truncated) = %v, wanted nil err", err)
+	}
+	if diff := cmp.Diff([]Record{recA}, jx.Records()); diff != "" {
+		t.Errorf("Records(#truncated) had diff: %s", diff)
+	}
+	// New records must start on a fresh line.
+	jx.Record(recB)
+	jx.Close()
+
+	jx, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open(#appended) = %v, wanted nil err", err)
+	}
+	defer jx.Close()
+	if diff := cmp.Diff([]Record{recA, recB}, jx.Records()); diff != "" {
+		t.Errorf("Records(#appended) had diff: %s", diff)
+	}
+}
+
+func TestCorruptedRecord(t *testing.T) {
+	path := tempJournal(t)
+	if err := ioutil.WriteFile(path, []byte("garbage\n{}\n"), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if _, err := Open(path); err == nil {
+		t.Errorf("Open(#corrupted) returned nil err, wanted non-nil")
+	}
+}
+
+func TestCompact(t *testing.T) {
+	path := tempJournal(t)
+
+	jx, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open(#new) = %v, wanted nil err", err)
+	}
+	for i := 0; i < 10; i++ {
+		jx.Record(recA)
+	}
+	jx.Register(func() []Record {
+		// Changes made during compaction must survive.
+		jx.Record(recC)
+		return []Record{recB}
+	})
+	if err := jx.Compact(); err != nil {
+		t.Errorf("Compact() = %v, wanted nil err", err)
+	}
+	jx.Record(recA)
+	jx.Close()
+
+	jx, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open(#compacted) = %v, wanted nil err", err)
+	}
+	defer jx.Close()
+	if diff := cmp.Diff([]Record{recB, recC, recA}, jx.Records()); diff != "" {
+		t.Errorf("Records(#compacted) had diff: %s", diff)
+	}
+}
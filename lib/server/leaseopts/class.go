@@ -0,0 +1,152 @@
+package leaseopts
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/oui"
+	pb "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/proto"
+)
+
+// Class is a named group of dynamic clients sharing lease options.
+type Class struct {
+	Name         string       // Name of the class.
+	VendorClass  string       // Prefix of the vendor class to match, any if empty.
+	UserClass    string       // User class to match, any if empty.
+	OUI          []string     // Lowercase vendor name prefixes to match, any if empty.
+	HwAddrPrefix [][]byte     // Hardware address prefixes to match, any if empty.
+	Fingerprint  [][]uint8    // Parameter request lists to match, any if empty.
+	Options      LeaseOptions // Lease options of members.
+	PoolStart    net.IP       // First IP of the dedicated pool, nil if none.
+	PoolEnd      net.IP       // Last IP of the dedicated pool.
+	Deny         bool         // Members are not served at all.
+}
+
+// ParseClass inspects a proto.ClassConfig and returns the class, inheriting all options not set by the class from defaults.
+func ParseClass(conf *pb.ClassConfig, defaults *LeaseOptions) (*Class, error) {
+	c := &Class{
+		Name:        conf.GetName(),
+		VendorClass: conf.GetVendorClass(),
+		UserClass:   conf.GetUserClass(),
+		Options:     *defaults,
+		Deny:        conf.GetDeny(),
+	}
+	if c.Name == "" {
+		return nil, fmt.Errorf("class without a name")
+	}
+
+	for _, o := range conf.GetOui() {
+		c.OUI = append(c.OUI, strings.ToLower(o))
+	}
+
+	for _, p := range conf.GetHwaddrPrefix() {
+		b, err := hex.DecodeString(strings.NewReplacer(":", "", "-", "").Replace(p))
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("invalid hwaddr_prefix '%s'", p)
+		}
+		c.HwAddrPrefix = append(c.HwAddrPrefix, b)
+	}
+
+	for _, f := range conf.GetFingerprint() {
+		var fp []uint8
+		for _, x := range strings.Split(f, ",") {
+			v, err := strconv.ParseUint(strings.TrimSpace(x), 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid fingerprint '%s': %v", f, err)
+			}
+			fp = append(fp, uint8(v))
+		}
+		c.Fingerprint = append(c.Fingerprint, fp)
+	}
+
+	if router, err := ipv4(conf.GetRouter()); err != nil {
+		return nil, err
+	} else if len(router) == 1 {
+		c.Options.Router = router[0]
+	}
+
+	if dns, err := ipv4(conf.GetDns()...); err != nil {
+		return nil, err
+	} else if len(dns) > 0 {
+		c.Options.DNS = dns
+	}
+
+	if ntp, err := ipv4(conf.GetNtp()...); err != nil {
+		return nil, err
+	} else if len(ntp) > 0 {
+		c.Options.NTP = ntp
+	}
+
+	if dn := conf.GetDomain(); dn != "" {
+		c.Options.Domain = dn
+	}
+
+	if s := conf.GetLeaseDuration(); s != "" {
+		if ld, err := time.ParseDuration(s); err != nil {
+			return nil, fmt.Errorf("failed to parse duration from string '%s': %v", s, err)
+		} else if ld < time.Minute {
+			return nil, fmt.Errorf("lease duration must be at least one minute, found %s", ld)
+		} else {
+			c.Options.LeaseDuration = ld
+		}
+	}
+
+	if dr := conf.GetDynamicRange(); dr != "" {
+		sr := strings.Split(dr, "-")
+		if len(sr) != 2 {
+			return nil, fmt.Errorf("dynamic_range format '%s' invalid. Expected 'start-end'", dr)
+		}
+		r, err := ipv4(sr...)
+		if err != nil {
+			return nil, fmt.Errorf("dynamic_range has invalid IP range '%s': %v", dr, err)
+		}
+		if bytes.Compare(r[0], r[1]) > 0 {
+			return nil, fmt.Errorf("dynamic_range '%s' ends before it starts", dr)
+		}
+		c.PoolStart, c.PoolEnd = r[0], r[1]
+	}
+	return c, nil
+}
+
+// Matches returns true if a client with the given hardware address, vendor class, user class and
+// parameter request list is a member of the class.
+func (c *Class) Matches(hw net.HardwareAddr, vendorClass, userClass string, params []uint8) bool {
+	if c.VendorClass != "" && !strings.HasPrefix(vendorClass, c.VendorClass) {
+		return false
+	}
+	if c.UserClass != "" && c.UserClass != userClass {
+		return false
+	}
+	if len(c.OUI) > 0 {
+		vendor, _ := oui.Lookup(hw)
+		if !anyOf(len(c.OUI), func(i int) bool { return strings.HasPrefix(strings.ToLower(vendor), c.OUI[i]) }) {
+			return false
+		}
+	}
+	if len(c.HwAddrPrefix) > 0 {
+		if !anyOf(len(c.HwAddrPrefix), func(i int) bool { return bytes.HasPrefix(hw, c.HwAddrPrefix[i]) }) {
+			return false
+		}
+	}
+	if len(c.Fingerprint) > 0 {
+		if !anyOf(len(c.Fingerprint), func(i int) bool { return bytes.Equal(params, c.Fingerprint[i]) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// anyOf returns true if f returns true for any index below n.
+func anyOf(n int, f func(int) bool) bool {
+	for i := 0; i < n; i++ {
+		if f(i) {
+			return true
+		}
+	}
+	return false
+}
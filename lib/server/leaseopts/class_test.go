@@ -0,0 +1,157 @@
+package leaseopts
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	pb "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/proto"
+)
+
+func TestParseClass(t *testing.T) {
+	defaults := &LeaseOptions{
+		Domain:        "funky",
+		Router:        net.IPv4(192, 168, 1, 1),
+		DNS:           []net.IP{net.IPv4(192, 168, 1, 1)},
+		LeaseDuration: time.Hour,
+	}
+	cc := pb.ClassConfig{
+		Name:          "phones",
+		VendorClass:   "android-dhcp-",
+		Oui:           []string{"Intel Corp"},
+		HwaddrPrefix:  []string{"b8:27:eb", "dc-a6"},
+		Fingerprint:   []string{"1,3,6, 15"},
+		Dns:           []string{"192.168.1.2"},
+		Domain:        "phones",
+		LeaseDuration: "10m",
+		DynamicRange:  "192.168.1.100-192.168.1.150",
+	}
+
+	c, err := ParseClass(&cc, defaults)
+	if err != nil {
+		t.Fatalf("ParseClass(#first) had error: %v", err)
+	}
+	if diff := cmp.Diff(c, &Class{
+		Name:         "phones",
+		VendorClass:  "android-dhcp-",
+		OUI:          []string{"intel corp"},
+		HwAddrPrefix: [][]byte{{0xb8, 0x27, 0xeb}, {0xdc, 0xa6}},
+		Fingerprint:  [][]uint8{{1, 3, 6, 15}},
+		Options: LeaseOptions{
+			Domain:        "phones",
+			Router:        net.IPv4(192, 168, 1, 1),
+			DNS:           []net.IP{net.IPv4(192, 168, 1, 2).To4()},
+			LeaseDuration: 10 * time.Minute,
+		},
+		PoolStart: net.IPv4(192, 168, 1, 100).To4(),
+		PoolEnd:   net.IPv4(192, 168, 1, 150).To4(),
+	}); diff != "" {
+		t.Errorf("Diff(#first): %s", diff)
+	}
+	// Defaults must not be modified.
+	if defaults.Domain != "funky" {
+		t.Errorf("ParseClass modified defaults: %+v", defaults)
+	}
+
+	for _, bad := range []*pb.ClassConfig{
+		{},
+		{Name: "x", HwaddrPrefix: []string{"zz"}},
+		{Name: "x", Fingerprint: []string{"1,256"}},
+		{Name: "x", LeaseDuration: "1s"},
+		{Name: "x", DynamicRange: "192.168.1.150-192.168.1.100"},
+		{Name: "x", DynamicRange: "192.168.1.150"},
+		{Name: "x", Router: "::1"},
+	} {
+		if _, err := ParseClass(bad, defaults); err == nil {
+			t.Errorf("ParseClass(%v) wanted err, got nil err", bad)
+		}
+	}
+}
+
+func TestClassMatches(t *testing.T) {
+	intel := net.HardwareAddr{0xf4, 0x8c, 0x50, 0x01, 0x02, 0x03}
+	other := net.HardwareAddr{0x02, 0x00, 0x00, 0x01, 0x02, 0x03}
+
+	input := []struct {
+		name        string
+		class       Class
+		hw          net.HardwareAddr
+		vendorClass string
+		userClass   string
+		params      []uint8
+		want        bool
+	}{
+		{
+			name: "empty class",
+			hw:   other,
+			want: true,
+		},
+		{
+			name:        "vendor class",
+			class:       Class{VendorClass: "MSFT"},
+			hw:          other,
+			vendorClass: "MSFT 5.0",
+			want:        true,
+		},
+		{
+			name:        "vendor class mismatch",
+			class:       Class{VendorClass: "MSFT"},
+			hw:          other,
+			vendorClass: "android-dhcp-11",
+		},
+		{
+			name:      "user class",
+			class:     Class{UserClass: "iPXE"},
+			hw:        other,
+			userClass: "iPXE",
+			want:      true,
+		},
+		{
+			name:  "oui",
+			class: Class{OUI: []string{"apple", "intel"}},
+			hw:    intel,
+			want:  true,
+		},
+		{
+			name:  "oui mismatch",
+			class: Class{OUI: []string{"intel"}},
+			hw:    other,
+		},
+		{
+			name:  "hwaddr prefix",
+			class: Class{HwAddrPrefix: [][]byte{{0xf4, 0x8c}}},
+			hw:    intel,
+			want:  true,
+		},
+		{
+			name:  "hwaddr prefix mismatch",
+			class: Class{HwAddrPrefix: [][]byte{{0xf4, 0x8c}}},
+			hw:    other,
+		},
+		{
+			name:   "fingerprint",
+			class:  Class{Fingerprint: [][]uint8{{1, 3}, {1, 3, 6}}},
+			hw:     other,
+			params: []uint8{1, 3, 6},
+			want:   true,
+		},
+		{
+			name:   "fingerprint mismatch",
+			class:  Class{Fingerprint: [][]uint8{{1, 3, 6}}},
+			hw:     other,
+			params: []uint8{1, 3, 6, 15},
+		},
+		{
+			name:        "all criteria",
+			class:       Class{VendorClass: "MSFT", HwAddrPrefix: [][]byte{{0xf4}}},
+			hw:          other,
+			vendorClass: "MSFT 5.0",
+		},
+	}
+	for _, test := range input {
+		if got := test.class.Matches(test.hw, test.vendorClass, test.userClass, test.params); got != test.want {
+			t.Errorf("Matches(%s) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -3,20 +3,74 @@ package leaseopts
 import (
 	"fmt"
 	"net"
+	"strings"
 	"time"
 
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/dhcpmsg"
 	pb "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/proto"
 )
 
 type LeaseOptions struct {
-	IP            net.IP        // Static IP of a lease.
-	Domain        string        // Domain to announce.
-	Hostname      string        // Hostname to use.
-	Netmask       net.IPMask    // Netmask of the network we announce.
-	Router        net.IP        // Router to use.
-	DNS           []net.IP      // List of DNS suggested to the client.
-	NTP           []net.IP      // List of NTP servers suggested to the client.
-	LeaseDuration time.Duration // Duration of the announced lease.
+	IP            net.IP          // Static IP of a lease.
+	Domain        string          // Domain to announce.
+	Hostname      string          // Hostname to use.
+	Netmask       net.IPMask      // Netmask of the network we announce.
+	Router        net.IP          // Router to use.
+	DNS           []net.IP        // List of DNS suggested to the client.
+	NTP           []net.IP        // List of NTP servers suggested to the client.
+	LeaseDuration time.Duration   // Duration of the announced lease.
+	NextServer    net.IP          // Server to load the boot file from.
+	BootFilename  string          // Boot file to announce if no boot rule matches.
+	Boot          []BootRule      // Rules selecting a boot file by client architecture and class.
+	Options       []Option        // Additional options.
+	Routes        []dhcpmsg.Route // Classless static routes.
+}
+
+// BootRule selects the boot file for clients matching all of its criteria.
+type BootRule struct {
+	Arch         []uint16 // Client architectures to match, any if empty.
+	VendorClass  string   // Prefix of the vendor class to match, any if empty.
+	UserClass    string   // User class to match, any if empty.
+	NextServer   net.IP   // Server to load the boot file from, nil to use the default.
+	BootFilename string   // Boot file to announce.
+}
+
+// maxBootFilenameLen is the longest boot file name fitting into option 67.
+const maxBootFilenameLen = 255
+
+// Matches returns true if a client with the given architectures, vendor class and user class matches the rule.
+func (br BootRule) Matches(arch []uint16, vendorClass, userClass string) bool {
+	if br.VendorClass != "" && !strings.HasPrefix(vendorClass, br.VendorClass) {
+		return false
+	}
+	if br.UserClass != "" && br.UserClass != userClass {
+		return false
+	}
+	if len(br.Arch) == 0 {
+		return true
+	}
+	for _, a := range arch {
+		for _, b := range br.Arch {
+			if a == b {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// BootFile returns the boot server and file to announce to a client with the given architectures, vendor class and user class.
+// The file is empty if no boot file should be announced.
+func (lopts *LeaseOptions) BootFile(arch []uint16, vendorClass, userClass string) (net.IP, string) {
+	for _, br := range lopts.Boot {
+		if br.Matches(arch, vendorClass, userClass) {
+			if br.NextServer != nil {
+				return br.NextServer, br.BootFilename
+			}
+			return lopts.NextServer, br.BootFilename
+		}
+	}
+	return lopts.NextServer, lopts.BootFilename
 }
 
 // ParseConfig inspects a proto.ServerConfig and returns the configured lease options and the IPNet we are reposible for.
@@ -56,9 +110,95 @@ func ParseConfig(conf *pb.ServerConfig) (*LeaseOptions, *net.IPNet, error) {
 	} else {
 		lopts.NTP = ntp
 	}
+
+	if ns, err := ipv4(conf.GetNextServer()); err != nil {
+		return nil, nil, err
+	} else if len(ns) == 1 {
+		lopts.NextServer = ns[0]
+	}
+
+	if bf := conf.GetBootFilename(); len(bf) > maxBootFilenameLen {
+		return nil, nil, fmt.Errorf("boot_filename '%s' exceeds %d bytes", bf, maxBootFilenameLen)
+	} else {
+		lopts.BootFilename = bf
+	}
+
+	for i, rule := range conf.GetBoot() {
+		br, err := parseBootRule(rule)
+		if err != nil {
+			return nil, nil, fmt.Errorf("boot rule #%d: %v", i+1, err)
+		}
+		lopts.Boot = append(lopts.Boot, br)
+	}
+
+	if opts, err := parseOptions(conf.GetOption()); err != nil {
+		return nil, nil, err
+	} else {
+		lopts.Options = opts
+	}
+
+	if routes, err := parseRoutes(conf.GetStaticRoute()); err != nil {
+		return nil, nil, err
+	} else {
+		lopts.Routes = routes
+	}
+	if err := lopts.checkRoutes(); err != nil {
+		return nil, nil, err
+	}
 	return lopts, ipnet, nil
 }
 
+// ClasslessRoutes returns the static routes to announce, including a default route via the router
+// unless one is configured: Clients ignore the router option if they receive static routes.
+func (lopts *LeaseOptions) ClasslessRoutes() []dhcpmsg.Route {
+	if len(lopts.Routes) == 0 || lopts.Router == nil {
+		return lopts.Routes
+	}
+	for _, r := range lopts.Routes {
+		if ones, _ := r.Dest.Mask.Size(); ones == 0 {
+			return lopts.Routes
+		}
+	}
+	def := dhcpmsg.Route{Dest: &net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)}, Router: lopts.Router}
+	return append(append([]dhcpmsg.Route{}, lopts.Routes...), def)
+}
+
+// checkRoutes verifies that the static routes fit into a single option.
+func (lopts *LeaseOptions) checkRoutes() error {
+	if n := len(dhcpmsg.OptionClasslessRoutes(lopts.ClasslessRoutes()...).Data); n > 255 {
+		return fmt.Errorf("static routes need %d bytes, at most 255 are possible", n)
+	}
+	return nil
+}
+
+// parseBootRule converts a proto.BootRule into a BootRule.
+func parseBootRule(rule *pb.BootRule) (BootRule, error) {
+	br := BootRule{
+		VendorClass:  rule.GetVendorClass(),
+		UserClass:    rule.GetUserClass(),
+		BootFilename: rule.GetBootFilename(),
+	}
+	if br.BootFilename == "" {
+		return br, fmt.Errorf("boot_filename must be set")
+	} else if len(br.BootFilename) > maxBootFilenameLen {
+		return br, fmt.Errorf("boot_filename '%s' exceeds %d bytes", br.BootFilename, maxBootFilenameLen)
+	}
+
+	for _, a := range rule.GetArch() {
+		if a > 0xffff {
+			return br, fmt.Errorf("arch %d is out of range", a)
+		}
+		br.Arch = append(br.Arch, uint16(a))
+	}
+
+	if ns, err := ipv4(rule.GetNextServer()); err != nil {
+		return br, err
+	} else if len(ns) == 1 {
+		br.NextServer = ns[0]
+	}
+	return br, nil
+}
+
 // setClientOverrides updates the given leaseOptions pointer and overwrites values with the configuration found in the given clientConfig.
 func SetClientOverrides(original *LeaseOptions, client *pb.ClientConfig) error {
 	opts := *original
@@ -89,6 +229,35 @@ func SetClientOverrides(original *LeaseOptions, client *pb.ClientConfig) error {
 	if hn := client.GetHostname(); hn != "" {
 		opts.Hostname = hn
 	}
+
+	if ns, err := ipv4(client.GetNextServer()); err != nil {
+		return err
+	} else if len(ns) == 1 {
+		opts.NextServer = ns[0]
+	}
+
+	if bf := client.GetBootFilename(); len(bf) > maxBootFilenameLen {
+		return fmt.Errorf("boot_filename '%s' exceeds %d bytes", bf, maxBootFilenameLen)
+	} else if bf != "" {
+		// A static boot file takes precedence over any rules.
+		opts.BootFilename = bf
+		opts.Boot = nil
+	}
+
+	if o, err := parseOptions(client.GetOption()); err != nil {
+		return err
+	} else if len(o) > 0 {
+		opts.Options = mergeOptions(opts.Options, o)
+	}
+
+	if routes, err := parseRoutes(client.GetStaticRoute()); err != nil {
+		return err
+	} else if len(routes) > 0 {
+		opts.Routes = routes
+	}
+	if err := opts.checkRoutes(); err != nil {
+		return err
+	}
 	// all done, update original reference.
 	*original = opts
 	return nil
@@ -1,11 +1,13 @@
 package leaseopts
 
 import (
+	"fmt"
 	"net"
 	"testing"
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/dhcpmsg"
 	pb "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/proto"
 )
 
@@ -42,6 +44,103 @@ func TestParseConfig(t *testing.T) {
 	}
 }
 
+func TestParseBootConfig(t *testing.T) {
+	pp := pb.ServerConfig{
+		Network:       "192.168.1.0/24",
+		LeaseDuration: "5m",
+		NextServer:    "192.168.1.2",
+		BootFilename:  "pxelinux.0",
+		Boot: []*pb.BootRule{
+			{Arch: []uint32{7, 9}, VendorClass: "PXEClient", BootFilename: "ipxe.efi"},
+			{UserClass: "iPXE", NextServer: "192.168.1.3", BootFilename: "boot.ipxe"},
+		},
+	}
+	lopts, _, err := ParseConfig(&pp)
+	if err != nil {
+		t.Fatalf("ParseConfig(#boot) had error: %v", err)
+	}
+	if diff := cmp.Diff(lopts, &LeaseOptions{
+		Netmask:       net.IPMask{255, 255, 255, 0},
+		LeaseDuration: 5 * time.Minute,
+		NextServer:    net.IPv4(192, 168, 1, 2).To4(),
+		BootFilename:  "pxelinux.0",
+		Boot: []BootRule{
+			{Arch: []uint16{7, 9}, VendorClass: "PXEClient", BootFilename: "ipxe.efi"},
+			{UserClass: "iPXE", NextServer: net.IPv4(192, 168, 1, 3).To4(), BootFilename: "boot.ipxe"},
+		},
+	}); diff != "" {
+		t.Errorf("Diff(#boot): %s", diff)
+	}
+
+	for _, rule := range []*pb.BootRule{
+		{VendorClass: "PXEClient"},
+		{Arch: []uint32{0x10000}, BootFilename: "x"},
+		{NextServer: "::1", BootFilename: "x"},
+	} {
+		pp.Boot = []*pb.BootRule{rule}
+		if _, _, err := ParseConfig(&pp); err == nil {
+			t.Errorf("ParseConfig(%v) wanted err, got nil err", rule)
+		}
+	}
+}
+
+func TestBootRuleMatches(t *testing.T) {
+	input := []struct {
+		name        string
+		rule        BootRule
+		arch        []uint16
+		vendorClass string
+		userClass   string
+		want        bool
+	}{
+		{
+			name: "empty rule",
+			want: true,
+		},
+		{
+			name:        "vendor class prefix",
+			rule:        BootRule{VendorClass: "PXEClient"},
+			vendorClass: "PXEClient:Arch:00000:UNDI:002001",
+			want:        true,
+		},
+		{
+			name:        "vendor class mismatch",
+			rule:        BootRule{VendorClass: "PXEClient"},
+			vendorClass: "HTTPClient:Arch:00016:UNDI:003001",
+		},
+		{
+			name: "arch",
+			rule: BootRule{Arch: []uint16{7, 9}},
+			arch: []uint16{9},
+			want: true,
+		},
+		{
+			name: "arch mismatch",
+			rule: BootRule{Arch: []uint16{7, 9}},
+			arch: []uint16{0},
+		},
+		{
+			name: "no arch",
+			rule: BootRule{Arch: []uint16{0}},
+		},
+		{
+			name:      "user class",
+			rule:      BootRule{UserClass: "iPXE"},
+			userClass: "iPXE",
+			want:      true,
+		},
+		{
+			name: "user class mismatch",
+			rule: BootRule{UserClass: "iPXE"},
+		},
+	}
+	for _, test := range input {
+		if got := test.rule.Matches(test.arch, test.vendorClass, test.userClass); got != test.want {
+			t.Errorf("Matches(%s) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
 func TestClientOverrides(t *testing.T) {
 	cc := pb.ClientConfig{
 		Ip:       "192.168.1.99",
@@ -154,3 +253,63 @@ func TestIpv4(t *testing.T) {
 		}
 	}
 }
+
+func TestStaticRoutes(t *testing.T) {
+	_, n10, _ := net.ParseCIDR("10.0.0.0/8")
+	_, n172, _ := net.ParseCIDR("172.16.0.0/12")
+	_, def, _ := net.ParseCIDR("0.0.0.0/0")
+
+	pp := pb.ServerConfig{
+		Network:       "192.168.1.0/24",
+		LeaseDuration: "5m",
+		Router:        "192.168.1.1",
+		StaticRoute:   []string{"10.0.0.0/8 192.168.1.254"},
+	}
+	lopts, _, err := ParseConfig(&pp)
+	if err != nil {
+		t.Fatalf("ParseConfig had error: %v", err)
+	}
+	// The router is added as default route.
+	if diff := cmp.Diff([]dhcpmsg.Route{
+		{Dest: n10, Router: net.IPv4(192, 168, 1, 254).To4()},
+		{Dest: def, Router: net.IPv4(192, 168, 1, 1).To4()},
+	}, lopts.ClasslessRoutes()); diff != "" {
+		t.Errorf("ClasslessRoutes(#server) had diff: %s", diff)
+	}
+
+	// Routes of clients replace those of the network, a configured default route is kept.
+	if err := SetClientOverrides(lopts, &pb.ClientConfig{StaticRoute: []string{"172.16.0.0/12 192.168.1.253", "0.0.0.0/0 192.168.1.2"}}); err != nil {
+		t.Fatalf("SetClientOverrides had error: %v", err)
+	}
+	if diff := cmp.Diff([]dhcpmsg.Route{
+		{Dest: n172, Router: net.IPv4(192, 168, 1, 253).To4()},
+		{Dest: def, Router: net.IPv4(192, 168, 1, 2).To4()},
+	}, lopts.ClasslessRoutes()); diff != "" {
+		t.Errorf("ClasslessRoutes(#client) had diff: %s", diff)
+	}
+
+	// No routes, no default route.
+	if routes := (&LeaseOptions{Router: net.IPv4(192, 168, 1, 1)}).ClasslessRoutes(); len(routes) != 0 {
+		t.Errorf("ClasslessRoutes(#none) = %v, wanted no routes", routes)
+	}
+
+	for _, bad := range [][]string{
+		{"10.0.0.0/8"},
+		{"10.0.0.0/33 192.168.1.1"},
+		{"10.0.0.0/8 ::1"},
+	} {
+		pp.StaticRoute = bad
+		if _, _, err := ParseConfig(&pp); err == nil {
+			t.Errorf("ParseConfig(%v) wanted err, got nil err", bad)
+		}
+	}
+
+	// Too many routes for one option.
+	pp.StaticRoute = nil
+	for i := 0; i < 40; i++ {
+		pp.StaticRoute = append(pp.StaticRoute, fmt.Sprintf("10.%d.1.0/24 192.168.1.1", i))
+	}
+	if _, _, err := ParseConfig(&pp); err == nil {
+		t.Errorf("ParseConfig(#too many routes) wanted err, got nil err")
+	}
+}
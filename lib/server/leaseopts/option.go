@@ -0,0 +1,190 @@
+package leaseopts
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/dhcpmsg"
+	pb "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/proto"
+)
+
+// Option is a configured DHCP option.
+type Option struct {
+	dhcpmsg.DHCPOpt
+	Always bool // Send even if the client did not request the option.
+}
+
+// reservedOptions can not be configured: they are either used by the protocol itself or have a dedicated setting.
+var reservedOptions = map[uint32]string{
+	dhcpmsg.OptPadding:                "padding",
+	dhcpmsg.OptSubnetMask:             "set by network",
+	dhcpmsg.OptRouter:                 "use router",
+	dhcpmsg.OptDNS:                    "use dns",
+	dhcpmsg.OptHostname:               "use hostname",
+	dhcpmsg.OptDomainName:             "use domain",
+	dhcpmsg.OptNTP:                    "use ntp",
+	dhcpmsg.OptRequestedIP:            "protocol",
+	dhcpmsg.OptIPAddressLeaseDuration: "use lease_duration",
+	52:                                "option overload",
+	dhcpmsg.OptMessageType:            "protocol",
+	dhcpmsg.OptServerIdentifier:       "protocol",
+	dhcpmsg.OptParametersList:         "protocol",
+	dhcpmsg.OptMessage:                "protocol",
+	dhcpmsg.OptMaxMessageSize:         "protocol",
+	dhcpmsg.OptRenewalDuration:        "protocol",
+	dhcpmsg.OptRebindDuration:         "protocol",
+	dhcpmsg.OptClientIdentifier:       "protocol",
+	dhcpmsg.OptTFTPServerName:         "use next_server",
+	dhcpmsg.OptBootFileName:           "use boot_filename",
+	dhcpmsg.OptRelayAgentInfo:         "relay agent information",
+	dhcpmsg.OptClasslessRoutes:        "use static_route",
+	dhcpmsg.OptMSClasslessRoutes:      "use static_route",
+	dhcpmsg.OptEnd:                    "end",
+}
+
+// parseOptions converts a list of proto.OptionConfig into options, rejecting duplicate codes.
+func parseOptions(list []*pb.OptionConfig) ([]Option, error) {
+	var res []Option
+	seen := map[uint8]bool{}
+	for _, oc := range list {
+		o, err := parseOption(oc)
+		if err != nil {
+			return nil, fmt.Errorf("option %d: %v", oc.GetCode(), err)
+		}
+		if seen[o.Option] {
+			return nil, fmt.Errorf("option %d: configured more than once", o.Option)
+		}
+		seen[o.Option] = true
+		res = append(res, o)
+	}
+	return res, nil
+}
+
+// parseOption validates a proto.OptionConfig and encodes its value.
+func parseOption(oc *pb.OptionConfig) (Option, error) {
+	o := Option{Always: oc.GetAlwaysSend()}
+	if oc.GetCode() > 255 {
+		return o, fmt.Errorf("code out of range")
+	}
+	if why, ok := reservedOptions[oc.GetCode()]; ok {
+		return o, fmt.Errorf("can not be configured (%s)", why)
+	}
+	o.Option = uint8(oc.GetCode())
+
+	values := oc.GetValue()
+	if len(values) == 0 {
+		return o, fmt.Errorf("no value")
+	}
+	if len(values) > 1 && oc.GetType() != pb.OptionConfig_IP_LIST && oc.GetType() != pb.OptionConfig_ROUTES {
+		return o, fmt.Errorf("type %s only accepts one value", oc.GetType())
+	}
+
+	var err error
+	switch oc.GetType() {
+	case pb.OptionConfig_IP, pb.OptionConfig_IP_LIST:
+		var ips []net.IP
+		ips, err = ipv4(values...)
+		for _, ip := range ips {
+			o.Data = append(o.Data, ip...)
+		}
+	case pb.OptionConfig_UINT8:
+		o.Data, err = uintBytes(values[0], 1)
+	case pb.OptionConfig_UINT16:
+		o.Data, err = uintBytes(values[0], 2)
+	case pb.OptionConfig_UINT32:
+		o.Data, err = uintBytes(values[0], 4)
+	case pb.OptionConfig_STRING:
+		o.Data = []byte(values[0])
+	case pb.OptionConfig_BOOL:
+		var b bool
+		if b, err = strconv.ParseBool(values[0]); err == nil {
+			o.Data = []byte{0}
+			if b {
+				o.Data[0] = 1
+			}
+		}
+	case pb.OptionConfig_HEX:
+		o.Data, err = hex.DecodeString(strings.NewReplacer(":", "", " ", "").Replace(values[0]))
+	case pb.OptionConfig_ROUTES:
+		var routes []dhcpmsg.Route
+		if routes, err = parseRoutes(values); err == nil {
+			o.Data = dhcpmsg.OptionClasslessRoutes(routes...).Data
+		}
+	default:
+		err = fmt.Errorf("unsupported type %s", oc.GetType())
+	}
+	if err != nil {
+		return o, err
+	}
+
+	if len(o.Data) == 0 || len(o.Data) > 255 {
+		return o, fmt.Errorf("encoded value has %d bytes, must be 1-255", len(o.Data))
+	}
+	return o, nil
+}
+
+// uintBytes encodes an unsigned integer with the given size in network byte order.
+func uintBytes(s string, size int) ([]byte, error) {
+	v, err := strconv.ParseUint(s, 0, 8*size)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, size)
+	for i := size - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+	return b, nil
+}
+
+// parseRoutes parses routes in the form 'destination/prefix router'.
+func parseRoutes(list []string) ([]dhcpmsg.Route, error) {
+	var routes []dhcpmsg.Route
+	for _, s := range list {
+		f := strings.Fields(s)
+		if len(f) != 2 {
+			return nil, fmt.Errorf("route '%s' invalid, expected 'destination/prefix router'", s)
+		}
+		_, dest, err := net.ParseCIDR(f[0])
+		if err != nil || dest.IP.To4() == nil {
+			return nil, fmt.Errorf("route '%s' has an invalid destination", s)
+		}
+		router, err := ipv4(f[1])
+		if err != nil {
+			return nil, fmt.Errorf("route '%s' has an invalid router", s)
+		}
+		routes = append(routes, dhcpmsg.Route{Dest: dest, Router: router[0]})
+	}
+	return routes, nil
+}
+
+// mergeOptions returns base with all options of the same code replaced by those found in override.
+func mergeOptions(base, override []Option) []Option {
+	var res []Option
+	replaced := map[uint8]bool{}
+	for _, o := range override {
+		replaced[o.Option] = true
+	}
+	for _, o := range base {
+		if !replaced[o.Option] {
+			res = append(res, o)
+		}
+	}
+	return append(res, override...)
+}
+
+// Requested returns true if the option must be sent to a client with the given parameter request list.
+func (o Option) Requested(params []uint8) bool {
+	if o.Always {
+		return true
+	}
+	for _, p := range params {
+		if p == o.Option {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+package leaseopts
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/dhcpmsg"
+	pb "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/proto"
+)
+
+func TestParseOption(t *testing.T) {
+	input := []struct {
+		name    string
+		conf    *pb.OptionConfig
+		want    Option
+		wantErr bool
+	}{
+		{
+			name: "ip",
+			conf: &pb.OptionConfig{Code: 150, Type: pb.OptionConfig_IP, Value: []string{"192.168.1.5"}},
+			want: Option{DHCPOpt: dhcpmsg.DHCPOpt{Option: 150, Data: []byte{192, 168, 1, 5}}},
+		},
+		{
+			name: "ip list",
+			conf: &pb.OptionConfig{Code: 44, Type: pb.OptionConfig_IP_LIST, Value: []string{"192.168.1.5", "10.0.0.1"}},
+			want: Option{DHCPOpt: dhcpmsg.DHCPOpt{Option: 44, Data: []byte{192, 168, 1, 5, 10, 0, 0, 1}}},
+		},
+		{
+			name: "uint8",
+			conf: &pb.OptionConfig{Code: 23, Type: pb.OptionConfig_UINT8, Value: []string{"64"}, AlwaysSend: true},
+			want: Option{DHCPOpt: dhcpmsg.DHCPOpt{Option: 23, Data: []byte{64}}, Always: true},
+		},
+		{
+			name: "uint16",
+			conf: &pb.OptionConfig{Code: 26, Type: pb.OptionConfig_UINT16, Value: []string{"1500"}},
+			want: Option{DHCPOpt: dhcpmsg.DHCPOpt{Option: 26, Data: []byte{0x05, 0xdc}}},
+		},
+		{
+			name: "uint32",
+			conf: &pb.OptionConfig{Code: 2, Type: pb.OptionConfig_UINT32, Value: []string{"0x01020304"}},
+			want: Option{DHCPOpt: dhcpmsg.DHCPOpt{Option: 2, Data: []byte{1, 2, 3, 4}}},
+		},
+		{
+			name: "string",
+			conf: &pb.OptionConfig{Code: 252, Type: pb.OptionConfig_STRING, Value: []string{"http://wpad/wpad.dat"}},
+			want: Option{DHCPOpt: dhcpmsg.DHCPOpt{Option: 252, Data: []byte("http://wpad/wpad.dat")}},
+		},
+		{
+			name: "bool",
+			conf: &pb.OptionConfig{Code: 19, Type: pb.OptionConfig_BOOL, Value: []string{"true"}},
+			want: Option{DHCPOpt: dhcpmsg.DHCPOpt{Option: 19, Data: []byte{1}}},
+		},
+		{
+			name: "hex",
+			conf: &pb.OptionConfig{Code: 43, Type: pb.OptionConfig_HEX, Value: []string{"01:04:0a:0b:0c:0d"}},
+			want: Option{DHCPOpt: dhcpmsg.DHCPOpt{Option: 43, Data: []byte{1, 4, 10, 11, 12, 13}}},
+		},
+		{
+			name: "routes",
+			conf: &pb.OptionConfig{Code: 224, Type: pb.OptionConfig_ROUTES, Value: []string{"10.0.0.0/8 192.168.1.1", "0.0.0.0/0  192.168.1.2"}},
+			want: Option{DHCPOpt: dhcpmsg.DHCPOpt{Option: 224, Data: []byte{8, 10, 192, 168, 1, 1, 0, 192, 168, 1, 2}}},
+		},
+		{
+			name:    "reserved",
+			conf:    &pb.OptionConfig{Code: 3, Type: pb.OptionConfig_IP, Value: []string{"192.168.1.1"}},
+			wantErr: true,
+		},
+		{
+			name:    "code out of range",
+			conf:    &pb.OptionConfig{Code: 256, Type: pb.OptionConfig_UINT8, Value: []string{"1"}},
+			wantErr: true,
+		},
+		{
+			name:    "no type",
+			conf:    &pb.OptionConfig{Code: 150, Value: []string{"1"}},
+			wantErr: true,
+		},
+		{
+			name:    "no value",
+			conf:    &pb.OptionConfig{Code: 150, Type: pb.OptionConfig_STRING},
+			wantErr: true,
+		},
+		{
+			name:    "too many values",
+			conf:    &pb.OptionConfig{Code: 150, Type: pb.OptionConfig_IP, Value: []string{"192.168.1.5", "10.0.0.1"}},
+			wantErr: true,
+		},
+		{
+			name:    "uint8 overflow",
+			conf:    &pb.OptionConfig{Code: 23, Type: pb.OptionConfig_UINT8, Value: []string{"256"}},
+			wantErr: true,
+		},
+		{
+			name:    "bad ip",
+			conf:    &pb.OptionConfig{Code: 150, Type: pb.OptionConfig_IP, Value: []string{"::1"}},
+			wantErr: true,
+		},
+		{
+			name:    "bad hex",
+			conf:    &pb.OptionConfig{Code: 43, Type: pb.OptionConfig_HEX, Value: []string{"0x"}},
+			wantErr: true,
+		},
+		{
+			name:    "bad route",
+			conf:    &pb.OptionConfig{Code: 224, Type: pb.OptionConfig_ROUTES, Value: []string{"10.0.0.0/8"}},
+			wantErr: true,
+		},
+		{
+			name:    "empty string",
+			conf:    &pb.OptionConfig{Code: 252, Type: pb.OptionConfig_STRING, Value: []string{""}},
+			wantErr: true,
+		},
+	}
+	for _, test := range input {
+		got, err := parseOption(test.conf)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseOption(%s) = %v, wantErr %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("parseOption(%s) had diff: %s", test.name, diff)
+		}
+	}
+}
+
+func TestOptionOverrides(t *testing.T) {
+	pp := pb.ServerConfig{
+		Network:       "192.168.1.0/24",
+		LeaseDuration: "5m",
+		Option: []*pb.OptionConfig{
+			{Code: 150, Type: pb.OptionConfig_IP, Value: []string{"192.168.1.5"}},
+			{Code: 252, Type: pb.OptionConfig_STRING, Value: []string{"wpad"}, AlwaysSend: true},
+		},
+	}
+	lopts, _, err := ParseConfig(&pp)
+	if err != nil {
+		t.Fatalf("ParseConfig had error: %v", err)
+	}
+
+	if err := SetClientOverrides(lopts, &pb.ClientConfig{Option: []*pb.OptionConfig{
+		{Code: 150, Type: pb.OptionConfig_IP, Value: []string{"192.168.1.6"}},
+		{Code: 19, Type: pb.OptionConfig_BOOL, Value: []string{"false"}},
+	}}); err != nil {
+		t.Fatalf("SetClientOverrides had error: %v", err)
+	}
+	if diff := cmp.Diff([]Option{
+		{DHCPOpt: dhcpmsg.DHCPOpt{Option: 252, Data: []byte("wpad")}, Always: true},
+		{DHCPOpt: dhcpmsg.DHCPOpt{Option: 150, Data: []byte{192, 168, 1, 6}}},
+		{DHCPOpt: dhcpmsg.DHCPOpt{Option: 19, Data: []byte{0}}},
+	}, lopts.Options); diff != "" {
+		t.Errorf("SetClientOverrides had diff: %s", diff)
+	}
+
+	pp.Option = append(pp.Option, &pb.OptionConfig{Code: 150, Type: pb.OptionConfig_IP, Value: []string{"192.168.1.7"}})
+	if _, _, err := ParseConfig(&pp); err == nil {
+		t.Errorf("ParseConfig(#duplicate) wanted err, got nil err")
+	}
+}
+
+func TestOptionRequested(t *testing.T) {
+	o := Option{DHCPOpt: dhcpmsg.DHCPOpt{Option: 150}}
+	if o.Requested([]uint8{1, 3, 6}) {
+		t.Errorf("Requested(#not requested) = true, want false")
+	}
+	if !o.Requested([]uint8{1, 150, 6}) {
+		t.Errorf("Requested(#requested) = false, want true")
+	}
+	o.Always = true
+	if !o.Requested(nil) {
+		t.Errorf("Requested(#always) = false, want true")
+	}
+}
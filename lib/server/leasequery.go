@@ -0,0 +1,135 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/dhcpmsg"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/logger"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ipdb"
+	d "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ipdb/duid"
+	pb "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/proto"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/replies"
+	yl "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ylog"
+)
+
+// parseRequesters parses the networks allowed to send leasequeries, single IPs are /32 networks.
+func parseRequesters(conf *pb.ServerConfig) ([]*net.IPNet, error) {
+	var res []*net.IPNet
+	for _, s := range conf.GetLeasequeryRequester() {
+		if !strings.Contains(s, "/") {
+			s += "/32"
+		}
+		_, ipnet, err := net.ParseCIDR(s)
+		if err != nil || ipnet.IP.To4() == nil {
+			return nil, fmt.Errorf("leasequery_requester '%s' is not an IPv4 address or network", s)
+		}
+		res = append(res, ipnet)
+	}
+	return res, nil
+}
+
+// handleLeaseQuery answers a DHCPLEASEQUERY (RFC 4388), the answer is sent to the giaddr of the requester.
+func (sx *server) handleLeaseQuery(yl *yl.Ylog, msg dhcpmsg.Message, opts dhcpmsg.DecodedOptions) {
+	if !isSet(msg.RelayIP) {
+		yl.Dropf(logger.LevelWarn, "LEASEQUERY: Message without giaddr. Dropping!")
+		sx.drop("no_relay_ip")
+		return
+	}
+	allowed := false
+	for _, n := range sx.requesters {
+		allowed = allowed || n.Contains(msg.RelayIP)
+	}
+	if !allowed {
+		yl.Dropf(logger.LevelWarn, "LEASEQUERY: Requester '%s' is not allowed to query leases. Dropping!", msg.RelayIP)
+		sx.drop("not_allowed")
+		return
+	}
+	rep, ok := sx.leaseQuery(yl, time.Now(), msg, opts)
+	if !ok {
+		yl.Dropf(logger.LevelWarn, "LEASEQUERY: Query without IP, client identifier or hwaddr. Dropping!")
+		sx.drop("bogus_leasequery")
+		return
+	}
+	sx.sendReply(msg, rep, msg.RelayIP, false)
+}
+
+// leaseQuery returns the answer to a leasequery by IP, client identifier or hwaddr, in this order.
+// Returns false if the query has none of them.
+func (sx *server) leaseQuery(yl *yl.Ylog, now time.Time, msg dhcpmsg.Message, opts dhcpmsg.DecodedOptions) (dhcpmsg.Message, bool) {
+	var leases []ipdb.Lease
+	known := false
+	switch {
+	case isSet(msg.ClientIP):
+		yl.Printf("LEASEQUERY: '%s' asks for IP '%s'", msg.RelayIP, msg.ClientIP)
+		if sn := sx.subnetForIP(msg.ClientIP); sn != nil {
+			known = true
+			if le, ok := sn.ipdb.LeaseByIP(msg.ClientIP); ok && le.Until.After(now) {
+				leases = append(leases, le)
+			}
+		}
+	case len(opts.ClientIdentifier) > 0:
+		cid := d.Duid(opts.ClientIdentifier)
+		yl.Printf("LEASEQUERY: '%s' asks for client identifier '%s'", msg.RelayIP, cid)
+		duids := []d.Duid{cid}
+		if hw := hwAddrFromDuid(cid); hw != nil && cid[0] == 0x01 {
+			// An htype 1 identifier: static and reserved clients lease with the internal duid of their hwaddr.
+			duids = append(duids, duidFromHwAddr(hw))
+		}
+		for _, sn := range sx.subnets() {
+			for _, duid := range duids {
+				if le, ok := sn.ipdb.LeaseByDuid(duid); ok && le.Until.After(now) {
+					leases = append(leases, le)
+				}
+			}
+		}
+	case len(bytes.Trim(msg.ClientMAC, "\x00")) > 0:
+		yl.Printf("LEASEQUERY: '%s' asks for hwaddr '%s'", msg.RelayIP, msg.ClientMAC)
+		for _, sn := range sx.subnets() {
+			for _, le := range sn.ipdb.Leases() {
+				if le.Until.After(now) && bytes.Equal(hwAddrFromDuid(le.Duid), msg.ClientMAC) {
+					leases = append(leases, le)
+				}
+			}
+		}
+	default:
+		return dhcpmsg.Message{}, false
+	}
+
+	if len(leases) == 0 {
+		typ, name := dhcpmsg.MsgTypeLeaseUnknown, "LEASEUNKNOWN"
+		if known {
+			typ, name = dhcpmsg.MsgTypeLeaseUnassigned, "LEASEUNASSIGNED"
+		}
+		yl.Decidef(dhcpmsg.MsgTypeName(uint8(typ)), "LEASEQUERY: No active lease found, sending %s", name)
+		return replies.LeaseQuery(msg.Xid, uint8(typ), sx.selfIP, msg.ClientIP, msg.ClientMAC, nil), true
+	}
+
+	// The most recently active lease is reported, all of them are associated IPs.
+	sort.SliceStable(leases, func(i, j int) bool { return leases[i].Until.After(leases[j].Until) })
+	le := leases[0]
+	lopts := []dhcpmsg.DHCPOpt{dhcpmsg.OptionIPAddressLeaseDuration(le.Until.Sub(now))}
+	if !le.Updated.IsZero() {
+		lopts = append(lopts, dhcpmsg.OptionClientLastTransaction(now.Sub(le.Updated)))
+	}
+	if !isInternalDuid(le.Duid) {
+		lopts = append(lopts, dhcpmsg.DHCPOpt{Option: dhcpmsg.OptClientIdentifier, Data: le.Duid})
+	}
+	if !isSet(msg.ClientIP) {
+		var ips []net.IP
+		for _, l := range leases {
+			ips = append(ips, l.IP)
+		}
+		lopts = append(lopts, dhcpmsg.OptionAssociatedIP(ips...))
+	}
+	mac := hwAddrFromDuid(le.Duid)
+	if mac == nil {
+		mac = msg.ClientMAC
+	}
+	yl.Decidef("leaseactive", "LEASEQUERY: Sending LEASEACTIVE for IP '%s' of DUID '%s'", le.IP, le.Duid)
+	return replies.LeaseQuery(msg.Xid, dhcpmsg.MsgTypeLeaseActive, sx.selfIP, le.IP, mac, lopts), true
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/metrics"
+)
+
+// Metrics of all servers, labeled by interface.
+var (
+	mReceived     = metrics.Default.Counter("psa_dhcpd_received_messages_total", "DHCP messages received, by message type.", "interface", "type")
+	mSent         = metrics.Default.Counter("psa_dhcpd_sent_messages_total", "DHCP messages sent, by message type.", "interface", "type")
+	mDropped      = metrics.Default.Counter("psa_dhcpd_dropped_messages_total", "DHCP messages dropped, by reason.", "interface", "reason")
+	mProbes       = metrics.Default.Counter("psa_dhcpd_arp_probes_total", "ARP probes of IPs about to be handed out, by result.", "interface", "result")
+	mFindIP       = metrics.Default.Histogram("psa_dhcpd_find_ip_seconds", "Time taken to find an IP for a client.", metrics.DefaultBuckets, "interface")
+	mFindIPFailed = metrics.Default.Counter("psa_dhcpd_find_ip_failures_total", "Searches for a free IP which failed.", "interface")
+	mLeased       = metrics.Default.Gauge("psa_dhcpd_leased_addresses", "IPs with an active lease.", "interface", "network")
+	mPermanent    = metrics.Default.Gauge("psa_dhcpd_permanent_addresses", "IPs permanently assigned to a client.", "interface", "network")
+	mFree         = metrics.Default.Gauge("psa_dhcpd_free_addresses", "IPs of the dynamic range which can be handed out.", "interface", "network")
+	mRogue        = metrics.Default.Counter("psa_dhcpd_rogue_replies_total", "Replies of untrusted DHCP servers seen, by server identifier.", "interface", "server")
+)
+
+// drop counts a dropped message.
+func (sx *server) drop(reason string) {
+	mDropped.Inc(sx.iface.Name, reason)
+}
+
+// exportStats updates the address gauges of all subnets.
+func (sx *server) exportStats() {
+	for _, sn := range sx.subnets() {
+		st := sn.ipdb.Stats()
+		mLeased.Set(float64(st.Leased), sx.iface.Name, sn.ipnet.String())
+		mPermanent.Set(float64(st.Permanent), sx.iface.Name, sn.ipnet.String())
+		mFree.Set(float64(st.Free), sx.iface.Name, sn.ipnet.String())
+	}
+}
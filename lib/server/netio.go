@@ -5,71 +5,195 @@ import (
 	"fmt"
 	"math/rand"
 	"net"
+	"strings"
 	"time"
 
 	"git.sr.ht/~adrian-blx/psa-dhcp/lib/dhcpmsg"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/logger"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/hooks"
 	d "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ipdb/duid"
+	pb "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/proto"
 	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/replies"
 	yl "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ylog"
 )
 
 func (sx *server) handleMsg(src, dst net.IP, msg dhcpmsg.Message) {
 	opts := dhcpmsg.DecodeOptions(msg.Options)
-	duid := sx.getDuid(msg.ClientMAC, opts.ClientIdentifier)
 	yl := yl.New(sx.l, msg, opts)
 
+	// The configuration must not change while we are handling a message.
+	sx.RLock()
+	defer sx.RUnlock()
+
+	if sx.peer != nil && !sx.peer.Active() {
+		// The failover peer is in charge, not logged as this happens for every message.
+		sx.drop("standby")
+		return
+	}
+	if opts.MessageType == dhcpmsg.MsgTypeLeaseQuery {
+		// Not sent by a client but by a relay agent or access concentrator.
+		mReceived.Inc(sx.iface.Name, dhcpmsg.MsgTypeName(opts.MessageType))
+		sx.handleLeaseQuery(yl, msg, opts)
+		return
+	}
+
+	sn := sx.subnetFor(msg)
+	if sn == nil {
+		yl.Dropf(logger.LevelInfo, "no subnet configured for relay agent '%s' and client IP '%s', dropping.", msg.RelayIP, msg.ClientIP)
+		sx.drop("no_subnet")
+		return
+	}
+	duid := sx.getDuid(sn, msg.ClientMAC, opts.ClientIdentifier)
+	if cduid, ok := sn.circuitDuid(opts.RelayAgentInfo); ok {
+		// The lease belongs to the switch port, not to the client.
+		yl.Printf("client is connected to configured circuit %q", opts.RelayAgentInfo.CircuitID)
+		duid = cduid
+	}
+	yl = yl.With("duid", duid)
+
 	// Some sanity checks before handling this message.
 	if bytes.Equal(sx.iface.HardwareAddr, msg.ClientMAC) {
-		yl.Printf("received a message with my own hwaddr from duid %s, dropping.", duid)
+		yl.Dropf(logger.LevelDebug, "received a message with my own hwaddr from duid %s, dropping.", duid)
+		sx.drop("own_hwaddr")
 		return
 	}
 	if sx.selfIP.Equal(opts.RequestedIP) {
-		yl.Printf("received request for my own IP from duid %s, nice try...", duid)
+		yl.Dropf(logger.LevelWarn, "received request for my own IP from duid %s, nice try...", duid)
+		sx.drop("own_ip")
 		return
 	}
 
+	mReceived.Inc(sx.iface.Name, dhcpmsg.MsgTypeName(opts.MessageType))
+	quarantined, ok := sx.checkAccess(yl, sn, msg, opts)
+	if !ok {
+		return
+	}
 	switch opts.MessageType {
 	case dhcpmsg.MsgTypeDiscover:
 		// 50% chance of delaying the replay to give 'slower' DHCP servers a chance.
 		if delay := time.Duration(rand.Int63n(2)*50) * time.Millisecond; delay > 0 {
-			yl.Printf("DISCOVER: Waiting for %v for other servers to pick up.", delay)
+			yl.Debugf("DISCOVER: Waiting for %v for other servers to pick up.", delay)
 			time.Sleep(delay)
 		}
-		sx.handleDiscover(yl, src, dst, duid, msg, opts)
+		sx.handleDiscover(yl, sn, src, dst, duid, msg, opts, quarantined)
 	case dhcpmsg.MsgTypeRequest:
-		sx.handleRequest(yl, src, dst, duid, msg, opts)
+		sx.handleRequest(yl, sn, src, dst, duid, msg, opts, quarantined)
+	case dhcpmsg.MsgTypeDecline:
+		sx.handleDecline(yl, sn, duid, msg, opts)
+	case dhcpmsg.MsgTypeRelease:
+		sx.handleRelease(yl, sn, duid, msg, opts)
+	case dhcpmsg.MsgTypeInform:
+		sx.handleInform(yl, sn, msg, opts)
 	default:
-		yl.Printf("dropping unhandled message of type %d", opts.MessageType)
+		yl.Dropf(logger.LevelDebug, "dropping unhandled message of type %d", opts.MessageType)
+		sx.drop("unhandled_type")
 		// ignored
 	}
 }
 
-func (sx *server) handleDiscover(yl *yl.Ylog, src, dst net.IP, duid d.Duid, msg dhcpmsg.Message, opts dhcpmsg.DecodedOptions) {
-	if !dst.Equal(net.IPv4bcast) {
-		yl.Printf("DISCOVER: Oops! Client with IP %s sent this to destination %s, should have been broadcasted. Dropping!", src, dst)
+// checkAccess applies the access control of the subnet to messages asking for configuration. It returns
+// false if the message must not be handled any further and true as first value if the client must be
+// served from the quarantine pool.
+func (sx *server) checkAccess(yl *yl.Ylog, sn *subnet, msg dhcpmsg.Message, opts dhcpmsg.DecodedOptions) (bool, bool) {
+	switch opts.MessageType {
+	case dhcpmsg.MsgTypeDiscover, dhcpmsg.MsgTypeRequest, dhcpmsg.MsgTypeInform:
+	default:
+		// Clients may always give up their leases.
+		return false, true
+	}
+	allowed, reason := sn.acl.Check(msg.ClientMAC, sn.known(msg.ClientMAC))
+	if allowed {
+		return false, true
+	}
+
+	switch sn.acl.Policy {
+	case pb.AccessConfig_QUARANTINE:
+		yl.Printf("ACCESS: Client not allowed by %s, serving from quarantine range", reason)
+		return true, true
+	case pb.AccessConfig_NAK:
+		if opts.MessageType == dhcpmsg.MsgTypeRequest {
+			yl.Decidef("nak", "ACCESS: Client not allowed by %s, sending NAK", reason)
+			sx.sendNACK(msg)
+			return false, false
+		}
+	}
+	yl.Dropf(logger.LevelInfo, "ACCESS: Client not allowed by %s. Dropping!", reason)
+	sx.drop("denied")
+	return false, false
+}
+
+func (sx *server) handleDiscover(yl *yl.Ylog, sn *subnet, src, dst net.IP, duid d.Duid, msg dhcpmsg.Message, opts dhcpmsg.DecodedOptions, quarantined bool) {
+	// Relay agents unicast the clients broadcast to us.
+	if !dst.Equal(net.IPv4bcast) && !isSet(msg.RelayIP) {
+		yl.Dropf(logger.LevelWarn, "DISCOVER: Oops! Client with IP %s sent this to destination %s, should have been broadcasted. Dropping!", src, dst)
+		sx.drop("not_broadcast")
 		return
 	}
 	if opts.ServerIdentifier != nil {
-		yl.Printf("DISCOVER: Oops! Client with DUID %s specified a server identifier! Dropping!", duid)
+		yl.Dropf(logger.LevelWarn, "DISCOVER: Oops! Client with DUID %s specified a server identifier! Dropping!", duid)
+		sx.drop("server_identifier")
+		return
+	}
+
+	_, class := sn.clientOptions(msg.ClientMAC, opts)
+	if class != nil && class.Deny {
+		yl.Dropf(logger.LevelInfo, "DISCOVER: Client is a member of denied class '%s'. Dropping!", class.Name)
+		sx.drop("denied")
 		return
 	}
 
-	yl.Printf("DISCOVER: Searching for a free IP, client suggested IP '%s'", opts.RequestedIP)
-	offer, err := sx.ipdb.FindIP(sx.ctx, sx.arpVerify(msg.ClientMAC), opts.RequestedIP, duid)
+	yl.Printf("DISCOVER: Searching for a free IP, client '%s' suggested IP '%s'", sanitizeHostname(opts.Hostname), opts.RequestedIP)
+	if until, ok := sn.ipdb.QuarantinedUntil(opts.RequestedIP); ok {
+		yl.Printf("DISCOVER: Suggested IP '%s' is quarantined until %s, ignoring it", opts.RequestedIP, until.Format(time.RFC3339))
+	}
+	start := time.Now()
+	var offer net.IP
+	var err error
+	if quarantined {
+		yl.Printf("DISCOVER: Searching in quarantine range %s-%s", sn.acl.PoolStart, sn.acl.PoolEnd)
+		offer, err = sx.findQuarantineIP(sn, duid, msg, opts)
+	} else if class != nil && class.PoolStart != nil {
+		yl.Printf("DISCOVER: Client is a member of class '%s', searching in %s-%s", class.Name, class.PoolStart, class.PoolEnd)
+		offer, err = sn.ipdb.FindIPInRange(sx.ctx, sx.probe(sn, msg.ClientMAC), opts.RequestedIP, duid, class.PoolStart, class.PoolEnd)
+	} else {
+		if class != nil {
+			yl.Printf("DISCOVER: Client is a member of class '%s'", class.Name)
+		}
+		offer, err = sn.ipdb.FindIP(sx.ctx, sx.probe(sn, msg.ClientMAC), opts.RequestedIP, duid)
+	}
+	mFindIP.Since(start, sx.iface.Name)
 	if err != nil {
-		yl.Printf("DISCOVER: Failed to find a free IP")
+		mFindIPFailed.Inc(sx.iface.Name)
+		yl.Dropf(logger.LevelWarn, "DISCOVER: Failed to find a free IP")
+		sx.drop("no_free_ip")
 		return
 	}
-	if err := sx.ipdb.UpdateClient(offer, duid, 15*time.Second); err != nil {
-		yl.Printf("DISCOVER: Failed to update temporarily lease during discovery")
+	if err := sn.ipdb.UpdateClient(offer, duid, 15*time.Second); err != nil {
+		yl.Dropf(logger.LevelWarn, "DISCOVER: Failed to update temporarily lease during discovery")
+		sx.drop("update_failed")
 		return
 	}
 
-	yl.Printf("DISCOVER: Sending offer for IP '%s' to DUID '%s'", offer, duid)
-	sx.sendMsg(msg, offer, replies.AssembleOffer)
+	yl.Decidef("offer", "DISCOVER: Sending offer for IP '%s' to DUID '%s'", offer, duid)
+	sx.sendMsg(sn, msg, opts, offer, replies.Offer)
+}
+
+// findQuarantineIP returns an IP of the quarantine pool, an existing lease outside of it is given up.
+func (sx *server) findQuarantineIP(sn *subnet, duid d.Duid, msg dhcpmsg.Message, opts dhcpmsg.DecodedOptions) (net.IP, error) {
+	find := func() (net.IP, error) {
+		return sn.ipdb.FindIPInRange(sx.ctx, sx.probe(sn, msg.ClientMAC), opts.RequestedIP, duid, sn.acl.PoolStart, sn.acl.PoolEnd)
+	}
+	ip, err := find()
+	if err != nil || sn.acl.InPool(ip) {
+		return ip, err
+	}
+	if err := sn.ipdb.ExpireClient(ip, duid); err != nil {
+		return nil, fmt.Errorf("failed to give up lease for '%s': %v", ip, err)
+	}
+	return find()
 }
 
-func (sx *server) handleRequest(yl *yl.Ylog, src, dst net.IP, duid d.Duid, msg dhcpmsg.Message, opts dhcpmsg.DecodedOptions) {
+func (sx *server) handleRequest(yl *yl.Ylog, sn *subnet, src, dst net.IP, duid d.Duid, msg dhcpmsg.Message, opts dhcpmsg.DecodedOptions, quarantined bool) {
 	/*
 	   ---------------------------------------------------------------------
 	   |              |INIT-REBOOT  |SELECTING    |RENEWING     |REBINDING |
@@ -80,12 +204,20 @@ func (sx *server) handleRequest(yl *yl.Ylog, src, dst net.IP, duid d.Duid, msg d
 	   ---------------------------------------------------------------------
 	*/
 
+	// Relay agents unicast broadcasted messages to us, the source is the relay itself.
+	bcast := dst.Equal(net.IPv4bcast)
+	if isSet(msg.RelayIP) {
+		bcast = true
+		src = msg.ClientIP
+	}
+
 	var desiredIP net.IP
-	if dst.Equal(net.IPv4bcast) && opts.ServerIdentifier == nil && opts.RequestedIP != nil {
+	event := hooks.EventCommit
+	if bcast && opts.ServerIdentifier == nil && opts.RequestedIP != nil {
 		// INIT-Reboot
 		yl.Printf("REQUEST: INIT-Reboot client desires IP '%s'", opts.RequestedIP)
 		desiredIP = opts.RequestedIP
-	} else if dst.Equal(net.IPv4bcast) && opts.ServerIdentifier.Equal(sx.selfIP) && opts.RequestedIP != nil {
+	} else if bcast && opts.ServerIdentifier.Equal(sx.selfIP) && opts.RequestedIP != nil {
 		// SELECTING
 		yl.Printf("REQUEST: SELECTING state for DUID '%s'", duid)
 		desiredIP = opts.RequestedIP
@@ -93,12 +225,15 @@ func (sx *server) handleRequest(yl *yl.Ylog, src, dst net.IP, duid d.Duid, msg d
 		// RENEWING
 		yl.Printf("REQUEST: RENEWAL from IP '%s'", src)
 		desiredIP = src
-	} else if dst.Equal(net.IPv4bcast) && opts.ServerIdentifier == nil && opts.RequestedIP == nil {
+		event = hooks.EventRenew
+	} else if bcast && opts.ServerIdentifier == nil && opts.RequestedIP == nil {
 		// REBINDING
 		yl.Printf("REQUEST: REBINDING from IP '%s'", src)
 		desiredIP = src
+		event = hooks.EventRenew
 	} else {
-		yl.Printf("REQUEST: Bogous request for destination '%s' with server identifier '%s' dropped", dst, opts.ServerIdentifier)
+		yl.Dropf(logger.LevelDebug, "REQUEST: Bogous request for destination '%s' with server identifier '%s' dropped", dst, opts.ServerIdentifier)
+		sx.drop("bogus_request")
 		return
 	}
 
@@ -108,51 +243,208 @@ func (sx *server) handleRequest(yl *yl.Ylog, src, dst net.IP, duid d.Duid, msg d
 	}
 
 	// We must not reply if we don't manage this network.
-	if !sx.ipdb.InManagedRange(desiredIP) {
-		yl.Printf("REQUEST: desired IP '%s' is not in our managed network range, dropping request", desiredIP)
+	if !sn.ipdb.InManagedRange(desiredIP) {
+		yl.Dropf(logger.LevelInfo, "REQUEST: desired IP '%s' is not in our managed network range, dropping request", desiredIP)
+		sx.drop("not_managed")
+		return
+	}
+
+	lopts, class := sn.clientOptions(msg.ClientMAC, opts)
+	if class != nil && class.Deny {
+		yl.Dropf(logger.LevelInfo, "REQUEST: Client is a member of denied class '%s'. Dropping!", class.Name)
+		sx.drop("denied")
 		return
 	}
 
-	lease, err := sx.ipdb.LookupClientByDuid(duid)
+	lease, err := sn.ipdb.LookupClientByDuid(duid)
 	if err != nil {
-		yl.Printf("REQUEST: Failed to find lease for DUID '%s', sending NAK: %v", duid, err)
-		sx.sendNACK(msg.Xid, msg.ClientMAC)
+		yl.Decidef("nak", "REQUEST: Failed to find lease for DUID '%s', sending NAK: %v", duid, err)
+		sx.sendNACK(msg)
 		return
 	}
 	if !desiredIP.Equal(lease) {
-		yl.Printf("REQUEST: Client wanted IP '%s', but got a lease for '%s', sending NAK", desiredIP, lease)
-		sx.sendNACK(msg.Xid, msg.ClientMAC)
+		yl.Decidef("nak", "REQUEST: Client wanted IP '%s', but got a lease for '%s', sending NAK", desiredIP, lease)
+		sx.sendNACK(msg)
+		return
+	}
+	if quarantined && !sn.acl.InPool(lease) {
+		yl.Decidef("nak", "REQUEST: Lease for '%s' is outside of the quarantine range, sending NAK", lease)
+		sx.sendNACK(msg)
 		return
 	}
-	if !sx.arpVerify(msg.ClientMAC)(sx.ctx, lease) {
-		yl.Printf("REQUEST: Rejecting lease for '%s' as IP failed ARP check, sending NAK", lease)
-		sx.sendNACK(msg.Xid, msg.ClientMAC)
+	if !sx.probe(sn, msg.ClientMAC)(sx.ctx, lease) {
+		yl.Decidef("nak", "REQUEST: Rejecting lease for '%s' as IP failed ARP check, sending NAK", lease)
+		sx.sendNACK(msg)
 		return
 	}
-	if err := sx.ipdb.UpdateClient(lease, duid, sx.lopts.LeaseDuration); err != nil {
+	if err := sn.ipdb.UpdateClient(lease, duid, lopts.LeaseDuration); err != nil {
 		// Probably a race condition - just drop it.
-		yl.Printf("REQUEST: UpdateClient(%s, %s) failed: %v", lease, duid, err)
+		yl.Dropf(logger.LevelWarn, "REQUEST: UpdateClient(%s, %s) failed: %v", lease, duid, err)
+		sx.drop("update_failed")
 		return
 	}
 
-	yl.Printf("REQUEST: Lease for '%s' confirmed", lease)
-	sx.sendMsg(msg, lease, replies.AssembleACK)
+	hostname := sanitizeHostname(opts.Hostname)
+	if err := sn.ipdb.SetHostname(lease, duid, hostname); err != nil {
+		yl.Errorf("REQUEST: SetHostname(%s, %s, %s) failed: %v", lease, duid, hostname, err)
+	}
+
+	yl.Decidef("ack", "REQUEST: Lease for '%s' confirmed for client '%s'", lease, hostname)
+	sx.sendMsg(sn, msg, opts, lease, replies.ACK)
+	sx.fire(event, msg.ClientMAC, lease, duid, hostname, time.Now().Add(lopts.LeaseDuration))
 }
 
-func (sx *server) sendNACK(xid uint32, mac net.HardwareAddr) {
-	pkt := replies.AssembleNACK(xid, sx.selfIP, mac)
-	sx.sendUnicast(mac, pkt)
+func (sx *server) handleDecline(yl *yl.Ylog, sn *subnet, duid d.Duid, msg dhcpmsg.Message, opts dhcpmsg.DecodedOptions) {
+	if !opts.ServerIdentifier.Equal(sx.selfIP) {
+		yl.Dropf(logger.LevelDebug, "DECLINE: Message is for server identifier '%s', not for us. Dropping!", opts.ServerIdentifier)
+		sx.drop("not_for_us")
+		return
+	}
+	if opts.RequestedIP == nil {
+		yl.Dropf(logger.LevelWarn, "DECLINE: Message without a requested IP. Dropping!")
+		sx.drop("no_requested_ip")
+		return
+	}
+
+	lease, err := sn.ipdb.LookupClientByDuid(duid)
+	if err != nil {
+		yl.Dropf(logger.LevelInfo, "DECLINE: No lease found for DUID '%s', nothing to decline: %v", duid, err)
+		sx.drop("no_lease")
+		return
+	}
+	if !lease.Equal(opts.RequestedIP) {
+		yl.Dropf(logger.LevelWarn, "DECLINE: Client declined IP '%s', but has a lease for '%s'. Dropping!", opts.RequestedIP, lease)
+		sx.drop("lease_mismatch")
+		return
+	}
+	if err := sn.ipdb.Quarantine(lease, duid, sx.quarantine); err != nil {
+		yl.Dropf(logger.LevelWarn, "DECLINE: Quarantine(%s, %s) failed: %v", lease, duid, err)
+		sx.drop("update_failed")
+		return
+	}
+	yl.Decidef("quarantine", "DECLINE: IP '%s' declined by DUID '%s' (message: %q), quarantined for %s", lease, duid, opts.Message, sx.quarantine)
+	sx.fire(hooks.EventDecline, msg.ClientMAC, lease, duid, sanitizeHostname(opts.Hostname), time.Now())
+}
+
+func (sx *server) handleRelease(yl *yl.Ylog, sn *subnet, duid d.Duid, msg dhcpmsg.Message, opts dhcpmsg.DecodedOptions) {
+	if !opts.ServerIdentifier.Equal(sx.selfIP) {
+		yl.Dropf(logger.LevelDebug, "RELEASE: Message is for server identifier '%s', not for us. Dropping!", opts.ServerIdentifier)
+		sx.drop("not_for_us")
+		return
+	}
+
+	lease, err := sn.ipdb.LookupClientByDuid(duid)
+	if err != nil {
+		yl.Dropf(logger.LevelInfo, "RELEASE: No lease found for DUID '%s', nothing to release: %v", duid, err)
+		sx.drop("no_lease")
+		return
+	}
+	if !lease.Equal(msg.ClientIP) {
+		yl.Dropf(logger.LevelWarn, "RELEASE: Client wants to release IP '%s', but has a lease for '%s'. Dropping!", msg.ClientIP, lease)
+		sx.drop("lease_mismatch")
+		return
+	}
+	if err := sn.ipdb.ExpireClient(lease, duid); err != nil {
+		yl.Dropf(logger.LevelWarn, "RELEASE: ExpireClient(%s, %s) failed: %v", lease, duid, err)
+		sx.drop("update_failed")
+		return
+	}
+	// RELEASE messages are not acknowledged.
+	yl.Decidef("release", "RELEASE: Lease for '%s' released by DUID '%s'", lease, duid)
+	sx.fire(hooks.EventRelease, msg.ClientMAC, lease, duid, sanitizeHostname(opts.Hostname), time.Now())
 }
 
-func (sx *server) sendMsg(msg dhcpmsg.Message, ip net.IP, f func(uint32, uint16, net.IP, net.IP, net.HardwareAddr, []dhcpmsg.DHCPOpt) []byte) {
+func (sx *server) handleInform(yl *yl.Ylog, sn *subnet, msg dhcpmsg.Message, opts dhcpmsg.DecodedOptions) {
+	if !isSet(msg.ClientIP) {
+		yl.Dropf(logger.LevelWarn, "INFORM: Message without client IP. Dropping!")
+		sx.drop("no_client_ip")
+		return
+	}
+	if !sn.ipdb.InManagedRange(msg.ClientIP) {
+		yl.Dropf(logger.LevelInfo, "INFORM: Client IP '%s' is not in our managed network range. Dropping!", msg.ClientIP)
+		sx.drop("not_managed")
+		return
+	}
+
+	if _, class := sn.clientOptions(msg.ClientMAC, opts); class != nil && class.Deny {
+		yl.Dropf(logger.LevelInfo, "INFORM: Client is a member of denied class '%s'. Dropping!", class.Name)
+		sx.drop("denied")
+		return
+	}
+
+	// The client configured its IP on its own: we must not send any lease information.
+	var iopts []dhcpmsg.DHCPOpt
+	for _, o := range sn.dhcpOptions(msg.ClientMAC, opts) {
+		if o.Option != dhcpmsg.OptIPAddressLeaseDuration {
+			iopts = append(iopts, o)
+		}
+	}
+
+	yl.Decidef("ack", "INFORM: Sending configuration to IP '%s'", msg.ClientIP)
+	// RFC 2131 4.3.5: The reply is unicasted to ciaddr, ignoring the broadcast flag.
+	rep := replies.InformACK(msg.Xid, msg.Flags, sx.selfIP, msg.ClientIP, msg.ClientMAC, iopts)
+	sx.sendReply(msg, rep, msg.ClientIP, false)
+}
+
+func (sx *server) sendNACK(msg dhcpmsg.Message) {
+	rep := replies.NACK(msg.Xid, sx.selfIP, msg.ClientMAC)
+	if isSet(msg.RelayIP) {
+		// RFC 2131 4.3.2: Relay agents must broadcast the NAK to the client.
+		rep.Flags |= dhcpmsg.FlagBroadcast
+	}
+	sx.sendReply(msg, rep, net.IPv4bcast, false)
+}
+
+func (sx *server) sendMsg(sn *subnet, msg dhcpmsg.Message, opts dhcpmsg.DecodedOptions, ip net.IP, f func(uint32, uint16, net.IP, net.IP, net.HardwareAddr, []dhcpmsg.DHCPOpt) dhcpmsg.Message) {
 	// FIXME: Overrides
 	bcast := (msg.Flags & dhcpmsg.FlagBroadcast) != 0
-	pkt := f(msg.Xid, msg.Flags, sx.selfIP, ip, msg.ClientMAC, sx.dhcpOptions(msg.ClientMAC))
+	dopts := sn.dhcpOptions(msg.ClientMAC, opts)
+	next, file := sn.bootFile(msg.ClientMAC, opts)
+	if file != "" {
+		dopts = append(dopts, dhcpmsg.OptionBootFileName(file))
+		if next != nil {
+			dopts = append(dopts, dhcpmsg.OptionTFTPServerName(next.String()))
+		}
+		if strings.HasPrefix(opts.VendorClass, httpClientClass) {
+			// UEFI HTTP boot clients ignore offers which do not identify as such.
+			dopts = append(dopts, dhcpmsg.OptionVendorClass(httpClientClass))
+		}
+	}
+
+	rep := f(msg.Xid, msg.Flags, sx.selfIP, ip, msg.ClientMAC, dopts)
+	if file != "" {
+		rep.NextIP = next
+		// The file field must stay NUL terminated: longer names are only sent as option 67.
+		if len(file) < len(rep.BootFilename) {
+			copy(rep.BootFilename[:], file)
+		}
+	}
+	sx.sendReply(msg, rep, ip, bcast)
+}
 
+// sendReply delivers a reply to the sender of msg: Through its relay agent, routed to dst if
+// the client is not on our network or directly on the wire.
+func (sx *server) sendReply(msg, rep dhcpmsg.Message, dst net.IP, bcast bool) error {
+	rep = replies.EchoRelayAgentInfo(msg, rep)
+	err := sx.deliver(msg, rep, dst, bcast)
+	if err == nil {
+		mSent.Inc(sx.iface.Name, dhcpmsg.MsgTypeName(dhcpmsg.DecodeOptions(rep.Options).MessageType))
+	}
+	return err
+}
+
+func (sx *server) deliver(msg, rep dhcpmsg.Message, dst net.IP, bcast bool) error {
+	if isSet(msg.RelayIP) {
+		rep.RelayIP = msg.RelayIP
+		return sx.sendRouted(replies.Frame(sx.selfIP, msg.RelayIP, replies.PortServer, rep))
+	}
+	if !dst.Equal(net.IPv4bcast) && !sx.local.ipdb.InManagedRange(dst) {
+		// Client of a relayed subnet, talking to us directly.
+		return sx.sendRouted(replies.Frame(sx.selfIP, dst, replies.PortClient, rep))
+	}
 	if bcast {
-		sx.l.Printf(">> SENDING AS BROADCASAT")
-		sx.sendUnicast(net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, pkt)
-	} else {
-		sx.sendUnicast(msg.ClientMAC, pkt)
+		sx.l.Debugf(">> SENDING AS BROADCASAT")
+		return sx.sendUnicast(net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, replies.Frame(sx.selfIP, net.IPv4bcast, replies.PortClient, rep))
 	}
+	return sx.sendUnicast(msg.ClientMAC, replies.Frame(sx.selfIP, dst, replies.PortClient, rep))
 }
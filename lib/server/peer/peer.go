@@ -0,0 +1,429 @@
+// Package peer keeps the lease databases of two psa-dhcpd instances in sync and decides which
+// of them answers requests: The primary is active once it knows the leases of the standby or
+// can not reach it, the standby only takes over while it does not hear from the primary.
+//
+// Both instances must share the same configuration. As only one instance hands out leases at
+// a time, the dynamic range is not split but handed over as a whole.
+package peer
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/logger"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ipdb"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ipdb/journal"
+)
+
+const (
+	RolePrimary = "primary" // Connects to the standby and is active unless it is syncing with it.
+	RoleStandby = "standby" // Accepts the connection of the primary, active only if the primary is gone.
+)
+
+const (
+	// Number of records to queue for the peer before the connection is reset.
+	queueLen = 1024
+	// Time to wait before connecting again.
+	redialInterval = 2 * time.Second
+)
+
+const (
+	msgChallenge = "challenge" // Sent by the standby after accepting a connection.
+	msgHello     = "hello"     // Answer of the primary to the challenge, with a challenge for the standby.
+	msgAccept    = "accept"    // Answer of the standby to the challenge of the primary.
+	msgHeartbeat = "heartbeat" // Sent periodically by both sides.
+	msgRecords   = "records"   // Changes of the lease database.
+)
+
+// Store is a lease database kept in sync with the peer.
+type Store interface {
+	Replay([]journal.Record) int
+	Snapshot() []journal.Record
+}
+
+type message struct {
+	Type    string           `json:"type"`
+	Nonce   string           `json:"nonce,omitempty"`
+	MAC     string           `json:"mac,omitempty"`
+	Servers []net.IP         `json:"servers,omitempty"` // Server identifiers of the sender, sent in the handshake.
+	Records []journal.Record `json:"records,omitempty"`
+}
+
+type Peer struct {
+	sync.Mutex
+	l         *logger.Logger
+	role      string
+	addr      string              // Address to connect to (primary) or to listen on (standby).
+	secret    []byte              // Shared secret to authenticate both sides.
+	next      ipdb.Recorder       // Local recorder to pass all changes to, may be nil.
+	stores    []Store             // Databases to keep in sync.
+	servers   []net.IP            // Our server identifiers.
+	peerIDs   []net.IP            // Server identifiers of the peer, learned in the handshake.
+	queue     chan journal.Record // Changes to send to the peer, nil if not connected.
+	conn      net.Conn            // Current connection to the peer, if any.
+	active    bool                // True if we answer requests.
+	lastSeen  time.Time           // When we last heard from the peer.
+	heartbeat time.Duration       // Interval of heartbeats.
+	takeover  time.Duration       // Silence after which the standby becomes active.
+}
+
+// New returns a peer of the given role. All changes are passed to next before being sent to the peer.
+func New(l *logger.Logger, role, addr string, secret []byte, next ipdb.Recorder) (*Peer, error) {
+	if role != RolePrimary && role != RoleStandby {
+		return nil, fmt.Errorf("invalid role '%s', must be '%s' or '%s'", role, RolePrimary, RoleStandby)
+	}
+	if addr == "" {
+		return nil, fmt.Errorf("no peer address given")
+	}
+	if len(secret) == 0 {
+		l.Warnf("# peer: no shared secret configured, anybody can act as peer!")
+	}
+	return &Peer{
+		l:         l,
+		role:      role,
+		addr:      addr,
+		secret:    secret,
+		next:      next,
+		lastSeen:  time.Now(),
+		heartbeat: 1 * time.Second,
+		takeover:  10 * time.Second,
+	}, nil
+}
+
+// Register adds a database to keep in sync with the peer.
+func (p *Peer) Register(s Store) {
+	p.Lock()
+	defer p.Unlock()
+	p.stores = append(p.stores, s)
+}
+
+// AddServerID adds a server identifier of ours, the peer does not report replies sent from it as rogue.
+func (p *Peer) AddServerID(ip net.IP) {
+	p.Lock()
+	defer p.Unlock()
+	p.servers = append(p.servers, ip)
+}
+
+// IsPeerServer returns true if ip is a server identifier of the peer.
+func (p *Peer) IsPeerServer(ip net.IP) bool {
+	p.Lock()
+	defer p.Unlock()
+	for _, x := range p.peerIDs {
+		if x.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Active returns true if we are supposed to answer requests.
+func (p *Peer) Active() bool {
+	p.Lock()
+	defer p.Unlock()
+	return p.active
+}
+
+// Record passes a local change to the next recorder and queues it for the peer.
+func (p *Peer) Record(rec journal.Record) error {
+	var err error
+	if p.next != nil {
+		err = p.next.Record(rec)
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	if p.queue == nil {
+		// Not connected: the peer receives a snapshot once it is back.
+		return err
+	}
+	select {
+	case p.queue <- rec:
+	default:
+		p.l.Warnf("# peer: queue overflow, resetting connection to force a full sync")
+		p.conn.Close()
+		p.queue = nil
+	}
+	return err
+}
+
+// Run connects to (or accepts connections of) the peer until the context is done.
+func (p *Peer) Run(ctx context.Context) error {
+	if p.role == RolePrimary {
+		return p.runPrimary(ctx)
+	}
+	return p.runStandby(ctx)
+}
+
+func (p *Peer) runPrimary(ctx context.Context) error {
+	var d net.Dialer
+	failing := false
+	for ctx.Err() == nil {
+		conn, err := d.DialContext(ctx, "tcp", p.addr)
+		if err != nil {
+			if !failing {
+				p.l.Errorf("# peer: failed to connect to standby at %s: %v", p.addr, err)
+				failing = true
+			}
+			p.setActive(true, "standby is unreachable")
+		} else {
+			failing = false
+			p.l.Printf("# peer: connected to standby at %s", p.addr)
+			err := p.serve(ctx, conn)
+			p.l.Warnf("# peer: connection to standby lost: %v", err)
+		}
+		select {
+		case <-time.After(redialInterval):
+		case <-ctx.Done():
+		}
+	}
+	return nil
+}
+
+func (p *Peer) runStandby(ctx context.Context) error {
+	ln, err := net.Listen("tcp", p.addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+	go p.watch(ctx)
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			err := p.serve(ctx, conn)
+			p.l.Printf("# peer: connection of %s closed: %v", conn.RemoteAddr(), err)
+		}()
+	}
+}
+
+// watch makes the standby active if the primary is silent for too long.
+func (p *Peer) watch(ctx context.Context) {
+	for {
+		select {
+		case <-time.After(p.heartbeat):
+		case <-ctx.Done():
+			return
+		}
+		p.Lock()
+		if !p.active && time.Since(p.lastSeen) > p.takeover {
+			p.l.Printf("# peer: primary is silent since %s, taking over", p.lastSeen.Format(time.RFC3339))
+			p.active = true
+		}
+		p.Unlock()
+	}
+}
+
+// serve exchanges changes with the peer until the connection fails.
+func (p *Peer) serve(ctx context.Context, conn net.Conn) error {
+	defer conn.Close()
+	enc := json.NewEncoder(conn)
+	dec := json.NewDecoder(conn)
+
+	conn.SetDeadline(time.Now().Add(p.takeover))
+	if err := p.handshake(enc, dec); err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Time{})
+
+	// The standby may have handed out leases while we were gone, the primary waits for its snapshot.
+	if p.role == RolePrimary {
+		p.setActive(false, "syncing with standby")
+	}
+
+	// Start queueing changes before taking the snapshot, so that nothing gets lost.
+	q := make(chan journal.Record, queueLen)
+	p.Lock()
+	if p.conn != nil {
+		// There can only be one primary.
+		p.conn.Close()
+	}
+	p.conn = conn
+	p.queue = q
+	stores := p.stores
+	p.Unlock()
+
+	defer func() {
+		p.Lock()
+		if p.conn == conn {
+			p.conn = nil
+			p.queue = nil
+		}
+		p.Unlock()
+	}()
+
+	var snap []journal.Record
+	for _, s := range stores {
+		snap = append(snap, s.Snapshot()...)
+	}
+	if err := enc.Encode(message{Type: msgRecords, Records: snap}); err != nil {
+		return err
+	}
+
+	sctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		// Unblock the reader on shutdown.
+		<-sctx.Done()
+		conn.Close()
+	}()
+	go p.write(sctx, enc, q)
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(3 * p.heartbeat))
+		msg := message{}
+		if err := dec.Decode(&msg); err != nil {
+			return err
+		}
+		p.seen()
+		if msg.Type == msgRecords {
+			p.apply(stores, msg.Records)
+			if p.role == RolePrimary {
+				// The first records are the snapshot of the standby.
+				p.setActive(true, "synced with standby")
+			}
+		}
+	}
+}
+
+// handshake authenticates both sides: Each of them answers a challenge of the other with the HMAC of
+// its role and the nonce.
+func (p *Peer) handshake(enc *json.Encoder, dec *json.Decoder) error {
+	nonce, err := newNonce()
+	if err != nil {
+		return err
+	}
+
+	if p.role == RolePrimary {
+		msg := message{}
+		if err := dec.Decode(&msg); err != nil {
+			return err
+		}
+		if msg.Type != msgChallenge {
+			return fmt.Errorf("expected %s, got %s", msgChallenge, msg.Type)
+		}
+		if err := enc.Encode(message{Type: msgHello, Nonce: nonce, MAC: p.sign(RolePrimary, msg.Nonce), Servers: p.serverIDs()}); err != nil {
+			return err
+		}
+		msg = message{}
+		if err := dec.Decode(&msg); err != nil {
+			return err
+		}
+		if msg.Type != msgAccept || !hmac.Equal([]byte(msg.MAC), []byte(p.sign(RoleStandby, nonce))) {
+			return fmt.Errorf("authentication of standby failed")
+		}
+		p.setPeerIDs(msg.Servers)
+		return nil
+	}
+
+	if err := enc.Encode(message{Type: msgChallenge, Nonce: nonce}); err != nil {
+		return err
+	}
+	msg := message{}
+	if err := dec.Decode(&msg); err != nil {
+		return err
+	}
+	if msg.Type != msgHello || !hmac.Equal([]byte(msg.MAC), []byte(p.sign(RolePrimary, nonce))) {
+		return fmt.Errorf("authentication of primary failed")
+	}
+	p.setPeerIDs(msg.Servers)
+	return enc.Encode(message{Type: msgAccept, MAC: p.sign(RoleStandby, msg.Nonce), Servers: p.serverIDs()})
+}
+
+func (p *Peer) serverIDs() []net.IP {
+	p.Lock()
+	defer p.Unlock()
+	return p.servers
+}
+
+// setPeerIDs remembers the server identifiers of an authenticated peer, they are kept while it is gone.
+func (p *Peer) setPeerIDs(ips []net.IP) {
+	p.Lock()
+	defer p.Unlock()
+	p.peerIDs = ips
+}
+
+func newNonce() (string, error) {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(nonce), nil
+}
+
+// sign returns the HMAC of the role and the nonce, including the role prevents answering a challenge
+// with the answer of the peer.
+func (p *Peer) sign(role, nonce string) string {
+	h := hmac.New(sha256.New, p.secret)
+	h.Write([]byte(role + ":" + nonce))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// write sends queued changes and heartbeats to the peer.
+func (p *Peer) write(ctx context.Context, enc *json.Encoder, q chan journal.Record) {
+	for {
+		msg := message{Type: msgHeartbeat}
+		select {
+		case rec := <-q:
+			msg = message{Type: msgRecords, Records: []journal.Record{rec}}
+		case <-time.After(p.heartbeat):
+		case <-ctx.Done():
+			return
+		}
+		if err := enc.Encode(msg); err != nil {
+			return
+		}
+	}
+}
+
+// seen notes that the peer is alive. The standby stops answering requests if the primary is back.
+func (p *Peer) seen() {
+	p.Lock()
+	defer p.Unlock()
+	p.lastSeen = time.Now()
+	if p.role == RoleStandby && p.active {
+		p.l.Printf("# peer: primary is back, standing by")
+		p.active = false
+	}
+}
+
+// setActive changes whether we answer requests.
+func (p *Peer) setActive(active bool, reason string) {
+	p.Lock()
+	defer p.Unlock()
+	if p.active != active {
+		p.l.Printf("# peer: %s, active: %v", reason, active)
+		p.active = active
+	}
+}
+
+// apply applies changes of the peer to all stores and to the next recorder.
+func (p *Peer) apply(stores []Store, records []journal.Record) {
+	for _, s := range stores {
+		s.Replay(records)
+	}
+	if p.next == nil {
+		return
+	}
+	for _, rec := range records {
+		if err := p.next.Record(rec); err != nil {
+			p.l.Errorf("# peer: failed to record change of peer: %v", err)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package peer
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/logger"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ipdb"
+	d "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ipdb/duid"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ipdb/journal"
+)
+
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func newPeer(t *testing.T, role, addr, secret string) (*Peer, *ipdb.IPDB) {
+	p, err := New(logger.New(ioutil.Discard, "", logger.LevelDebug, false, false), role, addr, []byte(secret), nil)
+	if err != nil {
+		t.Fatalf("New(%s) = %v, wanted nil err", role, err)
+	}
+	p.heartbeat = 10 * time.Millisecond
+	p.takeover = 200 * time.Millisecond
+
+	db, err := ipdb.New(net.IPv4(192, 168, 0, 0), net.IPv4Mask(255, 255, 255, 0))
+	if err != nil {
+		t.Fatalf("Could not create ipdb: %v", err)
+	}
+	db.SetRecorder(p)
+	p.Register(db)
+	return p, db
+}
+
+// waitFor polls f until it returns true.
+func waitFor(t *testing.T, what string, f func() bool) {
+	for i := 0; i < 300; i++ {
+		if f() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Timeout while waiting for %s", what)
+}
+
+func hasClient(db *ipdb.IPDB, duid d.Duid) func() bool {
+	return func() bool {
+		_, err := db.LookupClientByDuid(duid)
+		return err == nil
+	}
+}
+
+func TestFailover(t *testing.T) {
+	addr := freeAddr(t)
+	primary, pdb := newPeer(t, RolePrimary, addr, "secret")
+	standby, sdb := newPeer(t, RoleStandby, addr, "secret")
+
+	if primary.Active() || standby.Active() {
+		t.Fatalf("Active() = %v, %v before connecting; wanted false, false", primary.Active(), standby.Active())
+	}
+
+	primary.AddServerID(net.IPv4(192, 168, 0, 253))
+	standby.AddServerID(net.IPv4(192, 168, 0, 254))
+
+	// Leases existing before the connection are part of the snapshot.
+	pdb.UpdateClient(net.IPv4(192, 168, 0, 1), d.Duid{0x1}, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pctx, pcancel := context.WithCancel(ctx)
+	go standby.Run(ctx)
+	go primary.Run(pctx)
+
+	waitFor(t, "snapshot", hasClient(sdb, d.Duid{0x1}))
+	waitFor(t, "primary to sync", primary.Active)
+	if !primary.IsPeerServer(net.IPv4(192, 168, 0, 254)) || !standby.IsPeerServer(net.IPv4(192, 168, 0, 253)) {
+		t.Errorf("IsPeerServer() = false for server identifiers of the peer")
+	}
+	if primary.IsPeerServer(net.IPv4(192, 168, 0, 253)) {
+		t.Errorf("IsPeerServer() = true for own server identifier")
+	}
+	pdb.UpdateClient(net.IPv4(192, 168, 0, 2), d.Duid{0x2}, time.Hour)
+	waitFor(t, "replication", hasClient(sdb, d.Duid{0x2}))
+	pdb.ExpireClient(net.IPv4(192, 168, 0, 2), d.Duid{0x2})
+	waitFor(t, "expiry", func() bool { return !hasClient(sdb, d.Duid{0x2})() })
+
+	if standby.Active() {
+		t.Errorf("standby.Active() = true while primary is alive")
+	}
+
+	// Stop the primary: the standby takes over.
+	pcancel()
+	waitFor(t, "takeover", standby.Active)
+	sdb.UpdateClient(net.IPv4(192, 168, 0, 3), d.Duid{0x3}, time.Hour)
+
+	// The primary comes back and learns about the leases of the standby.
+	go primary.Run(ctx)
+	waitFor(t, "sync of standby leases", hasClient(pdb, d.Duid{0x3}))
+	waitFor(t, "standby to stand by", func() bool { return !standby.Active() })
+	waitFor(t, "primary to take over again", primary.Active)
+}
+
+func TestUnreachableStandby(t *testing.T) {
+	primary, _ := newPeer(t, RolePrimary, freeAddr(t), "secret")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go primary.Run(ctx)
+	waitFor(t, "primary to become active", primary.Active)
+}
+
+func TestAuthentication(t *testing.T) {
+	addr := freeAddr(t)
+	primary, pdb := newPeer(t, RolePrimary, addr, "wrong")
+	standby, sdb := newPeer(t, RoleStandby, addr, "secret")
+	pdb.UpdateClient(net.IPv4(192, 168, 0, 1), d.Duid{0x1}, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go standby.Run(ctx)
+	go primary.Run(ctx)
+
+	// A primary with the wrong secret must not stop the standby from taking over.
+	waitFor(t, "takeover", standby.Active)
+	if hasClient(sdb, d.Duid{0x1})() {
+		t.Errorf("Standby accepted leases of an unauthenticated primary")
+	}
+}
+
+func TestStandbyAuthentication(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer ln.Close()
+	primary, pdb := newPeer(t, RolePrimary, ln.Addr().String(), "secret")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go primary.Run(ctx)
+
+	// A standby without the secret accepts the primary and sends its leases.
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("Accept failed: %v", err)
+	}
+	defer conn.Close()
+	enc := json.NewEncoder(conn)
+	dec := json.NewDecoder(conn)
+	enc.Encode(message{Type: msgChallenge, Nonce: "00"})
+	msg := message{}
+	if err := dec.Decode(&msg); err != nil || msg.Type != msgHello {
+		t.Fatalf("Decode() = %+v, %v; wanted %s", msg, err, msgHello)
+	}
+	enc.Encode(message{Type: msgAccept, MAC: "bogus"})
+	enc.Encode(message{Type: msgRecords, Records: []journal.Record{{Op: journal.OpLease, IP: net.IPv4(192, 168, 0, 1), Duid: d.Duid{0x1}, Until: time.Now().Add(time.Hour)}}})
+
+	// The primary must hang up without applying anything.
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for dec.Decode(&msg) == nil {
+	}
+	if hasClient(pdb, d.Duid{0x1})() {
+		t.Errorf("Primary accepted leases of an unauthenticated standby")
+	}
+	if primary.Active() {
+		t.Errorf("primary.Active() = true, wanted false while the standby is reachable but not synced")
+	}
+}
+
+func TestNew(t *testing.T) {
+	l := logger.New(ioutil.Discard, "", logger.LevelDebug, false, false)
+	if _, err := New(l, "leader", "127.0.0.1:647", nil, nil); err == nil {
+		t.Errorf("New(#invalid role) returned nil err, wanted non-nil")
+	}
+	if _, err := New(l, RolePrimary, "", nil, nil); err == nil {
+		t.Errorf("New(#no address) returned nil err, wanted non-nil")
+	}
+}
@@ -20,6 +20,83 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
 
+type AccessConfig_Policy int32
+
+const (
+	AccessConfig_IGNORE     AccessConfig_Policy = 0
+	AccessConfig_NAK        AccessConfig_Policy = 1
+	AccessConfig_QUARANTINE AccessConfig_Policy = 2
+)
+
+var AccessConfig_Policy_name = map[int32]string{
+	0: "IGNORE",
+	1: "NAK",
+	2: "QUARANTINE",
+}
+
+var AccessConfig_Policy_value = map[string]int32{
+	"IGNORE":     0,
+	"NAK":        1,
+	"QUARANTINE": 2,
+}
+
+func (x AccessConfig_Policy) String() string {
+	return proto.EnumName(AccessConfig_Policy_name, int32(x))
+}
+
+func (AccessConfig_Policy) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_495b121871ab1746, []int{3, 0}
+}
+
+type OptionConfig_Type int32
+
+const (
+	OptionConfig_UNSET   OptionConfig_Type = 0
+	OptionConfig_IP      OptionConfig_Type = 1
+	OptionConfig_IP_LIST OptionConfig_Type = 2
+	OptionConfig_UINT8   OptionConfig_Type = 3
+	OptionConfig_UINT16  OptionConfig_Type = 4
+	OptionConfig_UINT32  OptionConfig_Type = 5
+	OptionConfig_STRING  OptionConfig_Type = 6
+	OptionConfig_BOOL    OptionConfig_Type = 7
+	OptionConfig_HEX     OptionConfig_Type = 8
+	OptionConfig_ROUTES  OptionConfig_Type = 9
+)
+
+var OptionConfig_Type_name = map[int32]string{
+	0: "UNSET",
+	1: "IP",
+	2: "IP_LIST",
+	3: "UINT8",
+	4: "UINT16",
+	5: "UINT32",
+	6: "STRING",
+	7: "BOOL",
+	8: "HEX",
+	9: "ROUTES",
+}
+
+var OptionConfig_Type_value = map[string]int32{
+	"UNSET":   0,
+	"IP":      1,
+	"IP_LIST": 2,
+	"UINT8":   3,
+	"UINT16":  4,
+	"UINT32":  5,
+	"STRING":  6,
+	"BOOL":    7,
+	"HEX":     8,
+	"ROUTES":  9,
+}
+
+func (x OptionConfig_Type) String() string {
+	return proto.EnumName(OptionConfig_Type_name, int32(x))
+}
+
+func (OptionConfig_Type) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_495b121871ab1746, []int{4, 0}
+}
+
 type ServerConfig struct {
 	// IP&cidr we are responsible for.
 	Network string `protobuf:"bytes,1,opt,name=network,proto3" json:"network,omitempty"`
@@ -38,10 +115,46 @@ type ServerConfig struct {
 	// Disable dynamic configuration, only hand out IPs to staticly configured hosts.
 	StaticOnly bool `protobuf:"varint,8,opt,name=static_only,json=staticOnly,proto3" json:"static_only,omitempty"`
 	// Static hwaddr -> config mapping.
-	Client               map[string]*ClientConfig `protobuf:"bytes,9,rep,name=client,proto3" json:"client,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
-	XXX_NoUnkeyedLiteral struct{}                 `json:"-"`
-	XXX_unrecognized     []byte                   `json:"-"`
-	XXX_sizecache        int32                    `json:"-"`
+	Client map[string]*ClientConfig `protobuf:"bytes,9,rep,name=client,proto3" json:"client,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	// For how long to stop offering an IP after a client declined it, defaults to 10m.
+	DeclineQuarantine string `protobuf:"bytes,10,opt,name=decline_quarantine,json=declineQuarantine,proto3" json:"decline_quarantine,omitempty"`
+	// Remote networks served through DHCP relay agents (giaddr), which must not overlap with network or
+	// with each other. All settings except for decline_quarantine, relay_subnet, tftp, rate_limit,
+	// trusted_server and leasequery_requester are used.
+	RelaySubnet []*ServerConfig `protobuf:"bytes,11,rep,name=relay_subnet,json=relaySubnet,proto3" json:"relay_subnet,omitempty"`
+	// Server to load the boot file from (siaddr and option 66), usually a TFTP server.
+	NextServer string `protobuf:"bytes,12,opt,name=next_server,json=nextServer,proto3" json:"next_server,omitempty"`
+	// Boot file to announce (file field and option 67) if no boot rule matches.
+	BootFilename string `protobuf:"bytes,13,opt,name=boot_filename,json=bootFilename,proto3" json:"boot_filename,omitempty"`
+	// Boot rules to select a boot file by client architecture and vendor class; the first matching rule wins.
+	Boot []*BootRule `protobuf:"bytes,14,rep,name=boot,proto3" json:"boot,omitempty"`
+	// Built-in read-only TFTP server, disabled if unset. Not used in relay_subnet.
+	Tftp *TFTPConfig `protobuf:"bytes,15,opt,name=tftp,proto3" json:"tftp,omitempty"`
+	// Client classes, the first class matching a client without a static configuration (client) applies.
+	Class []*ClassConfig `protobuf:"bytes,16,rep,name=class,proto3" json:"class,omitempty"`
+	// Additional options to announce.
+	Option []*OptionConfig `protobuf:"bytes,17,rep,name=option,proto3" json:"option,omitempty"`
+	// Classless static routes (options 121 and 249) to announce, eg. "10.0.0.0/8 172.21.0.254".
+	// The router is added as default route unless one is configured, as clients ignore it if routes are sent.
+	StaticRoute []string `protobuf:"bytes,18,rep,name=static_route,json=staticRoute,proto3" json:"static_route,omitempty"`
+	// Restricts which clients are served, all clients are if unset.
+	Access *AccessConfig `protobuf:"bytes,19,opt,name=access,proto3" json:"access,omitempty"`
+	// Limits the rate of messages handled, defaults apply if unset. Not used in relay_subnet.
+	RateLimit *RateLimitConfig `protobuf:"bytes,20,opt,name=rate_limit,json=rateLimit,proto3" json:"rate_limit,omitempty"`
+	// Server identifiers of other DHCP servers expected to answer clients on this network (eg. the failover
+	// peer), replies of all others are reported as rogue. Not used in relay_subnet.
+	TrustedServer []string `protobuf:"bytes,21,rep,name=trusted_server,json=trustedServer,proto3" json:"trusted_server,omitempty"`
+	// Static configuration by switch port for clients behind relay agents inserting the relay agent
+	// information option (82): the lease belongs to the circuit instead of the client, so a port always
+	// gets the same IP. Takes precedence over client.
+	Circuit []*CircuitConfig `protobuf:"bytes,22,rep,name=circuit,proto3" json:"circuit,omitempty"`
+	// Addresses or networks (eg. "10.0.0.1" or "10.0.0.0/24") of access routers allowed to query leases
+	// through DHCPLEASEQUERY (RFC 4388), answers are sent to their giaddr. Disabled if empty. Not used in
+	// relay_subnet.
+	LeasequeryRequester  []string `protobuf:"bytes,23,rep,name=leasequery_requester,json=leasequeryRequester,proto3" json:"leasequery_requester,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
 func (m *ServerConfig) Reset()         { *m = ServerConfig{} }
@@ -132,6 +245,657 @@ func (m *ServerConfig) GetClient() map[string]*ClientConfig {
 	return nil
 }
 
+func (m *ServerConfig) GetDeclineQuarantine() string {
+	if m != nil {
+		return m.DeclineQuarantine
+	}
+	return ""
+}
+
+func (m *ServerConfig) GetRelaySubnet() []*ServerConfig {
+	if m != nil {
+		return m.RelaySubnet
+	}
+	return nil
+}
+
+func (m *ServerConfig) GetNextServer() string {
+	if m != nil {
+		return m.NextServer
+	}
+	return ""
+}
+
+func (m *ServerConfig) GetBootFilename() string {
+	if m != nil {
+		return m.BootFilename
+	}
+	return ""
+}
+
+func (m *ServerConfig) GetBoot() []*BootRule {
+	if m != nil {
+		return m.Boot
+	}
+	return nil
+}
+
+func (m *ServerConfig) GetTftp() *TFTPConfig {
+	if m != nil {
+		return m.Tftp
+	}
+	return nil
+}
+
+func (m *ServerConfig) GetClass() []*ClassConfig {
+	if m != nil {
+		return m.Class
+	}
+	return nil
+}
+
+func (m *ServerConfig) GetOption() []*OptionConfig {
+	if m != nil {
+		return m.Option
+	}
+	return nil
+}
+
+func (m *ServerConfig) GetStaticRoute() []string {
+	if m != nil {
+		return m.StaticRoute
+	}
+	return nil
+}
+
+func (m *ServerConfig) GetAccess() *AccessConfig {
+	if m != nil {
+		return m.Access
+	}
+	return nil
+}
+
+func (m *ServerConfig) GetRateLimit() *RateLimitConfig {
+	if m != nil {
+		return m.RateLimit
+	}
+	return nil
+}
+
+func (m *ServerConfig) GetTrustedServer() []string {
+	if m != nil {
+		return m.TrustedServer
+	}
+	return nil
+}
+
+func (m *ServerConfig) GetCircuit() []*CircuitConfig {
+	if m != nil {
+		return m.Circuit
+	}
+	return nil
+}
+
+func (m *ServerConfig) GetLeasequeryRequester() []string {
+	if m != nil {
+		return m.LeasequeryRequester
+	}
+	return nil
+}
+
+type CircuitConfig struct {
+	// Circuit-id sub-option to match, as text or as hex with a "0x" prefix, eg. "Gi1/0/12" or "0x000400640102".
+	CircuitId string `protobuf:"bytes,1,opt,name=circuit_id,json=circuitId,proto3" json:"circuit_id,omitempty"`
+	// Remote-id sub-option to match, same format. Matches any remote-id if empty.
+	RemoteId string `protobuf:"bytes,2,opt,name=remote_id,json=remoteId,proto3" json:"remote_id,omitempty"`
+	// Configuration of the client connected to the circuit.
+	Config               *ClientConfig `protobuf:"bytes,3,opt,name=config,proto3" json:"config,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}      `json:"-"`
+	XXX_unrecognized     []byte        `json:"-"`
+	XXX_sizecache        int32         `json:"-"`
+}
+
+func (m *CircuitConfig) Reset()         { *m = CircuitConfig{} }
+func (m *CircuitConfig) String() string { return proto.CompactTextString(m) }
+func (*CircuitConfig) ProtoMessage()    {}
+func (*CircuitConfig) Descriptor() ([]byte, []int) {
+	return fileDescriptor_495b121871ab1746, []int{1}
+}
+
+func (m *CircuitConfig) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CircuitConfig.Unmarshal(m, b)
+}
+func (m *CircuitConfig) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CircuitConfig.Marshal(b, m, deterministic)
+}
+func (m *CircuitConfig) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CircuitConfig.Merge(m, src)
+}
+func (m *CircuitConfig) XXX_Size() int {
+	return xxx_messageInfo_CircuitConfig.Size(m)
+}
+func (m *CircuitConfig) XXX_DiscardUnknown() {
+	xxx_messageInfo_CircuitConfig.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CircuitConfig proto.InternalMessageInfo
+
+func (m *CircuitConfig) GetCircuitId() string {
+	if m != nil {
+		return m.CircuitId
+	}
+	return ""
+}
+
+func (m *CircuitConfig) GetRemoteId() string {
+	if m != nil {
+		return m.RemoteId
+	}
+	return ""
+}
+
+func (m *CircuitConfig) GetConfig() *ClientConfig {
+	if m != nil {
+		return m.Config
+	}
+	return nil
+}
+
+// Token bucket rate limits, excess messages are dropped. Rates are messages per second.
+type RateLimitConfig struct {
+	// Rate of messages accepted from a single client (by client identifier or hwaddr), defaults to 2.
+	ClientRate float64 `protobuf:"fixed64,1,opt,name=client_rate,json=clientRate,proto3" json:"client_rate,omitempty"`
+	// Messages a single client may send in a burst, defaults to 10.
+	ClientBurst uint32 `protobuf:"varint,2,opt,name=client_burst,json=clientBurst,proto3" json:"client_burst,omitempty"`
+	// Rate of messages accepted from all clients, defaults to 200.
+	GlobalRate float64 `protobuf:"fixed64,3,opt,name=global_rate,json=globalRate,proto3" json:"global_rate,omitempty"`
+	// Messages all clients may send in a burst, defaults to 400.
+	GlobalBurst uint32 `protobuf:"varint,4,opt,name=global_burst,json=globalBurst,proto3" json:"global_burst,omitempty"`
+	// Number of messages handled concurrently, defaults to 32.
+	Workers              uint32   `protobuf:"varint,5,opt,name=workers,proto3" json:"workers,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RateLimitConfig) Reset()         { *m = RateLimitConfig{} }
+func (m *RateLimitConfig) String() string { return proto.CompactTextString(m) }
+func (*RateLimitConfig) ProtoMessage()    {}
+func (*RateLimitConfig) Descriptor() ([]byte, []int) {
+	return fileDescriptor_495b121871ab1746, []int{2}
+}
+
+func (m *RateLimitConfig) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RateLimitConfig.Unmarshal(m, b)
+}
+func (m *RateLimitConfig) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RateLimitConfig.Marshal(b, m, deterministic)
+}
+func (m *RateLimitConfig) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RateLimitConfig.Merge(m, src)
+}
+func (m *RateLimitConfig) XXX_Size() int {
+	return xxx_messageInfo_RateLimitConfig.Size(m)
+}
+func (m *RateLimitConfig) XXX_DiscardUnknown() {
+	xxx_messageInfo_RateLimitConfig.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RateLimitConfig proto.InternalMessageInfo
+
+func (m *RateLimitConfig) GetClientRate() float64 {
+	if m != nil {
+		return m.ClientRate
+	}
+	return 0
+}
+
+func (m *RateLimitConfig) GetClientBurst() uint32 {
+	if m != nil {
+		return m.ClientBurst
+	}
+	return 0
+}
+
+func (m *RateLimitConfig) GetGlobalRate() float64 {
+	if m != nil {
+		return m.GlobalRate
+	}
+	return 0
+}
+
+func (m *RateLimitConfig) GetGlobalBurst() uint32 {
+	if m != nil {
+		return m.GlobalBurst
+	}
+	return 0
+}
+
+func (m *RateLimitConfig) GetWorkers() uint32 {
+	if m != nil {
+		return m.Workers
+	}
+	return 0
+}
+
+// Access control for clients, evaluated before any other configuration applies.
+// Rules are hardware addresses or prefixes of them (eg. an OUI such as "b8:27:eb") or "local" to match
+// locally administered (usually randomized) addresses.
+type AccessConfig struct {
+	// Clients allowed to be served. Unless empty, other clients are unknown and handled according to policy.
+	// Clients with a static configuration (client) are always known.
+	Allow []string `protobuf:"bytes,1,rep,name=allow,proto3" json:"allow,omitempty"`
+	// Clients never served normally, even if allowed or statically configured.
+	Deny []string `protobuf:"bytes,2,rep,name=deny,proto3" json:"deny,omitempty"`
+	// How to handle denied and unknown clients.
+	Policy AccessConfig_Policy `protobuf:"varint,3,opt,name=policy,proto3,enum=serverconfig.AccessConfig_Policy" json:"policy,omitempty"`
+	// Pool ('start-end') for the QUARANTINE policy, must be within network and must not overlap with
+	// dynamic_range.
+	QuarantineRange      string   `protobuf:"bytes,4,opt,name=quarantine_range,json=quarantineRange,proto3" json:"quarantine_range,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *AccessConfig) Reset()         { *m = AccessConfig{} }
+func (m *AccessConfig) String() string { return proto.CompactTextString(m) }
+func (*AccessConfig) ProtoMessage()    {}
+func (*AccessConfig) Descriptor() ([]byte, []int) {
+	return fileDescriptor_495b121871ab1746, []int{3}
+}
+
+func (m *AccessConfig) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_AccessConfig.Unmarshal(m, b)
+}
+func (m *AccessConfig) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_AccessConfig.Marshal(b, m, deterministic)
+}
+func (m *AccessConfig) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AccessConfig.Merge(m, src)
+}
+func (m *AccessConfig) XXX_Size() int {
+	return xxx_messageInfo_AccessConfig.Size(m)
+}
+func (m *AccessConfig) XXX_DiscardUnknown() {
+	xxx_messageInfo_AccessConfig.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AccessConfig proto.InternalMessageInfo
+
+func (m *AccessConfig) GetAllow() []string {
+	if m != nil {
+		return m.Allow
+	}
+	return nil
+}
+
+func (m *AccessConfig) GetDeny() []string {
+	if m != nil {
+		return m.Deny
+	}
+	return nil
+}
+
+func (m *AccessConfig) GetPolicy() AccessConfig_Policy {
+	if m != nil {
+		return m.Policy
+	}
+	return AccessConfig_IGNORE
+}
+
+func (m *AccessConfig) GetQuarantineRange() string {
+	if m != nil {
+		return m.QuarantineRange
+	}
+	return ""
+}
+
+// A DHCP option with a typed value.
+type OptionConfig struct {
+	// Option code. Options with a dedicated setting (eg. router) and options used by the protocol itself
+	// can not be configured.
+	Code uint32 `protobuf:"varint,1,opt,name=code,proto3" json:"code,omitempty"`
+	// Type of the value.
+	Type OptionConfig_Type `protobuf:"varint,2,opt,name=type,proto3,enum=serverconfig.OptionConfig_Type" json:"type,omitempty"`
+	// Value of the option, only IP_LIST and ROUTES accept more than one.
+	Value []string `protobuf:"bytes,3,rep,name=value,proto3" json:"value,omitempty"`
+	// Send the option even if the client did not request it in its parameter request list (option 55).
+	AlwaysSend           bool     `protobuf:"varint,4,opt,name=always_send,json=alwaysSend,proto3" json:"always_send,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *OptionConfig) Reset()         { *m = OptionConfig{} }
+func (m *OptionConfig) String() string { return proto.CompactTextString(m) }
+func (*OptionConfig) ProtoMessage()    {}
+func (*OptionConfig) Descriptor() ([]byte, []int) {
+	return fileDescriptor_495b121871ab1746, []int{4}
+}
+
+func (m *OptionConfig) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_OptionConfig.Unmarshal(m, b)
+}
+func (m *OptionConfig) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_OptionConfig.Marshal(b, m, deterministic)
+}
+func (m *OptionConfig) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_OptionConfig.Merge(m, src)
+}
+func (m *OptionConfig) XXX_Size() int {
+	return xxx_messageInfo_OptionConfig.Size(m)
+}
+func (m *OptionConfig) XXX_DiscardUnknown() {
+	xxx_messageInfo_OptionConfig.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_OptionConfig proto.InternalMessageInfo
+
+func (m *OptionConfig) GetCode() uint32 {
+	if m != nil {
+		return m.Code
+	}
+	return 0
+}
+
+func (m *OptionConfig) GetType() OptionConfig_Type {
+	if m != nil {
+		return m.Type
+	}
+	return OptionConfig_UNSET
+}
+
+func (m *OptionConfig) GetValue() []string {
+	if m != nil {
+		return m.Value
+	}
+	return nil
+}
+
+func (m *OptionConfig) GetAlwaysSend() bool {
+	if m != nil {
+		return m.AlwaysSend
+	}
+	return false
+}
+
+type ClassConfig struct {
+	// Name of the class, used for logging.
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// A client must match all configured criteria, lists match if any of their entries matches.
+	// Prefix of the vendor class (option 60), eg. "android-dhcp-".
+	VendorClass string `protobuf:"bytes,2,opt,name=vendor_class,json=vendorClass,proto3" json:"vendor_class,omitempty"`
+	// User class (option 77).
+	UserClass string `protobuf:"bytes,3,opt,name=user_class,json=userClass,proto3" json:"user_class,omitempty"`
+	// Vendor names from the OUI database, matched as case insensitive prefix, eg. "Raspberry Pi".
+	Oui []string `protobuf:"bytes,4,rep,name=oui,proto3" json:"oui,omitempty"`
+	// Hardware address prefixes, eg. "b8:27:eb".
+	HwaddrPrefix []string `protobuf:"bytes,5,rep,name=hwaddr_prefix,json=hwaddrPrefix,proto3" json:"hwaddr_prefix,omitempty"`
+	// Parameter request list (option 55) fingerprints, eg. "1,3,6,15,119,252".
+	Fingerprint []string `protobuf:"bytes,6,rep,name=fingerprint,proto3" json:"fingerprint,omitempty"`
+	// Router to announce to members.
+	Router string `protobuf:"bytes,7,opt,name=router,proto3" json:"router,omitempty"`
+	// DNS to announce to members.
+	Dns []string `protobuf:"bytes,8,rep,name=dns,proto3" json:"dns,omitempty"`
+	// NTP servers to announce to members.
+	Ntp []string `protobuf:"bytes,9,rep,name=ntp,proto3" json:"ntp,omitempty"`
+	// Domain name to announce to members.
+	Domain string `protobuf:"bytes,10,opt,name=domain,proto3" json:"domain,omitempty"`
+	// Validity of leases of members.
+	LeaseDuration string `protobuf:"bytes,11,opt,name=lease_duration,json=leaseDuration,proto3" json:"lease_duration,omitempty"`
+	// Dedicated pool ('start-end') to assign IPs to members from, must be within network and must not
+	// overlap with dynamic_range. Also used if static_only is set.
+	DynamicRange string `protobuf:"bytes,12,opt,name=dynamic_range,json=dynamicRange,proto3" json:"dynamic_range,omitempty"`
+	// Do not answer members at all.
+	Deny                 bool     `protobuf:"varint,13,opt,name=deny,proto3" json:"deny,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ClassConfig) Reset()         { *m = ClassConfig{} }
+func (m *ClassConfig) String() string { return proto.CompactTextString(m) }
+func (*ClassConfig) ProtoMessage()    {}
+func (*ClassConfig) Descriptor() ([]byte, []int) {
+	return fileDescriptor_495b121871ab1746, []int{5}
+}
+
+func (m *ClassConfig) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ClassConfig.Unmarshal(m, b)
+}
+func (m *ClassConfig) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ClassConfig.Marshal(b, m, deterministic)
+}
+func (m *ClassConfig) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ClassConfig.Merge(m, src)
+}
+func (m *ClassConfig) XXX_Size() int {
+	return xxx_messageInfo_ClassConfig.Size(m)
+}
+func (m *ClassConfig) XXX_DiscardUnknown() {
+	xxx_messageInfo_ClassConfig.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ClassConfig proto.InternalMessageInfo
+
+func (m *ClassConfig) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *ClassConfig) GetVendorClass() string {
+	if m != nil {
+		return m.VendorClass
+	}
+	return ""
+}
+
+func (m *ClassConfig) GetUserClass() string {
+	if m != nil {
+		return m.UserClass
+	}
+	return ""
+}
+
+func (m *ClassConfig) GetOui() []string {
+	if m != nil {
+		return m.Oui
+	}
+	return nil
+}
+
+func (m *ClassConfig) GetHwaddrPrefix() []string {
+	if m != nil {
+		return m.HwaddrPrefix
+	}
+	return nil
+}
+
+func (m *ClassConfig) GetFingerprint() []string {
+	if m != nil {
+		return m.Fingerprint
+	}
+	return nil
+}
+
+func (m *ClassConfig) GetRouter() string {
+	if m != nil {
+		return m.Router
+	}
+	return ""
+}
+
+func (m *ClassConfig) GetDns() []string {
+	if m != nil {
+		return m.Dns
+	}
+	return nil
+}
+
+func (m *ClassConfig) GetNtp() []string {
+	if m != nil {
+		return m.Ntp
+	}
+	return nil
+}
+
+func (m *ClassConfig) GetDomain() string {
+	if m != nil {
+		return m.Domain
+	}
+	return ""
+}
+
+func (m *ClassConfig) GetLeaseDuration() string {
+	if m != nil {
+		return m.LeaseDuration
+	}
+	return ""
+}
+
+func (m *ClassConfig) GetDynamicRange() string {
+	if m != nil {
+		return m.DynamicRange
+	}
+	return ""
+}
+
+func (m *ClassConfig) GetDeny() bool {
+	if m != nil {
+		return m.Deny
+	}
+	return false
+}
+
+type TFTPConfig struct {
+	// Directory to serve files from; next_server defaults to the IP of the interface if set.
+	Root string `protobuf:"bytes,1,opt,name=root,proto3" json:"root,omitempty"`
+	// Address to listen on, defaults to port 69 on the IP of the interface.
+	Listen               string   `protobuf:"bytes,2,opt,name=listen,proto3" json:"listen,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TFTPConfig) Reset()         { *m = TFTPConfig{} }
+func (m *TFTPConfig) String() string { return proto.CompactTextString(m) }
+func (*TFTPConfig) ProtoMessage()    {}
+func (*TFTPConfig) Descriptor() ([]byte, []int) {
+	return fileDescriptor_495b121871ab1746, []int{6}
+}
+
+func (m *TFTPConfig) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TFTPConfig.Unmarshal(m, b)
+}
+func (m *TFTPConfig) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TFTPConfig.Marshal(b, m, deterministic)
+}
+func (m *TFTPConfig) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TFTPConfig.Merge(m, src)
+}
+func (m *TFTPConfig) XXX_Size() int {
+	return xxx_messageInfo_TFTPConfig.Size(m)
+}
+func (m *TFTPConfig) XXX_DiscardUnknown() {
+	xxx_messageInfo_TFTPConfig.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TFTPConfig proto.InternalMessageInfo
+
+func (m *TFTPConfig) GetRoot() string {
+	if m != nil {
+		return m.Root
+	}
+	return ""
+}
+
+func (m *TFTPConfig) GetListen() string {
+	if m != nil {
+		return m.Listen
+	}
+	return ""
+}
+
+type BootRule struct {
+	// Client architectures (option 93) this rule applies to, eg. 0 for BIOS, 7 for x86-64 UEFI
+	// or 16 for x86-64 UEFI HTTP boot. Matches any architecture if empty.
+	Arch []uint32 `protobuf:"varint,1,rep,packed,name=arch,proto3" json:"arch,omitempty"`
+	// Prefix of the vendor class (option 60) this rule applies to, eg. "PXEClient" or "HTTPClient".
+	// Matches any vendor class if empty.
+	VendorClass string `protobuf:"bytes,2,opt,name=vendor_class,json=vendorClass,proto3" json:"vendor_class,omitempty"`
+	// User class (option 77) this rule applies to, eg. "iPXE". Matches any user class if empty.
+	UserClass string `protobuf:"bytes,3,opt,name=user_class,json=userClass,proto3" json:"user_class,omitempty"`
+	// Server to load the boot file from, defaults to next_server of the network.
+	NextServer string `protobuf:"bytes,4,opt,name=next_server,json=nextServer,proto3" json:"next_server,omitempty"`
+	// Boot file to announce to matching clients.
+	BootFilename         string   `protobuf:"bytes,5,opt,name=boot_filename,json=bootFilename,proto3" json:"boot_filename,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *BootRule) Reset()         { *m = BootRule{} }
+func (m *BootRule) String() string { return proto.CompactTextString(m) }
+func (*BootRule) ProtoMessage()    {}
+func (*BootRule) Descriptor() ([]byte, []int) {
+	return fileDescriptor_495b121871ab1746, []int{7}
+}
+
+func (m *BootRule) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BootRule.Unmarshal(m, b)
+}
+func (m *BootRule) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BootRule.Marshal(b, m, deterministic)
+}
+func (m *BootRule) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BootRule.Merge(m, src)
+}
+func (m *BootRule) XXX_Size() int {
+	return xxx_messageInfo_BootRule.Size(m)
+}
+func (m *BootRule) XXX_DiscardUnknown() {
+	xxx_messageInfo_BootRule.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BootRule proto.InternalMessageInfo
+
+func (m *BootRule) GetArch() []uint32 {
+	if m != nil {
+		return m.Arch
+	}
+	return nil
+}
+
+func (m *BootRule) GetVendorClass() string {
+	if m != nil {
+		return m.VendorClass
+	}
+	return ""
+}
+
+func (m *BootRule) GetUserClass() string {
+	if m != nil {
+		return m.UserClass
+	}
+	return ""
+}
+
+func (m *BootRule) GetNextServer() string {
+	if m != nil {
+		return m.NextServer
+	}
+	return ""
+}
+
+func (m *BootRule) GetBootFilename() string {
+	if m != nil {
+		return m.BootFilename
+	}
+	return ""
+}
+
 type ClientConfig struct {
 	// IP we will try to assign to this host.
 	Ip string `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
@@ -142,7 +906,15 @@ type ClientConfig struct {
 	// DNS to announce.
 	Dns []string `protobuf:"bytes,4,rep,name=dns,proto3" json:"dns,omitempty"`
 	// NTP servers to announce.
-	Ntp                  []string `protobuf:"bytes,5,rep,name=ntp,proto3" json:"ntp,omitempty"`
+	Ntp []string `protobuf:"bytes,5,rep,name=ntp,proto3" json:"ntp,omitempty"`
+	// Server to load the boot file from, overrides next_server of the network.
+	NextServer string `protobuf:"bytes,6,opt,name=next_server,json=nextServer,proto3" json:"next_server,omitempty"`
+	// Boot file to announce, overrides any boot rules of the network.
+	BootFilename string `protobuf:"bytes,7,opt,name=boot_filename,json=bootFilename,proto3" json:"boot_filename,omitempty"`
+	// Additional options to announce, replacing options of the network with the same code.
+	Option []*OptionConfig `protobuf:"bytes,8,rep,name=option,proto3" json:"option,omitempty"`
+	// Classless static routes to announce, replacing those of the network.
+	StaticRoute          []string `protobuf:"bytes,9,rep,name=static_route,json=staticRoute,proto3" json:"static_route,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -152,7 +924,7 @@ func (m *ClientConfig) Reset()         { *m = ClientConfig{} }
 func (m *ClientConfig) String() string { return proto.CompactTextString(m) }
 func (*ClientConfig) ProtoMessage()    {}
 func (*ClientConfig) Descriptor() ([]byte, []int) {
-	return fileDescriptor_495b121871ab1746, []int{1}
+	return fileDescriptor_495b121871ab1746, []int{8}
 }
 
 func (m *ClientConfig) XXX_Unmarshal(b []byte) error {
@@ -208,35 +980,359 @@ func (m *ClientConfig) GetNtp() []string {
 	return nil
 }
 
+func (m *ClientConfig) GetNextServer() string {
+	if m != nil {
+		return m.NextServer
+	}
+	return ""
+}
+
+func (m *ClientConfig) GetBootFilename() string {
+	if m != nil {
+		return m.BootFilename
+	}
+	return ""
+}
+
+func (m *ClientConfig) GetOption() []*OptionConfig {
+	if m != nil {
+		return m.Option
+	}
+	return nil
+}
+
+func (m *ClientConfig) GetStaticRoute() []string {
+	if m != nil {
+		return m.StaticRoute
+	}
+	return nil
+}
+
+// Configuration of a psa-dhcpd process serving several interfaces.
+type DaemonConfig struct {
+	// Interface name -> server configuration for this interface.
+	Interface            map[string]*ServerConfig `protobuf:"bytes,1,rep,name=interface,proto3" json:"interface,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	XXX_NoUnkeyedLiteral struct{}                 `json:"-"`
+	XXX_unrecognized     []byte                   `json:"-"`
+	XXX_sizecache        int32                    `json:"-"`
+}
+
+func (m *DaemonConfig) Reset()         { *m = DaemonConfig{} }
+func (m *DaemonConfig) String() string { return proto.CompactTextString(m) }
+func (*DaemonConfig) ProtoMessage()    {}
+func (*DaemonConfig) Descriptor() ([]byte, []int) {
+	return fileDescriptor_495b121871ab1746, []int{9}
+}
+
+func (m *DaemonConfig) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DaemonConfig.Unmarshal(m, b)
+}
+func (m *DaemonConfig) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DaemonConfig.Marshal(b, m, deterministic)
+}
+func (m *DaemonConfig) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DaemonConfig.Merge(m, src)
+}
+func (m *DaemonConfig) XXX_Size() int {
+	return xxx_messageInfo_DaemonConfig.Size(m)
+}
+func (m *DaemonConfig) XXX_DiscardUnknown() {
+	xxx_messageInfo_DaemonConfig.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DaemonConfig proto.InternalMessageInfo
+
+func (m *DaemonConfig) GetInterface() map[string]*ServerConfig {
+	if m != nil {
+		return m.Interface
+	}
+	return nil
+}
+
+// Configuration of psa-dhcpd6, serving stateful DHCPv6 (RFC 8415) on one interface.
+type Server6Config struct {
+	// Range of addresses to assign (IA_NA), eg. "2001:db8::1000-2001:db8::1fff". No addresses are
+	// assigned if empty.
+	AddressRange string `protobuf:"bytes,1,opt,name=address_range,json=addressRange,proto3" json:"address_range,omitempty"`
+	// Pool to delegate prefixes (IA_PD) from, eg. "2001:db8:100::/48". No prefixes are delegated if empty.
+	PrefixPool string `protobuf:"bytes,2,opt,name=prefix_pool,json=prefixPool,proto3" json:"prefix_pool,omitempty"`
+	// Length of delegated prefixes, must not be shorter than prefix_pool. Defaults to 64.
+	DelegatedLength uint32 `protobuf:"varint,3,opt,name=delegated_length,json=delegatedLength,proto3" json:"delegated_length,omitempty"`
+	// Preferred lifetime of addresses and prefixes, defaults to 1h. Clients renew after half of it.
+	PreferredLifetime string `protobuf:"bytes,4,opt,name=preferred_lifetime,json=preferredLifetime,proto3" json:"preferred_lifetime,omitempty"`
+	// Valid lifetime of addresses and prefixes, defaults to twice the preferred lifetime.
+	ValidLifetime string `protobuf:"bytes,5,opt,name=valid_lifetime,json=validLifetime,proto3" json:"valid_lifetime,omitempty"`
+	// List of DNS to announce.
+	Dns []string `protobuf:"bytes,6,rep,name=dns,proto3" json:"dns,omitempty"`
+	// Domain search list to announce.
+	Domain []string `protobuf:"bytes,7,rep,name=domain,proto3" json:"domain,omitempty"`
+	// Server preference (0-255) sent in advertisements, clients pick the server with the highest one.
+	Preference uint32 `protobuf:"varint,8,opt,name=preference,proto3" json:"preference,omitempty"`
+	// Commit leases on the first message of clients asking for rapid commit (Solicit -> Reply).
+	RapidCommit bool `protobuf:"varint,9,opt,name=rapid_commit,json=rapidCommit,proto3" json:"rapid_commit,omitempty"`
+	// Static duid -> config mapping, eg. "00-01-00-01-29-9e-0c-51-02-00-00-00-00-01".
+	Client               map[string]*Client6Config `protobuf:"bytes,10,rep,name=client,proto3" json:"client,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	XXX_NoUnkeyedLiteral struct{}                  `json:"-"`
+	XXX_unrecognized     []byte                    `json:"-"`
+	XXX_sizecache        int32                     `json:"-"`
+}
+
+func (m *Server6Config) Reset()         { *m = Server6Config{} }
+func (m *Server6Config) String() string { return proto.CompactTextString(m) }
+func (*Server6Config) ProtoMessage()    {}
+func (*Server6Config) Descriptor() ([]byte, []int) {
+	return fileDescriptor_495b121871ab1746, []int{10}
+}
+
+func (m *Server6Config) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Server6Config.Unmarshal(m, b)
+}
+func (m *Server6Config) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Server6Config.Marshal(b, m, deterministic)
+}
+func (m *Server6Config) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Server6Config.Merge(m, src)
+}
+func (m *Server6Config) XXX_Size() int {
+	return xxx_messageInfo_Server6Config.Size(m)
+}
+func (m *Server6Config) XXX_DiscardUnknown() {
+	xxx_messageInfo_Server6Config.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Server6Config proto.InternalMessageInfo
+
+func (m *Server6Config) GetAddressRange() string {
+	if m != nil {
+		return m.AddressRange
+	}
+	return ""
+}
+
+func (m *Server6Config) GetPrefixPool() string {
+	if m != nil {
+		return m.PrefixPool
+	}
+	return ""
+}
+
+func (m *Server6Config) GetDelegatedLength() uint32 {
+	if m != nil {
+		return m.DelegatedLength
+	}
+	return 0
+}
+
+func (m *Server6Config) GetPreferredLifetime() string {
+	if m != nil {
+		return m.PreferredLifetime
+	}
+	return ""
+}
+
+func (m *Server6Config) GetValidLifetime() string {
+	if m != nil {
+		return m.ValidLifetime
+	}
+	return ""
+}
+
+func (m *Server6Config) GetDns() []string {
+	if m != nil {
+		return m.Dns
+	}
+	return nil
+}
+
+func (m *Server6Config) GetDomain() []string {
+	if m != nil {
+		return m.Domain
+	}
+	return nil
+}
+
+func (m *Server6Config) GetPreference() uint32 {
+	if m != nil {
+		return m.Preference
+	}
+	return 0
+}
+
+func (m *Server6Config) GetRapidCommit() bool {
+	if m != nil {
+		return m.RapidCommit
+	}
+	return false
+}
+
+func (m *Server6Config) GetClient() map[string]*Client6Config {
+	if m != nil {
+		return m.Client
+	}
+	return nil
+}
+
+type Client6Config struct {
+	// Address to assign to this client, may be outside of address_range.
+	Ip string `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	// Prefix to delegate to this client, eg. "2001:db8:200::/56". May be outside of prefix_pool.
+	Prefix               string   `protobuf:"bytes,2,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Client6Config) Reset()         { *m = Client6Config{} }
+func (m *Client6Config) String() string { return proto.CompactTextString(m) }
+func (*Client6Config) ProtoMessage()    {}
+func (*Client6Config) Descriptor() ([]byte, []int) {
+	return fileDescriptor_495b121871ab1746, []int{11}
+}
+
+func (m *Client6Config) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Client6Config.Unmarshal(m, b)
+}
+func (m *Client6Config) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Client6Config.Marshal(b, m, deterministic)
+}
+func (m *Client6Config) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Client6Config.Merge(m, src)
+}
+func (m *Client6Config) XXX_Size() int {
+	return xxx_messageInfo_Client6Config.Size(m)
+}
+func (m *Client6Config) XXX_DiscardUnknown() {
+	xxx_messageInfo_Client6Config.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Client6Config proto.InternalMessageInfo
+
+func (m *Client6Config) GetIp() string {
+	if m != nil {
+		return m.Ip
+	}
+	return ""
+}
+
+func (m *Client6Config) GetPrefix() string {
+	if m != nil {
+		return m.Prefix
+	}
+	return ""
+}
+
 func init() {
+	proto.RegisterEnum("serverconfig.AccessConfig_Policy", AccessConfig_Policy_name, AccessConfig_Policy_value)
+	proto.RegisterEnum("serverconfig.OptionConfig_Type", OptionConfig_Type_name, OptionConfig_Type_value)
 	proto.RegisterType((*ServerConfig)(nil), "serverconfig.ServerConfig")
 	proto.RegisterMapType((map[string]*ClientConfig)(nil), "serverconfig.ServerConfig.ClientEntry")
+	proto.RegisterType((*CircuitConfig)(nil), "serverconfig.CircuitConfig")
+	proto.RegisterType((*RateLimitConfig)(nil), "serverconfig.RateLimitConfig")
+	proto.RegisterType((*AccessConfig)(nil), "serverconfig.AccessConfig")
+	proto.RegisterType((*OptionConfig)(nil), "serverconfig.OptionConfig")
+	proto.RegisterType((*ClassConfig)(nil), "serverconfig.ClassConfig")
+	proto.RegisterType((*TFTPConfig)(nil), "serverconfig.TFTPConfig")
+	proto.RegisterType((*BootRule)(nil), "serverconfig.BootRule")
 	proto.RegisterType((*ClientConfig)(nil), "serverconfig.ClientConfig")
+	proto.RegisterType((*DaemonConfig)(nil), "serverconfig.DaemonConfig")
+	proto.RegisterMapType((map[string]*ServerConfig)(nil), "serverconfig.DaemonConfig.InterfaceEntry")
+	proto.RegisterType((*Server6Config)(nil), "serverconfig.Server6Config")
+	proto.RegisterMapType((map[string]*Client6Config)(nil), "serverconfig.Server6Config.ClientEntry")
+	proto.RegisterType((*Client6Config)(nil), "serverconfig.Client6Config")
 }
 
 func init() { proto.RegisterFile("lib/server/proto/config.proto", fileDescriptor_495b121871ab1746) }
 
 var fileDescriptor_495b121871ab1746 = []byte{
-	// 333 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x64, 0x92, 0xc1, 0x6b, 0xe2, 0x40,
-	0x14, 0xc6, 0x49, 0xa2, 0x51, 0x5f, 0xa2, 0x2c, 0x73, 0x58, 0x06, 0x61, 0xd9, 0xe0, 0xb2, 0x25,
-	0xa7, 0x58, 0xec, 0xa5, 0xf4, 0xd0, 0x8b, 0xed, 0xb9, 0x90, 0xd2, 0xb3, 0x8c, 0xc9, 0xd4, 0x0e,
-	0xc6, 0x37, 0x61, 0x32, 0x5a, 0x72, 0xeb, 0x9f, 0x5e, 0x32, 0x33, 0x4a, 0xa4, 0xb7, 0xf9, 0x7e,
-	0xdf, 0x7b, 0x8f, 0xf0, 0x23, 0xf0, 0xa7, 0x12, 0xdb, 0x65, 0xc3, 0xd5, 0x89, 0xab, 0x65, 0xad,
-	0xa4, 0x96, 0xcb, 0x42, 0xe2, 0xbb, 0xd8, 0x65, 0x26, 0x90, 0xd8, 0x56, 0x96, 0x2d, 0xbe, 0x02,
-	0x88, 0x5f, 0x0d, 0x58, 0x1b, 0x40, 0x28, 0x8c, 0x90, 0xeb, 0x4f, 0xa9, 0xf6, 0xd4, 0x4b, 0xbc,
-	0x74, 0x92, 0x9f, 0x23, 0xf9, 0x07, 0xd3, 0xb2, 0x45, 0x76, 0x10, 0xc5, 0x46, 0x31, 0xdc, 0x71,
-	0xea, 0x9b, 0x3e, 0x76, 0x30, 0xef, 0x18, 0xf9, 0x0f, 0xb3, 0x8a, 0xb3, 0x86, 0x6f, 0xca, 0xa3,
-	0x62, 0x5a, 0x48, 0xa4, 0x81, 0x99, 0x9a, 0x1a, 0xfa, 0xe4, 0x20, 0xf9, 0x0d, 0x61, 0x29, 0x0f,
-	0x4c, 0x20, 0x1d, 0x98, 0xda, 0xa5, 0x8e, 0x2b, 0x79, 0xd4, 0x5c, 0xd1, 0xa1, 0xe5, 0x36, 0x91,
-	0x5f, 0x10, 0x94, 0xd8, 0xd0, 0x30, 0x09, 0xd2, 0x49, 0xde, 0x3d, 0x3b, 0x82, 0xba, 0xa6, 0x23,
-	0x4b, 0x50, 0xd7, 0xe4, 0x2f, 0x44, 0x8d, 0x66, 0x5a, 0x14, 0x1b, 0x89, 0x55, 0x4b, 0xc7, 0x89,
-	0x97, 0x8e, 0x73, 0xb0, 0xe8, 0x05, 0xab, 0x96, 0x3c, 0x42, 0x58, 0x54, 0x82, 0xa3, 0xa6, 0x93,
-	0x24, 0x48, 0xa3, 0xd5, 0x4d, 0xd6, 0x57, 0x91, 0xf5, 0x35, 0x64, 0x6b, 0x33, 0xf8, 0x8c, 0x5a,
-	0xb5, 0xb9, 0xdb, 0x9a, 0xbf, 0x41, 0xd4, 0xc3, 0xdd, 0x17, 0xec, 0x79, 0xeb, 0x2c, 0x75, 0x4f,
-	0x72, 0x0b, 0xc3, 0x13, 0xab, 0x8e, 0xd6, 0x4c, 0xb4, 0x9a, 0x5f, 0xdf, 0xb7, 0xbb, 0xf6, 0x7e,
-	0x6e, 0x07, 0x1f, 0xfc, 0x7b, 0x6f, 0x71, 0x82, 0xb8, 0x5f, 0x91, 0x19, 0xf8, 0xa2, 0x76, 0x67,
-	0x7d, 0x51, 0xf7, 0x9c, 0xf8, 0x57, 0x4e, 0xe6, 0x30, 0xfe, 0x90, 0x8d, 0x46, 0x76, 0xe0, 0x4e,
-	0xf2, 0x25, 0x9f, 0x7d, 0x0d, 0x7e, 0xf8, 0x1a, 0x5e, 0x7c, 0x6d, 0x43, 0xf3, 0x3f, 0xdc, 0x7d,
-	0x07, 0x00, 0x00, 0xff, 0xff, 0xc9, 0x50, 0xab, 0x70, 0x30, 0x02, 0x00, 0x00,
+	// 1436 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x57, 0xdd, 0x6e, 0x1b, 0xc5,
+	0x17, 0xaf, 0xbf, 0xed, 0xb3, 0xde, 0x64, 0x3b, 0xed, 0xbf, 0xff, 0x21, 0x55, 0x69, 0xea, 0x0a,
+	0x48, 0x11, 0x4d, 0x68, 0x2a, 0x42, 0x41, 0x7c, 0x28, 0x4d, 0xd3, 0x62, 0x11, 0x25, 0xe9, 0xc6,
+	0x41, 0xbd, 0x5b, 0x6d, 0x76, 0x27, 0xc9, 0xa8, 0xeb, 0xd9, 0xed, 0xec, 0x38, 0xa9, 0xaf, 0xb8,
+	0xe1, 0x0d, 0xb8, 0xe2, 0x05, 0xb8, 0x47, 0x3c, 0x07, 0x6f, 0xc0, 0x43, 0xf0, 0x08, 0x68, 0xce,
+	0xcc, 0xc6, 0xeb, 0xda, 0x51, 0x04, 0xe2, 0xca, 0x33, 0xbf, 0xf3, 0x3b, 0x67, 0xce, 0xce, 0x99,
+	0xf3, 0x61, 0xb8, 0x93, 0xf0, 0xa3, 0xb5, 0x9c, 0xc9, 0x33, 0x26, 0xd7, 0x32, 0x99, 0xaa, 0x74,
+	0x2d, 0x4a, 0xc5, 0x31, 0x3f, 0x59, 0xc5, 0x0d, 0xe9, 0x1a, 0x91, 0xc1, 0x7a, 0xbf, 0xb4, 0xa1,
+	0x7b, 0x80, 0xc0, 0x16, 0x02, 0x84, 0x42, 0x4b, 0x30, 0x75, 0x9e, 0xca, 0xd7, 0xb4, 0xb2, 0x5c,
+	0x59, 0xe9, 0xf8, 0xc5, 0x96, 0xdc, 0x07, 0x37, 0x1e, 0x8b, 0x70, 0xc8, 0xa3, 0x40, 0x86, 0xe2,
+	0x84, 0xd1, 0x2a, 0xca, 0xbb, 0x16, 0xf4, 0x35, 0x46, 0x3e, 0x80, 0x85, 0x84, 0x85, 0x39, 0x0b,
+	0xe2, 0x91, 0x0c, 0x15, 0x4f, 0x05, 0xad, 0x21, 0xcb, 0x45, 0xf4, 0x99, 0x05, 0xc9, 0x2d, 0x68,
+	0xc6, 0xe9, 0x30, 0xe4, 0x82, 0xd6, 0x51, 0x6c, 0x77, 0x1a, 0x97, 0xe9, 0x48, 0x31, 0x49, 0x1b,
+	0x06, 0x37, 0x3b, 0xe2, 0x41, 0x2d, 0x16, 0x39, 0x6d, 0x2e, 0xd7, 0x56, 0x3a, 0xbe, 0x5e, 0x6a,
+	0x44, 0xa8, 0x8c, 0xb6, 0x0c, 0x22, 0x54, 0x46, 0xee, 0x82, 0x93, 0xab, 0x50, 0xf1, 0x28, 0x48,
+	0x45, 0x32, 0xa6, 0xed, 0xe5, 0xca, 0x4a, 0xdb, 0x07, 0x03, 0xed, 0x89, 0x64, 0x4c, 0xbe, 0x81,
+	0x66, 0x94, 0x70, 0x26, 0x14, 0xed, 0x2c, 0xd7, 0x56, 0x9c, 0xf5, 0x0f, 0x57, 0xcb, 0x57, 0xb1,
+	0x5a, 0xbe, 0x86, 0xd5, 0x2d, 0x24, 0x6e, 0x0b, 0x25, 0xc7, 0xbe, 0xd5, 0x22, 0x0f, 0x81, 0xc4,
+	0x2c, 0x4a, 0xb8, 0x60, 0xc1, 0x9b, 0x51, 0x28, 0x43, 0xa1, 0xb8, 0x60, 0x14, 0xd0, 0xd1, 0xeb,
+	0x56, 0xf2, 0xf2, 0x42, 0x40, 0xbe, 0x86, 0xae, 0x64, 0x49, 0x38, 0x0e, 0xf2, 0xd1, 0x91, 0x60,
+	0x8a, 0x3a, 0x78, 0xe8, 0xd2, 0xe5, 0x87, 0xfa, 0x0e, 0xf2, 0x0f, 0x90, 0xae, 0x3f, 0x47, 0xb0,
+	0xb7, 0x2a, 0x30, 0x74, 0xda, 0xc5, 0x63, 0x40, 0x43, 0x46, 0x47, 0xc7, 0xe3, 0x28, 0x4d, 0x55,
+	0x70, 0xcc, 0x13, 0x26, 0xc2, 0x21, 0xa3, 0xae, 0x89, 0x87, 0x06, 0x9f, 0x5b, 0x8c, 0x7c, 0x0c,
+	0x75, 0xbd, 0xa7, 0x0b, 0x78, 0xf8, 0xad, 0xe9, 0xc3, 0x9f, 0xa6, 0xa9, 0xf2, 0x47, 0x09, 0xf3,
+	0x91, 0x43, 0x3e, 0x81, 0xba, 0x3a, 0x56, 0x19, 0x5d, 0x5c, 0xae, 0xac, 0x38, 0xeb, 0x74, 0x9a,
+	0x3b, 0x78, 0x3e, 0xd8, 0xb7, 0x6e, 0x22, 0x8b, 0xac, 0x41, 0x23, 0x4a, 0xc2, 0x3c, 0xa7, 0x1e,
+	0x9a, 0x7e, 0x6f, 0x9a, 0xbe, 0xa5, 0x45, 0x96, 0x6f, 0x78, 0x64, 0x1d, 0x9a, 0x69, 0x86, 0x4f,
+	0xe2, 0xfa, 0xbc, 0x9b, 0xd8, 0x43, 0x99, 0x55, 0xb1, 0x4c, 0x72, 0x0f, 0xba, 0x36, 0xa6, 0xf8,
+	0x10, 0x28, 0xc1, 0x70, 0xdb, 0x38, 0xfb, 0x1a, 0xd2, 0x66, 0xc3, 0x28, 0x62, 0x79, 0x4e, 0x6f,
+	0x2c, 0x57, 0x66, 0xcd, 0x6e, 0xa2, 0xac, 0x30, 0x6b, 0x98, 0xe4, 0x2b, 0x00, 0x19, 0x2a, 0x16,
+	0x24, 0x7c, 0xc8, 0x15, 0xbd, 0x89, 0x7a, 0x77, 0xa6, 0xf5, 0xfc, 0x50, 0xb1, 0x1d, 0x2d, 0xb6,
+	0xaa, 0x1d, 0x59, 0x00, 0xfa, 0x8d, 0x2b, 0x39, 0xca, 0x15, 0x8b, 0x8b, 0xe0, 0xfc, 0x0f, 0xdd,
+	0x72, 0x2d, 0x6a, 0xe3, 0xf3, 0x19, 0xb4, 0x22, 0x2e, 0xa3, 0x11, 0x57, 0xf4, 0x16, 0x7e, 0xf0,
+	0xed, 0x77, 0xae, 0xc8, 0x08, 0xad, 0xfd, 0x82, 0x4b, 0x1e, 0xc1, 0x4d, 0xcc, 0x95, 0x37, 0x23,
+	0x26, 0xc7, 0x81, 0xd4, 0xbf, 0xb9, 0x4e, 0x88, 0xff, 0xe3, 0x19, 0x37, 0x26, 0x32, 0xbf, 0x10,
+	0x2d, 0x1d, 0x82, 0x53, 0x7a, 0xaf, 0x3a, 0x35, 0x5e, 0xb3, 0xb1, 0x4d, 0x5f, 0xbd, 0x24, 0x9f,
+	0x42, 0xe3, 0x2c, 0x4c, 0x46, 0x26, 0x65, 0x67, 0xae, 0xc8, 0xe8, 0x16, 0xc1, 0x42, 0xe2, 0x97,
+	0xd5, 0x27, 0x95, 0xde, 0x8f, 0xe0, 0x4e, 0xf9, 0x48, 0xee, 0x00, 0x58, 0x2f, 0x03, 0x1e, 0x5b,
+	0xfb, 0x1d, 0x8b, 0xf4, 0x63, 0x72, 0x1b, 0x3a, 0x92, 0x0d, 0x53, 0xc5, 0xb4, 0xd4, 0x14, 0x87,
+	0xb6, 0x01, 0xfa, 0xb1, 0x0e, 0x93, 0x39, 0x8e, 0xd6, 0xae, 0xf4, 0xc1, 0x32, 0x7b, 0xbf, 0x57,
+	0x60, 0xf1, 0x9d, 0x38, 0xe8, 0xb4, 0x30, 0xe9, 0x18, 0xe8, 0x80, 0xa0, 0x13, 0x15, 0x1f, 0x0c,
+	0xa4, 0xb9, 0xfa, 0xc9, 0x58, 0xc2, 0xd1, 0x48, 0xe6, 0x0a, 0x1d, 0x71, 0x7d, 0xab, 0xf4, 0x54,
+	0x43, 0xda, 0xc6, 0x49, 0x92, 0x1e, 0x85, 0x89, 0xb1, 0x51, 0x33, 0x36, 0x0c, 0x54, 0xd8, 0xb0,
+	0x04, 0x63, 0xa3, 0x6e, 0x6c, 0x18, 0xcc, 0xd8, 0xa0, 0xd0, 0xd2, 0x55, 0x91, 0xc9, 0x1c, 0x4b,
+	0x95, 0xeb, 0x17, 0xdb, 0xde, 0x1f, 0x15, 0xe8, 0x96, 0x5f, 0x1d, 0xb9, 0x09, 0x8d, 0x30, 0x49,
+	0xd2, 0x73, 0x5a, 0xc1, 0x10, 0x9a, 0x0d, 0x21, 0x50, 0x8f, 0x99, 0x18, 0xd3, 0x2a, 0x82, 0xb8,
+	0x26, 0x5f, 0x40, 0x33, 0x4b, 0x13, 0x1e, 0x8d, 0xd1, 0xa7, 0x85, 0xf5, 0x7b, 0x97, 0xbf, 0xe5,
+	0xd5, 0x7d, 0x24, 0xfa, 0x56, 0x81, 0x3c, 0x00, 0x6f, 0x52, 0x94, 0x6c, 0x81, 0x36, 0xb5, 0x75,
+	0x71, 0x82, 0x63, 0x8d, 0xee, 0x3d, 0x84, 0xa6, 0x51, 0x26, 0x00, 0xcd, 0xfe, 0x8b, 0xdd, 0x3d,
+	0x7f, 0xdb, 0xbb, 0x46, 0x5a, 0x50, 0xdb, 0xdd, 0xfc, 0xde, 0xab, 0x90, 0x05, 0x80, 0x97, 0x87,
+	0x9b, 0xfe, 0xe6, 0xee, 0xa0, 0xbf, 0xbb, 0xed, 0x55, 0x7b, 0x3f, 0x55, 0xa1, 0x5b, 0x4e, 0x4e,
+	0xed, 0x79, 0x94, 0xc6, 0xe6, 0xee, 0x5d, 0x1f, 0xd7, 0xe4, 0x31, 0xd4, 0xd5, 0x38, 0x33, 0x0f,
+	0x6c, 0x61, 0xfd, 0xee, 0xe5, 0xa9, 0xbd, 0x3a, 0x18, 0x67, 0xcc, 0x47, 0xb2, 0xbe, 0x18, 0xf3,
+	0x2c, 0x6b, 0xe6, 0x62, 0x70, 0xa3, 0xa3, 0x13, 0x26, 0xe7, 0xe1, 0x38, 0x0f, 0x72, 0x26, 0x62,
+	0xfc, 0x88, 0xb6, 0x0f, 0x06, 0x3a, 0x60, 0x22, 0xee, 0x29, 0xa8, 0x6b, 0x23, 0xa4, 0x03, 0x8d,
+	0xc3, 0xdd, 0x83, 0xed, 0x81, 0x77, 0x8d, 0x34, 0xa1, 0xda, 0xdf, 0xf7, 0x2a, 0xc4, 0x81, 0x56,
+	0x7f, 0x3f, 0xd8, 0xe9, 0x1f, 0x0c, 0xbc, 0x2a, 0xca, 0xfb, 0xbb, 0x83, 0x27, 0x5e, 0x4d, 0x7f,
+	0xa8, 0x5e, 0x3e, 0xda, 0xf0, 0xea, 0xc5, 0xfa, 0xf1, 0xba, 0xd7, 0xd0, 0xeb, 0x83, 0x81, 0xdf,
+	0xdf, 0x7d, 0xe1, 0x35, 0x49, 0x1b, 0xea, 0x4f, 0xf7, 0xf6, 0x76, 0xbc, 0x96, 0xbe, 0x8a, 0xef,
+	0xb6, 0x5f, 0x79, 0x6d, 0x2d, 0xf6, 0xf7, 0x0e, 0x07, 0xdb, 0x07, 0x5e, 0xa7, 0xf7, 0x57, 0x15,
+	0x9c, 0x52, 0x55, 0xd3, 0xb7, 0x80, 0x55, 0xd7, 0xa4, 0x01, 0xae, 0xf5, 0xbb, 0x39, 0x63, 0x22,
+	0x4e, 0x65, 0x60, 0x4a, 0xa3, 0x49, 0x02, 0xc7, 0x60, 0xa8, 0xac, 0x73, 0x68, 0x94, 0xb3, 0x82,
+	0x60, 0x9a, 0x63, 0x47, 0x23, 0x46, 0xec, 0x41, 0x2d, 0x1d, 0x71, 0x5a, 0x37, 0x6d, 0x2d, 0x1d,
+	0x71, 0x5d, 0xe6, 0x4f, 0xcf, 0xc3, 0x38, 0x96, 0x41, 0x26, 0xd9, 0x31, 0x7f, 0x4b, 0x1b, 0x28,
+	0xeb, 0x1a, 0x70, 0x1f, 0x31, 0xb2, 0x0c, 0xce, 0x31, 0x17, 0x27, 0x4c, 0x66, 0x92, 0x0b, 0x65,
+	0xfb, 0x64, 0x19, 0x2a, 0x75, 0xd6, 0xd6, 0xbc, 0xce, 0xda, 0x9e, 0xe9, 0xac, 0x9d, 0x49, 0x67,
+	0x9d, 0x74, 0x6b, 0x98, 0xea, 0xd6, 0xb3, 0xcd, 0xde, 0x99, 0xd7, 0xec, 0x67, 0x06, 0x87, 0xee,
+	0x9c, 0xc1, 0xa1, 0x48, 0x07, 0x17, 0xc3, 0x8d, 0xeb, 0xde, 0x13, 0x80, 0x49, 0xdb, 0xd1, 0x0c,
+	0xa9, 0x5b, 0x99, 0xbd, 0x70, 0xbd, 0xd6, 0x9e, 0x25, 0x3c, 0x57, 0x4c, 0xd8, 0xab, 0xb6, 0xbb,
+	0xde, 0xaf, 0x15, 0x68, 0x17, 0xdd, 0x4d, 0x2b, 0x86, 0x32, 0x3a, 0xc5, 0xf4, 0x73, 0x7d, 0x5c,
+	0xff, 0x07, 0x91, 0x7a, 0xa7, 0x3f, 0xd7, 0xaf, 0xee, 0xcf, 0x8d, 0xd9, 0xfe, 0xdc, 0xfb, 0xb9,
+	0x0a, 0xdd, 0x72, 0xed, 0x23, 0x0b, 0x50, 0xe5, 0x99, 0xfd, 0xc6, 0x2a, 0xcf, 0x4a, 0x71, 0xab,
+	0x4e, 0xc5, 0x6d, 0x09, 0xda, 0xa7, 0x69, 0xae, 0xd0, 0xb0, 0xf1, 0xed, 0x62, 0x5f, 0xc4, 0xb4,
+	0x3e, 0x13, 0xd3, 0xc6, 0xd4, 0xb4, 0x54, 0x76, 0xbf, 0x79, 0xb5, 0xfb, 0xad, 0x59, 0xf7, 0x4b,
+	0x3d, 0xbd, 0xfd, 0xaf, 0x7b, 0x7a, 0x67, 0xa6, 0xa7, 0xf7, 0x7e, 0xab, 0x40, 0xf7, 0x59, 0xc8,
+	0x86, 0x85, 0x2e, 0x79, 0x01, 0x1d, 0x2e, 0x14, 0x93, 0xc7, 0x61, 0xc4, 0x30, 0x8e, 0xce, 0xfa,
+	0x83, 0xe9, 0xa3, 0xca, 0xf4, 0xd5, 0x7e, 0xc1, 0x35, 0x03, 0xdc, 0x44, 0x77, 0xe9, 0x15, 0x2c,
+	0x4c, 0x0b, 0xff, 0x71, 0xb7, 0x9c, 0x9a, 0xd8, 0x4a, 0xdd, 0xf2, 0xcf, 0x1a, 0xb8, 0x46, 0xb6,
+	0x61, 0x9d, 0xbe, 0x0f, 0xae, 0x4e, 0x51, 0x96, 0xe7, 0xf6, 0xdd, 0x9b, 0x33, 0xba, 0x16, 0x34,
+	0xef, 0xfe, 0x2e, 0x38, 0x26, 0xaf, 0x83, 0x2c, 0x4d, 0x13, 0x1b, 0x64, 0x30, 0xd0, 0x7e, 0x9a,
+	0x26, 0xba, 0xb0, 0xc7, 0x2c, 0x61, 0x27, 0xa1, 0x9e, 0x37, 0x12, 0x26, 0x4e, 0xd4, 0x29, 0x06,
+	0xdc, 0xf5, 0x17, 0x2f, 0xf0, 0x1d, 0x84, 0xf5, 0x80, 0xaa, 0x15, 0x99, 0x94, 0x9a, 0xca, 0x8f,
+	0x99, 0xe2, 0xc3, 0xa2, 0x0b, 0x5c, 0xbf, 0x90, 0xec, 0x58, 0x81, 0x4e, 0xdf, 0xb3, 0x30, 0xe1,
+	0x25, 0xaa, 0x79, 0xa1, 0x2e, 0xa2, 0x17, 0xb4, 0xd9, 0xd9, 0x7b, 0x52, 0x0f, 0xcc, 0xf8, 0x6d,
+	0x77, 0xe4, 0x7d, 0x00, 0x73, 0x0a, 0x13, 0x11, 0xc3, 0x01, 0xdc, 0xf5, 0x4b, 0x88, 0x8e, 0xbc,
+	0x0c, 0x33, 0x1e, 0x07, 0x51, 0x3a, 0xd4, 0x83, 0x57, 0x07, 0x73, 0xdd, 0x41, 0x6c, 0x0b, 0x21,
+	0xf2, 0xed, 0xc5, 0x8c, 0x0e, 0x18, 0xe5, 0x8f, 0xe6, 0x5d, 0xfe, 0xc6, 0xe5, 0x43, 0xfa, 0xd2,
+	0x0f, 0x57, 0xcd, 0x42, 0x8f, 0xa6, 0xa3, 0x7b, 0x7b, 0xde, 0x1c, 0xb2, 0x31, 0x1b, 0xde, 0xcf,
+	0xc1, 0x9d, 0x92, 0xcd, 0x4b, 0x54, 0x5b, 0xa0, 0x6d, 0xa2, 0x9a, 0xdd, 0x51, 0x13, 0xff, 0x76,
+	0x3d, 0xfe, 0x7b, 0x00, 0x90, 0xe8, 0xd1, 0x21, 0x97, 0x0d, 0x00, 0x00,
 }
@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	pb "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/proto"
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultClientRate  = 2
+	defaultClientBurst = 10
+	defaultGlobalRate  = 200
+	defaultGlobalBurst = 400
+	// maxClients bounds the number of tracked clients, others are only subject to the global limit.
+	maxClients = 16384
+)
+
+// Limiter limits the rate of messages per client and of all clients together.
+type Limiter struct {
+	sync.Mutex                            // Protects clients.
+	global      *rate.Limiter             // Limit of all clients.
+	clientRate  rate.Limit                // Rate of a single client.
+	clientBurst int                       // Burst of a single client.
+	clients     map[string]*clientLimiter // Limiters of recently seen clients.
+}
+
+type clientLimiter struct {
+	*rate.Limiter
+	seen time.Time // Time of the last message.
+}
+
+// New constructs a limiter from its configuration, unset values use their defaults.
+func New(conf *pb.RateLimitConfig) (*Limiter, error) {
+	cr, gr := conf.GetClientRate(), conf.GetGlobalRate()
+	if cr < 0 || gr < 0 {
+		return nil, fmt.Errorf("rates must not be negative")
+	}
+	if cr == 0 {
+		cr = defaultClientRate
+	}
+	if gr == 0 {
+		gr = defaultGlobalRate
+	}
+	cb, gb := int(conf.GetClientBurst()), int(conf.GetGlobalBurst())
+	if cb == 0 {
+		cb = defaultClientBurst
+	}
+	if gb == 0 {
+		gb = defaultGlobalBurst
+	}
+	return &Limiter{
+		global:      rate.NewLimiter(rate.Limit(gr), gb),
+		clientRate:  rate.Limit(cr),
+		clientBurst: cb,
+		clients:     make(map[string]*clientLimiter),
+	}, nil
+}
+
+// Allow returns true if a message of the client identified by key may be handled now, otherwise the
+// name of the exceeded limit.
+func (lx *Limiter) Allow(key string) (bool, string) {
+	return lx.allowAt(time.Now(), key)
+}
+
+func (lx *Limiter) allowAt(now time.Time, key string) (bool, string) {
+	lx.Lock()
+	c, ok := lx.clients[key]
+	if !ok && len(lx.clients) < maxClients {
+		c = &clientLimiter{Limiter: rate.NewLimiter(lx.clientRate, lx.clientBurst)}
+		lx.clients[key] = c
+	}
+	if c != nil {
+		c.seen = now
+	}
+	lx.Unlock()
+
+	// A flooding client must not use up tokens of the global limit.
+	if c != nil && !c.AllowN(now, 1) {
+		return false, "client"
+	}
+	if !lx.global.AllowN(now, 1) {
+		return false, "global"
+	}
+	return true, ""
+}
+
+// Expire forgets clients which did not send any message for the given duration and returns their count.
+func (lx *Limiter) Expire(idle time.Duration) int {
+	return lx.expireAt(time.Now(), idle)
+}
+
+func (lx *Limiter) expireAt(now time.Time, idle time.Duration) int {
+	lx.Lock()
+	defer lx.Unlock()
+
+	n := 0
+	for k, c := range lx.clients {
+		if now.Sub(c.seen) >= idle {
+			delete(lx.clients, k)
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	pb "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/proto"
+)
+
+func TestNew(t *testing.T) {
+	lx, err := New(nil)
+	if err != nil {
+		t.Fatalf("New(nil) = %v, wanted nil err", err)
+	}
+	if lx.clientRate != defaultClientRate || lx.clientBurst != defaultClientBurst || lx.global.Burst() != defaultGlobalBurst {
+		t.Errorf("New(nil) did not apply defaults: %+v", lx)
+	}
+
+	for _, bad := range []*pb.RateLimitConfig{
+		{ClientRate: -1},
+		{GlobalRate: -1},
+	} {
+		if _, err := New(bad); err == nil {
+			t.Errorf("New(%v) wanted err, got nil err", bad)
+		}
+	}
+}
+
+func TestAllow(t *testing.T) {
+	lx, err := New(&pb.RateLimitConfig{ClientRate: 1, ClientBurst: 2, GlobalRate: 1, GlobalBurst: 4})
+	if err != nil {
+		t.Fatalf("New = %v, wanted nil err", err)
+	}
+	now := time.Now()
+
+	input := []struct {
+		name       string
+		key        string
+		offset     time.Duration
+		want       bool
+		wantReason string
+	}{
+		{name: "a first", key: "a", want: true},
+		{name: "a burst", key: "a", want: true},
+		{name: "a flooding", key: "a", wantReason: "client"},
+		{name: "a flooding again", key: "a", wantReason: "client"},
+		{name: "b first", key: "b", want: true},
+		{name: "c first", key: "c", want: true},
+		{name: "d global", key: "d", wantReason: "global"},
+		{name: "a refilled", key: "a", offset: time.Second, want: true},
+		{name: "b global", key: "b", offset: time.Second, wantReason: "global"},
+	}
+	for _, test := range input {
+		got, reason := lx.allowAt(now.Add(test.offset), test.key)
+		if got != test.want || reason != test.wantReason {
+			t.Errorf("Allow(%s) = %v, %q; want %v, %q", test.name, got, reason, test.want, test.wantReason)
+		}
+	}
+}
+
+func TestExpire(t *testing.T) {
+	lx, err := New(nil)
+	if err != nil {
+		t.Fatalf("New = %v, wanted nil err", err)
+	}
+	now := time.Now()
+	lx.allowAt(now, "old")
+	lx.allowAt(now.Add(time.Minute), "new")
+
+	if n := lx.expireAt(now.Add(90*time.Second), time.Minute); n != 1 {
+		t.Errorf("Expire = %d, want 1", n)
+	}
+	if _, ok := lx.clients["new"]; !ok || len(lx.clients) != 1 {
+		t.Errorf("Expire kept %v, want only 'new'", lx.clients)
+	}
+}
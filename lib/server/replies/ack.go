@@ -6,8 +6,8 @@ import (
 	"git.sr.ht/~adrian-blx/psa-dhcp/lib/dhcpmsg"
 )
 
-func AssembleACK(xid uint32, flags uint16, srcIP, dstIP net.IP, dstMAC net.HardwareAddr, opts []dhcpmsg.DHCPOpt) []byte {
-	return assembleUdp(srcIP, dstFromFlag(flags, dstIP), dhcpmsg.Message{
+func ACK(xid uint32, flags uint16, srcIP, dstIP net.IP, dstMAC net.HardwareAddr, opts []dhcpmsg.DHCPOpt) dhcpmsg.Message {
+	return dhcpmsg.Message{
 		Op:        dhcpmsg.OpReply,
 		YourIP:    dstIP,
 		Xid:       xid,
@@ -19,5 +19,5 @@ func AssembleACK(xid uint32, flags uint16, srcIP, dstIP net.IP, dstMAC net.Hardw
 			dhcpmsg.OptionType(dhcpmsg.MsgTypeAck),
 			dhcpmsg.OptionServerIdentifier(srcIP),
 		}, opts...),
-	}.Assemble())
+	}
 }
@@ -7,23 +7,33 @@ import (
 	"git.sr.ht/~adrian-blx/psa-dhcp/lib/layer"
 )
 
-func assembleUdp(srcIP, dstIP net.IP, payload []byte) []byte {
+const (
+	PortServer = 67 // UDP port of servers and relay agents.
+	PortClient = 68 // UDP port of clients.
+)
+
+// Frame wraps a reply into an IPv4/UDP packet, sent from the server port to dstPort.
+func Frame(srcIP, dstIP net.IP, dstPort uint16, msg dhcpmsg.Message) []byte {
 	return layer.IPv4{
 		TTL:         64,
-		Protocol:    0x11,
+		Protocol:    layer.ProtoUDP,
 		Source:      srcIP,
 		Destination: dstIP,
 		Data: layer.UDP{
-			SrcPort: 67,
-			DstPort: 68,
-			Data:    payload,
+			SrcPort: PortServer,
+			DstPort: dstPort,
+			Data:    msg.Assemble(),
 		}.Assemble(),
 	}.Assemble()
 }
 
-func dstFromFlag(flags uint16, dst net.IP) net.IP {
-	if (flags & dhcpmsg.FlagBroadcast) != 0 {
-		return net.IPv4bcast
+// EchoRelayAgentInfo returns rep with the relay agent information option of req appended unchanged, as
+// required by RFC 3046. It must be the last option of a reply.
+func EchoRelayAgentInfo(req, rep dhcpmsg.Message) dhcpmsg.Message {
+	for _, o := range req.Options {
+		if o.Option == dhcpmsg.OptRelayAgentInfo {
+			rep.Options = append(rep.Options[:len(rep.Options):len(rep.Options)], o)
+		}
 	}
-	return dst
+	return rep
 }
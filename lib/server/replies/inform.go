@@ -0,0 +1,24 @@
+package replies
+
+import (
+	"net"
+
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/dhcpmsg"
+)
+
+// InformACK returns the ACK to a DHCPINFORM: it carries no lease as the client already configured its IP.
+func InformACK(xid uint32, flags uint16, srcIP, clientIP net.IP, dstMAC net.HardwareAddr, opts []dhcpmsg.DHCPOpt) dhcpmsg.Message {
+	return dhcpmsg.Message{
+		Op:        dhcpmsg.OpReply,
+		ClientIP:  clientIP,
+		Xid:       xid,
+		Flags:     flags,
+		Htype:     dhcpmsg.HtypeETHER,
+		ClientMAC: dstMAC,
+		Cookie:    dhcpmsg.DHCPCookie,
+		Options: append([]dhcpmsg.DHCPOpt{
+			dhcpmsg.OptionType(dhcpmsg.MsgTypeAck),
+			dhcpmsg.OptionServerIdentifier(srcIP),
+		}, opts...),
+	}
+}
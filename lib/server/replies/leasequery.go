@@ -0,0 +1,24 @@
+package replies
+
+import (
+	"net"
+
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/dhcpmsg"
+)
+
+// LeaseQuery returns the answer to a DHCPLEASEQUERY (RFC 4388): msgType is one of the leasequery reply
+// types, clientIP and clientMAC describe the client holding the lease, if any.
+func LeaseQuery(xid uint32, msgType uint8, srcIP, clientIP net.IP, clientMAC net.HardwareAddr, opts []dhcpmsg.DHCPOpt) dhcpmsg.Message {
+	return dhcpmsg.Message{
+		Op:        dhcpmsg.OpReply,
+		ClientIP:  clientIP,
+		Xid:       xid,
+		Htype:     dhcpmsg.HtypeETHER,
+		ClientMAC: clientMAC,
+		Cookie:    dhcpmsg.DHCPCookie,
+		Options: append([]dhcpmsg.DHCPOpt{
+			dhcpmsg.OptionType(msgType),
+			dhcpmsg.OptionServerIdentifier(srcIP),
+		}, opts...),
+	}
+}
@@ -6,8 +6,8 @@ import (
 	"git.sr.ht/~adrian-blx/psa-dhcp/lib/dhcpmsg"
 )
 
-func AssembleNACK(xid uint32, srcIP net.IP, dstMAC net.HardwareAddr) []byte {
-	return assembleUdp(srcIP, net.IPv4bcast, dhcpmsg.Message{
+func NACK(xid uint32, srcIP net.IP, dstMAC net.HardwareAddr) dhcpmsg.Message {
+	return dhcpmsg.Message{
 		Op:        dhcpmsg.OpReply,
 		Xid:       xid,
 		Htype:     dhcpmsg.HtypeETHER,
@@ -17,5 +17,5 @@ func AssembleNACK(xid uint32, srcIP net.IP, dstMAC net.HardwareAddr) []byte {
 			dhcpmsg.OptionType(dhcpmsg.MsgTypeNack),
 			dhcpmsg.OptionServerIdentifier(srcIP),
 		},
-	}.Assemble())
+	}
 }
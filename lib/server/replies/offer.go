@@ -6,8 +6,8 @@ import (
 	"git.sr.ht/~adrian-blx/psa-dhcp/lib/dhcpmsg"
 )
 
-func AssembleOffer(xid uint32, flags uint16, srcIP, dstIP net.IP, dstMAC net.HardwareAddr, opts []dhcpmsg.DHCPOpt) []byte {
-	return assembleUdp(srcIP, dstFromFlag(flags, dstIP), dhcpmsg.Message{
+func Offer(xid uint32, flags uint16, srcIP, dstIP net.IP, dstMAC net.HardwareAddr, opts []dhcpmsg.DHCPOpt) dhcpmsg.Message {
+	return dhcpmsg.Message{
 		Op:        dhcpmsg.OpReply,
 		Xid:       xid,
 		Htype:     dhcpmsg.HtypeETHER,
@@ -19,5 +19,5 @@ func AssembleOffer(xid uint32, flags uint16, srcIP, dstIP net.IP, dstMAC net.Har
 			dhcpmsg.OptionType(dhcpmsg.MsgTypeOffer),
 			dhcpmsg.OptionServerIdentifier(srcIP),
 		}, opts...),
-	}.Assemble())
+	}
 }
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/dhcpmsg"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/oui"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/hooks"
+	pb "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/proto"
+)
+
+const (
+	// How often the same rogue server is reported at most.
+	rogueAlertInterval = 10 * time.Minute
+	// Number of rogue servers tracked, further ones are reported as 'other'.
+	maxRogues = 256
+)
+
+// rogueServers remembers when rogue servers were last reported.
+type rogueServers struct {
+	sync.Mutex
+	m map[string]time.Time // Key is the server identifier.
+}
+
+// parseTrusted parses the server identifiers of trusted DHCP servers.
+func parseTrusted(conf *pb.ServerConfig) ([]net.IP, error) {
+	var res []net.IP
+	for _, s := range conf.GetTrustedServer() {
+		ip := net.ParseIP(s).To4()
+		if ip == nil {
+			return nil, fmt.Errorf("trusted_server '%s' is not an IPv4 address", s)
+		}
+		res = append(res, ip)
+	}
+	return res, nil
+}
+
+// checkRogue reports replies of other DHCP servers: src and hwaddr are the IP and hardware address the
+// reply was sent from.
+func (sx *server) checkRogue(src net.IP, hwaddr net.HardwareAddr, msg dhcpmsg.Message) {
+	opts := dhcpmsg.DecodeOptions(msg.Options)
+	if opts.MessageType != dhcpmsg.MsgTypeOffer && opts.MessageType != dhcpmsg.MsgTypeAck {
+		return
+	}
+	id := opts.ServerIdentifier
+	if id == nil {
+		id = src
+	}
+	if id.Equal(sx.selfIP) || bytes.Equal(hwaddr, sx.iface.HardwareAddr) {
+		// Our own replies.
+		return
+	}
+
+	if sx.peer != nil && sx.peer.IsPeerServer(id) {
+		// The failover peer, it answers while we stand by.
+		return
+	}
+	sx.RLock()
+	trusted := sx.trusted
+	sx.RUnlock()
+	for _, ip := range trusted {
+		if ip.Equal(id) {
+			return
+		}
+	}
+
+	tracked, report := sx.rogues.seen(id.String(), time.Now())
+	label := id.String()
+	if !tracked {
+		label = "other"
+	}
+	mRogue.Inc(sx.iface.Name, label)
+	if !report {
+		return
+	}
+
+	vid := "UNKNOWN VENDOR"
+	if res, ok := oui.Lookup(hwaddr); ok {
+		vid = res
+	}
+	sx.l.Warnf("# rogue DHCP server %s (hwaddr %s, %s) sent %s of IP %s to %s", id, hwaddr, vid, dhcpmsg.MsgTypeName(opts.MessageType), msg.YourIP, msg.ClientMAC)
+	sx.hooks.Fire(sx.event(hooks.EventRogue, hwaddr, id, nil, "", time.Now()))
+}
+
+// seen records a reply of the rogue server with the given identifier. It returns false if the server
+// is not tracked as there are too many, and true as second value if it must be reported.
+func (rx *rogueServers) seen(id string, now time.Time) (bool, bool) {
+	rx.Lock()
+	defer rx.Unlock()
+
+	last, ok := rx.m[id]
+	if !ok && len(rx.m) >= maxRogues {
+		return false, false
+	}
+	if ok && now.Sub(last) < rogueAlertInterval {
+		return true, false
+	}
+	rx.m[id] = now
+	return true, true
+}
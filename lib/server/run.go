@@ -2,6 +2,9 @@ package server
 
 import (
 	"context"
+	"fmt"
+	"net"
+	"time"
 
 	"git.sr.ht/~adrian-blx/psa-dhcp/lib/dhcpmsg"
 	"git.sr.ht/~adrian-blx/psa-dhcp/lib/layer"
@@ -12,8 +15,19 @@ func (sx *server) Run() error {
 	sx.l.Printf("# psa-dhcpd is ready!")
 	sx.l.Printf("# Configuration: %s", sx)
 
+	var tconn net.PacketConn
+	if sx.tftp != nil {
+		var err error
+		if tconn, err = net.ListenPacket("udp4", sx.tftpAddr); err != nil {
+			return fmt.Errorf("failed to listen for tftp on %s: %v", sx.tftpAddr, err)
+		}
+	}
+
 	rsock, err := rsocks.GetIPRecvSock(sx.iface)
 	if err != nil {
+		if tconn != nil {
+			tconn.Close()
+		}
 		return err
 	}
 
@@ -25,10 +39,37 @@ func (sx *server) Run() error {
 		rsock.Close()
 	}()
 
+	if sx.hooks != nil {
+		go sx.watchExpiry(ctx)
+	}
+	if tconn != nil {
+		go func() {
+			if err := sx.tftp.Serve(ctx, tconn); err != nil {
+				sx.l.Errorf("# tftp server failed: %v", err)
+			}
+		}()
+	}
+
+	// A bounded number of workers handles messages, the receive loop drops them if all are busy.
+	queue := make(chan packet, queueSize)
+	for i := 0; i < sx.workers; i++ {
+		go func() {
+			for p := range queue {
+				sx.handleMsg(p.src, p.dst, p.msg)
+			}
+		}()
+	}
+	defer close(queue)
+	go sx.expireLimits(ctx)
+
 	buf := make([]byte, 4096)
 	for {
-		nr, err := rsock.Read(buf)
+		nr, hwaddr, err := rsocks.ReadFrom(rsock, buf)
 		if err != nil {
+			if sx.ctx.Err() != nil {
+				// Regular shutdown.
+				return nil
+			}
 			return err
 		}
 		v4, err := layer.DecodeIPv4(buf[0:nr])
@@ -40,10 +81,53 @@ func (sx *server) Run() error {
 			continue
 		}
 		dhcp, err := dhcpmsg.Decode(udp.Data)
-		if err != nil || dhcp.Op != dhcpmsg.OpRequest {
+		if err != nil {
+			continue
+		}
+		if dhcp.Op == dhcpmsg.OpReply {
+			sx.checkRogue(v4.Source, hwaddr, *dhcp)
+			continue
+		}
+		if dhcp.Op != dhcpmsg.OpRequest {
 			continue
 		}
-		go sx.handleMsg(v4.Source, v4.Destination, *dhcp)
+		if ok, limit := sx.limiter.Allow(limitKey(*dhcp)); !ok {
+			sx.drop("rate_limit_" + limit)
+			continue
+		}
+		select {
+		case queue <- packet{src: v4.Source, dst: v4.Destination, msg: *dhcp}:
+		default:
+			sx.drop("queue_full")
+		}
+	}
+}
+
+// packet is a received message waiting to be handled.
+type packet struct {
+	src, dst net.IP
+	msg      dhcpmsg.Message
+}
+
+// limitKey identifies the client sending msg for rate limiting: by its client identifier if it sent a
+// sane one, by its hwaddr otherwise.
+func limitKey(msg dhcpmsg.Message) string {
+	if cid := dhcpmsg.DecodeOptions(msg.Options).ClientIdentifier; len(cid) >= 4 {
+		return string(cid)
+	}
+	return msg.ClientMAC.String()
+}
+
+// expireLimits periodically forgets rate limits of clients which went quiet.
+func (sx *server) expireLimits(ctx context.Context) {
+	t := time.NewTicker(limitExpiry)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			sx.limiter.Expire(limitExpiry)
+		}
 	}
-	return nil
 }
@@ -3,129 +3,285 @@ package server
 import (
 	"context"
 	"fmt"
-	"log"
 	"net"
-	"strings"
+	"reflect"
+	"sync"
+	"time"
 
+	"github.com/golang/protobuf/proto"
 	"git.sr.ht/~adrian-blx/psa-dhcp/lib/dhcpmsg"
 	"git.sr.ht/~adrian-blx/psa-dhcp/lib/libif"
-	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ipdb"
-	lo "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/leaseopts"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/logger"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/metrics"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/hooks"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ipdb/journal"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/peer"
 	pb "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/proto"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ratelimit"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/tftp"
 )
 
 type server struct {
-	ctx       context.Context            // Context used by this server.
-	l         *log.Logger                // Logger.
-	iface     *net.Interface             // Interface we are working on.
-	selfIP    net.IP                     // Our own IP (used as server identifier).
-	ipdb      *ipdb.IPDB                 // IP database instance.
-	lopts     lo.LeaseOptions            // Default options for leases.
-	overrides map[string]lo.LeaseOptions // Static client configuration, key is a private duid.
+	sync.RWMutex                     // Protects the configuration, held while handling messages.
+	ctx          context.Context     // Context used by this server.
+	l            *logger.Logger      // Logger.
+	iface        *net.Interface      // Interface we are working on.
+	selfIP       net.IP              // Our own IP (used as server identifier).
+	local        *subnet             // The subnet directly attached to iface.
+	relayed      []*subnet           // Subnets served through relay agents.
+	quarantine   time.Duration       // For how long to quarantine declined IPs.
+	hooks        *hooks.Hooks        // Hooks to notify about lease events, may be nil.
+	committed    *committedLeases    // Committed leases, to report their expiry to hooks.
+	peer         *peer.Peer          // Failover peer, nil if we are always active.
+	tftp         *tftp.Server        // Built-in TFTP server, nil if disabled.
+	tftpConf     *pb.TFTPConfig      // Configuration of the TFTP server.
+	tftpAddr     string              // Address the TFTP server listens on.
+	limiter      *ratelimit.Limiter  // Limits the rate of handled messages.
+	limitConf    *pb.RateLimitConfig // Configuration of the limiter.
+	workers      int                 // Number of messages handled concurrently.
+	trusted      []net.IP            // Server identifiers of other DHCP servers which are not rogue.
+	rogues       *rogueServers       // Rogue DHCP servers seen.
+	requesters   []*net.IPNet        // Networks allowed to send leasequeries.
 }
 
+const (
+	// Default quarantine for declined IPs.
+	defaultDeclineQuarantine = 10 * time.Minute
+	// Vendor class of UEFI HTTP boot clients.
+	httpClientClass = "HTTPClient"
+	// Default number of messages handled concurrently.
+	defaultWorkers = 32
+	// Messages waiting for a worker, further messages are dropped.
+	queueSize = 256
+	// Rate limits of clients are forgotten after this period of silence.
+	limitExpiry = time.Minute
+)
+
 // New constructs a new dhcp server instance.
-func New(ctx context.Context, l *log.Logger, iface *net.Interface, conf *pb.ServerConfig) (*server, error) {
+// If a journal is given, leases found in it are restored and all changes will be recorded to it.
+func New(ctx context.Context, l *logger.Logger, iface *net.Interface, conf *pb.ServerConfig, jx *journal.Journal) (*server, error) {
 	selfIP, err := libif.InterfaceAddr(iface)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch my own IP from interface '%s': %v", iface.Name, err)
 	}
 
-	lopts, ipnet, err := lo.ParseConfig(conf)
+	local, relayed, quarantine, err := parseConfig(l, iface, selfIP, conf)
 	if err != nil {
-		return nil, fmt.Errorf("config parse error: %v", err)
+		return nil, err
 	}
 
-	db, err := ipdb.New(ipnet.IP, ipnet.Mask)
-	if err != nil {
-		return nil, fmt.Errorf("failed to build ipdb: %v", err)
+	// Restore leases from a previous run.
+	if jx != nil {
+		for _, sn := range append([]*subnet{local}, relayed...) {
+			n := sn.ipdb.Replay(jx.Records())
+			l.Printf("# [%s] restored %d lease(s) from journal.", sn.ipnet, n)
+			sn.ipdb.SetRecorder(jx)
+			jx.Register(sn.ipdb.Snapshot)
+		}
 	}
-
-	// Check dynamic range configuration: It is not part of the lease config but a property of ipdb.
-	if dr := conf.GetDynamicRange(); dr != "" {
-		sr := strings.Split(dr, "-")
-		if len(sr) != 2 {
-			return nil, fmt.Errorf("dynamic_range format '%s' invalid. Expected 'start-end'", dr)
+	sx := &server{ctx: ctx, l: l, iface: iface, selfIP: selfIP, local: local, relayed: relayed, quarantine: quarantine, tftpConf: conf.GetTftp(), limitConf: conf.GetRateLimit()}
+	if sx.limiter, err = ratelimit.New(conf.GetRateLimit()); err != nil {
+		return nil, fmt.Errorf("rate_limit: %v", err)
+	}
+	if sx.trusted, err = parseTrusted(conf); err != nil {
+		return nil, err
+	}
+	if sx.requesters, err = parseRequesters(conf); err != nil {
+		return nil, err
+	}
+	sx.rogues = &rogueServers{m: make(map[string]time.Time)}
+	sx.workers = int(conf.GetRateLimit().GetWorkers())
+	if sx.workers == 0 {
+		sx.workers = defaultWorkers
+	}
+	if root := conf.GetTftp().GetRoot(); root != "" {
+		if sx.tftp, err = tftp.New(l, root); err != nil {
+			return nil, fmt.Errorf("failed to set up tftp root: %v", err)
 		}
-		ipa := net.ParseIP(sr[0])
-		ipb := net.ParseIP(sr[1])
-		if ipa == nil || ipb == nil {
-			return nil, fmt.Errorf("dynamic_range has invalid IP range: '%s'", dr)
+		sx.tftpAddr = conf.GetTftp().GetListen()
+		if sx.tftpAddr == "" {
+			sx.tftpAddr = net.JoinHostPort(selfIP.String(), "69")
 		}
-		if err := db.SetDynamicRange(ipa, ipb); err != nil {
-			return nil, fmt.Errorf("failed to configure dynamic_range '%s': %v", dr, err)
+		l.Printf("# serving %s through tftp on %s", sx.tftp.Root(), sx.tftpAddr)
+	}
+	metrics.Default.OnExport(sx.exportStats)
+	return sx, nil
+}
+
+// SetPeer keeps all leases in sync with a failover peer, must be called before Run.
+// Requests are only answered while the peer says that we are active, replies of the peer are trusted.
+func (sx *server) SetPeer(p *peer.Peer) {
+	sx.peer = p
+	p.AddServerID(sx.selfIP)
+	for _, sn := range sx.subnets() {
+		sn.ipdb.SetRecorder(p)
+		p.Register(sn.ipdb)
+	}
+}
+
+// parseConfig builds all subnets and the decline quarantine from the configuration.
+func parseConfig(l *logger.Logger, iface *net.Interface, selfIP net.IP, conf *pb.ServerConfig) (*subnet, []*subnet, time.Duration, error) {
+	local, err := newSubnet(l, conf, false)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	quarantine := defaultDeclineQuarantine
+	if dq := conf.GetDeclineQuarantine(); dq != "" {
+		if quarantine, err = time.ParseDuration(dq); err != nil {
+			return nil, nil, 0, fmt.Errorf("failed to parse decline_quarantine '%s': %v", dq, err)
 		}
-		l.Printf("# dynamic range restricted to %s", dr)
 	}
 
-	// Disable dynamic ranges if desired
-	if conf.GetStaticOnly() {
-		db.DisableDynamic()
-		l.Printf("# disabling dynamic IP assignment (static_only is 'true'), only static leases will be handed out.")
+	// Give ourselfs a permanent fake lease.
+	if err := local.ipdb.AddPermanentClient(selfIP, duidFromHwAddr(iface.HardwareAddr)); err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to add own IP (%s) to configured net (%s): %v", selfIP, local.ipnet, err)
 	}
 
-	// Configure static assignments
-	overrides := make(map[string]lo.LeaseOptions)
-	for k, v := range conf.GetClient() {
-		hwaddr, err := net.ParseMAC(k)
+	// Remote networks, reached through relay agents.
+	var relayed []*subnet
+	for _, rc := range conf.GetRelaySubnet() {
+		sn, err := newSubnet(l, rc, true)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse hwaddr '%s': %v", k, err)
+			return nil, nil, 0, fmt.Errorf("relay_subnet %s: %v", rc.GetNetwork(), err)
 		}
-		oopts := *lopts
-		lo.SetClientOverrides(&oopts, v)
-		if oopts.IP != nil {
-			if err := db.AddPermanentClient(oopts.IP, duidFromHwAddr(hwaddr)); err != nil {
-				return nil, fmt.Errorf("could not create permanent lease for %v -> %v: %v", hwaddr, oopts.IP, err)
+		for _, o := range append(relayed, local) {
+			if sn.overlaps(o) {
+				return nil, nil, 0, fmt.Errorf("relay_subnet %s overlaps with %s", sn.ipnet, o.ipnet)
 			}
 		}
-		if _, ok := overrides[hwaddr.String()]; ok {
-			return nil, fmt.Errorf("duplicate client override for %v", hwaddr)
-		}
-		l.Printf("# client override for %s configured.", hwaddr)
-		overrides[duidFromHwAddr(hwaddr).String()] = oopts
+		relayed = append(relayed, sn)
 	}
 
-	// Give ourselfs a permanent fake lease.
-	if err := db.AddPermanentClient(selfIP, duidFromHwAddr(iface.HardwareAddr)); err != nil {
-		return nil, fmt.Errorf("failed to add own IP (%s) to configured net (%s): %v", selfIP, *ipnet, err)
+	// Our own TFTP server is the default boot server.
+	if conf.GetTftp().GetRoot() != "" {
+		for _, sn := range append([]*subnet{local}, relayed...) {
+			sn.setDefaultNextServer(selfIP)
+		}
 	}
-	return &server{ctx: ctx, l: l, iface: iface, selfIP: selfIP, ipdb: db, lopts: *lopts, overrides: overrides}, nil
+	return local, relayed, quarantine, nil
 }
 
-// dhcpOptions assembles a list of dhcp options from the server configuration.
-func (sx *server) dhcpOptions(clientMAC net.HardwareAddr) []dhcpmsg.DHCPOpt {
-	opts := []dhcpmsg.DHCPOpt{
-		dhcpmsg.OptionIPAddressLeaseDuration(sx.lopts.LeaseDuration),
-		dhcpmsg.OptionSubnetMask(sx.lopts.Netmask),
+// Reload applies a new configuration to the running server while keeping all dynamic leases.
+// Networks can not be added, removed or changed. The running configuration is left untouched if
+// the new one fails to parse.
+func (sx *server) Reload(conf *pb.ServerConfig) error {
+	sx.l.Printf("# reloading configuration")
+	local, relayed, quarantine, err := parseConfig(sx.l, sx.iface, sx.selfIP, conf)
+	if err != nil {
+		return err
 	}
-	ov, ok := sx.overrides[duidFromHwAddr(clientMAC).String()]
 
-	if ok && ov.Router != nil {
-		opts = append(opts, dhcpmsg.OptionRouter(ov.Router))
-	} else if sx.lopts.Router != nil {
-		opts = append(opts, dhcpmsg.OptionRouter(sx.lopts.Router))
+	// Pair up running and new subnets before changing anything.
+	if local.ipnet.String() != sx.local.ipnet.String() {
+		return fmt.Errorf("network changed from %s to %s, this requires a restart", sx.local.ipnet, local.ipnet)
+	}
+	if len(relayed) != len(sx.relayed) {
+		return fmt.Errorf("relay_subnet count changed from %d to %d, this requires a restart", len(sx.relayed), len(relayed))
+	}
+	pairs := [][2]*subnet{{sx.local, local}}
+	for _, sn := range sx.relayed {
+		var nsn *subnet
+		for _, rsn := range relayed {
+			if rsn.ipnet.String() == sn.ipnet.String() {
+				nsn = rsn
+			}
+		}
+		if nsn == nil {
+			return fmt.Errorf("relay_subnet %s was removed, this requires a restart", sn.ipnet)
+		}
+		pairs = append(pairs, [2]*subnet{sn, nsn})
+	}
+	if conf.GetTftp().GetRoot() != sx.tftpConf.GetRoot() || conf.GetTftp().GetListen() != sx.tftpConf.GetListen() {
+		return fmt.Errorf("tftp configuration changed, this requires a restart")
+	}
+	if !proto.Equal(conf.GetRateLimit(), sx.limitConf) {
+		return fmt.Errorf("rate_limit configuration changed, this requires a restart")
+	}
+	trusted, err := parseTrusted(conf)
+	if err != nil {
+		return err
+	}
+	requesters, err := parseRequesters(conf)
+	if err != nil {
+		return err
 	}
 
-	if ok && len(ov.DNS) > 0 {
-		opts = append(opts, dhcpmsg.OptionDNS(ov.DNS...))
-	} else if len(sx.lopts.DNS) > 0 {
-		opts = append(opts, dhcpmsg.OptionDNS(sx.lopts.DNS...))
+	for _, p := range pairs {
+		if err := p[0].ipdb.CheckReconfigure(p[1].ipdb); err != nil {
+			return fmt.Errorf("can not reconfigure %s: %v", p[0].ipnet, err)
+		}
+	}
+
+	sx.Lock()
+	defer sx.Unlock()
+
+	for _, p := range pairs {
+		sn, nsn := p[0], p[1]
+		added, removed, err := sn.ipdb.Reconfigure(nsn.ipdb)
+		if err != nil {
+			// The new configuration is applied anyway, to keep all subnets consistent.
+			sx.l.Errorf("# [%s] failed to record static lease changes: %v", sn.ipnet, err)
+		}
+		if added > 0 || removed > 0 {
+			sx.l.Printf("# [%s] static leases: %d added, %d removed.", sn.ipnet, added, removed)
+		}
+		if !reflect.DeepEqual(sn.lopts, nsn.lopts) {
+			sx.l.Printf("# [%s] lease options changed to %+v", sn.ipnet, nsn.lopts)
+		}
+		sn.lopts = nsn.lopts
+		sn.overrides = nsn.overrides
+		sn.circuits = nsn.circuits
+		sn.classes = nsn.classes
+		sn.acl = nsn.acl
 	}
+	sx.trusted = trusted
+	sx.requesters = requesters
+	if quarantine != sx.quarantine {
+		sx.l.Printf("# decline quarantine changed from %s to %s", sx.quarantine, quarantine)
+		sx.quarantine = quarantine
+	}
+	return nil
+}
 
-	if ok && len(ov.NTP) > 0 {
-		opts = append(opts, dhcpmsg.OptionNTP(ov.NTP...))
-	} else if len(sx.lopts.NTP) > 0 {
-		opts = append(opts, dhcpmsg.OptionNTP(sx.lopts.NTP...))
+// subnetFor returns the subnet responsible for a message, nil if there is none.
+func (sx *server) subnetFor(msg dhcpmsg.Message) *subnet {
+	// Relayed messages: giaddr is the address of the relay agent in the clients network.
+	if isSet(msg.RelayIP) {
+		for _, sn := range sx.relayed {
+			if sn.ipdb.InManagedRange(msg.RelayIP) {
+				return sn
+			}
+		}
+		return nil
 	}
+	// Clients of relayed networks renew their leases by talking to us directly.
+	if isSet(msg.ClientIP) && !sx.local.ipdb.InManagedRange(msg.ClientIP) {
+		for _, sn := range sx.relayed {
+			if sn.ipdb.InManagedRange(msg.ClientIP) {
+				return sn
+			}
+		}
+		return nil
+	}
+	return sx.local
+}
 
-	if ok && ov.Domain != "" {
-		opts = append(opts, dhcpmsg.OptionDomainName(ov.Domain))
-	} else if sx.lopts.Domain != "" {
-		opts = append(opts, dhcpmsg.OptionDomainName(sx.lopts.Domain))
+// subnetForIP returns the subnet managing given IP, nil if there is none.
+func (sx *server) subnetForIP(ip net.IP) *subnet {
+	for _, sn := range sx.subnets() {
+		if sn.ipdb.InManagedRange(ip) {
+			return sn
+		}
 	}
-	return opts
+	return nil
+}
+
+// subnets returns all subnets served by us, the local one first.
+func (sx *server) subnets() []*subnet {
+	return append([]*subnet{sx.local}, sx.relayed...)
 }
 
 func (sx *server) String() string {
-	return fmt.Sprintf("server(iface=%s, ip=%s, lease_opts=%+v)", sx.iface.Name, sx.selfIP, sx.lopts)
+	return fmt.Sprintf("server(iface=%s, ip=%s, local=%s, relayed=%v)", sx.iface.Name, sx.selfIP, sx.local, sx.relayed)
 }
@@ -2,15 +2,23 @@ package server
 
 import (
 	"context"
-	"log"
+	"fmt"
 	"net"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/google/go-cmp/cmp"
 	"git.sr.ht/~adrian-blx/psa-dhcp/lib/dhcpmsg"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/logger"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ctl"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/hooks"
+	d "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ipdb/duid"
 	pb "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/proto"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/replies"
+	yl "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ylog"
 )
 
 func TestServer(t *testing.T) {
@@ -18,10 +26,11 @@ func TestServer(t *testing.T) {
 	if err != nil {
 		t.Errorf("setup for lo failed: %v", err)
 	}
-	l := log.New(os.Stdout, "testing: ", 0)
+	l := logger.New(os.Stdout, "testing: ", logger.LevelDebug, false, false)
 
 	conf := &pb.ServerConfig{
 		Network:       "127.0.0.1/16",
+		DynamicRange:  "127.0.8.1-127.0.8.254",
 		LeaseDuration: "5m",
 		Domain:        "main",
 		Router:        "127.0.0.1",
@@ -40,17 +49,30 @@ func TestServer(t *testing.T) {
 				Dns: []string{"192.168.2.2", "192.168.2.3"},
 			},
 			"04:00:00:00:00:00": &pb.ClientConfig{
-				Ip: "127.0.2.1",
+				Ip:       "127.0.2.1",
+				Hostname: "printer",
 			},
+			"08:00:00:00:00:00": &pb.ClientConfig{
+				StaticRoute: []string{"10.0.0.0/8 127.0.0.254"},
+			},
+		},
+		Class: []*pb.ClassConfig{
+			{Name: "printers", HwaddrPrefix: []string{"06:00"}, Deny: true},
+			{Name: "phones", VendorClass: "android-dhcp-", Dns: []string{"192.168.3.2"}, LeaseDuration: "1h"},
+			{Name: "fingerprinted", Fingerprint: []string{"1,3,6"}, Domain: "other", DynamicRange: "127.0.9.1-127.0.9.9"},
+		},
+		Option: []*pb.OptionConfig{
+			{Code: 150, Type: pb.OptionConfig_IP, Value: []string{"192.168.1.9"}},
 		},
 	}
-	sx, err := New(context.Background(), l, iface, conf)
+	sx, err := New(context.Background(), l, iface, conf, nil)
 	if err != nil {
 		t.Errorf("New server failed: %v", err)
 	}
 
 	input := []struct {
 		client string
+		opts   dhcpmsg.DecodedOptions
 		want   []dhcpmsg.DHCPOpt
 	}{
 		{
@@ -88,6 +110,83 @@ func TestServer(t *testing.T) {
 		},
 		{
 			client: "04:00:00:00:00:00",
+			want: []dhcpmsg.DHCPOpt{
+				dhcpmsg.OptionIPAddressLeaseDuration(5 * time.Minute),
+				dhcpmsg.OptionSubnetMask(net.IPMask{0xff, 0xff, 0, 0}),
+				dhcpmsg.OptionRouter(net.IPv4(127, 0, 0, 1)),
+				dhcpmsg.OptionDNS(net.IPv4(192, 168, 1, 2), net.IPv4(192, 168, 1, 3)),
+				dhcpmsg.OptionNTP(net.IPv4(192, 168, 1, 4), net.IPv4(192, 168, 1, 5)),
+				dhcpmsg.OptionDomainName("main"),
+				dhcpmsg.OptionHostname("printer"),
+			},
+		},
+		{
+			// Static configuration takes precedence over classes.
+			client: "01:00:00:00:00:00",
+			opts:   dhcpmsg.DecodedOptions{VendorClass: "android-dhcp-11"},
+			want: []dhcpmsg.DHCPOpt{
+				dhcpmsg.OptionIPAddressLeaseDuration(5 * time.Minute),
+				dhcpmsg.OptionSubnetMask(net.IPMask{0xff, 0xff, 0, 0}),
+				dhcpmsg.OptionRouter(net.IPv4(192, 168, 2, 1)),
+				dhcpmsg.OptionDNS(net.IPv4(192, 168, 2, 2), net.IPv4(192, 168, 2, 3)),
+				dhcpmsg.OptionNTP(net.IPv4(192, 168, 2, 4), net.IPv4(192, 168, 2, 5)),
+				dhcpmsg.OptionDomainName("main"),
+			},
+		},
+		{
+			client: "05:00:00:00:00:00",
+			opts:   dhcpmsg.DecodedOptions{VendorClass: "android-dhcp-11", ParametersList: []uint8{1, 3, 6}},
+			want: []dhcpmsg.DHCPOpt{
+				dhcpmsg.OptionIPAddressLeaseDuration(time.Hour),
+				dhcpmsg.OptionSubnetMask(net.IPMask{0xff, 0xff, 0, 0}),
+				dhcpmsg.OptionRouter(net.IPv4(127, 0, 0, 1)),
+				dhcpmsg.OptionDNS(net.IPv4(192, 168, 3, 2)),
+				dhcpmsg.OptionNTP(net.IPv4(192, 168, 1, 4), net.IPv4(192, 168, 1, 5)),
+				dhcpmsg.OptionDomainName("main"),
+			},
+		},
+		{
+			client: "05:00:00:00:00:00",
+			opts:   dhcpmsg.DecodedOptions{ParametersList: []uint8{1, 3, 6}},
+			want: []dhcpmsg.DHCPOpt{
+				dhcpmsg.OptionIPAddressLeaseDuration(5 * time.Minute),
+				dhcpmsg.OptionSubnetMask(net.IPMask{0xff, 0xff, 0, 0}),
+				dhcpmsg.OptionRouter(net.IPv4(127, 0, 0, 1)),
+				dhcpmsg.OptionDNS(net.IPv4(192, 168, 1, 2), net.IPv4(192, 168, 1, 3)),
+				dhcpmsg.OptionNTP(net.IPv4(192, 168, 1, 4), net.IPv4(192, 168, 1, 5)),
+				dhcpmsg.OptionDomainName("other"),
+			},
+		},
+		{
+			client: "07:00:00:00:00:00",
+			opts:   dhcpmsg.DecodedOptions{ParametersList: []uint8{1, 3, 150}},
+			want: []dhcpmsg.DHCPOpt{
+				dhcpmsg.OptionIPAddressLeaseDuration(5 * time.Minute),
+				dhcpmsg.OptionSubnetMask(net.IPMask{0xff, 0xff, 0, 0}),
+				dhcpmsg.OptionRouter(net.IPv4(127, 0, 0, 1)),
+				dhcpmsg.OptionDNS(net.IPv4(192, 168, 1, 2), net.IPv4(192, 168, 1, 3)),
+				dhcpmsg.OptionNTP(net.IPv4(192, 168, 1, 4), net.IPv4(192, 168, 1, 5)),
+				dhcpmsg.OptionDomainName("main"),
+				{Option: 150, Data: []byte{192, 168, 1, 9}},
+			},
+		},
+		{
+			client: "08:00:00:00:00:00",
+			opts:   dhcpmsg.DecodedOptions{ParametersList: []uint8{1, 3, 121, 249}},
+			want: []dhcpmsg.DHCPOpt{
+				dhcpmsg.OptionIPAddressLeaseDuration(5 * time.Minute),
+				dhcpmsg.OptionSubnetMask(net.IPMask{0xff, 0xff, 0, 0}),
+				dhcpmsg.OptionRouter(net.IPv4(127, 0, 0, 1)),
+				dhcpmsg.OptionDNS(net.IPv4(192, 168, 1, 2), net.IPv4(192, 168, 1, 3)),
+				dhcpmsg.OptionNTP(net.IPv4(192, 168, 1, 4), net.IPv4(192, 168, 1, 5)),
+				dhcpmsg.OptionDomainName("main"),
+				{Option: dhcpmsg.OptClasslessRoutes, Data: []byte{8, 10, 127, 0, 0, 254, 0, 127, 0, 0, 1}},
+				{Option: dhcpmsg.OptMSClasslessRoutes, Data: []byte{8, 10, 127, 0, 0, 254, 0, 127, 0, 0, 1}},
+			},
+		},
+		{
+			// Routes are only sent if requested.
+			client: "08:00:00:00:00:00",
 			want: []dhcpmsg.DHCPOpt{
 				dhcpmsg.OptionIPAddressLeaseDuration(5 * time.Minute),
 				dhcpmsg.OptionSubnetMask(net.IPMask{0xff, 0xff, 0, 0}),
@@ -103,9 +202,757 @@ func TestServer(t *testing.T) {
 		if err != nil {
 			t.Errorf("ParseMAC(%s) = %v; want nil", test.client, err)
 		}
-		msg := sx.dhcpOptions(mac)
+		msg := sx.local.dhcpOptions(mac, test.opts)
 		if diff := cmp.Diff(msg, test.want); diff != "" {
 			t.Errorf("Test(%s) failed with diff: %s", mac, diff)
 		}
 	}
+
+	if _, class := sx.local.clientOptions(net.HardwareAddr{6, 0, 0, 0, 0, 1}, dhcpmsg.DecodedOptions{}); class == nil || !class.Deny {
+		t.Errorf("clientOptions(#denied) returned class %v, wanted denied class", class)
+	}
+	if _, class := sx.local.clientOptions(net.HardwareAddr{7, 0, 0, 0, 0, 1}, dhcpmsg.DecodedOptions{}); class != nil {
+		t.Errorf("clientOptions(#no class) returned class %v, wanted nil", class)
+	}
+
+	// Other clients do not get IPs of class pools, even if they ask for one.
+	isFree := func(context.Context, net.IP) bool { return true }
+	for i := 0; i < 10; i++ {
+		if ip, err := sx.local.ipdb.FindIP(context.Background(), isFree, net.IPv4(127, 0, 9, 1), d.Duid{0x01, byte(i)}); err != nil || ip.To4()[2] != 8 {
+			t.Errorf("FindIP(#non-member) = %v, %v; wanted IP of dynamic_range", ip, err)
+		}
+	}
+
+	// Pools of classes must be within the network and outside of dynamic_range.
+	for name, dr := range map[string]string{
+		"outside": "10.0.0.1-10.0.0.2",
+		"overlap": "127.0.8.200-127.0.9.1",
+	} {
+		bad := proto.Clone(conf).(*pb.ServerConfig)
+		bad.Class = append(bad.Class, &pb.ClassConfig{Name: name, DynamicRange: dr})
+		if _, err := New(context.Background(), l, iface, bad, nil); err == nil {
+			t.Errorf("New server with class pool %s (%s) returned nil err, wanted non-nil", name, dr)
+		}
+	}
+	bad := proto.Clone(conf).(*pb.ServerConfig)
+	bad.DynamicRange = ""
+	if _, err := New(context.Background(), l, iface, bad, nil); err == nil {
+		t.Errorf("New server with class pool in default dynamic_range returned nil err, wanted non-nil")
+	}
+}
+
+func TestQuarantineRange(t *testing.T) {
+	iface, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Errorf("setup for lo failed: %v", err)
+	}
+	l := logger.New(os.Stdout, "testing: ", logger.LevelDebug, false, false)
+
+	for _, test := range []struct {
+		name    string
+		dynamic string
+		static  bool
+		wantErr bool
+	}{
+		{name: "disjoint", dynamic: "127.0.8.1-127.0.8.254"},
+		{name: "static_only", static: true},
+		{name: "overlap", dynamic: "127.0.8.1-127.0.9.1", wantErr: true},
+		{name: "default dynamic_range", wantErr: true},
+	} {
+		conf := &pb.ServerConfig{
+			Network:       "127.0.0.1/16",
+			DynamicRange:  test.dynamic,
+			StaticOnly:    test.static,
+			LeaseDuration: "5m",
+			Access:        &pb.AccessConfig{Policy: pb.AccessConfig_QUARANTINE, QuarantineRange: "127.0.9.1-127.0.9.9"},
+		}
+		_, err := New(context.Background(), l, iface, conf, nil)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("New(%s) = %v, wanted err: %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestBadClientOverride(t *testing.T) {
+	iface, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Errorf("setup for lo failed: %v", err)
+	}
+	l := logger.New(os.Stdout, "testing: ", logger.LevelDebug, false, false)
+
+	for name, bad := range map[string]*pb.ClientConfig{
+		"option":        {Ip: "127.0.2.1", Option: []*pb.OptionConfig{{Code: 150, Type: pb.OptionConfig_IP, Value: []string{"not-an-ip"}}}},
+		"static_route":  {Ip: "127.0.2.1", StaticRoute: []string{"10.0.0.0/8"}},
+		"boot_filename": {Ip: "127.0.2.1", BootFilename: strings.Repeat("x", 256)},
+	} {
+		conf := &pb.ServerConfig{
+			Network:       "127.0.0.1/16",
+			LeaseDuration: "5m",
+			Client:        map[string]*pb.ClientConfig{"01:00:00:00:00:00": bad},
+		}
+		if _, err := New(context.Background(), l, iface, conf, nil); err == nil {
+			t.Errorf("New(#bad %s) returned nil err, wanted non-nil", name)
+		}
+	}
+}
+
+func TestSubnetFor(t *testing.T) {
+	iface, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Errorf("setup for lo failed: %v", err)
+	}
+	l := logger.New(os.Stdout, "testing: ", logger.LevelDebug, false, false)
+
+	conf := &pb.ServerConfig{
+		Network:       "127.0.0.1/16",
+		LeaseDuration: "5m",
+		RelaySubnet: []*pb.ServerConfig{
+			{Network: "10.1.0.0/24", LeaseDuration: "10m"},
+			{Network: "10.2.0.0/24", LeaseDuration: "20m"},
+		},
+	}
+	sx, err := New(context.Background(), l, iface, conf, nil)
+	if err != nil {
+		t.Fatalf("New server failed: %v", err)
+	}
+
+	input := []struct {
+		name string
+		msg  dhcpmsg.Message
+		want *subnet
+	}{
+		{
+			name: "local",
+			msg:  dhcpmsg.Message{RelayIP: net.IPv4zero, ClientIP: net.IPv4zero},
+			want: sx.local,
+		},
+		{
+			name: "local client",
+			msg:  dhcpmsg.Message{RelayIP: net.IPv4zero, ClientIP: net.IPv4(127, 0, 3, 4)},
+			want: sx.local,
+		},
+		{
+			name: "relayed",
+			msg:  dhcpmsg.Message{RelayIP: net.IPv4(10, 2, 0, 1), ClientIP: net.IPv4zero},
+			want: sx.relayed[1],
+		},
+		{
+			name: "relayed client",
+			msg:  dhcpmsg.Message{RelayIP: net.IPv4zero, ClientIP: net.IPv4(10, 1, 0, 99)},
+			want: sx.relayed[0],
+		},
+		{
+			name: "unknown relay",
+			msg:  dhcpmsg.Message{RelayIP: net.IPv4(10, 3, 0, 1), ClientIP: net.IPv4zero},
+		},
+		{
+			name: "unknown client",
+			msg:  dhcpmsg.Message{RelayIP: net.IPv4zero, ClientIP: net.IPv4(10, 3, 0, 99)},
+		},
+	}
+	for _, test := range input {
+		if got := sx.subnetFor(test.msg); got != test.want {
+			t.Errorf("subnetFor(%s) = %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	// Overlapping networks must be rejected.
+	conf.RelaySubnet = append(conf.RelaySubnet, &pb.ServerConfig{Network: "10.1.0.128/25", LeaseDuration: "10m"})
+	if _, err := New(context.Background(), l, iface, conf, nil); err == nil {
+		t.Errorf("New server with overlapping relay_subnet returned nil err, wanted non-nil")
+	}
+}
+
+func TestBootFile(t *testing.T) {
+	l := logger.New(os.Stdout, "testing: ", logger.LevelDebug, false, false)
+	conf := &pb.ServerConfig{
+		Network:       "192.168.1.0/24",
+		LeaseDuration: "5m",
+		NextServer:    "192.168.1.2",
+		BootFilename:  "default.0",
+		Boot: []*pb.BootRule{
+			{UserClass: "iPXE", BootFilename: "http://192.168.1.3/boot.ipxe"},
+			{Arch: []uint32{0}, VendorClass: "PXEClient", BootFilename: "undionly.kpxe"},
+			{Arch: []uint32{7, 9}, VendorClass: "PXEClient", BootFilename: "ipxe.efi"},
+			{Arch: []uint32{16}, VendorClass: "HTTPClient", NextServer: "192.168.1.3", BootFilename: "http://192.168.1.3/ipxe.efi"},
+		},
+		Client: map[string]*pb.ClientConfig{
+			"02:00:00:00:00:01": {BootFilename: "special.efi", NextServer: "192.168.1.4"},
+		},
+	}
+	sn, err := newSubnet(l, conf, false)
+	if err != nil {
+		t.Fatalf("newSubnet failed: %v", err)
+	}
+
+	input := []struct {
+		name     string
+		mac      net.HardwareAddr
+		opts     dhcpmsg.DecodedOptions
+		wantNext net.IP
+		wantFile string
+	}{
+		{
+			name:     "no pxe client",
+			mac:      net.HardwareAddr{2, 0, 0, 0, 0, 2},
+			wantNext: net.IPv4(192, 168, 1, 2),
+			wantFile: "default.0",
+		},
+		{
+			name:     "bios",
+			mac:      net.HardwareAddr{2, 0, 0, 0, 0, 2},
+			opts:     dhcpmsg.DecodedOptions{ClientArch: []uint16{0}, VendorClass: "PXEClient:Arch:00000:UNDI:002001"},
+			wantNext: net.IPv4(192, 168, 1, 2),
+			wantFile: "undionly.kpxe",
+		},
+		{
+			name:     "uefi",
+			mac:      net.HardwareAddr{2, 0, 0, 0, 0, 2},
+			opts:     dhcpmsg.DecodedOptions{ClientArch: []uint16{7}, VendorClass: "PXEClient:Arch:00007:UNDI:003016"},
+			wantNext: net.IPv4(192, 168, 1, 2),
+			wantFile: "ipxe.efi",
+		},
+		{
+			name:     "uefi http",
+			mac:      net.HardwareAddr{2, 0, 0, 0, 0, 2},
+			opts:     dhcpmsg.DecodedOptions{ClientArch: []uint16{16}, VendorClass: "HTTPClient:Arch:00016:UNDI:003001"},
+			wantNext: net.IPv4(192, 168, 1, 3),
+			wantFile: "http://192.168.1.3/ipxe.efi",
+		},
+		{
+			name:     "ipxe",
+			mac:      net.HardwareAddr{2, 0, 0, 0, 0, 2},
+			opts:     dhcpmsg.DecodedOptions{ClientArch: []uint16{7}, VendorClass: "PXEClient:Arch:00007:UNDI:003016", UserClass: "iPXE"},
+			wantNext: net.IPv4(192, 168, 1, 2),
+			wantFile: "http://192.168.1.3/boot.ipxe",
+		},
+		{
+			name:     "client override",
+			mac:      net.HardwareAddr{2, 0, 0, 0, 0, 1},
+			opts:     dhcpmsg.DecodedOptions{ClientArch: []uint16{7}, VendorClass: "PXEClient:Arch:00007:UNDI:003016"},
+			wantNext: net.IPv4(192, 168, 1, 4),
+			wantFile: "special.efi",
+		},
+	}
+	for _, test := range input {
+		next, file := sn.bootFile(test.mac, test.opts)
+		if !next.Equal(test.wantNext) || file != test.wantFile {
+			t.Errorf("bootFile(%s) = %v, %q; want %v, %q", test.name, next, file, test.wantNext, test.wantFile)
+		}
+	}
+
+	// Our own IP only becomes the boot server if none is configured.
+	conf.NextServer = ""
+	conf.Client["02:00:00:00:00:03"] = &pb.ClientConfig{BootFilename: "other.efi"}
+	if sn, err = newSubnet(l, conf, false); err != nil {
+		t.Fatalf("newSubnet(#no next_server) failed: %v", err)
+	}
+	sn.setDefaultNextServer(net.IPv4(192, 168, 1, 1))
+	for _, test := range []struct {
+		mac  net.HardwareAddr
+		want net.IP
+	}{
+		{mac: net.HardwareAddr{2, 0, 0, 0, 0, 1}, want: net.IPv4(192, 168, 1, 4)},
+		{mac: net.HardwareAddr{2, 0, 0, 0, 0, 2}, want: net.IPv4(192, 168, 1, 1)},
+		{mac: net.HardwareAddr{2, 0, 0, 0, 0, 3}, want: net.IPv4(192, 168, 1, 1)},
+	} {
+		if next, _ := sn.bootFile(test.mac, dhcpmsg.DecodedOptions{}); !next.Equal(test.want) {
+			t.Errorf("bootFile(%s) after setDefaultNextServer = %v, want %v", test.mac, next, test.want)
+		}
+	}
+}
+
+func TestCircuit(t *testing.T) {
+	l := logger.New(os.Stdout, "testing: ", logger.LevelDebug, false, false)
+	conf := &pb.ServerConfig{
+		Network:       "192.168.1.0/24",
+		LeaseDuration: "5m",
+		Dns:           []string{"192.168.1.2"},
+		Circuit: []*pb.CircuitConfig{
+			{CircuitId: "Gi1/0/12", Config: &pb.ClientConfig{Ip: "192.168.1.12", Dns: []string{"192.168.1.3"}}},
+			{CircuitId: "0x00040064", RemoteId: "switch-2", Config: &pb.ClientConfig{Ip: "192.168.1.13"}},
+		},
+		Client: map[string]*pb.ClientConfig{
+			"02:00:00:00:00:01": {Dns: []string{"192.168.1.4"}},
+		},
+	}
+	sn, err := newSubnet(l, conf, true)
+	if err != nil {
+		t.Fatalf("newSubnet failed: %v", err)
+	}
+
+	mac := net.HardwareAddr{2, 0, 0, 0, 0, 1}
+	input := []struct {
+		name    string
+		info    *dhcpmsg.RelayAgentInfo
+		wantIP  net.IP
+		wantDNS []net.IP
+	}{
+		{
+			name:    "no relay info",
+			wantDNS: []net.IP{net.IPv4(192, 168, 1, 4).To4()},
+		},
+		{
+			name:    "text circuit",
+			info:    &dhcpmsg.RelayAgentInfo{CircuitID: []byte("Gi1/0/12"), RemoteID: []byte("any")},
+			wantIP:  net.IPv4(192, 168, 1, 12),
+			wantDNS: []net.IP{net.IPv4(192, 168, 1, 3).To4()},
+		},
+		{
+			name:    "hex circuit",
+			info:    &dhcpmsg.RelayAgentInfo{CircuitID: []byte{0, 4, 0, 0x64}, RemoteID: []byte("switch-2")},
+			wantIP:  net.IPv4(192, 168, 1, 13),
+			wantDNS: []net.IP{net.IPv4(192, 168, 1, 2).To4()},
+		},
+		{
+			name:    "remote id mismatch",
+			info:    &dhcpmsg.RelayAgentInfo{CircuitID: []byte{0, 4, 0, 0x64}, RemoteID: []byte("switch-3")},
+			wantDNS: []net.IP{net.IPv4(192, 168, 1, 4).To4()},
+		},
+	}
+	for _, test := range input {
+		duid, ok := sn.circuitDuid(test.info)
+		if ok != (test.wantIP != nil) {
+			t.Errorf("circuitDuid(%s) = %v, want %v", test.name, ok, test.wantIP != nil)
+		}
+		if ok {
+			if ip, err := sn.ipdb.LookupClientByDuid(duid); err != nil || !ip.Equal(test.wantIP) {
+				t.Errorf("LookupClientByDuid(%s) = %v, %v; want %v", test.name, ip, err, test.wantIP)
+			}
+		}
+		lopts, _ := sn.clientOptions(mac, dhcpmsg.DecodedOptions{RelayAgentInfo: test.info})
+		if diff := cmp.Diff(test.wantDNS, lopts.DNS); diff != "" {
+			t.Errorf("clientOptions(%s) had DNS diff: %s", test.name, diff)
+		}
+	}
+
+	for _, bad := range [][]*pb.CircuitConfig{
+		{{CircuitId: ""}},
+		{{CircuitId: "0xzz"}},
+		{{CircuitId: "a"}, {CircuitId: "a"}},
+		{{CircuitId: "a", Config: &pb.ClientConfig{Ip: "10.0.0.1"}}},
+		{{CircuitId: "a", Config: &pb.ClientConfig{Ip: "192.168.1.9", StaticRoute: []string{"bogus"}}}},
+	} {
+		if _, err := newSubnet(l, &pb.ServerConfig{Network: "192.168.1.0/24", LeaseDuration: "5m", Circuit: bad}, true); err == nil {
+			t.Errorf("newSubnet(%v) wanted err, got nil err", bad)
+		}
+	}
+
+	// The relay agent information must be echoed as last option.
+	info := dhcpmsg.OptionRelayAgentInfo(dhcpmsg.SubOpt{Code: dhcpmsg.SubOptCircuitID, Data: []byte("Gi1/0/12")})
+	req := dhcpmsg.Message{Options: []dhcpmsg.DHCPOpt{dhcpmsg.OptionType(dhcpmsg.MsgTypeRequest), info}}
+	rep := replies.EchoRelayAgentInfo(req, replies.NACK(1, net.IPv4(192, 168, 1, 1), mac))
+	if diff := cmp.Diff(info, rep.Options[len(rep.Options)-1]); diff != "" {
+		t.Errorf("EchoRelayAgentInfo had a diff: %s", diff)
+	}
+}
+
+func TestReload(t *testing.T) {
+	iface, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Errorf("setup for lo failed: %v", err)
+	}
+	l := logger.New(os.Stdout, "testing: ", logger.LevelDebug, false, false)
+
+	conf := &pb.ServerConfig{
+		Network:       "127.0.0.1/16",
+		LeaseDuration: "5m",
+		Dns:           []string{"192.168.1.2"},
+		Client: map[string]*pb.ClientConfig{
+			"01:00:00:00:00:00": &pb.ClientConfig{Ip: "127.0.2.1"},
+		},
+		RelaySubnet: []*pb.ServerConfig{
+			{Network: "10.1.0.0/24", LeaseDuration: "10m"},
+		},
+	}
+	sx, err := New(context.Background(), l, iface, conf, nil)
+	if err != nil {
+		t.Fatalf("New server failed: %v", err)
+	}
+	mac1, _ := net.ParseMAC("01:00:00:00:00:00")
+	mac2, _ := net.ParseMAC("02:00:00:00:00:00")
+
+	// Broken configurations must not change anything.
+	for name, bad := range map[string]*pb.ServerConfig{
+		"parse error":     {Network: "127.0.0.1/16", LeaseDuration: "5 fortnights"},
+		"bad range":       {Network: "127.0.0.1/16", LeaseDuration: "5m", DynamicRange: "127.0.0.10-10.0.0.1"},
+		"network changed": {Network: "127.1.0.1/24", LeaseDuration: "5m"},
+		"relay removed":   {Network: "127.0.0.1/16", LeaseDuration: "5m"},
+		"bad client option": {Network: "127.0.0.1/16", LeaseDuration: "5m", Client: map[string]*pb.ClientConfig{
+			"01:00:00:00:00:00": {Ip: "127.0.2.1", StaticRoute: []string{"bogus"}},
+		}, RelaySubnet: []*pb.ServerConfig{{Network: "10.1.0.0/24", LeaseDuration: "10m"}}},
+	} {
+		if err := sx.Reload(bad); err == nil {
+			t.Errorf("Reload(%s) returned nil err, wanted non-nil", name)
+		}
+	}
+	if ip, err := sx.local.ipdb.LookupClientByDuid(duidFromHwAddr(mac1)); err != nil || !ip.Equal(net.IPv4(127, 0, 2, 1)) {
+		t.Errorf("LookupClientByDuid(mac1) = %v, %v after failed reloads; wanted 127.0.2.1, nil", ip, err)
+	}
+
+	nconf := &pb.ServerConfig{
+		Network:       "127.0.0.1/16",
+		LeaseDuration: "5m",
+		Dns:           []string{"192.168.1.9"},
+		Client: map[string]*pb.ClientConfig{
+			"02:00:00:00:00:00": &pb.ClientConfig{Ip: "127.0.2.2"},
+		},
+		RelaySubnet: []*pb.ServerConfig{
+			{Network: "10.1.0.0/24", LeaseDuration: "20m"},
+		},
+	}
+	if err := sx.Reload(nconf); err != nil {
+		t.Fatalf("Reload() = %v, wanted nil err", err)
+	}
+	if ip, err := sx.local.ipdb.LookupClientByDuid(duidFromHwAddr(mac1)); err == nil {
+		t.Errorf("LookupClientByDuid(mac1) = %v, wanted err for removed client", ip)
+	}
+	if ip, err := sx.local.ipdb.LookupClientByDuid(duidFromHwAddr(mac2)); err != nil || !ip.Equal(net.IPv4(127, 0, 2, 2)) {
+		t.Errorf("LookupClientByDuid(mac2) = %v, %v; wanted 127.0.2.2, nil", ip, err)
+	}
+	if ip, err := sx.local.ipdb.LookupClientByDuid(duidFromHwAddr(iface.HardwareAddr)); err != nil || !ip.Equal(sx.selfIP) {
+		t.Errorf("LookupClientByDuid(self) = %v, %v; wanted %v, nil", ip, err, sx.selfIP)
+	}
+	if diff := cmp.Diff([]net.IP{net.ParseIP("192.168.1.9")}, sx.local.lopts.DNS); diff != "" {
+		t.Errorf("DNS had diff: %s", diff)
+	}
+	if got := sx.relayed[0].lopts.LeaseDuration; got != 20*time.Minute {
+		t.Errorf("relayed LeaseDuration = %v, wanted 20m", got)
+	}
+}
+
+func TestControl(t *testing.T) {
+	iface, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Errorf("setup for lo failed: %v", err)
+	}
+	l := logger.New(os.Stdout, "testing: ", logger.LevelDebug, false, false)
+
+	conf := &pb.ServerConfig{
+		Network:       "127.0.0.1/16",
+		LeaseDuration: "5m",
+		RelaySubnet: []*pb.ServerConfig{
+			{Network: "10.1.0.0/24", LeaseDuration: "10m"},
+		},
+	}
+	sx, err := New(context.Background(), l, iface, conf, nil)
+	if err != nil {
+		t.Fatalf("New server failed: %v", err)
+	}
+	mac, _ := net.ParseMAC("02:00:00:00:00:01")
+	sx.relayed[0].ipdb.UpdateClient(net.IPv4(10, 1, 0, 5), d.Duid{0x01, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x05}, time.Hour)
+
+	if _, err := sx.Control(&ctl.Request{Method: ctl.MethodReserve, IP: net.IPv4(10, 1, 0, 9), MAC: mac.String()}); err != nil {
+		t.Errorf("Control(reserve) = %v, wanted nil err", err)
+	}
+	if _, err := sx.Control(&ctl.Request{Method: ctl.MethodReserve, IP: net.IPv4(10, 9, 0, 9), MAC: mac.String()}); err != ctl.ErrNotFound {
+		t.Errorf("Control(#reserve unmanaged) = %v, wanted ErrNotFound", err)
+	}
+
+	// Reservations survive a reload.
+	if err := sx.Reload(conf); err != nil {
+		t.Fatalf("Reload() = %v, wanted nil err", err)
+	}
+
+	res, err := sx.Control(&ctl.Request{Method: ctl.MethodLeases, MAC: mac.String()})
+	if err != nil || len(res.Leases) != 1 || !res.Leases[0].IP.Equal(net.IPv4(10, 1, 0, 9)) || !res.Leases[0].Permanent {
+		t.Errorf("Control(leases by mac) = %+v, %v; wanted the reservation", res, err)
+	}
+	res, err = sx.Control(&ctl.Request{Method: ctl.MethodLeases, Duid: "01-02-00-00-00-00-00-05"})
+	if err != nil || len(res.Leases) != 1 || !res.Leases[0].IP.Equal(net.IPv4(10, 1, 0, 5)) {
+		t.Errorf("Control(leases by duid) = %+v, %v; wanted lease of 10.1.0.5", res, err)
+	}
+
+	hx, err := hooks.New(l, "", "")
+	if err != nil {
+		t.Fatalf("hooks.New() = %v, wanted nil err", err)
+	}
+	sx.SetHooks(hx)
+	if _, ok := sx.committed.m["10.1.0.5"]; !ok {
+		t.Errorf("SetHooks() did not pick up lease of 10.1.0.5: %+v", sx.committed.m)
+	}
+	if _, err := sx.Control(&ctl.Request{Method: ctl.MethodRevoke, IP: net.IPv4(10, 1, 0, 5)}); err != nil {
+		t.Errorf("Control(revoke) = %v, wanted nil err", err)
+	}
+	if _, ok := sx.committed.m["10.1.0.5"]; ok {
+		t.Errorf("Control(revoke) kept the revoked lease: %+v", sx.committed.m)
+	}
+	// A client without client identifier leases with the duid of its hwaddr: this is no reservation.
+	dmac, _ := net.ParseMAC("02:00:00:00:00:02")
+	sx.relayed[0].ipdb.UpdateClient(net.IPv4(10, 1, 0, 6), duidFromHwAddr(dmac), time.Hour)
+	if _, err := sx.Control(&ctl.Request{Method: ctl.MethodUnreserve, MAC: dmac.String()}); err != ctl.ErrNotFound {
+		t.Errorf("Control(#unreserve dynamic) = %v, wanted ErrNotFound", err)
+	}
+	sx.relayed[0].ipdb.ExpireClient(net.IPv4(10, 1, 0, 6), duidFromHwAddr(dmac))
+	if _, err := sx.Control(&ctl.Request{Method: ctl.MethodUnreserve, MAC: mac.String()}); err != nil {
+		t.Errorf("Control(unreserve) = %v, wanted nil err", err)
+	}
+	res, err = sx.Control(&ctl.Request{Method: ctl.MethodPools})
+	if err != nil || len(res.Pools) != 2 {
+		t.Fatalf("Control(pools) = %+v, %v; wanted 2 pools", res, err)
+	}
+	// Only our own permanent lease is left.
+	if p := res.Pools[1]; p.Network != "10.1.0.0/24" || !p.Relayed || p.Size != 254 || p.Leased != 0 || p.Permanent != 0 {
+		t.Errorf("Control(pools) returned unexpected relayed pool %+v", p)
+	}
+	if p := res.Pools[0]; p.Permanent != 1 {
+		t.Errorf("Control(pools) returned unexpected local pool %+v", p)
+	}
+}
+
+func TestSanitizeHostname(t *testing.T) {
+	input := []struct {
+		in   string
+		want string
+	}{
+		{in: "", want: ""},
+		{in: "android-1234.lan", want: "android-1234.lan"},
+		{in: "bad\x00host\nname; rm -rf /", want: "badhostnamerm-rf"},
+		{in: strings.Repeat("a", 300), want: strings.Repeat("a", maxHostnameLen)},
+	}
+	for _, test := range input {
+		if got := sanitizeHostname(test.in); got != test.want {
+			t.Errorf("sanitizeHostname(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestHwAddrFromDuid(t *testing.T) {
+	mac, _ := net.ParseMAC("02:00:00:00:00:01")
+	input := []struct {
+		duid d.Duid
+		want net.HardwareAddr
+	}{
+		{duid: duidFromHwAddr(mac), want: mac},
+		{duid: append(d.Duid{0x01}, mac...), want: mac},
+		{duid: append(d.Duid{0x00, 0x03, 0x00, 0x01}, mac...)},
+		{duid: d.Duid{0xff, 0x01, 0x02, 0x03, 0x04}},
+	}
+	for _, test := range input {
+		if got := hwAddrFromDuid(test.duid); got.String() != test.want.String() {
+			t.Errorf("hwAddrFromDuid(%s) = %v, want %v", test.duid, got, test.want)
+		}
+	}
+}
+
+func TestExpireLeases(t *testing.T) {
+	iface, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Errorf("setup for lo failed: %v", err)
+	}
+	l := logger.New(os.Stdout, "testing: ", logger.LevelDebug, false, false)
+
+	conf := &pb.ServerConfig{
+		Network:       "127.0.0.1/16",
+		LeaseDuration: "5m",
+	}
+	sx, err := New(context.Background(), l, iface, conf, nil)
+	if err != nil {
+		t.Fatalf("New server failed: %v", err)
+	}
+	mac, _ := net.ParseMAC("02:00:00:00:00:01")
+	ip := net.IPv4(127, 0, 0, 9)
+	sx.local.ipdb.UpdateClient(ip, duidFromHwAddr(mac), time.Minute)
+
+	hx, err := hooks.New(l, "", "")
+	if err != nil {
+		t.Fatalf("hooks.New() = %v, wanted nil err", err)
+	}
+	sx.SetHooks(hx)
+	if ev, ok := sx.committed.m[ip.String()]; !ok || ev.MAC != mac.String() {
+		t.Errorf("SetHooks() did not pick up existing lease of %s: %+v", ip, sx.committed.m)
+	}
+
+	now := time.Now()
+	sx.fire(hooks.EventRenew, mac, ip, duidFromHwAddr(mac), "laptop", now.Add(time.Minute))
+	sx.expireLeases(now)
+	if ev, ok := sx.committed.m[ip.String()]; !ok || ev.Hostname != "laptop" {
+		t.Errorf("expireLeases(now) removed active lease of %s: %+v", ip, sx.committed.m)
+	}
+	sx.expireLeases(now.Add(2 * time.Minute))
+	if len(sx.committed.m) != 0 {
+		t.Errorf("expireLeases(now+2m) kept expired leases: %+v", sx.committed.m)
+	}
+
+	sx.fire(hooks.EventCommit, mac, ip, duidFromHwAddr(mac), "laptop", now.Add(time.Minute))
+	sx.fire(hooks.EventRelease, mac, ip, duidFromHwAddr(mac), "", now)
+	if len(sx.committed.m) != 0 {
+		t.Errorf("Released lease is still tracked: %+v", sx.committed.m)
+	}
+}
+
+func TestCheckRogue(t *testing.T) {
+	iface, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Errorf("setup for lo failed: %v", err)
+	}
+	l := logger.New(os.Stdout, "testing: ", logger.LevelDebug, false, false)
+
+	conf := &pb.ServerConfig{
+		Network:       "127.0.0.1/16",
+		LeaseDuration: "5m",
+		TrustedServer: []string{"127.0.0.9"},
+	}
+	sx, err := New(context.Background(), l, iface, conf, nil)
+	if err != nil {
+		t.Fatalf("New server failed: %v", err)
+	}
+	client, _ := net.ParseMAC("02:00:00:00:00:01")
+	rogue, _ := net.ParseMAC("b8:27:eb:00:00:01")
+	offer := func(server net.IP) dhcpmsg.Message {
+		return replies.Offer(1, 0, server, net.IPv4(127, 0, 1, 1), client, nil)
+	}
+
+	sx.checkRogue(sx.selfIP, iface.HardwareAddr, offer(sx.selfIP))
+	sx.checkRogue(net.IPv4(127, 0, 0, 9), rogue, offer(net.IPv4(127, 0, 0, 9)))
+	sx.checkRogue(net.IPv4(127, 0, 0, 5), rogue, replies.NACK(1, net.IPv4(127, 0, 0, 5), client))
+	if len(sx.rogues.m) != 0 {
+		t.Errorf("checkRogue reported trusted servers or naks: %v", sx.rogues.m)
+	}
+	sx.checkRogue(net.IPv4(127, 0, 0, 5), rogue, offer(net.IPv4(127, 0, 0, 5)))
+	if _, ok := sx.rogues.m["127.0.0.5"]; !ok || len(sx.rogues.m) != 1 {
+		t.Errorf("checkRogue did not report 127.0.0.5: %v", sx.rogues.m)
+	}
+
+	now := time.Now()
+	for _, test := range []struct {
+		offset      time.Duration
+		wantTracked bool
+		wantReport  bool
+	}{
+		{offset: time.Minute, wantTracked: true},
+		{offset: rogueAlertInterval, wantTracked: true, wantReport: true},
+	} {
+		tracked, report := sx.rogues.seen("127.0.0.5", now.Add(test.offset))
+		if tracked != test.wantTracked || report != test.wantReport {
+			t.Errorf("seen(+%s) = %v, %v; want %v, %v", test.offset, tracked, report, test.wantTracked, test.wantReport)
+		}
+	}
+	for i := 0; i < maxRogues; i++ {
+		sx.rogues.seen(fmt.Sprintf("10.0.%d.%d", i/256, i%256), now)
+	}
+	if tracked, _ := sx.rogues.seen("10.1.0.0", now); tracked {
+		t.Errorf("seen() tracked more than %d servers", maxRogues)
+	}
+}
+
+func TestLeaseQuery(t *testing.T) {
+	iface, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Errorf("setup for lo failed: %v", err)
+	}
+	l := logger.New(os.Stdout, "testing: ", logger.LevelDebug, false, false)
+
+	conf := &pb.ServerConfig{
+		Network:             "127.0.0.1/16",
+		LeaseDuration:       "5m",
+		LeasequeryRequester: []string{"127.0.0.9", "10.0.0.0/8"},
+	}
+	sx, err := New(context.Background(), l, iface, conf, nil)
+	if err != nil {
+		t.Fatalf("New server failed: %v", err)
+	}
+	if len(sx.requesters) != 2 || !sx.requesters[0].Contains(net.IPv4(127, 0, 0, 9)) || sx.requesters[0].Contains(net.IPv4(127, 0, 0, 10)) {
+		t.Errorf("parseRequesters = %v, want 127.0.0.9/32 and 10.0.0.0/8", sx.requesters)
+	}
+	if _, err := parseRequesters(&pb.ServerConfig{LeasequeryRequester: []string{"::1"}}); err == nil {
+		t.Errorf("parseRequesters(::1) wanted err, got nil err")
+	}
+
+	mac, _ := net.ParseMAC("02:00:00:00:00:01")
+	cmac, _ := net.ParseMAC("02:00:00:00:00:02")
+	cid := append([]byte{0x01}, cmac...)
+	sx.local.ipdb.UpdateClient(net.IPv4(127, 0, 1, 1), duidFromHwAddr(mac), time.Hour)
+	sx.local.ipdb.UpdateClient(net.IPv4(127, 0, 1, 2), d.Duid(cid), time.Hour)
+	smac, _ := net.ParseMAC("02:00:00:00:00:04")
+	sx.local.ipdb.AddPermanentClient(net.IPv4(127, 0, 1, 4), duidFromHwAddr(smac))
+	sx.local.ipdb.UpdateClient(net.IPv4(127, 0, 1, 4), duidFromHwAddr(smac), time.Hour)
+
+	input := []struct {
+		name     string
+		msg      dhcpmsg.Message
+		opts     dhcpmsg.DecodedOptions
+		wantType uint8
+		wantIP   net.IP
+		wantMAC  net.HardwareAddr
+		wantCid  []byte
+		wantIPs  []net.IP
+	}{
+		{
+			name:     "active ip",
+			msg:      dhcpmsg.Message{ClientIP: net.IPv4(127, 0, 1, 1)},
+			wantType: dhcpmsg.MsgTypeLeaseActive,
+			wantIP:   net.IPv4(127, 0, 1, 1).To4(),
+			wantMAC:  mac,
+		},
+		{
+			name:     "unassigned ip",
+			msg:      dhcpmsg.Message{ClientIP: net.IPv4(127, 0, 1, 3)},
+			wantType: dhcpmsg.MsgTypeLeaseUnassigned,
+			wantIP:   net.IPv4(127, 0, 1, 3).To4(),
+		},
+		{
+			name:     "unknown ip",
+			msg:      dhcpmsg.Message{ClientIP: net.IPv4(10, 0, 0, 1)},
+			wantType: dhcpmsg.MsgTypeLeaseUnknown,
+			wantIP:   net.IPv4(10, 0, 0, 1).To4(),
+		},
+		{
+			name:     "client identifier",
+			opts:     dhcpmsg.DecodedOptions{ClientIdentifier: cid},
+			wantType: dhcpmsg.MsgTypeLeaseActive,
+			wantIP:   net.IPv4(127, 0, 1, 2).To4(),
+			wantMAC:  cmac,
+			wantCid:  cid,
+			wantIPs:  []net.IP{net.IPv4(127, 0, 1, 2).To4()},
+		},
+		{
+			name:     "client identifier of static client",
+			opts:     dhcpmsg.DecodedOptions{ClientIdentifier: append([]byte{0x01}, smac...)},
+			wantType: dhcpmsg.MsgTypeLeaseActive,
+			wantIP:   net.IPv4(127, 0, 1, 4).To4(),
+			wantMAC:  smac,
+			wantIPs:  []net.IP{net.IPv4(127, 0, 1, 4).To4()},
+		},
+		{
+			name:     "hwaddr",
+			msg:      dhcpmsg.Message{ClientMAC: mac},
+			wantType: dhcpmsg.MsgTypeLeaseActive,
+			wantIP:   net.IPv4(127, 0, 1, 1).To4(),
+			wantMAC:  mac,
+			wantIPs:  []net.IP{net.IPv4(127, 0, 1, 1).To4()},
+		},
+		{
+			name:     "unknown hwaddr",
+			msg:      dhcpmsg.Message{ClientMAC: net.HardwareAddr{2, 0, 0, 0, 0, 3}},
+			wantType: dhcpmsg.MsgTypeLeaseUnknown,
+			wantMAC:  net.HardwareAddr{2, 0, 0, 0, 0, 3},
+		},
+	}
+	for _, test := range input {
+		msg := test.msg
+		msg.RelayIP = net.IPv4(127, 0, 0, 9)
+		rep, ok := sx.leaseQuery(yl.New(l, msg, test.opts), time.Now(), msg, test.opts)
+		if !ok {
+			t.Errorf("leaseQuery(%s) = false, want true", test.name)
+			continue
+		}
+		ropts := dhcpmsg.DecodeOptions(rep.Options)
+		if ropts.MessageType != test.wantType || !rep.ClientIP.Equal(test.wantIP) || rep.ClientMAC.String() != test.wantMAC.String() {
+			t.Errorf("leaseQuery(%s) = type %d, ip %s, mac %s; want %d, %s, %s", test.name, ropts.MessageType, rep.ClientIP, rep.ClientMAC, test.wantType, test.wantIP, test.wantMAC)
+		}
+		if diff := cmp.Diff(test.wantCid, ropts.ClientIdentifier); diff != "" {
+			t.Errorf("leaseQuery(%s) had client identifier diff: %s", test.name, diff)
+		}
+		if diff := cmp.Diff(test.wantIPs, ropts.AssociatedIPs); diff != "" {
+			t.Errorf("leaseQuery(%s) had associated IPs diff: %s", test.name, diff)
+		}
+		if test.wantType == dhcpmsg.MsgTypeLeaseActive && (ropts.IPAddressLeaseDuration < 59*time.Minute || ropts.ClientLastTransaction > time.Minute) {
+			t.Errorf("leaseQuery(%s) = duration %s, last transaction %s; want about 1h and 0s", test.name, ropts.IPAddressLeaseDuration, ropts.ClientLastTransaction)
+		}
+	}
+
+	if _, ok := sx.leaseQuery(yl.New(l, dhcpmsg.Message{}, dhcpmsg.DecodedOptions{}), time.Now(), dhcpmsg.Message{}, dhcpmsg.DecodedOptions{}); ok {
+		t.Errorf("leaseQuery(empty) = true, want false")
+	}
 }
@@ -0,0 +1,301 @@
+package server
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/dhcpmsg"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/logger"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/acl"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ipdb"
+	d "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ipdb/duid"
+	lo "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/leaseopts"
+	pb "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/proto"
+)
+
+// subnet is a network served by us, either directly or through a relay agent.
+type subnet struct {
+	ipnet     *net.IPNet                 // The network of this subnet.
+	relayed   bool                       // True if this subnet is only reachable through relay agents.
+	ipdb      *ipdb.IPDB                 // IP database instance.
+	lopts     lo.LeaseOptions            // Default options for leases.
+	overrides map[string]lo.LeaseOptions // Static client configuration, key is a private duid.
+	circuits  []circuit                  // Static configuration by relay agent circuit, also in overrides.
+	classes   []*lo.Class                // Client classes, the first matching one applies.
+	acl       *acl.ACL                   // Decides which clients are served.
+}
+
+// circuit identifies a switch port through the relay agent information option.
+type circuit struct {
+	circuitID []byte // Circuit-id to match.
+	remoteID  []byte // Remote-id to match, any if nil.
+	duid      d.Duid // Private duid owning the lease of the circuit.
+}
+
+// newSubnet constructs a subnet from its configuration.
+func newSubnet(l *logger.Logger, conf *pb.ServerConfig, relayed bool) (*subnet, error) {
+	lopts, ipnet, err := lo.ParseConfig(conf)
+	if err != nil {
+		return nil, fmt.Errorf("config parse error: %v", err)
+	}
+
+	db, err := ipdb.New(ipnet.IP, ipnet.Mask)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build ipdb: %v", err)
+	}
+
+	// Check dynamic range configuration: It is not part of the lease config but a property of ipdb.
+	if dr := conf.GetDynamicRange(); dr != "" {
+		sr := strings.Split(dr, "-")
+		if len(sr) != 2 {
+			return nil, fmt.Errorf("dynamic_range format '%s' invalid. Expected 'start-end'", dr)
+		}
+		ipa := net.ParseIP(sr[0])
+		ipb := net.ParseIP(sr[1])
+		if ipa == nil || ipb == nil {
+			return nil, fmt.Errorf("dynamic_range has invalid IP range: '%s'", dr)
+		}
+		if err := db.SetDynamicRange(ipa, ipb); err != nil {
+			return nil, fmt.Errorf("failed to configure dynamic_range '%s': %v", dr, err)
+		}
+		l.Printf("# [%s] dynamic range restricted to %s", ipnet, dr)
+	}
+
+	// Disable dynamic ranges if desired
+	if conf.GetStaticOnly() {
+		db.DisableDynamic()
+		l.Printf("# [%s] disabling dynamic IP assignment (static_only is 'true'), only static leases will be handed out.", ipnet)
+	}
+
+	// Configure static assignments
+	overrides := make(map[string]lo.LeaseOptions)
+	for k, v := range conf.GetClient() {
+		hwaddr, err := net.ParseMAC(k)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse hwaddr '%s': %v", k, err)
+		}
+		oopts := *lopts
+		if err := lo.SetClientOverrides(&oopts, v); err != nil {
+			return nil, fmt.Errorf("client %s: %v", hwaddr, err)
+		}
+		if oopts.IP != nil {
+			if err := db.AddPermanentClient(oopts.IP, duidFromHwAddr(hwaddr)); err != nil {
+				return nil, fmt.Errorf("could not create permanent lease for %v -> %v: %v", hwaddr, oopts.IP, err)
+			}
+		}
+		if _, ok := overrides[duidFromHwAddr(hwaddr).String()]; ok {
+			return nil, fmt.Errorf("duplicate client override for %v", hwaddr)
+		}
+		l.Printf("# [%s] client override for %s configured.", ipnet, hwaddr)
+		overrides[duidFromHwAddr(hwaddr).String()] = oopts
+	}
+
+	// Configure static assignments by circuit
+	var circuits []circuit
+	for _, cc := range conf.GetCircuit() {
+		c, err := parseCircuit(cc)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := overrides[c.duid.String()]; ok {
+			return nil, fmt.Errorf("duplicate circuit %q", cc.GetCircuitId())
+		}
+		oopts := *lopts
+		if err := lo.SetClientOverrides(&oopts, cc.GetConfig()); err != nil {
+			return nil, fmt.Errorf("circuit %q: %v", cc.GetCircuitId(), err)
+		}
+		if oopts.IP != nil {
+			if err := db.AddPermanentClient(oopts.IP, c.duid); err != nil {
+				return nil, fmt.Errorf("could not create permanent lease for circuit %q -> %v: %v", cc.GetCircuitId(), oopts.IP, err)
+			}
+		}
+		l.Printf("# [%s] circuit override for %q configured.", ipnet, cc.GetCircuitId())
+		overrides[c.duid.String()] = oopts
+		circuits = append(circuits, c)
+	}
+
+	// Configure client classes
+	var classes []*lo.Class
+	for _, cc := range conf.GetClass() {
+		c, err := lo.ParseClass(cc, lopts)
+		if err != nil {
+			return nil, fmt.Errorf("class '%s': %v", cc.GetName(), err)
+		}
+		if c.PoolStart != nil && !(db.InManagedRange(c.PoolStart) && db.InManagedRange(c.PoolEnd)) {
+			return nil, fmt.Errorf("class '%s': dynamic_range is not within %s", c.Name, ipnet)
+		}
+		if c.PoolStart != nil && db.OverlapsDynamicRange(c.PoolStart, c.PoolEnd) {
+			return nil, fmt.Errorf("class '%s': dynamic_range overlaps with the dynamic_range of %s", c.Name, ipnet)
+		}
+		l.Printf("# [%s] client class '%s' configured.", ipnet, c.Name)
+		classes = append(classes, c)
+	}
+
+	// Configure access control
+	ax, err := acl.Parse(conf.GetAccess())
+	if err != nil {
+		return nil, fmt.Errorf("access: %v", err)
+	}
+	if ax.PoolStart != nil {
+		if !(db.InManagedRange(ax.PoolStart) && db.InManagedRange(ax.PoolEnd)) {
+			return nil, fmt.Errorf("access: quarantine_range is not within %s", ipnet)
+		}
+		if db.OverlapsDynamicRange(ax.PoolStart, ax.PoolEnd) {
+			return nil, fmt.Errorf("access: quarantine_range overlaps with the dynamic_range of %s", ipnet)
+		}
+		l.Printf("# [%s] denied and unknown clients are served from quarantine range %s-%s.", ipnet, ax.PoolStart, ax.PoolEnd)
+	}
+	return &subnet{ipnet: ipnet, relayed: relayed, ipdb: db, lopts: *lopts, overrides: overrides, circuits: circuits, classes: classes, acl: ax}, nil
+}
+
+// parseCircuit inspects a proto.CircuitConfig. The duid is derived from the configured ids only, so
+// the lease stays with the circuit.
+func parseCircuit(cc *pb.CircuitConfig) (circuit, error) {
+	var c circuit
+	var err error
+	if c.circuitID, err = parseRelayID(cc.GetCircuitId()); err != nil || len(c.circuitID) == 0 {
+		return c, fmt.Errorf("circuit_id %q invalid: %v", cc.GetCircuitId(), err)
+	}
+	if c.remoteID, err = parseRelayID(cc.GetRemoteId()); err != nil {
+		return c, fmt.Errorf("remote_id %q invalid: %v", cc.GetRemoteId(), err)
+	}
+	// 0x0000 = Reserved/invalid duid type -> this is internal, followed by the length of the circuit-id.
+	duid := append([]byte{0x00, 0x00, uint8(len(c.circuitID))}, c.circuitID...)
+	c.duid = d.Duid(append(duid, c.remoteID...))
+	return c, nil
+}
+
+// parseRelayID parses a circuit-id or remote-id given as text or as hex with a "0x" prefix.
+func parseRelayID(s string) ([]byte, error) {
+	var b []byte
+	var err error
+	if s == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(s, "0x") {
+		b, err = hex.DecodeString(s[2:])
+	} else {
+		b = []byte(s)
+	}
+	if err == nil && len(b) > 255 {
+		err = fmt.Errorf("longer than 255 bytes")
+	}
+	return b, err
+}
+
+// circuitDuid returns the duid of the circuit configuration matching the relay agent information of a
+// request, false if there is none.
+func (sn *subnet) circuitDuid(info *dhcpmsg.RelayAgentInfo) (d.Duid, bool) {
+	if info == nil {
+		return nil, false
+	}
+	for _, c := range sn.circuits {
+		if bytes.Equal(c.circuitID, info.CircuitID) && (c.remoteID == nil || bytes.Equal(c.remoteID, info.RemoteID)) {
+			return c.duid, true
+		}
+	}
+	return nil, false
+}
+
+// known returns true if the client has a static configuration.
+func (sn *subnet) known(clientMAC net.HardwareAddr) bool {
+	_, ok := sn.overrides[duidFromHwAddr(clientMAC).String()]
+	return ok
+}
+
+// clientOptions returns the lease options of a client: the static configuration of its circuit or
+// its own, those of the first matching class or the defaults of the subnet. The class is nil unless the client is a member of one.
+func (sn *subnet) clientOptions(clientMAC net.HardwareAddr, opts dhcpmsg.DecodedOptions) (lo.LeaseOptions, *lo.Class) {
+	if duid, ok := sn.circuitDuid(opts.RelayAgentInfo); ok {
+		return sn.overrides[duid.String()], nil
+	}
+	if ov, ok := sn.overrides[duidFromHwAddr(clientMAC).String()]; ok {
+		return ov, nil
+	}
+	for _, c := range sn.classes {
+		if c.Matches(clientMAC, opts.VendorClass, opts.UserClass, opts.ParametersList) {
+			return c.Options, c
+		}
+	}
+	return sn.lopts, nil
+}
+
+// dhcpOptions assembles a list of dhcp options for a client from the subnet configuration.
+func (sn *subnet) dhcpOptions(clientMAC net.HardwareAddr, copts dhcpmsg.DecodedOptions) []dhcpmsg.DHCPOpt {
+	lopts, _ := sn.clientOptions(clientMAC, copts)
+	opts := []dhcpmsg.DHCPOpt{
+		dhcpmsg.OptionIPAddressLeaseDuration(lopts.LeaseDuration),
+		dhcpmsg.OptionSubnetMask(lopts.Netmask),
+	}
+
+	if lopts.Router != nil {
+		opts = append(opts, dhcpmsg.OptionRouter(lopts.Router))
+	}
+
+	if len(lopts.DNS) > 0 {
+		opts = append(opts, dhcpmsg.OptionDNS(lopts.DNS...))
+	}
+
+	if len(lopts.NTP) > 0 {
+		opts = append(opts, dhcpmsg.OptionNTP(lopts.NTP...))
+	}
+
+	if lopts.Domain != "" {
+		opts = append(opts, dhcpmsg.OptionDomainName(lopts.Domain))
+	}
+
+	if lopts.Hostname != "" {
+		opts = append(opts, dhcpmsg.OptionHostname(lopts.Hostname))
+	}
+
+	if routes := lopts.ClasslessRoutes(); len(routes) > 0 {
+		for _, o := range []dhcpmsg.DHCPOpt{dhcpmsg.OptionClasslessRoutes(routes...), dhcpmsg.OptionMSClasslessRoutes(routes...)} {
+			if (lo.Option{DHCPOpt: o}).Requested(copts.ParametersList) {
+				opts = append(opts, o)
+			}
+		}
+	}
+
+	for _, o := range lopts.Options {
+		if o.Requested(copts.ParametersList) {
+			opts = append(opts, o.DHCPOpt)
+		}
+	}
+	return opts
+}
+
+// bootFile returns the boot server and file to announce to the given client, the file is empty if there is none.
+func (sn *subnet) bootFile(clientMAC net.HardwareAddr, opts dhcpmsg.DecodedOptions) (net.IP, string) {
+	lopts, _ := sn.clientOptions(clientMAC, opts)
+	return lopts.BootFile(opts.ClientArch, opts.VendorClass, opts.UserClass)
+}
+
+// setDefaultNextServer sets the boot server of the subnet, client overrides and classes which have none.
+func (sn *subnet) setDefaultNextServer(ip net.IP) {
+	if sn.lopts.NextServer == nil {
+		sn.lopts.NextServer = ip
+	}
+	for k, ov := range sn.overrides {
+		if ov.NextServer == nil {
+			ov.NextServer = ip
+			sn.overrides[k] = ov
+		}
+	}
+	for _, c := range sn.classes {
+		if c.Options.NextServer == nil {
+			c.Options.NextServer = ip
+		}
+	}
+}
+
+// overlaps returns true if both subnets share any IPs.
+func (sn *subnet) overlaps(other *subnet) bool {
+	return sn.ipnet.Contains(other.ipnet.IP) || other.ipnet.Contains(sn.ipnet.IP)
+}
+
+func (sn *subnet) String() string {
+	return fmt.Sprintf("subnet(net=%s, relayed=%v, lease_opts=%+v, classes=%d)", sn.ipnet, sn.relayed, sn.lopts, len(sn.classes))
+}
@@ -0,0 +1,438 @@
+// Package tftp implements a read-only TFTP server (RFC 1350) with support for the
+// blksize, tsize and timeout options (RFC 2347, 2348 and 2349).
+package tftp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/logger"
+)
+
+const (
+	opRRQ   = 1 // Read request.
+	opWRQ   = 2 // Write request.
+	opDATA  = 3 // Data block.
+	opACK   = 4 // Acknowledgement of a data block.
+	opERROR = 5 // Error, terminates the transfer.
+	opOACK  = 6 // Acknowledgement of requested options.
+)
+
+const (
+	errNotDefined      = 0
+	errFileNotFound    = 1
+	errAccessViolation = 2
+	errIllegalOp       = 4
+	errUnknownTID      = 5
+)
+
+const (
+	// Block size if the client does not request one.
+	defaultBlksize = 512
+	// Range of block sizes a client may request.
+	minBlksize = 8
+	maxBlksize = 65464
+	// Retransmission timeout if the client does not request one.
+	defaultTimeout = 2 * time.Second
+	// Number of times a packet is sent before giving up.
+	maxRetries = 5
+	// Largest request we accept.
+	maxRequestSize = 2048
+)
+
+var (
+	errOutsideRoot = errors.New("path is outside of the root directory")
+	errNotRegular  = errors.New("not a regular file")
+)
+
+// Server serves files below a root directory.
+type Server struct {
+	l    *logger.Logger
+	root string // Absolute path of the directory to serve, without symlinks.
+}
+
+// request is a parsed read or write request.
+type request struct {
+	op       uint16
+	filename string
+	mode     string
+	options  map[string]string // Requested options, names are lowercase.
+}
+
+// transfer is a single file transfer to a client.
+type transfer struct {
+	conn    *net.UDPConn  // Socket of this transfer, its port is our transfer ID.
+	raddr   *net.UDPAddr  // Address of the client.
+	blksize int           // Negotiated block size.
+	timeout time.Duration // Negotiated retransmission timeout.
+}
+
+// New returns a server for the files below root.
+func New(l *logger.Logger, root string) (*Server, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if abs, err = filepath.EvalSymlinks(abs); err != nil {
+		return nil, err
+	}
+	if fi, err := os.Stat(abs); err != nil {
+		return nil, err
+	} else if !fi.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", abs)
+	}
+	return &Server{l: l, root: abs}, nil
+}
+
+// Root returns the directory served by this server.
+func (s *Server) Root() string {
+	return s.root
+}
+
+// ListenAndServe listens on the given UDP address and serves requests until the context is done.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	conn, err := net.ListenPacket("udp4", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, conn)
+}
+
+// Serve answers requests received on conn until the context is done. Conn is closed on return.
+func (s *Server) Serve(ctx context.Context, conn net.PacketConn) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	var localIP net.IP
+	if ua, ok := conn.LocalAddr().(*net.UDPAddr); ok {
+		localIP = ua.IP
+	}
+
+	buf := make([]byte, maxRequestSize)
+	for {
+		nr, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				// Regular shutdown.
+				return nil
+			}
+			return err
+		}
+		raddr, ok := addr.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+
+		req, err := parseRequest(buf[:nr])
+		if err != nil {
+			s.l.Warnf("TFTP: Dropping malformed request from %s: %v", raddr, err)
+			conn.WriteTo(errorPacket(errIllegalOp, "malformed request"), raddr)
+			continue
+		}
+		if req.op == opWRQ {
+			s.l.Warnf("TFTP: Refusing write of '%s' by %s", req.filename, raddr)
+			conn.WriteTo(errorPacket(errAccessViolation, "server is read-only"), raddr)
+			continue
+		}
+		go s.serveFile(ctx, localIP, raddr, req)
+	}
+}
+
+// serveFile sends the requested file to the client from a new socket.
+func (s *Server) serveFile(ctx context.Context, localIP net.IP, raddr *net.UDPAddr, req *request) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: localIP})
+	if err != nil {
+		s.l.Errorf("TFTP: Failed to open transfer socket for %s: %v", raddr, err)
+		return
+	}
+	defer conn.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	t := &transfer{conn: conn, raddr: raddr, blksize: defaultBlksize, timeout: defaultTimeout}
+	if req.mode != "octet" && req.mode != "netascii" {
+		s.l.Warnf("TFTP: %s requested '%s' in unsupported mode '%s'", raddr, req.filename, req.mode)
+		t.sendError(errIllegalOp, "unsupported mode")
+		return
+	}
+
+	fh, size, err := s.open(req.filename)
+	if err != nil {
+		s.l.Warnf("TFTP: %s requested '%s': %v", raddr, req.filename, err)
+		if os.IsNotExist(err) {
+			t.sendError(errFileNotFound, "file not found")
+		} else {
+			t.sendError(errAccessViolation, "access violation")
+		}
+		return
+	}
+	defer fh.Close()
+
+	var r io.Reader = fh
+	if req.mode == "netascii" {
+		// The transferred size is unknown in advance.
+		r = newNetasciiReader(fh)
+		size = -1
+	}
+
+	oack := t.negotiate(req.options, size)
+	s.l.Printf("TFTP: Sending '%s' to %s (blksize=%d, timeout=%s)", req.filename, raddr, t.blksize, t.timeout)
+	start := time.Now()
+	n, err := t.send(r, oack)
+	if err != nil {
+		s.l.Errorf("TFTP: Transfer of '%s' to %s failed after %d bytes: %v", req.filename, raddr, n, err)
+		return
+	}
+	s.l.Printf("TFTP: Sent '%s' to %s (%d bytes in %s)", req.filename, raddr, n, time.Since(start).Round(time.Millisecond))
+}
+
+// open opens a regular file below the root directory and returns it with its size.
+func (s *Server) open(name string) (*os.File, int64, error) {
+	path, err := s.resolve(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	fi, err := fh.Stat()
+	if err != nil {
+		fh.Close()
+		return nil, 0, err
+	}
+	if !fi.Mode().IsRegular() {
+		fh.Close()
+		return nil, 0, errNotRegular
+	}
+	return fh, fi.Size(), nil
+}
+
+// resolve maps a requested file name to a path below the root directory.
+// Symlinks are followed but must not lead out of the root directory.
+func (s *Server) resolve(name string) (string, error) {
+	// Some clients use DOS style paths.
+	name = strings.ReplaceAll(name, `\`, "/")
+	path, err := filepath.EvalSymlinks(filepath.Join(s.root, filepath.Clean("/"+name)))
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(s.root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", errOutsideRoot
+	}
+	return path, nil
+}
+
+// negotiate applies the supported options requested by the client.
+// It returns the OACK to send, nil if no option was accepted. A negative size is not announced.
+func (t *transfer) negotiate(options map[string]string, size int64) []byte {
+	var oack []byte
+	add := func(name, value string) {
+		oack = append(append(oack, name...), 0)
+		oack = append(append(oack, value...), 0)
+	}
+
+	if v, ok := options["blksize"]; ok {
+		if n, err := strconv.Atoi(v); err == nil && n >= minBlksize {
+			if n > maxBlksize {
+				n = maxBlksize
+			}
+			t.blksize = n
+			add("blksize", strconv.Itoa(n))
+		}
+	}
+	if v, ok := options["timeout"]; ok {
+		if n, err := strconv.Atoi(v); err == nil && n >= 1 && n <= 255 {
+			t.timeout = time.Duration(n) * time.Second
+			add("timeout", strconv.Itoa(n))
+		}
+	}
+	if _, ok := options["tsize"]; ok && size >= 0 {
+		add("tsize", strconv.FormatInt(size, 10))
+	}
+
+	if oack == nil {
+		return nil
+	}
+	return append([]byte{0, opOACK}, oack...)
+}
+
+// send transfers all data of r to the client, starting with the OACK if any.
+// It returns the number of bytes acknowledged by the client.
+func (t *transfer) send(r io.Reader, oack []byte) (int64, error) {
+	if oack != nil {
+		if err := t.exchange(oack, 0); err != nil {
+			return 0, err
+		}
+	}
+
+	var sent int64
+	buf := make([]byte, 4+t.blksize)
+	binary.BigEndian.PutUint16(buf, opDATA)
+	// Block numbers wrap around for files of more than 65535 blocks.
+	for block := uint16(1); ; block++ {
+		n, err := io.ReadFull(r, buf[4:])
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			t.sendError(errNotDefined, "read error")
+			return sent, err
+		}
+		binary.BigEndian.PutUint16(buf[2:], block)
+		if err := t.exchange(buf[:4+n], block); err != nil {
+			return sent, err
+		}
+		sent += int64(n)
+		if n < t.blksize {
+			return sent, nil
+		}
+	}
+}
+
+// exchange sends pkt and waits until the client acknowledges block, retransmitting pkt on timeouts.
+func (t *transfer) exchange(pkt []byte, block uint16) error {
+	buf := make([]byte, maxRequestSize)
+	for try := 0; try < maxRetries; try++ {
+		if _, err := t.conn.WriteToUDP(pkt, t.raddr); err != nil {
+			return err
+		}
+
+		t.conn.SetReadDeadline(time.Now().Add(t.timeout))
+		for {
+			nr, addr, err := t.conn.ReadFromUDP(buf)
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if !addr.IP.Equal(t.raddr.IP) || addr.Port != t.raddr.Port {
+				t.conn.WriteToUDP(errorPacket(errUnknownTID, "unknown transfer id"), addr)
+				continue
+			}
+			if nr < 4 {
+				continue
+			}
+
+			switch binary.BigEndian.Uint16(buf) {
+			case opACK:
+				if binary.BigEndian.Uint16(buf[2:]) == block {
+					return nil
+				}
+				// Duplicate ACKs are ignored: answering them would double
+				// the traffic for the rest of the transfer (sorcerer's apprentice syndrome).
+			case opERROR:
+				msg := bytes.TrimRight(buf[4:nr], "\x00")
+				return fmt.Errorf("client sent error %d: %s", binary.BigEndian.Uint16(buf[2:]), msg)
+			default:
+				t.sendError(errIllegalOp, "illegal operation")
+				return fmt.Errorf("unexpected opcode %d", binary.BigEndian.Uint16(buf))
+			}
+		}
+	}
+	return fmt.Errorf("timeout waiting for ack of block %d", block)
+}
+
+// sendError sends an error to the client, which terminates the transfer.
+func (t *transfer) sendError(code uint16, msg string) {
+	t.conn.WriteToUDP(errorPacket(code, msg), t.raddr)
+}
+
+// parseRequest decodes a read or write request.
+func parseRequest(b []byte) (*request, error) {
+	if len(b) < 2 {
+		return nil, fmt.Errorf("short packet")
+	}
+	op := binary.BigEndian.Uint16(b)
+	if op != opRRQ && op != opWRQ {
+		return nil, fmt.Errorf("unexpected opcode %d", op)
+	}
+	if len(b) < 3 || b[len(b)-1] != 0 {
+		return nil, fmt.Errorf("request is not NUL terminated")
+	}
+
+	fields := strings.Split(string(b[2:len(b)-1]), "\x00")
+	if len(fields) < 2 || len(fields)%2 != 0 {
+		return nil, fmt.Errorf("bad number of fields: %d", len(fields))
+	}
+	if fields[0] == "" {
+		return nil, fmt.Errorf("empty file name")
+	}
+
+	req := &request{op: op, filename: fields[0], mode: strings.ToLower(fields[1]), options: map[string]string{}}
+	for i := 2; i < len(fields); i += 2 {
+		req.options[strings.ToLower(fields[i])] = fields[i+1]
+	}
+	return req, nil
+}
+
+// errorPacket assembles an ERROR packet.
+func errorPacket(code uint16, msg string) []byte {
+	b := make([]byte, 4, 5+len(msg))
+	binary.BigEndian.PutUint16(b, opERROR)
+	binary.BigEndian.PutUint16(b[2:], code)
+	return append(append(b, msg...), 0)
+}
+
+// netasciiReader converts a file to netascii: LF becomes CR LF and CR becomes CR NUL.
+type netasciiReader struct {
+	r    *bufio.Reader
+	next []byte // Converted bytes not yet returned.
+}
+
+func newNetasciiReader(r io.Reader) *netasciiReader {
+	return &netasciiReader{r: bufio.NewReader(r)}
+}
+
+func (nr *netasciiReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(nr.next) > 0 {
+			p[n] = nr.next[0]
+			nr.next = nr.next[1:]
+			n++
+			continue
+		}
+		c, err := nr.r.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+		switch c {
+		case '\n':
+			p[n] = '\r'
+			nr.next = []byte{'\n'}
+		case '\r':
+			p[n] = '\r'
+			nr.next = []byte{0}
+		default:
+			p[n] = c
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,292 @@
+package tftp
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/logger"
+)
+
+// testServer serves a temporary root directory with a few files on localhost.
+func testServer(t *testing.T) (*Server, *net.UDPAddr) {
+	dir, err := ioutil.TempDir("", "tftp")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	root := filepath.Join(dir, "root")
+	os.Mkdir(root, 0700)
+	os.Mkdir(filepath.Join(root, "efi"), 0700)
+	ioutil.WriteFile(filepath.Join(dir, "secret"), []byte("secret"), 0600)
+	ioutil.WriteFile(filepath.Join(root, "efi", "ipxe.efi"), bytes.Repeat([]byte{'x'}, 1030), 0600)
+	ioutil.WriteFile(filepath.Join(root, "exact"), bytes.Repeat([]byte{'y'}, 1024), 0600)
+	ioutil.WriteFile(filepath.Join(root, "text"), []byte("a\nb\r"), 0600)
+	os.Symlink(filepath.Join(dir, "secret"), filepath.Join(root, "escape"))
+	os.Symlink(filepath.Join(root, "exact"), filepath.Join(root, "inside"))
+
+	s, err := New(logger.New(os.Stdout, "testing: ", logger.LevelDebug, false, false), root)
+	if err != nil {
+		t.Fatalf("New(%s) = %v, wanted nil err", root, err)
+	}
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go s.Serve(ctx, conn)
+	return s, conn.LocalAddr().(*net.UDPAddr)
+}
+
+// get fetches a file, returning its content and the options acknowledged by the server.
+func get(t *testing.T, addr *net.UDPAddr, name, mode string, options ...string) ([]byte, []string, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+	defer conn.Close()
+
+	rrq := append([]byte{0, opRRQ}, name...)
+	rrq = append(append(append(rrq, 0), mode...), 0)
+	for _, o := range options {
+		rrq = append(append(rrq, o...), 0)
+	}
+	conn.WriteToUDP(rrq, addr)
+
+	var data []byte
+	var oack []string
+	blksize := defaultBlksize
+	buf := make([]byte, 70000)
+	for {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		nr, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch binary.BigEndian.Uint16(buf) {
+		case opOACK:
+			oack = splitFields(buf[2:nr])
+			for i := 0; i+1 < len(oack); i += 2 {
+				if oack[i] == "blksize" {
+					blksize = atoi(oack[i+1])
+				}
+			}
+			conn.WriteToUDP([]byte{0, opACK, 0, 0}, from)
+		case opDATA:
+			data = append(data, buf[4:nr]...)
+			conn.WriteToUDP([]byte{0, opACK, buf[2], buf[3]}, from)
+			if nr-4 < blksize {
+				return data, oack, nil
+			}
+		case opERROR:
+			return nil, nil, &tftpError{code: binary.BigEndian.Uint16(buf[2:])}
+		}
+	}
+}
+
+type tftpError struct {
+	code uint16
+}
+
+func (e *tftpError) Error() string {
+	return "tftp error"
+}
+
+func splitFields(b []byte) []string {
+	var res []string
+	for _, f := range bytes.Split(bytes.TrimRight(b, "\x00"), []byte{0}) {
+		res = append(res, string(f))
+	}
+	return res
+}
+
+func atoi(s string) (n int) {
+	for _, c := range s {
+		n = n*10 + int(c-'0')
+	}
+	return
+}
+
+func TestTransfer(t *testing.T) {
+	_, addr := testServer(t)
+
+	input := []struct {
+		name     string
+		file     string
+		mode     string
+		options  []string
+		wantData []byte
+		wantOACK []string
+		wantCode uint16
+	}{
+		{
+			name:     "plain",
+			file:     "efi/ipxe.efi",
+			mode:     "octet",
+			wantData: bytes.Repeat([]byte{'x'}, 1030),
+		},
+		{
+			name:     "options",
+			file:     "/efi/ipxe.efi",
+			mode:     "OCTET",
+			options:  []string{"tsize", "0", "blksize", "1024", "timeout", "3", "unknown", "1"},
+			wantData: bytes.Repeat([]byte{'x'}, 1030),
+			wantOACK: []string{"blksize", "1024", "timeout", "3", "tsize", "1030"},
+		},
+		{
+			name:     "exact multiple of blksize",
+			file:     "exact",
+			mode:     "octet",
+			wantData: bytes.Repeat([]byte{'y'}, 1024),
+		},
+		{
+			name:     "dos path",
+			file:     `\efi\ipxe.efi`,
+			mode:     "octet",
+			wantData: bytes.Repeat([]byte{'x'}, 1030),
+		},
+		{
+			name:     "symlink inside root",
+			file:     "inside",
+			mode:     "octet",
+			wantData: bytes.Repeat([]byte{'y'}, 1024),
+		},
+		{
+			name:     "netascii",
+			file:     "text",
+			mode:     "netascii",
+			options:  []string{"tsize", "0"},
+			wantData: []byte("a\r\nb\r\x00"),
+		},
+		{
+			name:     "missing",
+			file:     "nope",
+			mode:     "octet",
+			wantCode: errFileNotFound,
+		},
+		{
+			name:     "traversal",
+			file:     "../secret",
+			mode:     "octet",
+			wantCode: errFileNotFound,
+		},
+		{
+			name:     "symlink escape",
+			file:     "escape",
+			mode:     "octet",
+			wantCode: errAccessViolation,
+		},
+		{
+			name:     "directory",
+			file:     "efi",
+			mode:     "octet",
+			wantCode: errAccessViolation,
+		},
+		{
+			name:     "bad mode",
+			file:     "exact",
+			mode:     "mail",
+			wantCode: errIllegalOp,
+		},
+	}
+	for _, test := range input {
+		data, oack, err := get(t, addr, test.file, test.mode, test.options...)
+		if test.wantCode != 0 {
+			if te, ok := err.(*tftpError); !ok || te.code != test.wantCode {
+				t.Errorf("get(%s) = %v, wanted error code %d", test.name, err, test.wantCode)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("get(%s) = %v, wanted nil err", test.name, err)
+			continue
+		}
+		if diff := cmp.Diff(test.wantData, data); diff != "" {
+			t.Errorf("get(%s) had data diff: %s", test.name, diff)
+		}
+		if diff := cmp.Diff(test.wantOACK, oack); diff != "" {
+			t.Errorf("get(%s) had oack diff: %s", test.name, diff)
+		}
+	}
+}
+
+func TestWriteRefused(t *testing.T) {
+	_, addr := testServer(t)
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+	defer conn.Close()
+	conn.WriteToUDP([]byte("\x00\x02upload\x00octet\x00"), addr)
+
+	buf := make([]byte, 512)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	nr, _, err := conn.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("ReadFromUDP = %v, wanted nil err", err)
+	}
+	if nr < 4 || binary.BigEndian.Uint16(buf) != opERROR || binary.BigEndian.Uint16(buf[2:]) != errAccessViolation {
+		t.Errorf("WRQ got reply %v, wanted access violation", buf[:nr])
+	}
+}
+
+func TestParseRequest(t *testing.T) {
+	input := []struct {
+		name    string
+		data    string
+		want    *request
+		wantErr bool
+	}{
+		{
+			name: "rrq",
+			data: "\x00\x01pxelinux.0\x00octet\x00",
+			want: &request{op: opRRQ, filename: "pxelinux.0", mode: "octet", options: map[string]string{}},
+		},
+		{
+			name: "options",
+			data: "\x00\x01a\x00NetASCII\x00BLKSIZE\x001468\x00tsize\x000\x00",
+			want: &request{op: opRRQ, filename: "a", mode: "netascii", options: map[string]string{"blksize": "1468", "tsize": "0"}},
+		},
+		{
+			name:    "unterminated",
+			data:    "\x00\x01a\x00octet",
+			wantErr: true,
+		},
+		{
+			name:    "missing mode",
+			data:    "\x00\x01a\x00",
+			wantErr: true,
+		},
+		{
+			name:    "dangling option",
+			data:    "\x00\x01a\x00octet\x00blksize\x00",
+			wantErr: true,
+		},
+		{
+			name:    "data",
+			data:    "\x00\x03\x00\x01",
+			wantErr: true,
+		},
+	}
+	for _, test := range input {
+		req, err := parseRequest([]byte(test.data))
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseRequest(%s) = %v, wantErr %v", test.name, err, test.wantErr)
+			continue
+		}
+		if diff := cmp.Diff(test.want, req, cmp.AllowUnexported(request{})); diff != "" {
+			t.Errorf("parseRequest(%s) had diff: %s", test.name, diff)
+		}
+	}
+}
@@ -18,13 +18,30 @@ func (sx *server) arpVerify(hw net.HardwareAddr) func(context.Context, net.IP) b
 			v, err := arpping.Ping(ctx, sx.iface, sx.selfIP, ip)
 			if err == nil {
 				// Consider this to be 'free' if the reported mac matches the client.
-				return bytes.Equal(v, hw)
+				if bytes.Equal(v, hw) {
+					mProbes.Inc(sx.iface.Name, "client")
+					return true
+				}
+				mProbes.Inc(sx.iface.Name, "taken")
+				return false
 			}
 		}
+		mProbes.Inc(sx.iface.Name, "free")
 		return true
 	}
 }
 
+// probe returns a function to check if an IP in the given subnet is free.
+func (sx *server) probe(sn *subnet, hw net.HardwareAddr) func(context.Context, net.IP) bool {
+	if sn.relayed {
+		// We can not ARP into remote networks: rely on our own bookkeeping.
+		return func(context.Context, net.IP) bool {
+			return true
+		}
+	}
+	return sx.arpVerify(hw)
+}
+
 // sendUnicast sends given payload to an hwaddr / ip destination.
 func (sx *server) sendUnicast(hwaddr net.HardwareAddr, payload []byte) error {
 	ss, err := rsocks.GetUnicastSendSock(sx.iface, hwaddr)
@@ -36,10 +53,21 @@ func (sx *server) sendUnicast(hwaddr net.HardwareAddr, payload []byte) error {
 	return nil
 }
 
+// sendRouted sends given IPv4 packet to its destination, using the routing table of the kernel.
+func (sx *server) sendRouted(payload []byte) error {
+	ss, err := rsocks.GetRoutedSendSock()
+	if err != nil {
+		return err
+	}
+	defer ss.Close()
+	_, err = ss.Write(payload)
+	return err
+}
+
 // getDuid returns the duid to use for this client, based on the static assignements config.
-func (sx *server) getDuid(hwaddr net.HardwareAddr, cid []byte) d.Duid {
+func (sx *server) getDuid(sn *subnet, hwaddr net.HardwareAddr, cid []byte) d.Duid {
 	sduid := duidFromHwAddr(hwaddr)
-	if _, err := sx.ipdb.LookupClientByDuid(sduid); err == nil {
+	if _, err := sn.ipdb.LookupClientByDuid(sduid); err == nil {
 		// Found client with our own internal duid representation, most likely
 		// due to a static assignment, so we use the internal version.
 		return sduid
@@ -52,9 +80,47 @@ func (sx *server) getDuid(hwaddr net.HardwareAddr, cid []byte) d.Duid {
 	return d.Duid(cid)
 }
 
+// maxHostnameLen is the maximum length of a hostname as defined by RFC 1035.
+const maxHostnameLen = 255
+
+// sanitizeHostname returns a client supplied hostname with all characters not allowed in hostnames removed.
+func sanitizeHostname(hn string) string {
+	var res []byte
+	for i := 0; i < len(hn) && len(res) < maxHostnameLen; i++ {
+		c := hn[i]
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '-' || c == '.' || c == '_' {
+			res = append(res, c)
+		}
+	}
+	return string(res)
+}
+
+// isSet returns true if the IP is neither nil nor 0.0.0.0.
+func isSet(ip net.IP) bool {
+	return ip != nil && !ip.Equal(net.IPv4zero)
+}
+
+// hwAddrFromDuid returns the hwaddr of our internal duids and of client identifiers
+// with an ethernet address, nil for all other duids.
+func hwAddrFromDuid(duid d.Duid) net.HardwareAddr {
+	if len(duid) == 10 && bytes.Equal(duid[0:4], []byte{0x00, 0x03, 0x00, 0x00}) {
+		return net.HardwareAddr(duid[4:])
+	}
+	if len(duid) == 7 && duid[0] == 0x01 {
+		return net.HardwareAddr(duid[1:])
+	}
+	return nil
+}
+
 // duidFromHwAddr constructs a duid for internal use from a plain hwaddr.
 func duidFromHwAddr(hw net.HardwareAddr) d.Duid {
 	// 0x0003 = DUID-LL
 	// 0x0000 = Reserved/invalid hw type -> this is internal.
 	return d.Duid(append([]byte{0x00, 0x03, 0x00, 0x00}, hw...))
 }
+
+// isInternalDuid returns true for duids constructed by us, which are not client identifiers.
+func isInternalDuid(duid d.Duid) bool {
+	// DUID-LL with the reserved hw type of duidFromHwAddr or the reserved type of circuit duids.
+	return bytes.HasPrefix(duid, []byte{0x00, 0x03, 0x00, 0x00}) || bytes.HasPrefix(duid, []byte{0x00, 0x00})
+}
@@ -2,26 +2,56 @@ package ylog
 
 import (
 	"fmt"
-	"log"
 
 	"git.sr.ht/~adrian-blx/psa-dhcp/lib/dhcpmsg"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/logger"
 	"git.sr.ht/~adrian-blx/psa-dhcp/lib/oui"
 )
 
+// Ylog logs the handling of a single message, tagged with the hwaddr and vendor of the client.
 type Ylog struct {
-	l *log.Logger
-	s string
+	l *logger.Logger
 }
 
-func New(l *log.Logger, msg dhcpmsg.Message, opts dhcpmsg.DecodedOptions) *Ylog {
+func New(l *logger.Logger, msg dhcpmsg.Message, opts dhcpmsg.DecodedOptions) *Ylog {
 	vid := "UNKNOWN VENDOR"
-	if res, ok := oui.Lookup(msg.ClientMAC); ok {
+	res, ok := oui.Lookup(msg.ClientMAC)
+	if ok {
 		vid = res
 	}
 	s := fmt.Sprintf("[%s] <%-18s> ", msg.ClientMAC, vid)
-	return &Ylog{l: l, s: s}
+	l = l.WithTag(s,
+		"xid", fmt.Sprintf("0x%08x", msg.Xid),
+		"mac", msg.ClientMAC,
+		"vendor", res,
+		"msg_type", dhcpmsg.MsgTypeName(opts.MessageType))
+	return &Ylog{l: l}
+}
+
+// With returns a Ylog adding the given key value pairs to its messages.
+func (yl *Ylog) With(kv ...interface{}) *Ylog {
+	return &Ylog{l: yl.l.With(kv...)}
 }
 
 func (yl *Ylog) Printf(fmt string, args ...interface{}) {
-	yl.l.Printf(yl.s+fmt, args...)
+	yl.l.Printf(fmt, args...)
+}
+
+func (yl *Ylog) Debugf(fmt string, args ...interface{}) {
+	yl.l.Debugf(fmt, args...)
+}
+
+func (yl *Ylog) Errorf(fmt string, args ...interface{}) {
+	yl.l.Errorf(fmt, args...)
+}
+
+// Decidef logs how the message was answered, eg. with an 'offer' or a 'nak'.
+func (yl *Ylog) Decidef(decision, fmt string, args ...interface{}) {
+	yl.l.With("decision", decision).Infof(fmt, args...)
+}
+
+// Dropf logs why the message gets dropped. Routine drops should be logged below LevelWarn,
+// which is meant for malformed or suspicious messages and for failures on our side.
+func (yl *Ylog) Dropf(lv logger.Level, fmt string, args ...interface{}) {
+	yl.l.With("decision", "drop").Logf(lv, fmt, args...)
 }
@@ -0,0 +1,142 @@
+package server6
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net"
+	"sync"
+	"time"
+
+	d "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ipdb/duid"
+)
+
+// maxProbes is the number of pool entries tried to find a free one.
+const maxProbes = 4096
+
+// Kinds of bindings.
+const (
+	kindAddr   = 'a' // Address of an IA_NA.
+	kindPrefix = 'p' // Prefix of an IA_PD.
+)
+
+// binding binds an address or prefix to an IA of a client.
+type binding struct {
+	key   string     // Kind, duid and IAID of the IA.
+	duid  d.Duid     // Client holding the binding.
+	net   *net.IPNet // Address (/128) or prefix.
+	until time.Time  // End of the valid lifetime.
+}
+
+// bindings holds all bindings of a server, in memory.
+type bindings struct {
+	sync.Mutex
+	byKey    map[string]*binding // Bindings by IA.
+	byNet    map[string]*binding // Bindings by address or prefix.
+	reserved map[string]bool     // Addresses and prefixes of static clients.
+}
+
+func newBindings(reserved map[string]bool) *bindings {
+	return &bindings{byKey: make(map[string]*binding), byNet: make(map[string]*binding), reserved: reserved}
+}
+
+func bindingKey(kind byte, duid d.Duid, iaid uint32) string {
+	return fmt.Sprintf("%c/%s/%d", kind, duid, iaid)
+}
+
+// assign binds an address or prefix to an IA until the given time and returns it. The existing binding of
+// the IA is kept, unless static is set and differs. Otherwise static, hint and a hash of the IA are tried.
+// A binding is never shortened.
+func (bx *bindings) assign(kind byte, px *pool, static, hint *net.IPNet, duid d.Duid, iaid uint32, now, until time.Time) (*net.IPNet, error) {
+	bx.Lock()
+	defer bx.Unlock()
+
+	key := bindingKey(kind, duid, iaid)
+	if b, ok := bx.byKey[key]; ok && b.until.After(now) && (static == nil || static.String() == b.net.String()) {
+		if until.After(b.until) {
+			b.until = until
+		}
+		return b.net, nil
+	}
+	bx.remove(key)
+
+	n := bx.find(px, static, hint, key, now)
+	if n == nil {
+		return nil, fmt.Errorf("no free entry in pool")
+	}
+	b := &binding{key: key, duid: duid, net: n, until: until}
+	bx.byKey[key] = b
+	bx.byNet[n.String()] = b
+	return n, nil
+}
+
+func (bx *bindings) find(px *pool, static, hint *net.IPNet, key string, now time.Time) *net.IPNet {
+	if static != nil {
+		if bx.free(static, now) {
+			return static
+		}
+		// Static entries are never assigned from the pool.
+		return nil
+	}
+	if px == nil {
+		return nil
+	}
+	if hint != nil && px.contains(hint) && !bx.reserved[hint.String()] && bx.free(hint, now) {
+		return hint
+	}
+	// Clients get the same entry for as long as it is free.
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	start := h.Sum64() % px.size
+	for i := uint64(0); i < px.size && i < maxProbes; i++ {
+		n := px.nth((start + i) % px.size)
+		if !bx.reserved[n.String()] && bx.free(n, now) {
+			return n
+		}
+	}
+	return nil
+}
+
+// free returns true if n is not bound, expired bindings are removed.
+func (bx *bindings) free(n *net.IPNet, now time.Time) bool {
+	b, ok := bx.byNet[n.String()]
+	if ok && !b.until.After(now) {
+		bx.remove(b.key)
+		return true
+	}
+	return !ok
+}
+
+// release removes the binding of an IA, returns false if there was none for n.
+func (bx *bindings) release(kind byte, duid d.Duid, iaid uint32, n *net.IPNet) bool {
+	bx.Lock()
+	defer bx.Unlock()
+
+	key := bindingKey(kind, duid, iaid)
+	if b, ok := bx.byKey[key]; !ok || b.net.String() != n.String() {
+		return false
+	}
+	bx.remove(key)
+	return true
+}
+
+func (bx *bindings) remove(key string) {
+	if b, ok := bx.byKey[key]; ok {
+		delete(bx.byNet, b.net.String())
+		delete(bx.byKey, key)
+	}
+}
+
+// expire removes all expired bindings and returns their count.
+func (bx *bindings) expire(now time.Time) int {
+	bx.Lock()
+	defer bx.Unlock()
+
+	n := 0
+	for k, b := range bx.byKey {
+		if !b.until.After(now) {
+			bx.remove(k)
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,188 @@
+package server6
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/dhcp6msg"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/logger"
+	d "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ipdb/duid"
+)
+
+// msgTypeNames are the names of message types used in log messages.
+var msgTypeNames = map[uint8]string{
+	dhcp6msg.MsgTypeSolicit:            "SOLICIT",
+	dhcp6msg.MsgTypeRequest:            "REQUEST",
+	dhcp6msg.MsgTypeConfirm:            "CONFIRM",
+	dhcp6msg.MsgTypeRenew:              "RENEW",
+	dhcp6msg.MsgTypeRebind:             "REBIND",
+	dhcp6msg.MsgTypeRelease:            "RELEASE",
+	dhcp6msg.MsgTypeDecline:            "DECLINE",
+	dhcp6msg.MsgTypeInformationRequest: "INFORMATION-REQUEST",
+}
+
+// handleMsg returns the reply to a client message, false if it must not be answered.
+func (sx *server) handleMsg(now time.Time, msg dhcp6msg.Message) (dhcp6msg.Message, bool) {
+	opts := dhcp6msg.DecodeOptions(msg.Options)
+	name, ok := msgTypeNames[msg.MsgType]
+	if !ok {
+		// Server messages or messages we do not know.
+		return dhcp6msg.Message{}, false
+	}
+	duid := d.Duid(opts.ClientID)
+	l := sx.l.With("xid", fmt.Sprintf("0x%06x", msg.Xid), "duid", duid, "msg_type", strings.ToLower(name))
+
+	// Messages which must (not) be sent to us specifically.
+	switch msg.MsgType {
+	case dhcp6msg.MsgTypeSolicit, dhcp6msg.MsgTypeRebind, dhcp6msg.MsgTypeConfirm:
+		if opts.ServerID != nil {
+			l.With("decision", "drop").Warnf("%s: message of %s carries a server id, dropping.", name, duid)
+			return dhcp6msg.Message{}, false
+		}
+	case dhcp6msg.MsgTypeInformationRequest:
+		if opts.ServerID != nil && !bytes.Equal(opts.ServerID, sx.duid) {
+			return dhcp6msg.Message{}, false
+		}
+	default:
+		if !bytes.Equal(opts.ServerID, sx.duid) {
+			// Meant for another server.
+			return dhcp6msg.Message{}, false
+		}
+	}
+	if len(duid) == 0 && msg.MsgType != dhcp6msg.MsgTypeInformationRequest {
+		l.With("decision", "drop").Warnf("%s: message without client id, dropping.", name)
+		return dhcp6msg.Message{}, false
+	}
+
+	rep := dhcp6msg.Message{MsgType: dhcp6msg.MsgTypeReply, Xid: msg.Xid}
+	if len(duid) > 0 {
+		rep.Options = append(rep.Options, dhcp6msg.OptionClientID(duid))
+	}
+	rep.Options = append(rep.Options, dhcp6msg.OptionServerID(sx.duid))
+
+	switch msg.MsgType {
+	case dhcp6msg.MsgTypeSolicit:
+		if sx.rapidCommit && opts.RapidCommit {
+			l.Printf("%s: %s asks for rapid commit.", name, duid)
+			rep.Options = append(rep.Options, dhcp6msg.OptionRapidCommit())
+			rep.Options = append(rep.Options, sx.assignIAs(l, name, now, duid, opts, now.Add(sx.valid))...)
+		} else {
+			rep.MsgType = dhcp6msg.MsgTypeAdvertise
+			if sx.preference > 0 {
+				rep.Options = append(rep.Options, dhcp6msg.OptionPreference(sx.preference))
+			}
+			rep.Options = append(rep.Options, sx.assignIAs(l, name, now, duid, opts, now.Add(advertiseReservation))...)
+		}
+	case dhcp6msg.MsgTypeRequest, dhcp6msg.MsgTypeRenew, dhcp6msg.MsgTypeRebind:
+		// Bindings lost in a restart are re-created if the addresses and prefixes of the client are still free.
+		rep.Options = append(rep.Options, sx.assignIAs(l, name, now, duid, opts, now.Add(sx.valid))...)
+	case dhcp6msg.MsgTypeRelease:
+		sx.releaseIAs(l, name, duid, opts)
+		rep.Options = append(rep.Options, dhcp6msg.OptionStatusCode(dhcp6msg.StatusSuccess, "released"))
+	case dhcp6msg.MsgTypeInformationRequest:
+		l.Printf("%s: sending configuration to %s.", name, duid)
+	default:
+		// Answering with a wrong NotOnLink would disconnect the client, not answering is always safe.
+		l.With("decision", "drop").Infof("%s: not supported, ignoring message of %s.", name, duid)
+		return dhcp6msg.Message{}, false
+	}
+
+	if len(sx.dns) > 0 && requested(opts, dhcp6msg.OptDNS) {
+		rep.Options = append(rep.Options, dhcp6msg.OptionDNS(sx.dns...))
+	}
+	if len(sx.domains) > 0 && requested(opts, dhcp6msg.OptDomainList) {
+		rep.Options = append(rep.Options, dhcp6msg.OptionDomainList(sx.domains...))
+	}
+	decision := "reply"
+	if rep.MsgType == dhcp6msg.MsgTypeAdvertise {
+		decision = "advertise"
+	}
+	l.With("decision", decision).Debugf("%s: sending %s to %s.", name, decision, duid)
+	return rep, true
+}
+
+// assignIAs binds addresses and prefixes to all IAs of the client until the given time and returns the
+// options describing them. Addresses and prefixes of the client which it can not keep have zero lifetimes.
+func (sx *server) assignIAs(l *logger.Logger, name string, now time.Time, duid d.Duid, opts dhcp6msg.DecodedOptions, until time.Time) []dhcp6msg.DHCP6Opt {
+	sc := sx.static[duid.String()]
+	var res []dhcp6msg.DHCP6Opt
+	for _, ia := range opts.IANA {
+		var hint *net.IPNet
+		if len(ia.Addrs) > 0 {
+			hint = &net.IPNet{IP: ia.Addrs[0].IP, Mask: net.CIDRMask(128, 128)}
+		}
+		rep := sx.newIA(ia.IAID)
+		n, err := sx.bindings.assign(kindAddr, sx.addrs, sc.ip, hint, duid, ia.IAID, now, until)
+		if err != nil {
+			l.Warnf("%s: no address for IA_NA %d of %s: %v", name, ia.IAID, duid, err)
+			rep.Status = &dhcp6msg.Status{Code: dhcp6msg.StatusNoAddrsAvail, Message: "no addresses available"}
+		} else {
+			l.Printf("%s: IA_NA %d of %s -> %s", name, ia.IAID, duid, n.IP)
+			rep.Addrs = append(rep.Addrs, dhcp6msg.IAAddr{IP: n.IP, Preferred: sx.preferred, Valid: sx.valid})
+		}
+		for _, a := range ia.Addrs {
+			if n == nil || !a.IP.Equal(n.IP) {
+				rep.Addrs = append(rep.Addrs, dhcp6msg.IAAddr{IP: a.IP})
+			}
+		}
+		res = append(res, dhcp6msg.OptionIANA(rep))
+	}
+	for _, ia := range opts.IAPD {
+		var hint *net.IPNet
+		if len(ia.Prefixes) > 0 {
+			hint = ia.Prefixes[0].Prefix
+		}
+		rep := sx.newIA(ia.IAID)
+		n, err := sx.bindings.assign(kindPrefix, sx.prefixes, sc.prefix, hint, duid, ia.IAID, now, until)
+		if err != nil {
+			l.Warnf("%s: no prefix for IA_PD %d of %s: %v", name, ia.IAID, duid, err)
+			rep.Status = &dhcp6msg.Status{Code: dhcp6msg.StatusNoPrefixAvail, Message: "no prefixes available"}
+		} else {
+			l.Printf("%s: IA_PD %d of %s -> %s", name, ia.IAID, duid, n)
+			rep.Prefixes = append(rep.Prefixes, dhcp6msg.IAPrefix{Prefix: n, Preferred: sx.preferred, Valid: sx.valid})
+		}
+		for _, p := range ia.Prefixes {
+			if n == nil || p.Prefix.String() != n.String() {
+				rep.Prefixes = append(rep.Prefixes, dhcp6msg.IAPrefix{Prefix: p.Prefix})
+			}
+		}
+		res = append(res, dhcp6msg.OptionIAPD(rep))
+	}
+	return res
+}
+
+// releaseIAs removes the bindings of all addresses and prefixes released by the client.
+func (sx *server) releaseIAs(l *logger.Logger, name string, duid d.Duid, opts dhcp6msg.DecodedOptions) {
+	for _, ia := range opts.IANA {
+		for _, a := range ia.Addrs {
+			if sx.bindings.release(kindAddr, duid, ia.IAID, &net.IPNet{IP: a.IP, Mask: net.CIDRMask(128, 128)}) {
+				l.Printf("%s: %s released %s", name, duid, a.IP)
+			}
+		}
+	}
+	for _, ia := range opts.IAPD {
+		for _, p := range ia.Prefixes {
+			if sx.bindings.release(kindPrefix, duid, ia.IAID, p.Prefix) {
+				l.Printf("%s: %s released %s", name, duid, p.Prefix)
+			}
+		}
+	}
+}
+
+// newIA returns an IA with the renew and rebind times recommended by RFC 8415.
+func (sx *server) newIA(iaid uint32) dhcp6msg.IA {
+	return dhcp6msg.IA{IAID: iaid, T1: sx.preferred / 2, T2: sx.preferred * 4 / 5}
+}
+
+// requested returns true if the client asked for the option.
+func requested(opts dhcp6msg.DecodedOptions, code uint16) bool {
+	for _, c := range opts.ORO {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package server6
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+)
+
+// maxPoolSize caps the number of entries of a pool, which is plenty for any network.
+const maxPoolSize = 1 << 62
+
+// pool is a range of addresses or a pool of prefixes of the same length.
+type pool struct {
+	base   *big.Int // First address or prefix.
+	step   *big.Int // Distance between two entries, 1 for addresses.
+	size   uint64   // Number of entries.
+	length int      // Prefix length of entries, 128 for addresses.
+}
+
+// newRange returns a pool with all addresses from begin to end, including both.
+func newRange(begin, end net.IP) (*pool, error) {
+	if begin.To16() == nil || begin.To4() != nil || end.To16() == nil || end.To4() != nil {
+		return nil, fmt.Errorf("range %s-%s is not IPv6", begin, end)
+	}
+	b, e := toInt(begin), toInt(end)
+	if b.Cmp(e) > 0 {
+		return nil, fmt.Errorf("range %s-%s ends before it begins", begin, end)
+	}
+	return &pool{base: b, step: big.NewInt(1), size: capSize(new(big.Int).Sub(e, b)), length: 128}, nil
+}
+
+// newPrefixPool returns a pool of all prefixes with the given length within n.
+func newPrefixPool(n *net.IPNet, length int) (*pool, error) {
+	ones, bits := n.Mask.Size()
+	if bits != 128 || n.IP.To4() != nil {
+		return nil, fmt.Errorf("prefix pool %s is not IPv6", n)
+	}
+	if length < ones || length > 128 {
+		return nil, fmt.Errorf("delegated length %d does not fit into prefix pool %s", length, n)
+	}
+	last := new(big.Int).Lsh(big.NewInt(1), uint(length-ones))
+	return &pool{
+		base:   toInt(n.IP.Mask(n.Mask)),
+		step:   new(big.Int).Lsh(big.NewInt(1), uint(128-length)),
+		size:   capSize(last.Sub(last, big.NewInt(1))),
+		length: length,
+	}, nil
+}
+
+// nth returns the i-th entry of the pool, i must be smaller than size.
+func (px *pool) nth(i uint64) *net.IPNet {
+	n := new(big.Int).Mul(px.step, new(big.Int).SetUint64(i))
+	return &net.IPNet{IP: toIP(n.Add(n, px.base)), Mask: net.CIDRMask(px.length, 128)}
+}
+
+// contains returns true if n is an entry of the pool.
+func (px *pool) contains(n *net.IPNet) bool {
+	if ones, _ := n.Mask.Size(); ones != px.length || n.IP.To4() != nil {
+		return false
+	}
+	off := new(big.Int).Sub(toInt(n.IP), px.base)
+	if off.Sign() < 0 {
+		return false
+	}
+	i, rem := new(big.Int).QuoRem(off, px.step, new(big.Int))
+	return rem.Sign() == 0 && i.IsUint64() && i.Uint64() < px.size
+}
+
+func (px *pool) String() string {
+	return fmt.Sprintf("%s-%s", px.nth(0), px.nth(px.size-1))
+}
+
+// capSize returns the number of entries of a pool from its last index.
+func capSize(last *big.Int) uint64 {
+	if !last.IsUint64() || last.Uint64() >= maxPoolSize {
+		return maxPoolSize
+	}
+	return last.Uint64() + 1
+}
+
+func toInt(ip net.IP) *big.Int {
+	return new(big.Int).SetBytes(ip.To16())
+}
+
+func toIP(n *big.Int) net.IP {
+	ip := make(net.IP, 16)
+	n.FillBytes(ip)
+	return ip
+}
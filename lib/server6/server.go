@@ -0,0 +1,215 @@
+package server6
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/dhcp6msg"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/logger"
+	d "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/ipdb/duid"
+	pb "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/proto"
+)
+
+type server struct {
+	ctx         context.Context
+	l           *logger.Logger
+	iface       *net.Interface
+	duid        d.Duid                  // Our server identifier, the DUID-LL of iface.
+	addrs       *pool                   // Addresses to assign, nil if disabled.
+	prefixes    *pool                   // Prefixes to delegate, nil if disabled.
+	preferred   time.Duration           // Preferred lifetime of addresses and prefixes.
+	valid       time.Duration           // Valid lifetime of addresses and prefixes.
+	dns         []net.IP                // DNS to announce.
+	domains     []string                // Domain search list to announce.
+	preference  uint8                   // Preference sent in advertisements.
+	rapidCommit bool                    // Whether to commit leases on solicit.
+	static      map[string]staticClient // Static clients by duid.
+	bindings    *bindings               // Bindings of all clients.
+}
+
+// staticClient is the fixed address and prefix of a client, either may be nil.
+type staticClient struct {
+	ip     *net.IPNet
+	prefix *net.IPNet
+}
+
+const (
+	// Default preferred lifetime.
+	defaultPreferred = time.Hour
+	// Default length of delegated prefixes.
+	defaultDelegatedLength = 64
+	// For how long advertised addresses and prefixes are reserved for a client.
+	advertiseReservation = 30 * time.Second
+	// How often expired bindings are removed.
+	expireInterval = time.Minute
+)
+
+// New constructs a new DHCPv6 server instance.
+func New(ctx context.Context, l *logger.Logger, iface *net.Interface, conf *pb.Server6Config) (*server, error) {
+	if len(iface.HardwareAddr) == 0 {
+		return nil, fmt.Errorf("interface '%s' has no hwaddr to derive a server duid from", iface.Name)
+	}
+	sx := &server{ctx: ctx, l: l, iface: iface, duid: d.Duid(dhcp6msg.DuidLL(iface.HardwareAddr)), rapidCommit: conf.GetRapidCommit()}
+
+	if ar := conf.GetAddressRange(); ar != "" {
+		r := strings.Split(ar, "-")
+		if len(r) != 2 {
+			return nil, fmt.Errorf("address_range '%s' is not in the format begin-end", ar)
+		}
+		pool, err := newRange(net.ParseIP(strings.TrimSpace(r[0])), net.ParseIP(strings.TrimSpace(r[1])))
+		if err != nil {
+			return nil, fmt.Errorf("address_range: %v", err)
+		}
+		sx.addrs = pool
+	}
+	if pp := conf.GetPrefixPool(); pp != "" {
+		_, ipnet, err := net.ParseCIDR(pp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse prefix_pool '%s': %v", pp, err)
+		}
+		length := int(conf.GetDelegatedLength())
+		if length == 0 {
+			length = defaultDelegatedLength
+		}
+		if sx.prefixes, err = newPrefixPool(ipnet, length); err != nil {
+			return nil, err
+		}
+	}
+	if conf.GetPreference() > 255 {
+		return nil, fmt.Errorf("preference %d exceeds 255", conf.GetPreference())
+	}
+	sx.preference = uint8(conf.GetPreference())
+
+	sx.preferred = defaultPreferred
+	if s := conf.GetPreferredLifetime(); s != "" {
+		pl, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse duration from string '%s': %v", s, err)
+		}
+		if pl < time.Minute {
+			return nil, fmt.Errorf("preferred lifetime must be at least one minute, found %s", pl)
+		}
+		sx.preferred = pl
+	}
+	sx.valid = 2 * sx.preferred
+	if s := conf.GetValidLifetime(); s != "" {
+		vl, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse duration from string '%s': %v", s, err)
+		}
+		if vl < sx.preferred {
+			return nil, fmt.Errorf("valid lifetime %s is shorter than preferred lifetime %s", vl, sx.preferred)
+		}
+		sx.valid = vl
+	}
+
+	for _, s := range conf.GetDns() {
+		ip := net.ParseIP(s)
+		if ip == nil || ip.To4() != nil {
+			return nil, fmt.Errorf("%s is not a valid ipv6", s)
+		}
+		sx.dns = append(sx.dns, ip)
+	}
+	sx.domains = conf.GetDomain()
+
+	reserved := make(map[string]bool)
+	sx.static = make(map[string]staticClient)
+	for k, cc := range conf.GetClient() {
+		duid, err := d.Parse(k)
+		if err != nil {
+			return nil, fmt.Errorf("client '%s' is not a duid: %v", k, err)
+		}
+		var sc staticClient
+		if s := cc.GetIp(); s != "" {
+			ip := net.ParseIP(s)
+			if ip == nil || ip.To4() != nil {
+				return nil, fmt.Errorf("client %s: %s is not a valid ipv6", duid, s)
+			}
+			sc.ip = &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+		}
+		if s := cc.GetPrefix(); s != "" {
+			_, ipnet, err := net.ParseCIDR(s)
+			if err != nil || ipnet.IP.To4() != nil {
+				return nil, fmt.Errorf("client %s: %s is not a valid ipv6 prefix", duid, s)
+			}
+			sc.prefix = ipnet
+		}
+		for _, n := range []*net.IPNet{sc.ip, sc.prefix} {
+			if n == nil {
+				continue
+			}
+			if reserved[n.String()] {
+				return nil, fmt.Errorf("client %s: %s is assigned to more than one client", duid, n)
+			}
+			reserved[n.String()] = true
+		}
+		sx.static[duid.String()] = sc
+	}
+	sx.bindings = newBindings(reserved)
+
+	if sx.addrs == nil && sx.prefixes == nil && len(sx.static) == 0 {
+		l.Printf("# neither address_range, prefix_pool nor clients configured: answering information requests only.")
+	}
+	return sx, nil
+}
+
+func (sx *server) Run() error {
+	sx.l.Printf("# psa-dhcpd6 is ready!")
+	sx.l.Printf("# Configuration: %s", sx)
+
+	conn, err := net.ListenMulticastUDP("udp6", sx.iface, &net.UDPAddr{IP: net.ParseIP(dhcp6msg.AllServers), Port: dhcp6msg.PortServer})
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", sx.iface.Name, err)
+	}
+
+	// Ensure that we close the socket if context is done.
+	ctx, cancel := context.WithCancel(sx.ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	go func() {
+		t := time.NewTicker(expireInterval)
+		defer t.Stop()
+		for {
+			select {
+			case now := <-t.C:
+				sx.bindings.expire(now)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	buf := make([]byte, 4096)
+	for {
+		nr, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if sx.ctx.Err() != nil {
+				// Regular shutdown.
+				return nil
+			}
+			return err
+		}
+		msg, err := dhcp6msg.Decode(buf[0:nr])
+		if err != nil {
+			continue
+		}
+		rep, ok := sx.handleMsg(time.Now(), *msg)
+		if !ok {
+			continue
+		}
+		dst := &net.UDPAddr{IP: src.IP, Port: dhcp6msg.PortClient, Zone: src.Zone}
+		if _, err := conn.WriteToUDP(rep.Assemble(), dst); err != nil {
+			sx.l.Errorf("failed to send reply to %s: %v", dst, err)
+		}
+	}
+}
+
+func (sx *server) String() string {
+	return fmt.Sprintf("server6(iface=%s, duid=%s, addrs=%v, prefixes=%v, static=%d)", sx.iface.Name, sx.duid, sx.addrs, sx.prefixes, len(sx.static))
+}
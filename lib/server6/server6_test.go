@@ -0,0 +1,220 @@
+package server6
+
+import (
+	"context"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/dhcp6msg"
+	"git.sr.ht/~adrian-blx/psa-dhcp/lib/logger"
+	pb "git.sr.ht/~adrian-blx/psa-dhcp/lib/server/proto"
+)
+
+func TestPool(t *testing.T) {
+	px, err := newRange(net.ParseIP("2001:db8::fffe"), net.ParseIP("2001:db8::1:1"))
+	if err != nil {
+		t.Fatalf("newRange = %v, wanted nil err", err)
+	}
+	if px.size != 4 || px.nth(2).String() != "2001:db8::1:0/128" {
+		t.Errorf("newRange = size %d, nth(2) %s; want 4, 2001:db8::1:0/128", px.size, px.nth(2))
+	}
+
+	_, n, _ := net.ParseCIDR("2001:db8:100::/48")
+	pp, err := newPrefixPool(n, 56)
+	if err != nil {
+		t.Fatalf("newPrefixPool = %v, wanted nil err", err)
+	}
+	if pp.size != 256 || pp.nth(255).String() != "2001:db8:100:ff00::/56" {
+		t.Errorf("newPrefixPool = size %d, nth(255) %s; want 256, 2001:db8:100:ff00::/56", pp.size, pp.nth(255))
+	}
+	for _, test := range []struct {
+		prefix string
+		want   bool
+	}{
+		{prefix: "2001:db8:100:1200::/56", want: true},
+		{prefix: "2001:db8:100:1280::/57"},
+		{prefix: "2001:db8:100:1280::/56"},
+		{prefix: "2001:db8:101::/56"},
+	} {
+		_, n, _ := net.ParseCIDR(test.prefix)
+		n.IP = net.ParseIP(test.prefix[:len(test.prefix)-3])
+		if got := pp.contains(n); got != test.want {
+			t.Errorf("contains(%s) = %v, want %v", test.prefix, got, test.want)
+		}
+	}
+
+	_, huge, _ := net.ParseCIDR("2001:db8::/32")
+	if hp, err := newPrefixPool(huge, 128); err != nil || hp.size != maxPoolSize {
+		t.Errorf("newPrefixPool(/32, 128) = %v, %v; want size %d", hp, err, uint64(maxPoolSize))
+	}
+	for _, bad := range []struct{ begin, end string }{
+		{begin: "2001:db8::2", end: "2001:db8::1"},
+		{begin: "10.0.0.1", end: "10.0.0.2"},
+	} {
+		if _, err := newRange(net.ParseIP(bad.begin), net.ParseIP(bad.end)); err == nil {
+			t.Errorf("newRange(%s, %s) wanted err, got nil err", bad.begin, bad.end)
+		}
+	}
+	if _, err := newPrefixPool(n, 40); err == nil {
+		t.Errorf("newPrefixPool(/48, 40) wanted err, got nil err")
+	}
+}
+
+func TestBindings(t *testing.T) {
+	px, _ := newRange(net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2"))
+	static := &net.IPNet{IP: net.ParseIP("2001:db8::100"), Mask: net.CIDRMask(128, 128)}
+	bx := newBindings(map[string]bool{static.String(): true})
+	now := time.Now()
+	until := now.Add(time.Hour)
+
+	a, err := bx.assign(kindAddr, px, nil, px.nth(1), []byte{1}, 1, now, until)
+	if err != nil || a.String() != px.nth(1).String() {
+		t.Errorf("assign(hint) = %v, %v; want %s", a, err, px.nth(1))
+	}
+	if again, _ := bx.assign(kindAddr, px, nil, nil, []byte{1}, 1, now, until); again.String() != a.String() {
+		t.Errorf("assign(again) = %v, want %s", again, a)
+	}
+	b, err := bx.assign(kindAddr, px, nil, px.nth(1), []byte{2}, 1, now, until)
+	if err != nil || b.String() != px.nth(0).String() {
+		t.Errorf("assign(taken hint) = %v, %v; want %s", b, err, px.nth(0))
+	}
+	if c, err := bx.assign(kindAddr, px, nil, nil, []byte{3}, 1, now, until); err == nil {
+		t.Errorf("assign(exhausted) = %v, wanted err", c)
+	}
+	if s, err := bx.assign(kindAddr, px, static, nil, []byte{4}, 1, now, until); err != nil || s.String() != static.String() {
+		t.Errorf("assign(static) = %v, %v; want %s", s, err, static)
+	}
+
+	if bx.release(kindAddr, []byte{1}, 1, b) {
+		t.Errorf("release of another client's address succeeded")
+	}
+	if !bx.release(kindAddr, []byte{1}, 1, a) {
+		t.Errorf("release(%s) failed", a)
+	}
+	if c, err := bx.assign(kindAddr, px, nil, nil, []byte{3}, 1, now, until); err != nil || c.String() != a.String() {
+		t.Errorf("assign(released) = %v, %v; want %s", c, err, a)
+	}
+	if n := bx.expire(until); n != 3 || len(bx.byNet) != 0 {
+		t.Errorf("expire = %d, left %v; want 3 and none", n, bx.byNet)
+	}
+}
+
+func TestHandleMsg(t *testing.T) {
+	l := logger.New(os.Stdout, "testing: ", logger.LevelDebug, false, false)
+	iface := &net.Interface{Name: "test0", HardwareAddr: net.HardwareAddr{2, 0, 0, 0, 0, 1}}
+	conf := &pb.Server6Config{
+		AddressRange:      "2001:db8::1000-2001:db8::1fff",
+		PrefixPool:        "2001:db8:100::/48",
+		DelegatedLength:   56,
+		PreferredLifetime: "10m",
+		Dns:               []string{"2001:db8::53"},
+		Preference:        10,
+		Client: map[string]*pb.Client6Config{
+			"00-03-00-01-02-00-00-00-00-09": {Ip: "2001:db8::9"},
+		},
+	}
+	sx, err := New(context.Background(), l, iface, conf)
+	if err != nil {
+		t.Fatalf("New = %v, wanted nil err", err)
+	}
+	client := dhcp6msg.DuidLL(net.HardwareAddr{2, 0, 0, 0, 0, 2})
+	now := time.Now()
+
+	solicit := dhcp6msg.Message{MsgType: dhcp6msg.MsgTypeSolicit, Xid: 1, Options: []dhcp6msg.DHCP6Opt{
+		dhcp6msg.OptionClientID(client),
+		dhcp6msg.OptionIANA(dhcp6msg.IA{IAID: 1}),
+		dhcp6msg.OptionIAPD(dhcp6msg.IA{IAID: 2}),
+		dhcp6msg.OptionORO(dhcp6msg.OptDNS),
+	}}
+	adv, ok := sx.handleMsg(now, solicit)
+	if !ok || adv.MsgType != dhcp6msg.MsgTypeAdvertise || adv.Xid != 1 {
+		t.Fatalf("handleMsg(solicit) = %+v, %v; want advertise", adv, ok)
+	}
+	aopts := dhcp6msg.DecodeOptions(adv.Options)
+	if len(aopts.IANA) != 1 || len(aopts.IANA[0].Addrs) != 1 || !sx.addrs.contains(&net.IPNet{IP: aopts.IANA[0].Addrs[0].IP, Mask: net.CIDRMask(128, 128)}) {
+		t.Fatalf("advertise had no address of the range: %+v", aopts.IANA)
+	}
+	if len(aopts.IAPD) != 1 || len(aopts.IAPD[0].Prefixes) != 1 || !sx.prefixes.contains(aopts.IAPD[0].Prefixes[0].Prefix) {
+		t.Fatalf("advertise had no prefix of the pool: %+v", aopts.IAPD)
+	}
+	if aopts.Preference != 10 || len(aopts.DNS) != 1 || string(aopts.ServerID) != string(sx.duid) {
+		t.Errorf("advertise = %+v, want preference 10, DNS and server id", aopts)
+	}
+
+	// The client requests what was advertised.
+	request := dhcp6msg.Message{MsgType: dhcp6msg.MsgTypeRequest, Xid: 2, Options: []dhcp6msg.DHCP6Opt{
+		dhcp6msg.OptionClientID(client),
+		dhcp6msg.OptionServerID(sx.duid),
+		dhcp6msg.OptionIANA(aopts.IANA[0]),
+		dhcp6msg.OptionIAPD(aopts.IAPD[0]),
+	}}
+	rep, ok := sx.handleMsg(now, request)
+	ropts := dhcp6msg.DecodeOptions(rep.Options)
+	if !ok || rep.MsgType != dhcp6msg.MsgTypeReply {
+		t.Fatalf("handleMsg(request) = %+v, %v; want reply", rep, ok)
+	}
+	if diff := cmp.Diff(aopts.IANA, ropts.IANA); diff != "" {
+		t.Errorf("reply had IA_NA diff: %s", diff)
+	}
+	if diff := cmp.Diff(aopts.IAPD, ropts.IAPD); diff != "" {
+		t.Errorf("reply had IA_PD diff: %s", diff)
+	}
+	if ropts.IANA[0].T1 != 5*time.Minute || ropts.IANA[0].Addrs[0].Valid != 20*time.Minute || ropts.DNS != nil {
+		t.Errorf("reply = %+v, want T1 5m, valid lifetime 20m and no DNS", ropts.IANA[0])
+	}
+
+	// Other servers and messages without client id are ignored.
+	request.Options[1] = dhcp6msg.OptionServerID([]byte{0, 3, 0, 1, 2, 0, 0, 0, 0, 5})
+	if _, ok := sx.handleMsg(now, request); ok {
+		t.Errorf("handleMsg(request of other server) = true, want false")
+	}
+	if _, ok := sx.handleMsg(now, dhcp6msg.Message{MsgType: dhcp6msg.MsgTypeSolicit}); ok {
+		t.Errorf("handleMsg(solicit without client id) = true, want false")
+	}
+
+	// Static clients get their address, unknown addresses get zero lifetimes.
+	renew := dhcp6msg.Message{MsgType: dhcp6msg.MsgTypeRenew, Xid: 3, Options: []dhcp6msg.DHCP6Opt{
+		dhcp6msg.OptionClientID(dhcp6msg.DuidLL(net.HardwareAddr{2, 0, 0, 0, 0, 9})),
+		dhcp6msg.OptionServerID(sx.duid),
+		dhcp6msg.OptionIANA(dhcp6msg.IA{IAID: 7, Addrs: []dhcp6msg.IAAddr{{IP: net.ParseIP("2001:db8::1234")}}}),
+	}}
+	rep, _ = sx.handleMsg(now, renew)
+	want := []dhcp6msg.IAAddr{
+		{IP: net.ParseIP("2001:db8::9"), Preferred: 10 * time.Minute, Valid: 20 * time.Minute},
+		{IP: net.ParseIP("2001:db8::1234")},
+	}
+	if diff := cmp.Diff(want, dhcp6msg.DecodeOptions(rep.Options).IANA[0].Addrs); diff != "" {
+		t.Errorf("renew of static client had a diff: %s", diff)
+	}
+
+	release := dhcp6msg.Message{MsgType: dhcp6msg.MsgTypeRelease, Xid: 4, Options: []dhcp6msg.DHCP6Opt{
+		dhcp6msg.OptionClientID(client),
+		dhcp6msg.OptionServerID(sx.duid),
+		dhcp6msg.OptionIANA(ropts.IANA[0]),
+		dhcp6msg.OptionIAPD(ropts.IAPD[0]),
+	}}
+	rep, ok = sx.handleMsg(now, release)
+	if st := dhcp6msg.DecodeOptions(rep.Options).Status; !ok || st == nil || st.Code != dhcp6msg.StatusSuccess {
+		t.Errorf("handleMsg(release) = %+v, %v; want success", rep, ok)
+	}
+	if len(sx.bindings.byKey) != 1 {
+		t.Errorf("release left bindings %v, want only the static one", sx.bindings.byKey)
+	}
+
+	for _, bad := range []*pb.Server6Config{
+		{AddressRange: "2001:db8::1"},
+		{PrefixPool: "2001:db8::/64", DelegatedLength: 56},
+		{PreferredLifetime: "1s"},
+		{ValidLifetime: "1m"},
+		{Dns: []string{"10.0.0.1"}},
+		{Client: map[string]*pb.Client6Config{"00-01": {Ip: "10.0.0.1"}}},
+		{Client: map[string]*pb.Client6Config{"00-01": {Ip: "2001:db8::1"}, "00-02": {Ip: "2001:db8::1"}}},
+	} {
+		if _, err := New(context.Background(), l, iface, bad); err == nil {
+			t.Errorf("New(%v) wanted err, got nil err", bad)
+		}
+	}
+}